@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/handlers"
+)
+
+// defaultArrivalsReportAt is when the next day's arrivals are emailed when ARRIVALS_REPORT_AT is unset
+const defaultArrivalsReportAt = 18 * time.Hour
+
+// arrivalsReportSettings returns the staff to email the next day's arrivals to, from a comma separated list,
+// and the time of day to email them at, written as 15:04
+func arrivalsReportSettings(to, at string) ([]string, time.Duration, error) {
+	var recipients []string
+	for _, email := range strings.Split(to, ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			recipients = append(recipients, email)
+		}
+	}
+
+	if at == "" {
+		return recipients, defaultArrivalsReportAt, nil
+	}
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return recipients, time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// nextArrivalsReport returns the first time after now that is at past midnight
+func nextArrivalsReport(now time.Time, at time.Duration) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	next := midnight.Add(at)
+	if !next.After(now) {
+		next = midnight.AddDate(0, 0, 1).Add(at)
+	}
+
+	return next
+}
+
+// scheduleArrivalsReport emails the staff the guests arriving the next day, every day at at past midnight
+func scheduleArrivalsReport(repo *handlers.Repository, at time.Duration) {
+	go func() {
+		for {
+			next := nextArrivalsReport(time.Now(), at)
+			time.Sleep(time.Until(next))
+
+			tomorrow := time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, time.UTC)
+			arrivals, err := repo.SendArrivalsReport(context.Background(), tomorrow)
+			if err != nil {
+				errorLog.Println(err)
+			} else {
+				infoLog.Printf("sent the report of %d arrival(s) on %s", arrivals, tomorrow.Format("2006-01-02"))
+			}
+		}
+	}()
+}
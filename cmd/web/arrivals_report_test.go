@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestArrivalsReportSettings(t *testing.T) {
+	tests := []struct {
+		name       string
+		to         string
+		at         string
+		recipients []string
+		expectedAt time.Duration
+		fails      bool
+	}{
+		{"unset", "", "", nil, defaultArrivalsReportAt, false},
+		{"recipients", " desk@example.com,, manager@example.com ", "", []string{"desk@example.com", "manager@example.com"}, defaultArrivalsReportAt, false},
+		{"time", "desk@example.com", "07:30", []string{"desk@example.com"}, 7*time.Hour + 30*time.Minute, false},
+		{"invalid-time", "desk@example.com", "7pm", nil, 0, true},
+	}
+
+	for _, e := range tests {
+		recipients, at, err := arrivalsReportSettings(e.to, e.at)
+		if (err != nil) != e.fails {
+			t.Errorf("%s: expected an error to be %t, got %v", e.name, e.fails, err)
+			continue
+		}
+		if fmt.Sprint(recipients) != fmt.Sprint(e.recipients) || at != e.expectedAt {
+			t.Errorf("%s: expected %v at %s, got %v at %s", e.name, e.recipients, e.expectedAt, recipients, at)
+		}
+	}
+}
+
+func TestNextArrivalsReport(t *testing.T) {
+	day := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected time.Time
+	}{
+		{"later-today", day.Add(9 * time.Hour), day.Add(18 * time.Hour)},
+		{"right-now", day.Add(18 * time.Hour), day.AddDate(0, 0, 1).Add(18 * time.Hour)},
+		{"tomorrow", day.Add(20 * time.Hour), day.AddDate(0, 0, 1).Add(18 * time.Hour)},
+	}
+
+	for _, e := range tests {
+		if next := nextArrivalsReport(e.now, 18*time.Hour); !next.Equal(e.expected) {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, next)
+		}
+	}
+}
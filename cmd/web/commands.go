@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+)
+
+// commands are the subcommands the binary runs instead of starting the web server
+var commands = map[string]func(args []string) error{
+	"migrate": migrateCommand,
+	"seed":    seedCommand,
+}
+
+// runCommand runs the named subcommand with the remaining command line arguments
+func runCommand(name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	return command(args)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/handlers"
+)
+
+// expireInterval is how often unpaid reservations, expired holds and waitlist offers are looked for
+const expireInterval = time.Minute
+
+// expireReservations releases the rooms of pending reservations that weren't paid in time, of holds guests
+// didn't turn into reservations in time and of waitlist offers that weren't booked in time, every interval
+func expireReservations(repo *handlers.Repository, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			expired, err := repo.DB.ExpirePendingReservations(context.Background(), time.Now())
+			if err != nil {
+				errorLog.Println(err)
+			} else if expired > 0 {
+				infoLog.Printf("expired %d unpaid reservation(s)", expired)
+			}
+
+			released, err := repo.DB.ExpireHolds(context.Background(), time.Now())
+			if err != nil {
+				errorLog.Println(err)
+			} else if released > 0 {
+				infoLog.Printf("released %d expired hold(s)", released)
+			}
+
+			offers, err := repo.ExpireWaitlistOffers(context.Background(), time.Now())
+			if err != nil {
+				errorLog.Println(err)
+			} else if offers > 0 {
+				infoLog.Printf("expired %d waitlist offer(s)", offers)
+			}
+		}
+	}()
+}
@@ -2,26 +2,35 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/crislainesc/bookings/internal/config"
+	"github.com/crislainesc/bookings/internal/currency"
 	"github.com/crislainesc/bookings/internal/driver"
 	"github.com/crislainesc/bookings/internal/handlers"
 	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
 	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/payments"
 	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+	"github.com/crislainesc/bookings/internal/storage"
 	"github.com/joho/godotenv"
 )
 
 const (
-	portNumber = ":8080"
+	portNumber        = ":8080"
+	defaultUploadsDir = "../../uploads"
 )
 
 var (
@@ -33,6 +42,14 @@ var (
 
 // main is the main function
 func main() {
+	if len(os.Args) > 1 {
+		err := runCommand(os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	db, err := run()
 
 	if err != nil {
@@ -44,6 +61,12 @@ func main() {
 
 	listenForMail()
 
+	expireReservations(handlers.Repo, expireInterval)
+
+	if len(app.ArrivalsReportTo) > 0 {
+		scheduleArrivalsReport(handlers.Repo, app.ArrivalsReportAt)
+	}
+
 	if err != nil {
 		log.Println(err)
 	}
@@ -98,17 +121,9 @@ func dir(envFile string) string {
 	return filepath.Join(currentDir, envFile)
 }
 
-func run() (*driver.Database, error) {
-	gob.Register(models.Reservation{})
-	gob.Register(models.User{})
-	gob.Register(models.Room{})
-	gob.Register(models.RoomRestriction{})
-	gob.Register(map[string]int{})
-
-	loadEnv(".env")
-
-	inProduction := os.Getenv("IN_PRODUCTION")
-	useCache := os.Getenv("USE_CACHE")
+// connectionString builds the database connection string from the environment.
+// It exits if the required settings are missing.
+func connectionString() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbName := os.Getenv("DB_NAME")
 	dbUser := os.Getenv("DB_USER")
@@ -121,6 +136,85 @@ func run() (*driver.Database, error) {
 		os.Exit(1)
 	}
 
+	return fmt.Sprintf(
+		"host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
+		dbHost,
+		dbPort,
+		dbName,
+		dbUser,
+		dbPassword,
+		dbSSL,
+	)
+}
+
+// uploadsDir returns the directory uploaded files are stored in
+func uploadsDir() string {
+	if dir := os.Getenv("UPLOADS_DIR"); dir != "" {
+		return dir
+	}
+	return defaultUploadsDir
+}
+
+// paymentGateway returns the gateway reservations are paid through, or nil when payments are disabled
+func paymentGateway(name, webhookSecret string) (payments.PaymentGateway, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "fake":
+		if webhookSecret == "" {
+			return nil, errors.New("PAYMENT_WEBHOOK_SECRET is required for the payment gateway")
+		}
+		return payments.NewFakeGateway(webhookSecret, app.BaseURL+fakeGatewayPath, app.BaseURL+paymentWebhookPath), nil
+	default:
+		return nil, fmt.Errorf("unknown payment gateway %q", name)
+	}
+}
+
+// property returns the business invoices are issued by, as set in the environment
+func property() (models.Property, error) {
+	p := models.Property{
+		Name:    os.Getenv("PROPERTY_NAME"),
+		Email:   os.Getenv("PROPERTY_EMAIL"),
+		Phone:   os.Getenv("PROPERTY_PHONE"),
+		TaxID:   os.Getenv("PROPERTY_TAX_ID"),
+		TaxName: os.Getenv("TAX_NAME"),
+	}
+
+	if p.Name == "" {
+		p.Name = i18n.T(i18n.Default, "site.name")
+	}
+
+	// one line of the address per line of the value, e.g. PROPERTY_ADDRESS="1 Main Street\nSpringfield"
+	if address := os.Getenv("PROPERTY_ADDRESS"); address != "" {
+		p.Address = strings.Split(address, "\n")
+	}
+
+	if rate := os.Getenv("TAX_RATE"); rate != "" {
+		percent, err := strconv.ParseFloat(rate, 64)
+		if err != nil || percent < 0 || percent >= 100 {
+			return p, fmt.Errorf("invalid TAX_RATE %q, expected a percentage such as 10 or 7.5", rate)
+		}
+		p.TaxRate = int(math.Round(percent * 100))
+	}
+
+	return p, nil
+}
+
+func run() (*driver.Database, error) {
+	gob.Register(models.Reservation{})
+	gob.Register(models.User{})
+	gob.Register(models.Room{})
+	gob.Register(models.RoomRestriction{})
+	gob.Register(map[string]int{})
+
+	loadEnv(".env")
+
+	inProduction := os.Getenv("IN_PRODUCTION")
+	useCache := os.Getenv("USE_CACHE")
+	dbQueryTimeout := os.Getenv("DB_QUERY_TIMEOUT")
+	dbSlowQuery := os.Getenv("DB_SLOW_QUERY")
+	autoMigrate, _ := strconv.ParseBool(os.Getenv("AUTO_MIGRATE"))
+
 	mailChan := make(chan models.MailData)
 	app.MailChan = mailChan
 
@@ -141,22 +235,58 @@ func run() (*driver.Database, error) {
 
 	app.Session = session
 
+	// per-query timeout, e.g. "3s"; the repository falls back to its default when unset
+	app.DBQueryTimeout, _ = time.ParseDuration(dbQueryTimeout)
+
+	if threshold, err := time.ParseDuration(dbSlowQuery); err == nil {
+		app.QueryHooks = append(app.QueryHooks, dbrepo.NewSlowQueryLogger(infoLog, threshold))
+	}
+
+	app.Blobs = storage.NewLocalStore(uploadsDir(), "/uploads")
+
+	app.BaseURL = strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if app.BaseURL == "" {
+		app.BaseURL = "http://localhost" + portNumber
+	}
+
+	gateway, err := paymentGateway(os.Getenv("PAYMENT_GATEWAY"), os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+	if err != nil {
+		return nil, err
+	}
+	app.Payments = gateway
+
+	app.Currency = currency.Default
+	if code := os.Getenv("CURRENCY"); code != "" {
+		c, ok := currency.Lookup(code)
+		if !ok {
+			return nil, fmt.Errorf("unknown currency %q", code)
+		}
+		app.Currency = c.Code
+	}
+
+	app.Property, err = property()
+	if err != nil {
+		return nil, err
+	}
+	app.AttachInvoices, _ = strconv.ParseBool(os.Getenv("ATTACH_INVOICES"))
+
+	app.ArrivalsReportTo, app.ArrivalsReportAt, err = arrivalsReportSettings(os.Getenv("ARRIVALS_REPORT_TO"), os.Getenv("ARRIVALS_REPORT_AT"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ARRIVALS_REPORT_AT: %w", err)
+	}
+
 	log.Println("Connecting to database...")
-	connectionString := fmt.Sprintf(
-		"host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
-		dbHost,
-		dbPort,
-		dbName,
-		dbUser,
-		dbPassword,
-		dbSSL,
-	)
-	db, err := driver.ConnectSQL(connectionString)
+	db, err := driver.ConnectSQL(connectionString())
 	if err != nil {
 		log.Fatal("Cannot connect to database! Dying...")
 	}
 	log.Println("Connected to database!")
 
+	err = checkSchema(db, autoMigrate)
+	if err != nil {
+		return nil, err
+	}
+
 	tcache, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal("cannot create template cache", err.Error())
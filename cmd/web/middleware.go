@@ -1,12 +1,44 @@
 package main
 
 import (
+	"mime"
 	"net/http"
 
+	"github.com/crislainesc/bookings/internal/currency"
 	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
 	"github.com/justinas/nosurf"
 )
 
+const (
+	// localeCookie remembers the language a guest picked
+	localeCookie = "lang"
+	// currencyCookie remembers the currency a guest picked to see prices in
+	currencyCookie = "currency"
+)
+
+const (
+	// maxFormSize is the largest body of a request that doesn't upload files
+	maxFormSize = 1 << 20
+	// maxMultipartSize is the largest body of a request uploading files, as large as the photos of a room
+	// the admin can upload at once
+	maxMultipartSize = 50 << 20
+)
+
+// LimitBody limits the size of request bodies before anything reads them, the CSRF check included, which
+// parses the whole form of a post. Handlers taking uploads can limit their own requests further.
+func LimitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := int64(maxFormSize)
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "multipart/form-data" {
+			limit = maxMultipartSize
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 
@@ -17,6 +49,10 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// the payment gateway signs its requests instead, and the fake one posts from its own pages
+	csrfHandler.ExemptPath(paymentWebhookPath)
+	csrfHandler.ExemptGlob(fakeGatewayPath + "/*")
+
 	return csrfHandler
 }
 
@@ -35,3 +71,63 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Localize picks the language of a request: the lang URL parameter, which is remembered in a cookie,
+// then that cookie, then the Accept-Language header
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := r.URL.Query().Get("lang")
+
+		if i18n.IsSupported(locale) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     localeCookie,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if cookie, err := r.Cookie(localeCookie); err == nil && i18n.IsSupported(cookie.Value) {
+			locale = cookie.Value
+		} else {
+			locale = i18n.Negotiate(r.Header.Get("Accept-Language"))
+		}
+
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
+// PickCurrency picks the currency prices are shown in: the currency parameter of the URL or of a posted search,
+// which is remembered in a cookie, then that cookie. Prices are shown in the currency of the property otherwise.
+// Uploads aren't parsed for it, so their handlers can limit them.
+func PickCurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := ""
+
+		picked := r.URL.Query().Get("currency")
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil &&
+			picked == "" && r.Method == http.MethodPost && mediaType == "application/x-www-form-urlencoded" {
+			picked = r.PostFormValue("currency")
+		}
+
+		if c, ok := currency.Lookup(picked); ok {
+			code = c.Code
+			http.SetCookie(w, &http.Cookie{
+				Name:     currencyCookie,
+				Value:    code,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		} else if cookie, err := r.Cookie(currencyCookie); err == nil {
+			if c, ok := currency.Lookup(cookie.Value); ok {
+				code = c.Code
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(currency.WithCode(r.Context(), code)))
+	})
+}
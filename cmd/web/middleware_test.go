@@ -1,8 +1,14 @@
 package main
 
 import (
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/i18n"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -28,3 +34,142 @@ func TestSessionLoad(t *testing.T) {
 		t.Errorf("type is not http.Handler but is %T", v)
 	}
 }
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		cookie         string
+		acceptLanguage string
+		expected       string
+		setsCookie     bool
+	}{
+		{"default", "/", "", "", "en", false},
+		{"accept-language", "/", "", "pt-BR,pt;q=0.9,en;q=0.8", "pt", false},
+		{"cookie-over-header", "/", "en", "pt-BR", "en", false},
+		{"url-over-cookie", "/?lang=pt", "en", "", "pt", true},
+		{"unsupported-url", "/?lang=fr", "pt", "", "pt", false},
+	}
+
+	for _, e := range tests {
+		var locale string
+		h := Localize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale = i18n.FromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", e.url, nil)
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: localeCookie, Value: e.cookie})
+		}
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if locale != e.expected {
+			t.Errorf("%s: expected locale %s, got %s", e.name, e.expected, locale)
+		}
+
+		setsCookie := len(rr.Result().Cookies()) > 0
+		if setsCookie != e.setsCookie {
+			t.Errorf("%s: expected setting the cookie to be %v", e.name, e.setsCookie)
+		}
+	}
+}
+
+func TestPickCurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		cookie     string
+		expected   string
+		setsCookie bool
+	}{
+		{"nothing-picked", "GET", "/", "", "", "", false},
+		{"cookie", "GET", "/", "", "eur", "EUR", false},
+		{"url-over-cookie", "GET", "/?currency=brl", "", "EUR", "BRL", true},
+		{"posted-search", "POST", "/search-availability", "currency=GBP", "", "GBP", true},
+		{"unknown-currency", "GET", "/?currency=XYZ", "", "EUR", "EUR", false},
+		{"unknown-cookie", "GET", "/", "", "XYZ", "", false},
+	}
+
+	for _, e := range tests {
+		var code string
+		h := PickCurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			code = currency.FromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		if e.method == "POST" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: currencyCookie, Value: e.cookie})
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if code != e.expected {
+			t.Errorf("%s: expected currency %q, got %q", e.name, e.expected, code)
+		}
+
+		setsCookie := len(rr.Result().Cookies()) > 0
+		if setsCookie != e.setsCookie {
+			t.Errorf("%s: expected setting the cookie to be %v", e.name, e.setsCookie)
+		}
+	}
+}
+
+// TestPickCurrencyLeavesUploads tests that the body of an upload is left for its handler to limit and parse
+func TestPickCurrencyLeavesUploads(t *testing.T) {
+	body := "--x\r\nContent-Disposition: form-data; name=\"currency\"\r\n\r\nGBP\r\n--x--\r\n"
+
+	var code string
+	var parsed bool
+	h := PickCurrency(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code = currency.FromContext(r.Context())
+		parsed = r.MultipartForm != nil
+	}))
+
+	req := httptest.NewRequest("POST", "/admin/rooms/1/photos", strings.NewReader(body))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if parsed || code != "" {
+		t.Errorf("expected the upload not to be parsed, got currency %q", code)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		size        int
+		expectError bool
+	}{
+		{"form", "application/x-www-form-urlencoded", maxFormSize, false},
+		{"form-too-large", "application/x-www-form-urlencoded", maxFormSize + 1, true},
+		{"upload", "multipart/form-data; boundary=x", maxFormSize + 1, false},
+		{"upload-too-large", "multipart/form-data; boundary=x", maxMultipartSize + 1, true},
+	}
+
+	for _, e := range tests {
+		var err error
+		h := LimitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err = io.Copy(io.Discard, r.Body)
+		}))
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", e.size)))
+		req.Header.Set("Content-Type", e.contentType)
+
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if (err != nil) != e.expectError {
+			t.Errorf("%s: expected an error reading the body to be %v, got %v", e.name, e.expectError, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/crislainesc/bookings/internal/driver"
+	"github.com/crislainesc/bookings/internal/migrate"
+	"github.com/crislainesc/bookings/migrations"
+)
+
+const migrateUsage = "usage: web migrate up | down [steps] | status"
+
+// migrateCommand applies, rolls back or lists the embedded migrations
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	loadEnv(".env")
+
+	db, err := driver.ConnectSQL(connectionString())
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	migrator, err := migrate.New(db.SQL, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("Applied %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			log.Println("Schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("Rolled back %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%d_%s\t%s\n", s.Migration.Version, s.Migration.Name, state)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// checkSchema makes sure the database schema is current on boot, applying pending
+// migrations when autoMigrate is set and warning about them otherwise
+func checkSchema(db *driver.Database, autoMigrate bool) error {
+	migrator, err := migrate.New(db.SQL, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if autoMigrate {
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("Applied %d_%s", m.Version, m.Name)
+		}
+		return err
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		log.Printf("Database schema is %d migration(s) behind; run \"web migrate up\" or set AUTO_MIGRATE=true", len(pending))
+	}
+
+	return nil
+}
@@ -4,10 +4,18 @@ import (
 	"net/http"
 
 	"github.com/crislainesc/bookings/internal/handlers"
+	"github.com/crislainesc/bookings/internal/payments"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+const (
+	// paymentWebhookPath is where the payment gateway reports the outcome of checkouts
+	paymentWebhookPath = "/payments/webhook"
+	// fakeGatewayPath is where the checkout pages of the fake payment gateway are served
+	fakeGatewayPath = "/fake-gateway"
+)
+
 func routes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -15,18 +23,28 @@ func routes() http.Handler {
 	mux.Use(middleware.RealIP)
 	mux.Use(middleware.Logger)
 	mux.Use(middleware.Recoverer)
+	mux.Use(LimitBody)
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(Localize)
+	mux.Use(PickCurrency)
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
 
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
+	mux.Get("/rooms", handlers.Repo.Rooms)
+	mux.Get("/rooms/{slug}", handlers.Repo.RoomDetail)
+	mux.Get("/rooms/{slug}/calendar", handlers.Repo.RoomCalendarJSON)
+	mux.Get("/generals-quarters", handlers.Repo.LegacyRoom)
+	mux.Get("/majors-suite", handlers.Repo.LegacyRoom)
 
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Post("/search-availability-flexible", handlers.Repo.PostFlexibleAvailability)
+	mux.Get("/waitlist", handlers.Repo.Waitlist)
+	mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", handlers.Repo.WaitlistOffer)
 	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 
@@ -35,6 +53,14 @@ func routes() http.Handler {
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+	mux.Get("/reservations/cancel/{token}", handlers.Repo.CancelReservation)
+	mux.Post("/reservations/cancel/{token}", handlers.Repo.PostCancelReservation)
+	mux.Get("/reservations/invoice/{token}", handlers.Repo.ReservationInvoice)
+	mux.Post(paymentWebhookPath, handlers.Repo.PaymentWebhook)
+
+	if fake, ok := app.Payments.(*payments.FakeGateway); ok {
+		mux.Handle(fakeGatewayPath+"/*", http.StripPrefix(fakeGatewayPath, fake))
+	}
 
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostLogin)
@@ -43,20 +69,67 @@ func routes() http.Handler {
 	fileServer := http.FileServer(http.Dir("../../static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
+	uploadsServer := http.FileServer(http.Dir(uploadsDir()))
+	mux.Handle("/uploads/*", http.StripPrefix("/uploads", uploadsServer))
+
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Use(Auth)
 
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservation)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
+		mux.Get("/reservations-new-json", handlers.Repo.AdminNewReservationsJSON)
+		mux.Get("/reservations-all-json", handlers.Repo.AdminAllReservationsJSON)
+		mux.Get("/reservations-new-export", handlers.Repo.AdminExportNewReservations)
+		mux.Get("/reservations-all-export", handlers.Repo.AdminExportAllReservations)
+		mux.Get("/reservations-import", handlers.Repo.AdminImportReservations)
+		mux.Post("/reservations-import", handlers.Repo.AdminPostImportReservations)
+		mux.Get("/reports/arrivals", handlers.Repo.AdminArrivalsReport)
+		mux.Get("/reports/departures", handlers.Repo.AdminDeparturesReport)
+		mux.Get("/reports/occupancy", handlers.Repo.AdminOccupancyReport)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
 		mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+		mux.Get("/reservations/{src}/{id}/invoice", handlers.Repo.AdminReservationInvoice)
 		mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
 		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
 		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
 		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.Get("/cancel-reservation/{src}/{id}/do", handlers.Repo.AdminCancelReservation)
+
+		mux.Get("/rooms", handlers.Repo.AdminRooms)
+		mux.Get("/rooms/new", handlers.Repo.AdminNewRoom)
+		mux.Post("/rooms/new", handlers.Repo.AdminPostRoom)
+		mux.Get("/rooms/{id}", handlers.Repo.AdminShowRoom)
+		mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+		mux.Get("/rooms/{id}/delete", handlers.Repo.AdminDeleteRoom)
+		mux.Post("/rooms/{id}/photos", handlers.Repo.AdminPostRoomPhotos)
+		mux.Get("/booking-rules", handlers.Repo.AdminBookingRules)
+		mux.Get("/booking-rules/new", handlers.Repo.AdminNewBookingRule)
+		mux.Post("/booking-rules/new", handlers.Repo.AdminPostBookingRule)
+		mux.Get("/booking-rules/{id}", handlers.Repo.AdminShowBookingRule)
+		mux.Post("/booking-rules/{id}", handlers.Repo.AdminPostBookingRule)
+		mux.Get("/booking-rules/{id}/delete", handlers.Repo.AdminDeleteBookingRule)
+		mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+		mux.Get("/cancellation-policies/new", handlers.Repo.AdminNewCancellationPolicy)
+		mux.Post("/cancellation-policies/new", handlers.Repo.AdminPostCancellationPolicy)
+		mux.Get("/cancellation-policies/{id}", handlers.Repo.AdminShowCancellationPolicy)
+		mux.Post("/cancellation-policies/{id}", handlers.Repo.AdminPostCancellationPolicy)
+		mux.Get("/cancellation-policies/{id}/delete", handlers.Repo.AdminDeleteCancellationPolicy)
+		mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+		mux.Get("/promo-codes/new", handlers.Repo.AdminNewPromoCode)
+		mux.Post("/promo-codes/new", handlers.Repo.AdminPostPromoCode)
+		mux.Get("/promo-codes/{id}", handlers.Repo.AdminShowPromoCode)
+		mux.Post("/promo-codes/{id}", handlers.Repo.AdminPostPromoCode)
+		mux.Get("/promo-codes/{id}/delete", handlers.Repo.AdminDeletePromoCode)
+		mux.Get("/guests", handlers.Repo.AdminGuests)
+		mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", handlers.Repo.AdminPostGuest)
+		mux.Post("/guests/{id}/merge", handlers.Repo.AdminMergeGuest)
+		mux.Get("/exchange-rates", handlers.Repo.AdminExchangeRates)
+		mux.Post("/exchange-rates", handlers.Repo.AdminPostExchangeRate)
+		mux.Get("/exchange-rates/{id}/delete", handlers.Repo.AdminDeleteExchangeRate)
 	})
 
 	return mux
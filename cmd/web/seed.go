@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/driver"
+	"github.com/crislainesc/bookings/internal/seed"
+)
+
+// seedCommand inserts the reference data and admin user, and optionally demo reservations
+func seedCommand(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	demo := flags.Bool("demo", false, "generate demo reservations")
+	from := flags.String("from", time.Now().Format("2006-01-02"), "first arrival date for demo reservations")
+	to := flags.String("to", time.Now().AddDate(0, 3, 0).Format("2006-01-02"), "last departure date for demo reservations")
+	count := flags.Int("count", 40, "number of demo reservations to generate")
+	randSeed := flags.Int64("rand-seed", time.Now().UnixNano(), "random seed, for reproducible demo data")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	loadEnv(".env")
+
+	db, err := driver.ConnectSQL(connectionString())
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx := context.Background()
+
+	err = seed.ReferenceData(ctx, db.SQL)
+	if err != nil {
+		return err
+	}
+	log.Println("Reference data seeded")
+
+	admin := seed.Admin{
+		FirstName: os.Getenv("ADMIN_FIRST_NAME"),
+		LastName:  os.Getenv("ADMIN_LAST_NAME"),
+		Email:     os.Getenv("ADMIN_EMAIL"),
+		Password:  os.Getenv("ADMIN_PASSWORD"),
+	}
+
+	if admin.Email == "" {
+		log.Println("ADMIN_EMAIL not set, skipping admin user")
+	} else {
+		created, err := seed.AdminUser(ctx, db.SQL, admin)
+		if err != nil {
+			return err
+		}
+		if created {
+			log.Printf("Admin user %s created", admin.Email)
+		} else {
+			log.Printf("Admin user %s already exists", admin.Email)
+		}
+	}
+
+	if !*demo {
+		return nil
+	}
+
+	start, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		return fmt.Errorf("invalid -from date: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		return fmt.Errorf("invalid -to date: %w", err)
+	}
+
+	created, err := seed.DemoReservations(ctx, db.SQL, seed.DemoOptions{
+		From:  start,
+		To:    end,
+		Count: *count,
+		Rand:  rand.New(rand.NewSource(*randSeed)),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%d demo reservations created", created)
+
+	return nil
+}
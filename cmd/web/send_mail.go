@@ -48,6 +48,10 @@ func sendMsg(m models.MailData) {
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
 
+	for _, attachment := range m.Attachments {
+		email.Attach(&mail.File{Name: attachment.Name, MimeType: attachment.ContentType, Data: attachment.Data})
+	}
+
 	err = email.Send(client)
 	if err != nil {
 		errorLog.Println(err)
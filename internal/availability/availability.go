@@ -0,0 +1,133 @@
+package availability
+
+import (
+	"sort"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// dateLayout is the layout nights are keyed by
+const dateLayout = "2006-01-02"
+
+// Calendar knows which nights of a room are taken by reservations and owner blocks
+type Calendar struct {
+	taken map[string]bool
+}
+
+// Window is a stay a room is free for
+type Window struct {
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// Nights returns the length of the stay
+func (w Window) Nights() int {
+	return dates.Between(w.StartDate, w.EndDate)
+}
+
+// NewCalendar builds the calendar of a room from its restrictions. A reservation takes the nights
+// from its start date up to, but not including, its end date; an owner block takes the night of its start date.
+func NewCalendar(restrictions []models.RoomRestriction) Calendar {
+	c := Calendar{taken: make(map[string]bool)}
+
+	for _, r := range restrictions {
+		end := r.EndDate
+		if !end.After(r.StartDate) {
+			end = r.StartDate.AddDate(0, 0, 1)
+		}
+
+		for d := dates.Day(r.StartDate); d.Before(end); d = d.AddDate(0, 0, 1) {
+			c.taken[d.Format(dateLayout)] = true
+		}
+	}
+
+	return c
+}
+
+// Taken reports whether the night starting on the given day is booked or blocked
+func (c Calendar) Taken(night time.Time) bool {
+	return c.taken[dates.Day(night).Format(dateLayout)]
+}
+
+// Free reports whether every night from start up to end is free
+func (c Calendar) Free(start, end time.Time) bool {
+	for d := dates.Day(start); d.Before(dates.Day(end)); d = d.AddDate(0, 0, 1) {
+		if c.Taken(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// Around returns up to limit free stays as long as start to end, moved by at most flex days either way
+// and never starting before earliest, nearest to the requested dates first
+func (c Calendar) Around(start, end time.Time, flex int, earliest time.Time, limit int) []Window {
+	length := dates.Between(start, end)
+	if length < 1 {
+		return nil
+	}
+
+	var windows []Window
+	for shift := -flex; shift <= flex; shift++ {
+		s := dates.Day(start).AddDate(0, 0, shift)
+		if s.Before(dates.Day(earliest)) {
+			continue
+		}
+
+		e := s.AddDate(0, 0, length)
+		if c.Free(s, e) {
+			windows = append(windows, Window{StartDate: s, EndDate: e})
+		}
+	}
+
+	sort.SliceStable(windows, func(i, j int) bool {
+		return abs(dates.Between(start, windows[i].StartDate)) < abs(dates.Between(start, windows[j].StartDate))
+	})
+
+	if len(windows) > limit {
+		windows = windows[:limit]
+	}
+
+	return windows
+}
+
+// Within returns up to limit free stays of the given number of nights that start and end between from and to,
+// earliest first. Windows don't overlap, so each one offers different nights.
+func (c Calendar) Within(from, to time.Time, length int, limit int) []Window {
+	if length < 1 {
+		return nil
+	}
+
+	var windows []Window
+	for s := dates.Day(from); len(windows) < limit; {
+		e := s.AddDate(0, 0, length)
+		if e.After(dates.Day(to)) {
+			break
+		}
+
+		if c.Free(s, e) {
+			windows = append(windows, Window{StartDate: s, EndDate: e})
+			s = e
+			continue
+		}
+
+		s = s.AddDate(0, 0, 1)
+	}
+
+	return windows
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// RoomWindows is a room with the stays it is free for
+type RoomWindows struct {
+	Room    models.Room
+	Windows []Window
+}
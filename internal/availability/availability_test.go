@@ -0,0 +1,84 @@
+package availability
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse(dateLayout, s)
+	return t
+}
+
+// testCalendar has a reservation for the nights of the 10th to the 12th and an owner block on the 20th
+var testCalendar = NewCalendar([]models.RoomRestriction{
+	{StartDate: date("2040-03-10"), EndDate: date("2040-03-13"), ReservationID: 1},
+	{StartDate: date("2040-03-20"), EndDate: date("2040-03-20")},
+})
+
+func TestCalendarTaken(t *testing.T) {
+	tests := map[string]bool{
+		"2040-03-09": false,
+		"2040-03-10": true,
+		"2040-03-12": true,
+		"2040-03-13": false,
+		"2040-03-20": true,
+		"2040-03-21": false,
+	}
+
+	for night, expected := range tests {
+		if got := testCalendar.Taken(date(night)); got != expected {
+			t.Errorf("Taken(%s) = %t, wanted %t", night, got, expected)
+		}
+	}
+}
+
+func TestCalendarFree(t *testing.T) {
+	if !testCalendar.Free(date("2040-03-07"), date("2040-03-10")) {
+		t.Error("a stay leaving on the day another arrives should be free")
+	}
+	if testCalendar.Free(date("2040-03-08"), date("2040-03-11")) {
+		t.Error("a stay overlapping a reservation should not be free")
+	}
+}
+
+func TestCalendarAround(t *testing.T) {
+	windows := testCalendar.Around(date("2040-03-10"), date("2040-03-12"), 3, date("2040-01-01"), 3)
+
+	expected := []string{"2040-03-08", "2040-03-07", "2040-03-13"}
+	if len(windows) != len(expected) {
+		t.Fatalf("expected %d windows, got %v", len(expected), windows)
+	}
+	for i, w := range windows {
+		if w.StartDate.Format(dateLayout) != expected[i] || w.Nights() != 2 {
+			t.Errorf("window %d: expected 2 nights from %s, got %d from %s", i, expected[i], w.Nights(), w.StartDate.Format(dateLayout))
+		}
+	}
+
+	windows = testCalendar.Around(date("2040-03-10"), date("2040-03-12"), 3, date("2040-03-09"), 3)
+	for _, w := range windows {
+		if w.StartDate.Before(date("2040-03-09")) {
+			t.Errorf("window starting %s is before the earliest date", w.StartDate.Format(dateLayout))
+		}
+	}
+}
+
+func TestCalendarWithin(t *testing.T) {
+	windows := testCalendar.Within(date("2040-03-01"), date("2040-04-01"), 3, 10)
+
+	expected := []string{"2040-03-01", "2040-03-04", "2040-03-07", "2040-03-13", "2040-03-16", "2040-03-21", "2040-03-24", "2040-03-27"}
+	if len(windows) != len(expected) {
+		t.Fatalf("expected %d windows, got %d", len(expected), len(windows))
+	}
+	for i, w := range windows {
+		if w.StartDate.Format(dateLayout) != expected[i] {
+			t.Errorf("window %d: expected start %s, got %s", i, expected[i], w.StartDate.Format(dateLayout))
+		}
+	}
+
+	if windows := testCalendar.Within(date("2040-03-01"), date("2040-04-01"), 3, 2); len(windows) != 2 {
+		t.Errorf("expected the limit to apply, got %d windows", len(windows))
+	}
+}
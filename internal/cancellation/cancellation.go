@@ -0,0 +1,82 @@
+// Package cancellation works out what cancelling a reservation costs under the cancellation policy of its room.
+package cancellation
+
+import (
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// Quote is what cancelling a reservation costs, in the minor units of the currency of the property
+type Quote struct {
+	// Penalty is the part of the total the property keeps
+	Penalty int
+	// Refund is the part of what was paid that goes back to the guest
+	Refund int
+}
+
+// Free reports whether the reservation can be cancelled without a penalty
+func (q Quote) Free() bool {
+	return q.Penalty == 0
+}
+
+// Compute returns what cancelling at now a reservation arriving at arrival costs, for a stay with a total
+// price of which paid was already paid. From the day of arrival the stay has begun, and the whole total is
+// kept whatever the policy.
+func Compute(policy models.CancellationPolicy, total, paid int, arrival, now time.Time) Quote {
+	var q Quote
+
+	switch {
+	case policy.NonRefundable, !Open(arrival, now):
+		q.Penalty = total
+	case policy.PenaltyPercent <= 0:
+	case dates.Between(now, arrival) >= policy.FreeDays:
+	case policy.PenaltyPercent >= 100:
+		q.Penalty = total
+	default:
+		// rounded down, in favour of the guest
+		q.Penalty = total * policy.PenaltyPercent / 100
+	}
+
+	if policy.NonRefundable {
+		// nothing paid for a non-refundable rate goes back, even above the total
+		return q
+	}
+
+	if paid > q.Penalty {
+		q.Refund = paid - q.Penalty
+	}
+
+	return q
+}
+
+// Open reports whether a guest can still cancel a reservation arriving at arrival, which they can until the
+// day before arrival
+func Open(arrival, now time.Time) bool {
+	return dates.Day(now).Before(dates.Day(arrival))
+}
+
+// Deadline returns the last day a reservation arriving at arrival can be cancelled for free,
+// and false when it can never be, or always is
+func Deadline(policy models.CancellationPolicy, arrival time.Time) (time.Time, bool) {
+	if policy.NonRefundable || policy.PenaltyPercent <= 0 {
+		return time.Time{}, false
+	}
+	return dates.Day(arrival).AddDate(0, 0, -policy.FreeDays), true
+}
+
+// Terms returns the policy written out for guests
+func Terms(policy models.CancellationPolicy) i18n.Message {
+	switch {
+	case policy.NonRefundable:
+		return i18n.Message{Key: "cancellation.non_refundable"}
+	case policy.PenaltyPercent <= 0:
+		return i18n.Message{Key: "cancellation.free"}
+	case policy.FreeDays == 0:
+		return i18n.Message{Key: "cancellation.free_until_arrival", Args: []interface{}{policy.PenaltyPercent}}
+	default:
+		return i18n.Message{Key: "cancellation.free_until", Args: []interface{}{policy.FreeDays, policy.PenaltyPercent}}
+	}
+}
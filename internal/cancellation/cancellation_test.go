@@ -0,0 +1,98 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func TestCompute(t *testing.T) {
+	arrival := time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)
+	flexible := models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}
+
+	tests := []struct {
+		name            string
+		policy          models.CancellationPolicy
+		paid            int
+		now             time.Time
+		expectedPenalty int
+		expectedRefund  int
+	}{
+		{"no-policy", models.CancellationPolicy{}, 10000, arrival.AddDate(0, 0, -1).Add(23 * time.Hour), 0, 10000},
+		{"no-policy-on-arrival", models.CancellationPolicy{}, 10000, arrival, 10000, 0},
+		{"no-policy-after-checkout", models.CancellationPolicy{}, 10000, arrival.AddDate(0, 0, 5), 10000, 0},
+		{"on-arrival-before-paying", flexible, 0, arrival.Add(12 * time.Hour), 10000, 0},
+		{"before-deadline", flexible, 10000, arrival.AddDate(0, 0, -8), 0, 10000},
+		{"on-deadline", flexible, 10000, arrival.AddDate(0, 0, -7).Add(23 * time.Hour), 0, 10000},
+		{"after-deadline", flexible, 10000, arrival.AddDate(0, 0, -6), 5000, 5000},
+		{"deposit-below-penalty", flexible, 3000, arrival.AddDate(0, 0, -1), 5000, 0},
+		{"nothing-paid", flexible, 0, arrival.AddDate(0, 0, -1), 5000, 0},
+		{"full-penalty", models.CancellationPolicy{FreeDays: 3, PenaltyPercent: 100}, 10000, arrival, 10000, 0},
+		{"non-refundable", models.CancellationPolicy{NonRefundable: true, FreeDays: 30}, 10000, arrival.AddDate(-1, 0, 0), 10000, 0},
+	}
+
+	for _, e := range tests {
+		q := Compute(e.policy, 10000, e.paid, arrival, e.now)
+		if q.Penalty != e.expectedPenalty || q.Refund != e.expectedRefund {
+			t.Errorf("%s: expected a penalty of %d and a refund of %d, got %d and %d",
+				e.name, e.expectedPenalty, e.expectedRefund, q.Penalty, q.Refund)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	arrival := time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected bool
+	}{
+		{"day-before", arrival.Add(-time.Minute), true},
+		{"on-arrival", arrival, false},
+		{"during-the-stay", arrival.AddDate(0, 0, 2), false},
+	}
+
+	for _, e := range tests {
+		if got := Open(arrival, e.now); got != e.expected {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	arrival := time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	deadline, ok := Deadline(models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}, arrival)
+	if !ok || !deadline.Equal(time.Date(2040, 3, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a deadline on 2040-03-13, got %v %v", deadline, ok)
+	}
+
+	if _, ok := Deadline(models.CancellationPolicy{}, arrival); ok {
+		t.Error("expected no deadline when cancelling is always free")
+	}
+
+	if _, ok := Deadline(models.CancellationPolicy{NonRefundable: true}, arrival); ok {
+		t.Error("expected no deadline for a non-refundable rate")
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      models.CancellationPolicy
+		expectedKey string
+	}{
+		{"free", models.CancellationPolicy{}, "cancellation.free"},
+		{"free-until", models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 50}, "cancellation.free_until"},
+		{"free-until-arrival", models.CancellationPolicy{PenaltyPercent: 50}, "cancellation.free_until_arrival"},
+		{"non-refundable", models.CancellationPolicy{NonRefundable: true, PenaltyPercent: 50}, "cancellation.non_refundable"},
+	}
+
+	for _, e := range tests {
+		if key := Terms(e.policy).Key; key != e.expectedKey {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expectedKey, key)
+		}
+	}
+}
@@ -3,17 +3,38 @@ package config
 import (
 	"html/template"
 	"log"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/payments"
+	"github.com/crislainesc/bookings/internal/repository"
+	"github.com/crislainesc/bookings/internal/storage"
 )
 
 type AppConfig struct {
-	UseCache      bool
-	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	UseCache       bool
+	TemplateCache  map[string]*template.Template
+	InfoLog        *log.Logger
+	ErrorLog       *log.Logger
+	InProduction   bool
+	Session        *scs.SessionManager
+	MailChan       chan models.MailData
+	DBQueryTimeout time.Duration
+	QueryHooks     []repository.QueryHook
+	Blobs          storage.BlobStore
+	// Currency is the code of the currency the property charges and stores prices in
+	Currency string
+	// BaseURL is the address the site is reached at, for links leaving it such as payment return pages
+	BaseURL string
+	// Payments takes payments for reservations; reservations are confirmed without payment when it is nil
+	Payments payments.PaymentGateway
+	// Property is who invoices are issued by
+	Property models.Property
+	// AttachInvoices attaches the invoice to the email confirming a reservation
+	AttachInvoices bool
+	// ArrivalsReportTo are the staff emailed the list of the next day's arrivals every day at ArrivalsReportAt,
+	// the time since midnight
+	ArrivalsReportTo []string
+	ArrivalsReportAt time.Duration
 }
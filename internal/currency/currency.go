@@ -0,0 +1,156 @@
+package currency
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/crislainesc/bookings/internal/i18n"
+)
+
+// Default is the currency of the property when none is configured
+const Default = "USD"
+
+// Currency is a currency prices can be charged or shown in. Amounts are kept in its minor units,
+// e.g. cents, and Decimals is the number of minor units digits.
+type Currency struct {
+	Code     string
+	Symbol   string
+	Decimals int
+}
+
+var currencies = map[string]Currency{
+	"AUD": {Code: "AUD", Symbol: "A$", Decimals: 2},
+	"BRL": {Code: "BRL", Symbol: "R$", Decimals: 2},
+	"CAD": {Code: "CAD", Symbol: "C$", Decimals: 2},
+	"CHF": {Code: "CHF", Symbol: "CHF", Decimals: 2},
+	"EUR": {Code: "EUR", Symbol: "€", Decimals: 2},
+	"GBP": {Code: "GBP", Symbol: "£", Decimals: 2},
+	"JPY": {Code: "JPY", Symbol: "¥", Decimals: 0},
+	"USD": {Code: "USD", Symbol: "$", Decimals: 2},
+}
+
+// Lookup returns the currency with an ISO 4217 code, in any case
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	return c, ok
+}
+
+// Get returns the currency with the code, or the default currency when the code is unknown
+func Get(code string) Currency {
+	if c, ok := Lookup(code); ok {
+		return c
+	}
+	return currencies[Default]
+}
+
+// Codes returns the codes of every known currency in alphabetical order
+func Codes() []string {
+	codes := make([]string, 0, len(currencies))
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Convert converts an amount in the minor units of from to the minor units of to, at rate units of to
+// for each unit of from
+func Convert(amount int, from, to Currency, rate float64) int {
+	major := float64(amount) / math.Pow10(from.Decimals)
+	return int(math.Round(major * rate * math.Pow10(to.Decimals)))
+}
+
+// FormatAmount writes an amount in the minor units of c without a symbol or thousands separators,
+// e.g. 12050 cents as 120.50, the way the admin forms read it back
+func FormatAmount(amount int, c Currency) string {
+	return number(amount, c.Decimals, ".", "")
+}
+
+// Format writes an amount in the minor units of c the way it is written in locale,
+// e.g. 123450 USD cents as $1,234.50 in English and $ 1.234,50 in Portuguese
+func Format(amount int, c Currency, locale string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := number(amount, c.Decimals, i18n.T(locale, "number.decimal"), i18n.T(locale, "number.group"))
+	return sign + i18n.T(locale, "money.format", c.Symbol, digits)
+}
+
+// number writes a non-negative amount of minor units with the decimal and thousands separators
+func number(amount, decimals int, decimal, group string) string {
+	unit := int(math.Pow10(decimals))
+	whole := strconv.Itoa(amount / unit)
+
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(digit)
+	}
+
+	if decimals > 0 {
+		fraction := strconv.Itoa(amount%unit + unit)
+		b.WriteString(decimal)
+		b.WriteString(fraction[1:])
+	}
+
+	return b.String()
+}
+
+// Display shows amounts kept in the currency of the property in the currency a guest picked.
+// The zero Display shows amounts in the default currency.
+type Display struct {
+	// Base is the currency prices are charged and stored in
+	Base Currency
+	// Currency is the currency amounts are shown in, converted at Rate units for each unit of Base
+	Currency Currency
+	Rate     float64
+	Locale   string
+	// Options are the codes of the currencies a guest can pick from
+	Options []string
+}
+
+// Converted reports whether amounts are shown in a currency other than the one they are charged in
+func (d Display) Converted() bool {
+	return d.Currency.Code != "" && d.Currency.Code != d.Base.Code && d.Rate > 0
+}
+
+// Convert converts an amount in the minor units of the base currency to the shown currency
+func (d Display) Convert(amount int) int {
+	if !d.Converted() {
+		return amount
+	}
+	return Convert(amount, d.Base, d.Currency, d.Rate)
+}
+
+// Format writes an amount in the minor units of the base currency in the shown currency and locale
+func (d Display) Format(amount int) string {
+	c := d.Base
+	if d.Converted() {
+		c = d.Currency
+	}
+	if c.Code == "" {
+		c = currencies[Default]
+	}
+	return Format(d.Convert(amount), c, d.Locale)
+}
+
+type contextKey struct{}
+
+// WithCode returns a copy of ctx carrying the code of the currency a guest picked
+func WithCode(ctx context.Context, code string) context.Context {
+	return context.WithValue(ctx, contextKey{}, code)
+}
+
+// FromContext returns the code of the currency a guest picked, or an empty string when they haven't
+func FromContext(ctx context.Context) string {
+	code, _ := ctx.Value(contextKey{}).(string)
+	return code
+}
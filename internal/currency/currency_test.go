@@ -0,0 +1,104 @@
+package currency
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount   int
+		code     string
+		locale   string
+		expected string
+	}{
+		{0, "USD", "en", "$0.00"},
+		{5, "USD", "en", "$0.05"},
+		{123456, "USD", "en", "$1,234.56"},
+		{-12050, "USD", "en", "-$120.50"},
+		{123456789, "EUR", "en", "€1,234,567.89"},
+		{123456, "BRL", "pt", "R$ 1.234,56"},
+		{100, "USD", "pt", "$ 1,00"},
+		{1234, "JPY", "en", "¥1,234"},
+		{12050, "GBP", "fr", "£120.50"},
+	}
+
+	for _, e := range tests {
+		if got := Format(e.amount, Get(e.code), e.locale); got != e.expected {
+			t.Errorf("Format(%d, %s, %s): expected %s, got %s", e.amount, e.code, e.locale, e.expected, got)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	if got := FormatAmount(123456, Get("USD")); got != "1234.56" {
+		t.Errorf("expected 1234.56, got %s", got)
+	}
+	if got := FormatAmount(1234, Get("JPY")); got != "1234" {
+		t.Errorf("expected 1234, got %s", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   int
+		from, to string
+		rate     float64
+		expected int
+	}{
+		{12000, "USD", "EUR", 0.9, 10800},
+		{12050, "USD", "BRL", 5.1234, 61737},
+		{12000, "USD", "JPY", 150.5, 18060},
+		{18060, "JPY", "USD", 1 / 150.5, 12000},
+	}
+
+	for _, e := range tests {
+		if got := Convert(e.amount, Get(e.from), Get(e.to), e.rate); got != e.expected {
+			t.Errorf("Convert(%d %s to %s): expected %d, got %d", e.amount, e.from, e.to, e.expected, got)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if c, ok := Lookup(" eur "); !ok || c.Code != "EUR" {
+		t.Errorf("expected to find EUR, got %v %v", c, ok)
+	}
+	if _, ok := Lookup("XYZ"); ok {
+		t.Error("expected an unknown currency not to be found")
+	}
+	if c := Get("XYZ"); c.Code != Default {
+		t.Errorf("expected the default currency for an unknown code, got %s", c.Code)
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	var zero Display
+	if got := zero.Format(12050); got != "$120.50" {
+		t.Errorf("expected the zero display to show dollars, got %s", got)
+	}
+
+	d := Display{Base: Get("USD"), Currency: Get("BRL"), Rate: 5, Locale: "pt"}
+	if !d.Converted() {
+		t.Error("expected the display to convert")
+	}
+	if got := d.Format(12050); got != "R$ 602,50" {
+		t.Errorf("expected R$ 602,50, got %s", got)
+	}
+
+	d.Currency = d.Base
+	if d.Converted() {
+		t.Error("expected the display not to convert to the currency prices are charged in")
+	}
+	if got := d.Format(12050); got != "$ 120,50" {
+		t.Errorf("expected $ 120,50, got %s", got)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if code := FromContext(context.Background()); code != "" {
+		t.Errorf("expected no currency, got %s", code)
+	}
+	if code := FromContext(WithCode(context.Background(), "EUR")); code != "EUR" {
+		t.Errorf("expected EUR, got %s", code)
+	}
+}
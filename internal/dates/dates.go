@@ -0,0 +1,15 @@
+// Package dates works with the calendar dates of stays, which are stored as midnight UTC.
+package dates
+
+import "time"
+
+// Day truncates t to midnight UTC, the way dates are stored
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Between returns the number of days from the date of start to the date of end, negative when end is earlier
+func Between(start, end time.Time) int {
+	return int(Day(end).Sub(Day(start)).Hours() / 24)
+}
@@ -0,0 +1,47 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDay(t *testing.T) {
+	saoPaulo := time.FixedZone("BRT", -3*60*60)
+
+	tests := []struct {
+		name     string
+		t        time.Time
+		expected time.Time
+	}{
+		{"midnight", time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC), time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"late-in-the-day", time.Date(2040, 3, 20, 23, 59, 59, 0, time.UTC), time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"other-zone", time.Date(2040, 3, 20, 22, 0, 0, 0, saoPaulo), time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, e := range tests {
+		if got := Day(e.t); !got.Equal(e.expected) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	start := time.Date(2040, 3, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		end      time.Time
+		expected int
+	}{
+		{"same-day", start.Add(23 * time.Hour), 0},
+		{"next-day", start.AddDate(0, 0, 1), 1},
+		{"across-months", time.Date(2040, 4, 2, 12, 0, 0, 0, time.UTC), 13},
+		{"earlier", start.AddDate(0, 0, -3), -3},
+	}
+
+	for _, e := range tests {
+		if got := Between(start, e.end); got != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
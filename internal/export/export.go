@@ -0,0 +1,301 @@
+// Package export writes reservations, and the tables of the reports, to CSV or XLSX files for the
+// accountant, a row at a time, so exports of any size are streamed rather than built in memory.
+//
+// CSV files are written the way spreadsheets in the language of the export open them: dates in its date
+// format and amounts with its decimal separator, with fields separated by semicolons where the decimal
+// separator is a comma. XLSX files hold typed dates and numbers the spreadsheet formats itself.
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/xlsx"
+)
+
+// Format is a file format reservations and reports can be exported to
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// ParseFormat returns the format with a name, in any case
+func ParseFormat(name string) (Format, bool) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case CSV, XLSX:
+		return f, true
+	}
+	return "", false
+}
+
+// ContentType returns the media type of files in the format
+func (f Format) ContentType() string {
+	if f == XLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// kinds of the values of the columns
+const (
+	kindText = iota
+	kindNumber
+	kindDecimal
+	kindDate
+	kindAmount
+)
+
+// Value is the value of a cell, written the way its kind is written in the format of the file
+type Value struct {
+	kind    int
+	text    string
+	number  int
+	decimal float64
+	date    time.Time
+}
+
+// Text returns a text value
+func Text(s string) Value { return Value{kind: kindText, text: s} }
+
+// Number returns a whole number value
+func Number(n int) Value { return Value{kind: kindNumber, number: n} }
+
+// Decimal returns a number value written with one decimal place, such as a percentage
+func Decimal(f float64) Value { return Value{kind: kindDecimal, decimal: math.Round(f*10) / 10} }
+
+// Date returns a date value, written empty when it is the zero time
+func Date(t time.Time) Value { return Value{kind: kindDate, date: t} }
+
+// Amount returns an amount of money in the minor units of the currency of the export
+func Amount(minor int) Value { return Value{kind: kindAmount, number: minor} }
+
+// yesNo returns the text of a flag
+func yesNo(b bool) Value {
+	if b {
+		return Text("yes")
+	}
+	return Text("no")
+}
+
+// Column is a column reservations can be exported with
+type Column struct {
+	Key    string
+	Header string
+	// Default columns are exported when none are picked
+	Default bool
+	value   func(models.Reservation) Value
+}
+
+// Columns are the columns reservations can be exported with, in the order they are written
+var Columns = []Column{
+	{"id", "ID", true, func(r models.Reservation) Value { return Number(r.ID) }},
+	{"first_name", "First name", true, func(r models.Reservation) Value { return Text(r.FirstName) }},
+	{"last_name", "Last name", true, func(r models.Reservation) Value { return Text(r.LastName) }},
+	{"email", "Email", true, func(r models.Reservation) Value { return Text(r.Email) }},
+	{"phone", "Phone", false, func(r models.Reservation) Value { return Text(r.Phone) }},
+	{"room", "Room", true, func(r models.Reservation) Value { return Text(r.Room.RoomName) }},
+	{"arrival", "Arrival", true, func(r models.Reservation) Value { return Date(r.StartDate) }},
+	{"departure", "Departure", true, func(r models.Reservation) Value { return Date(r.EndDate) }},
+	{"nights", "Nights", true, func(r models.Reservation) Value { return Number(r.Nights()) }},
+	{"adults", "Adults", false, func(r models.Reservation) Value { return Number(r.Adults) }},
+	{"children", "Children", false, func(r models.Reservation) Value { return Number(r.Children) }},
+	{"status", "Status", true, func(r models.Reservation) Value { return Text(r.Status) }},
+	{"promo_code", "Promo code", false, func(r models.Reservation) Value { return Text(r.PromoCode) }},
+	{"discount", "Discount", false, func(r models.Reservation) Value { return Amount(r.Discount) }},
+	{"total", "Total", true, func(r models.Reservation) Value { return Amount(r.Total) }},
+	{"paid", "Paid", false, func(r models.Reservation) Value { return Amount(r.Paid) }},
+	{"balance", "Balance due", false, func(r models.Reservation) Value { return Amount(r.Balance()) }},
+	{"special_requests", "Special requests", false, func(r models.Reservation) Value { return Text(r.SpecialRequests) }},
+	{"processed", "Processed", false, func(r models.Reservation) Value { return yesNo(r.Processed != 0) }},
+	{"booked", "Booked", false, func(r models.Reservation) Value { return Date(r.CreatedAt) }},
+}
+
+// ErrUnknownColumn is returned for a column key that isn't one of Columns
+var ErrUnknownColumn = errors.New("export: unknown column")
+
+// ColumnsFor returns the columns with the keys, in the order of Columns, or the default columns when no
+// key is given
+func ColumnsFor(keys []string) ([]Column, error) {
+	picked := make(map[string]bool)
+	for _, key := range keys {
+		picked[key] = true
+	}
+
+	var columns []Column
+	for _, c := range Columns {
+		if picked[c.Key] || len(keys) == 0 && c.Default {
+			columns = append(columns, c)
+		}
+		delete(picked, c.Key)
+	}
+	if len(picked) > 0 {
+		return nil, ErrUnknownColumn
+	}
+
+	return columns, nil
+}
+
+// Options are the settings of an export
+type Options struct {
+	Format  Format
+	Columns []Column
+	// Currency is the currency of the amounts
+	Currency currency.Currency
+	// Locale is the language CSV dates and amounts are written in
+	Locale string
+	// Sheet is the name of the XLSX worksheet, Reservations when it is empty
+	Sheet string
+}
+
+// Writer writes reservations, or the rows of a table, to an export file
+type Writer struct {
+	opts Options
+	csv  *csv.Writer
+	xlsx *xlsx.Writer
+
+	dateLayout string
+	decimal    string
+}
+
+// NewWriter starts an export of reservations with the columns of the options on w, writing the header row
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	headers := make([]string, len(opts.Columns))
+	for i, c := range opts.Columns {
+		headers[i] = c.Header
+	}
+
+	return NewTableWriter(w, opts, headers)
+}
+
+// NewTableWriter starts an export of a table with the headers on w, writing the header row. Its rows are
+// written with WriteRow; the columns of the options aren't used.
+func NewTableWriter(w io.Writer, opts Options, headers []string) (*Writer, error) {
+	ew := &Writer{opts: opts}
+
+	if opts.Format == XLSX {
+		sheet := opts.Sheet
+		if sheet == "" {
+			sheet = "Reservations"
+		}
+
+		var err error
+		ew.xlsx, err = xlsx.NewWriter(w, sheet)
+		if err != nil {
+			return nil, err
+		}
+
+		cells := make([]xlsx.Cell, len(headers))
+		for i, h := range headers {
+			cells[i] = xlsx.Bold(h)
+		}
+		return ew, ew.xlsx.WriteRow(cells...)
+	}
+
+	ew.dateLayout = i18n.T(opts.Locale, "date.format")
+	ew.decimal = i18n.T(opts.Locale, "number.decimal")
+
+	// the byte order mark tells spreadsheets the file is UTF-8, so accented names aren't garbled
+	_, err := io.WriteString(w, "\ufeff")
+	if err != nil {
+		return nil, err
+	}
+
+	ew.csv = csv.NewWriter(w)
+	ew.csv.UseCRLF = true
+	if ew.decimal == "," {
+		ew.csv.Comma = ';'
+	}
+
+	return ew, ew.csv.Write(headers)
+}
+
+// Write writes the row of a reservation
+func (w *Writer) Write(r models.Reservation) error {
+	values := make([]Value, len(w.opts.Columns))
+	for i, c := range w.opts.Columns {
+		values[i] = c.value(r)
+	}
+	return w.WriteRow(values...)
+}
+
+// WriteRow writes a row of values
+func (w *Writer) WriteRow(values ...Value) error {
+	if w.xlsx != nil {
+		cells := make([]xlsx.Cell, len(values))
+		for i, v := range values {
+			cells[i] = w.cell(v)
+		}
+		return w.xlsx.WriteRow(cells...)
+	}
+
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = w.field(v)
+	}
+	return w.csv.Write(record)
+}
+
+// Close writes what is left of the export. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.xlsx != nil {
+		return w.xlsx.Close()
+	}
+
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// cell returns the spreadsheet cell of a value
+func (w *Writer) cell(v Value) xlsx.Cell {
+	switch v.kind {
+	case kindNumber:
+		return xlsx.Number(float64(v.number))
+	case kindDecimal:
+		return xlsx.Number(v.decimal)
+	case kindDate:
+		if v.date.IsZero() {
+			return xlsx.Text("")
+		}
+		return xlsx.Date(v.date)
+	case kindAmount:
+		return xlsx.Amount(v.number, w.opts.Currency.Decimals)
+	}
+	return xlsx.Text(v.text)
+}
+
+// field returns the CSV field of a value
+func (w *Writer) field(v Value) string {
+	switch v.kind {
+	case kindNumber:
+		return strconv.Itoa(v.number)
+	case kindDecimal:
+		return strings.Replace(strconv.FormatFloat(v.decimal, 'f', 1, 64), ".", w.decimal, 1)
+	case kindDate:
+		if v.date.IsZero() {
+			return ""
+		}
+		return i18n.FormatDate(v.date, w.dateLayout, w.opts.Locale)
+	case kindAmount:
+		return strings.Replace(currency.FormatAmount(v.number, w.opts.Currency), ".", w.decimal, 1)
+	}
+	return escapeFormula(v.text)
+}
+
+// escapeFormula keeps text a guest typed, such as their name, from being run as a formula when the CSV
+// file is opened in a spreadsheet, by starting it with a quote when it starts like a formula
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,170 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func testReservation() models.Reservation {
+	return models.Reservation{
+		ID:        3,
+		FirstName: "=HYPERLINK(\"x\")",
+		LastName:  "Smith, Jr.",
+		Email:     "john@smith.com",
+		Phone:     "+1 555",
+		StartDate: time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2040, 1, 13, 0, 0, 0, 0, time.UTC),
+		Room:      models.Room{RoomName: "General's Quarters"},
+		Status:    models.ReservationConfirmed,
+		Total:     123450,
+	}
+}
+
+func TestColumnsFor(t *testing.T) {
+	columns, err := ColumnsFor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range columns {
+		if !c.Default {
+			t.Errorf("expected only default columns without picked ones, got %s", c.Key)
+		}
+	}
+
+	columns, err = ColumnsFor([]string{"total", "id", "total"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 2 || columns[0].Key != "id" || columns[1].Key != "total" {
+		t.Errorf("expected the id and total columns in order, got %+v", columns)
+	}
+
+	_, err = ColumnsFor([]string{"id", "password"})
+	if err != ErrUnknownColumn {
+		t.Errorf("expected ErrUnknownColumn, got %v", err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{"csv": CSV, " XLSX": XLSX} {
+		if f, ok := ParseFormat(name); !ok || f != expected {
+			t.Errorf("expected %q to be %s, got %s", name, expected, f)
+		}
+	}
+	if _, ok := ParseFormat("pdf"); ok {
+		t.Error("expected pdf not to be a format")
+	}
+}
+
+// csvTests is the data for the CSV export tests
+var csvTests = []struct {
+	name     string
+	locale   string
+	currency string
+	expected string
+}{
+	{"english", "en", "USD", "ID,First name,Last name,Phone,Arrival,Total\r\n" +
+		"3,\"'=HYPERLINK(\"\"x\"\")\",\"Smith, Jr.\",'+1 555,2040-01-10,1234.50\r\n"},
+	{"portuguese", "pt", "BRL", "ID;First name;Last name;Phone;Arrival;Total\r\n" +
+		"3;\"'=HYPERLINK(\"\"x\"\")\";Smith, Jr.;'+1 555;10/01/2040;1234,50\r\n"},
+	{"no-decimals", "en", "JPY", "ID,First name,Last name,Phone,Arrival,Total\r\n" +
+		"3,\"'=HYPERLINK(\"\"x\"\")\",\"Smith, Jr.\",'+1 555,2040-01-10,123450\r\n"},
+}
+
+func TestCSV(t *testing.T) {
+	columns, _ := ColumnsFor([]string{"id", "first_name", "last_name", "phone", "arrival", "total"})
+
+	for _, e := range csvTests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, Options{Format: CSV, Columns: columns, Currency: currency.Get(e.currency), Locale: e.locale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Write(testReservation())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.String()
+		if !strings.HasPrefix(out, "\ufeff") {
+			t.Errorf("%s: expected the file to start with a byte order mark", e.name)
+		}
+		if got := strings.TrimPrefix(out, "\ufeff"); got != e.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	columns, _ := ColumnsFor([]string{"first_name", "arrival", "nights", "total"})
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Options{Format: XLSX, Columns: columns, Currency: currency.Get("USD"), Locale: "pt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(testReservation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, f := range z.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			content, _ := io.ReadAll(r)
+			sheet = string(content)
+		}
+	}
+
+	// text isn't escaped as a formula since spreadsheets never run the text of a cell
+	for _, want := range []string{
+		`<t xml:space="preserve">First name</t>`,
+		`<t xml:space="preserve">=HYPERLINK(&#34;x&#34;)</t>`,
+		`<c s="2"><v>51145</v></c><c><v>3</v></c><c s="4"><v>1234.5</v></c></row>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("expected the sheet to contain %s, got %s", want, sheet)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewTableWriter(&buf, Options{Format: CSV, Currency: currency.Get("BRL"), Locale: "pt"}, []string{"Month", "Occupancy %", "Revenue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.WriteRow(Text("2040-01"), Decimal(66.666), Amount(123450))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\ufeffMonth;Occupancy %;Revenue\r\n2040-01;66,7;1234,50\r\n"
+	if buf.String() != expected {
+		t.Errorf("expected\n%q\ngot\n%q", expected, buf.String())
+	}
+}
@@ -1,17 +1,25 @@
 package forms
 
-type errors map[string][]string
+import "github.com/crislainesc/bookings/internal/i18n"
 
-// Add adds an error message for a given form field
-func (e errors) Add(field, message string) {
-	e[field] = append(e[field], message)
+type errors map[string][]i18n.Message
+
+// Add adds an error message for a given form field. The message is a catalog key, or text that is
+// shown as it is in every language, formatted with args.
+func (e errors) Add(field, message string, args ...interface{}) {
+	e[field] = append(e[field], i18n.Message{Key: message, Args: args})
 }
 
 // Get returns first error message for a field
 func (e errors) Get(field string) string {
+	return e.In(field, i18n.Default)
+}
+
+// In returns first error message for a field, translated to locale
+func (e errors) In(field, locale string) string {
 	es := e[field]
 	if len(es) == 0 {
 		return ""
 	}
-	return es[0]
+	return es[0].In(locale)
 }
@@ -1,17 +1,27 @@
 package forms
 
 import (
-	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/crislainesc/bookings/internal/i18n"
 )
 
-// Form creates a custom form struct and embeds a url.Values object
+// DateLayout is the layout of the dates posted in forms
+const DateLayout = "2006-01-02"
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9 .()-]+$`)
+
+// Form creates a custom form struct and embeds a url.Values object.
+// Locale is the language Error translates messages to.
 type Form struct {
 	url.Values
 	Errors errors
+	Locale string
 }
 
 // Valid returns true if there are no errors, otherwise false
@@ -22,17 +32,23 @@ func (f *Form) Valid() bool {
 // New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]i18n.Message{}),
+		Locale: i18n.Default,
 	}
 }
 
+// Error returns first error message for a field in the language of the form
+func (f *Form) Error(field string) string {
+	return f.Errors.In(field, f.Locale)
+}
+
 // Required checks for required fields
 func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field cannot be blank")
+			f.Errors.Add(field, "forms.required")
 		}
 	}
 }
@@ -47,7 +63,7 @@ func (f *Form) Has(field string) bool {
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+		f.Errors.Add(field, "forms.min_length", length)
 		return false
 	}
 	return true
@@ -56,6 +72,122 @@ func (f *Form) MinLength(field string, length int) bool {
 // IsEmails checks if form field is a valid email address
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "This field must be a valid email address")
+		f.Errors.Add(field, "forms.email")
+	}
+}
+
+// MaxLength checks for maximum length
+func (f *Form) MaxLength(field string, length int) bool {
+	x := f.Get(field)
+	if len(x) > length {
+		f.Errors.Add(field, "forms.max_length", length)
+		return false
+	}
+	return true
+}
+
+// Matches checks that a form field matches pattern, adding message, a catalog key or plain text,
+// as the error when it doesn't
+func (f *Form) Matches(field string, pattern *regexp.Regexp, message string) bool {
+	if !pattern.MatchString(f.Get(field)) {
+		f.Errors.Add(field, message)
+		return false
+	}
+	return true
+}
+
+// IsPhone checks that a form field is a phone number of 7 to 15 digits, optionally starting with +
+// and grouped with spaces, dots, dashes or parentheses
+func (f *Form) IsPhone(field string) bool {
+	x := strings.TrimSpace(f.Get(field))
+	digits := 0
+	if phonePattern.MatchString(x) {
+		for _, c := range x {
+			if c >= '0' && c <= '9' {
+				digits++
+			}
+		}
+	}
+	if digits < 7 || digits > 15 {
+		f.Errors.Add(field, "forms.phone")
+		return false
+	}
+	return true
+}
+
+// IsInt checks that a form field is a whole number
+func (f *Form) IsInt(field string) bool {
+	_, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		f.Errors.Add(field, "forms.int")
+		return false
+	}
+	return true
+}
+
+// InRange checks that a form field is a whole number from min to max
+func (f *Form) InRange(field string, min, max int) bool {
+	if !f.IsInt(field) {
+		return false
+	}
+	if n := f.Int(field); n < min || n > max {
+		f.Errors.Add(field, "forms.range", min, max)
+		return false
+	}
+	return true
+}
+
+// IsDate checks that a form field is a date in DateLayout
+func (f *Form) IsDate(field string) bool {
+	_, err := time.Parse(DateLayout, strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		f.Errors.Add(field, "forms.date")
+		return false
+	}
+	return true
+}
+
+// NotInPast checks that a form field is a date no earlier than today
+func (f *Form) NotInPast(field string) bool {
+	if !f.IsDate(field) {
+		return false
+	}
+	y, m, d := time.Now().Date()
+	if f.Date(field).Before(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)) {
+		f.Errors.Add(field, "forms.past")
+		return false
 	}
+	return true
+}
+
+// DateRange checks that two form fields are dates, the end after the start and at most maxDays
+// after it. A maxDays of 0 doesn't limit the span. Range errors are added to the end field.
+func (f *Form) DateRange(startField, endField string, maxDays int) bool {
+	startOK, endOK := f.IsDate(startField), f.IsDate(endField)
+	if !startOK || !endOK {
+		return false
+	}
+
+	start, end := f.Date(startField), f.Date(endField)
+	if !end.After(start) {
+		f.Errors.Add(endField, "forms.date_order")
+		return false
+	}
+	if maxDays > 0 && end.Sub(start) > time.Duration(maxDays)*24*time.Hour {
+		f.Errors.Add(endField, "forms.date_span", maxDays)
+		return false
+	}
+	return true
+}
+
+// Int returns a form field as a whole number, or 0 when it isn't one
+func (f *Form) Int(field string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	return n
+}
+
+// Date returns a form field as a date, or the zero time when it isn't one
+func (f *Form) Date(field string) time.Time {
+	t, _ := time.Parse(DateLayout, strings.TrimSpace(f.Get(field)))
+	return t
 }
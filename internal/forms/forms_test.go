@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
 	"testing"
+	"time"
 )
 
 func TestForm_Valid(t *testing.T) {
@@ -127,3 +129,155 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_MaxLength(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("name", "abcdef")
+	form := New(postedValues)
+
+	form.MaxLength("name", 3)
+	if form.Valid() {
+		t.Error("shows max length of 3 met when data is longer")
+	}
+
+	form = New(postedValues)
+	form.MaxLength("name", 6)
+	if !form.Valid() {
+		t.Error("shows max length of 6 not met when it is")
+	}
+}
+
+func TestForm_Matches(t *testing.T) {
+	pattern := regexp.MustCompile(`^[a-z]+$`)
+
+	postedValues := url.Values{}
+	postedValues.Add("slug", "abc")
+	postedValues.Add("other", "ABC")
+	form := New(postedValues)
+
+	if !form.Matches("slug", pattern, "lowercase only") {
+		t.Error("got no match when the value matches")
+	}
+
+	if form.Matches("other", pattern, "lowercase only") {
+		t.Error("got a match when the value does not match")
+	}
+
+	if form.Errors.Get("other") != "lowercase only" {
+		t.Errorf("expected the given message, got %q", form.Errors.Get("other"))
+	}
+}
+
+func TestForm_IsPhone(t *testing.T) {
+	tests := map[string]bool{
+		"555-555-5555":        true,
+		"+55 (11) 98765-4321": true,
+		"555.5555":            true,
+		"12345":               false,
+		"call me":             false,
+		"555-555-5555 ext 2":  false,
+		"1234567890123456":    false,
+		"":                    false,
+	}
+
+	for phone, valid := range tests {
+		form := New(url.Values{"phone": {phone}})
+		if form.IsPhone("phone") != valid {
+			t.Errorf("IsPhone(%q): expected %v", phone, valid)
+		}
+	}
+}
+
+func TestForm_IsInt(t *testing.T) {
+	form := New(url.Values{"a": {"12"}, "b": {"1.5"}, "c": {""}})
+
+	if !form.IsInt("a") || form.Int("a") != 12 {
+		t.Error("got invalid for a whole number")
+	}
+
+	if form.IsInt("b") || form.IsInt("c") {
+		t.Error("got valid for a value that is not a whole number")
+	}
+
+	if form.Int("b") != 0 {
+		t.Error("expected 0 for a value that is not a whole number")
+	}
+}
+
+func TestForm_InRange(t *testing.T) {
+	form := New(url.Values{"low": {"0"}, "ok": {"5"}, "high": {"11"}, "text": {"five"}})
+
+	if !form.InRange("ok", 1, 10) {
+		t.Error("got out of range for a number in range")
+	}
+
+	for _, field := range []string{"low", "high", "text"} {
+		if form.InRange(field, 1, 10) {
+			t.Errorf("got in range for %s", field)
+		}
+	}
+}
+
+func TestForm_IsDate(t *testing.T) {
+	form := New(url.Values{"good": {"2030-01-31"}, "bad": {"31/01/2030"}})
+
+	if !form.IsDate("good") {
+		t.Error("got invalid for a valid date")
+	}
+
+	if form.Date("good") != time.Date(2030, 1, 31, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("got the wrong date: %v", form.Date("good"))
+	}
+
+	if form.IsDate("bad") || form.IsDate("missing") {
+		t.Error("got valid for an invalid date")
+	}
+
+	if !form.Date("bad").IsZero() {
+		t.Error("expected the zero time for an invalid date")
+	}
+}
+
+func TestForm_NotInPast(t *testing.T) {
+	form := New(url.Values{
+		"today":     {time.Now().Format(DateLayout)},
+		"tomorrow":  {time.Now().AddDate(0, 0, 1).Format(DateLayout)},
+		"yesterday": {time.Now().AddDate(0, 0, -1).Format(DateLayout)},
+	})
+
+	if !form.NotInPast("today") || !form.NotInPast("tomorrow") {
+		t.Error("got a date in the past for today or later")
+	}
+
+	if form.NotInPast("yesterday") {
+		t.Error("got yesterday as not in the past")
+	}
+}
+
+func TestForm_DateRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		valid bool
+	}{
+		{"valid", "2030-01-01", "2030-01-05", true},
+		{"end-before-start", "2030-01-05", "2030-01-01", false},
+		{"same-day", "2030-01-01", "2030-01-01", false},
+		{"too-long", "2030-01-01", "2030-02-01", false},
+		{"invalid-start", "soon", "2030-01-05", false},
+		{"invalid-end", "2030-01-01", "", false},
+	}
+
+	for _, e := range tests {
+		form := New(url.Values{"start": {e.start}, "end": {e.end}})
+		if form.DateRange("start", "end", 30) != e.valid {
+			t.Errorf("%s: expected %v", e.name, e.valid)
+		}
+	}
+
+	form := New(url.Values{"start": {"2030-01-01"}, "end": {"2031-01-01"}})
+	if !form.DateRange("start", "end", 0) {
+		t.Error("got invalid for a long range without a limit")
+	}
+}
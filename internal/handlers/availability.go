@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/availability"
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/go-chi/chi"
+)
+
+const (
+	// maxFlexDays is how far a flexible search may move the requested dates either way
+	maxFlexDays = 7
+	// maxFlexNights is the longest stay a search within a month can ask for
+	maxFlexNights = 28
+	// windowsPerRoom is the number of stays a flexible search offers for each room
+	windowsPerRoom = 3
+)
+
+var monthPattern = regexp.MustCompile(`^[0-9]{4}-(0[1-9]|1[0-2])$`)
+
+// CalendarDay is a night in the availability calendar of a room
+type CalendarDay struct {
+	Date      string `json:"date"`
+	Available bool   `json:"available"`
+}
+
+// CalendarResponse is the availability calendar of a room for one month
+type CalendarResponse struct {
+	OK      bool          `json:"ok"`
+	Message string        `json:"message"`
+	Room    string        `json:"room"`
+	Year    int           `json:"year"`
+	Month   int           `json:"month"`
+	Days    []CalendarDay `json:"days"`
+}
+
+// PostFlexibleAvailability finds the nearest stays each room is free for, either around the requested dates
+// or for a number of nights anywhere in a month
+func (repository *Repository) PostFlexibleAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	adults, children, err := parseGuests(form, "adults", "children")
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "invalid number of guests")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	today := dates.Day(time.Now())
+
+	var from, to time.Time
+	var search func(calendar availability.Calendar) []availability.Window
+
+	switch form.Get("flex") {
+	case "month":
+		if !form.Matches("month", monthPattern, "This field must be a month such as 2030-01") {
+			repository.App.Session.Put(r.Context(), "error", "can't parse month!")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		month, _ := time.Parse("2006-01", form.Get("month"))
+
+		if !form.InRange("nights", 1, maxFlexNights) {
+			repository.App.Session.Put(r.Context(), "error", "invalid number of nights")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		nights := form.Int("nights")
+
+		from, to = month, month.AddDate(0, 1, 0)
+		if from.Before(today) {
+			from = today
+		}
+
+		search = func(calendar availability.Calendar) []availability.Window {
+			return calendar.Within(from, to, nights, windowsPerRoom)
+		}
+	default:
+		if !form.IsDate("start") {
+			repository.App.Session.Put(r.Context(), "error", "can't parse start date!")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		if !form.DateRange("start", "end", maxStayNights) {
+			repository.App.Session.Put(r.Context(), "error", "can't parse end date!")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		startDate, endDate := form.Date("start"), form.Date("end")
+
+		flexDays := 3
+		if form.Has("flex_days") && form.InRange("flex_days", 0, maxFlexDays) {
+			flexDays = form.Int("flex_days")
+		}
+
+		from, to = startDate.AddDate(0, 0, -flexDays), endDate.AddDate(0, 0, flexDays)
+
+		search = func(calendar availability.Calendar) []availability.Window {
+			return calendar.Around(startDate, endDate, flexDays, today, windowsPerRoom)
+		}
+	}
+
+	rooms, err := repository.DB.GetActiveRooms(r.Context())
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	var results []availability.RoomWindows
+	for _, room := range rooms {
+		if !room.Fits(adults, children) {
+			continue
+		}
+
+		// owner blocks end on the day they start, so look one day back to catch a block on the first day
+		restrictions, err := repository.DB.GetRestrictionsForRoomByDate(r.Context(), room.ID, from.AddDate(0, 0, -1), to)
+		if err != nil {
+			repository.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		windows := search(availability.NewCalendar(restrictions))
+		if len(windows) > 0 {
+			results = append(results, availability.RoomWindows{Room: room, Windows: windows})
+		}
+	}
+
+	if len(results) == 0 {
+		repository.App.Session.Put(r.Context(), "error", "No availability")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["results"] = results
+
+	intMap := make(map[string]int)
+	intMap["adults"] = adults
+	intMap["children"] = children
+
+	// search results can't be reloaded from a link, so the currency menu is left out
+	money := repository.priceDisplay(r)
+	money.Options = nil
+
+	render.Template(w, r, "flexible-availability.page.tmpl.html", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+		Money:  money,
+	})
+}
+
+// RoomCalendarJSON returns which nights of a month a room can be booked for, for the calendar on the room page
+func (repository *Repository) RoomCalendarJSON(w http.ResponseWriter, r *http.Request) {
+	room, err := repository.DB.GetRoomBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil || !room.Active {
+		writeCalendar(w, http.StatusNotFound, CalendarResponse{Message: "Room not found"})
+		return
+	}
+
+	today := dates.Day(time.Now())
+
+	year, month := today.Year(), int(today.Month())
+	form := forms.New(r.URL.Query())
+	if form.Has("y") {
+		if !form.InRange("y", 1, 9999) {
+			writeCalendar(w, http.StatusBadRequest, CalendarResponse{Message: "Invalid year"})
+			return
+		}
+
+		if !form.InRange("m", 1, 12) {
+			writeCalendar(w, http.StatusBadRequest, CalendarResponse{Message: "Invalid month"})
+			return
+		}
+
+		year, month = form.Int("y"), form.Int("m")
+	}
+
+	firstOfMonth := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	firstOfNextMonth := firstOfMonth.AddDate(0, 1, 0)
+
+	restrictions, err := repository.DB.GetRestrictionsForRoomByDate(r.Context(), room.ID, firstOfMonth.AddDate(0, 0, -1), firstOfNextMonth)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	calendar := availability.NewCalendar(restrictions)
+
+	resp := CalendarResponse{
+		OK:    true,
+		Room:  room.Slug,
+		Year:  year,
+		Month: month,
+	}
+
+	for d := firstOfMonth; d.Before(firstOfNextMonth); d = d.AddDate(0, 0, 1) {
+		resp.Days = append(resp.Days, CalendarDay{
+			Date:      d.Format(dateLayout),
+			Available: !d.Before(today) && !calendar.Taken(d),
+		})
+	}
+
+	writeCalendar(w, http.StatusOK, resp)
+}
+
+// writeCalendar writes a calendar response as JSON
+func writeCalendar(w http.ResponseWriter, status int, resp CalendarResponse) {
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// flexibleAvailabilityTests is the data for the PostFlexibleAvailability handler tests
+var flexibleAvailabilityTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name: "around dates",
+		postedData: url.Values{
+			"start":     {"2040-01-10"},
+			"end":       {"2040-01-12"},
+			"flex_days": {"3"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "nights in a month",
+		postedData: url.Values{
+			"flex":   {"month"},
+			"month":  {"2040-01"},
+			"nights": {"3"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "month in the past",
+		postedData: url.Values{
+			"flex":   {"month"},
+			"month":  {"2000-01"},
+			"nights": {"3"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "party too large",
+		postedData: url.Values{
+			"start":  {"2040-01-10"},
+			"end":    {"2040-01-12"},
+			"adults": {"5"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "invalid month",
+		postedData: url.Values{
+			"flex":   {"month"},
+			"month":  {"January"},
+			"nights": {"3"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "too many nights",
+		postedData: url.Values{
+			"flex":   {"month"},
+			"month":  {"2040-01"},
+			"nights": {"40"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "end before start",
+		postedData: url.Values{
+			"start": {"2040-01-12"},
+			"end":   {"2040-01-10"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+}
+
+// TestPostFlexibleAvailability tests the PostFlexibleAvailability handler
+func TestPostFlexibleAvailability(t *testing.T) {
+	for _, e := range flexibleAvailabilityTests {
+		req, _ := http.NewRequest("POST", "/search-availability-flexible", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostFlexibleAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// roomCalendarTests is the data for the RoomCalendarJSON handler tests
+var roomCalendarTests = []struct {
+	name               string
+	slug               string
+	query              string
+	expectedStatusCode int
+	expectedDays       int
+	unavailable        []string
+}{
+	{"booked room", "majors-suite", "y=2040&m=1", http.StatusOK, 31, []string{"2040-01-10", "2040-01-11", "2040-01-12"}},
+	{"free room", "generals-quarters", "y=2040&m=2", http.StatusOK, 29, nil},
+	{"current month", "generals-quarters", "", http.StatusOK, 0, nil},
+	{"unknown room", "colonels-cabin", "y=2040&m=1", http.StatusNotFound, 0, nil},
+	{"invalid month", "majors-suite", "y=2040&m=13", http.StatusBadRequest, 0, nil},
+}
+
+// TestRoomCalendarJSON tests the RoomCalendarJSON handler
+func TestRoomCalendarJSON(t *testing.T) {
+	for _, e := range roomCalendarTests {
+		req, _ := http.NewRequest("GET", "/rooms/"+e.slug+"/calendar?"+e.query, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"slug": e.slug})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.RoomCalendarJSON)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		var resp CalendarResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: failed to parse json: %v", e.name, err)
+			continue
+		}
+
+		if e.expectedDays > 0 && len(resp.Days) != e.expectedDays {
+			t.Errorf("%s: expected %d days, got %d", e.name, e.expectedDays, len(resp.Days))
+		}
+
+		unavailable := make(map[string]bool)
+		for _, d := range e.unavailable {
+			unavailable[d] = true
+		}
+
+		for _, day := range resp.Days {
+			if e.query != "" && day.Available == unavailable[day.Date] {
+				t.Errorf("%s: %s should have availability %t", e.name, day.Date, !unavailable[day.Date])
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/rules"
+	"github.com/go-chi/chi"
+)
+
+// checkBookingRules adds the booking rules a stay in a room breaks to the form errors.
+// A room ID of 0 checks the rules that apply to every room.
+func (repository *Repository) checkBookingRules(ctx context.Context, form *forms.Form, roomID int, start, end time.Time) error {
+	bookingRules, err := repository.DB.GetBookingRulesForRoom(ctx, roomID)
+	if err != nil {
+		return err
+	}
+
+	rule := rules.ForStay(bookingRules, roomID, start)
+	for _, v := range rules.Check(rule, start, end, time.Now()) {
+		form.Errors.Add(v.Field, v.Message.Key, v.Message.Args...)
+	}
+
+	return nil
+}
+
+// dateError returns the first error of the date fields of a form, in the language of the form
+func dateError(form *forms.Form) string {
+	if msg := form.Error("start_date"); msg != "" {
+		return msg
+	}
+	return form.Error("end_date")
+}
+
+// weekdayOption is a weekday checkbox of the booking rule form
+type weekdayOption struct {
+	Value             int
+	Name              string
+	ClosedToArrival   bool
+	ClosedToDeparture bool
+}
+
+// AdminBookingRules lists every booking rule
+func (repository *Repository) AdminBookingRules(w http.ResponseWriter, r *http.Request) {
+	bookingRules, err := repository.DB.AllBookingRules(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = bookingRules
+
+	render.Template(w, r, "admin-booking-rules.page.tmpl.html", &models.TemplateData{Data: data})
+}
+
+// AdminNewBookingRule shows the form to create a booking rule
+func (repository *Repository) AdminNewBookingRule(w http.ResponseWriter, r *http.Request) {
+	repository.renderBookingRule(w, r, models.BookingRule{MinNights: 1}, forms.New(nil))
+}
+
+// AdminShowBookingRule shows the form to edit a booking rule
+func (repository *Repository) AdminShowBookingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	rule, err := repository.DB.GetBookingRuleByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.renderBookingRule(w, r, rule, forms.New(nil))
+}
+
+// AdminPostBookingRule creates a booking rule, or updates it when the URL has a rule id
+func (repository *Repository) AdminPostBookingRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id := 0
+	if param := chi.URLParam(r, "id"); param != "" {
+		id, err = strconv.Atoi(param)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	rule := bookingRuleFromForm(form)
+	rule.ID = id
+
+	if !form.Valid() {
+		repository.renderBookingRule(w, r, rule, form)
+		return
+	}
+
+	if id == 0 {
+		id, err = repository.DB.InsertBookingRule(r.Context(), rule)
+	} else {
+		err = repository.DB.UpdateBookingRule(r.Context(), rule)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Booking rule saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/booking-rules/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteBookingRule deletes a booking rule
+func (repository *Repository) AdminDeleteBookingRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repository.DB.DeleteBookingRule(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Booking rule deleted")
+	http.Redirect(w, r, "/admin/booking-rules", http.StatusSeeOther)
+}
+
+// renderBookingRule shows the booking rule form with the rooms a rule can be limited to
+func (repository *Repository) renderBookingRule(w http.ResponseWriter, r *http.Request, rule models.BookingRule, form *forms.Form) {
+	rooms, err := repository.DB.GetAllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var weekdays []weekdayOption
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays = append(weekdays, weekdayOption{
+			Value:             int(d),
+			Name:              d.String(),
+			ClosedToArrival:   containsWeekday(rule.ClosedToArrival, d),
+			ClosedToDeparture: containsWeekday(rule.ClosedToDeparture, d),
+		})
+	}
+
+	stringMap := make(map[string]string)
+	if rule.Seasonal() {
+		stringMap["season_start"] = rule.SeasonStart.Format(dateLayout)
+		stringMap["season_end"] = rule.SeasonEnd.Format(dateLayout)
+	}
+
+	data := make(map[string]interface{})
+	data["rule"] = rule
+	data["rooms"] = rooms
+	data["weekdays"] = weekdays
+
+	render.Template(w, r, "admin-booking-rule.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: stringMap,
+	})
+}
+
+// bookingRuleFromForm validates the posted booking rule form and builds the rule from it
+func bookingRuleFromForm(form *forms.Form) models.BookingRule {
+	form.Required("name")
+
+	rule := models.BookingRule{
+		Name:              strings.TrimSpace(form.Get("name")),
+		ClosedToArrival:   rules.ParseWeekdays(strings.Join(form.Values["closed_to_arrival"], ",")),
+		ClosedToDeparture: rules.ParseWeekdays(strings.Join(form.Values["closed_to_departure"], ",")),
+	}
+
+	if form.Has("room_id") && form.InRange("room_id", 0, math.MaxInt32) {
+		rule.RoomID = form.Int("room_id")
+	}
+
+	if form.Has("season_start") || form.Has("season_end") {
+		if form.IsDate("season_start") && form.IsDate("season_end") {
+			rule.SeasonStart, rule.SeasonEnd = form.Date("season_start"), form.Date("season_end")
+			if rule.SeasonEnd.Before(rule.SeasonStart) {
+				form.Errors.Add("season_end", "Season end can't be before its start")
+			}
+		}
+	}
+
+	rule.MinNights = optionalInt(form, "min_nights", 1, maxStayNights, 1)
+	rule.MaxNights = optionalInt(form, "max_nights", 0, maxStayNights, 0)
+	if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "Maximum nights can't be less than the minimum")
+	}
+	rule.MinLeadDays = optionalInt(form, "min_lead_days", 0, maxStayNights, 0)
+	rule.MaxHorizonDays = optionalInt(form, "max_horizon_days", 0, 10*maxStayNights, 0)
+
+	return rule
+}
+
+// optionalInt returns a whole number from min to max read from the form, or def when the field is empty
+func optionalInt(form *forms.Form, field string, min, max, def int) int {
+	if !form.Has(field) {
+		return def
+	}
+	form.InRange(field, min, max)
+	return form.Int(field)
+}
+
+func containsWeekday(days []time.Weekday, d time.Weekday) bool {
+	for _, x := range days {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// adminPostBookingRuleTests is the data for the AdminPostBookingRule handler tests
+var adminPostBookingRuleTests = []struct {
+	name               string
+	id                 string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name: "new-rule",
+		postedData: url.Values{
+			"name":              {"Summer"},
+			"room_id":           {"2"},
+			"season_start":      {"2045-06-01"},
+			"season_end":        {"2045-08-31"},
+			"min_nights":        {"5"},
+			"max_nights":        {"14"},
+			"closed_to_arrival": {"0", "6"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/booking-rules/3",
+	},
+	{
+		name:               "update-rule",
+		id:                 "1",
+		postedData:         url.Values{"name": {"Standard"}, "max_horizon_days": {"365"}},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/booking-rules/1",
+	},
+	{
+		name:               "missing-name",
+		postedData:         url.Values{"min_nights": {"2"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "season-ends-before-it-starts",
+		postedData: url.Values{
+			"name":         {"Winter"},
+			"season_start": {"2045-03-01"},
+			"season_end":   {"2045-01-01"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "maximum-below-minimum",
+		postedData:         url.Values{"name": {"Long stays"}, "min_nights": {"7"}, "max_nights": {"3"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "invalid-lead-time",
+		postedData:         url.Values{"name": {"Early birds"}, "min_lead_days": {"soon"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "database-fails",
+		postedData:         url.Values{"name": {"fail"}},
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+	{
+		name:               "invalid-id",
+		id:                 "abc",
+		postedData:         url.Values{},
+		expectedStatusCode: http.StatusBadRequest,
+	},
+}
+
+// TestAdminPostBookingRule tests the AdminPostBookingRule handler
+func TestAdminPostBookingRule(t *testing.T) {
+	for _, e := range adminPostBookingRuleTests {
+		req, _ := http.NewRequest("POST", "/admin/booking-rules/new", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.id != "" {
+			req = withURLParams(req, map[string]string{"id": e.id})
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostBookingRule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminShowBookingRuleTests is the data for the AdminShowBookingRule handler tests
+var adminShowBookingRuleTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+}{
+	{"existing-rule", "2", http.StatusOK},
+	{"unknown-rule", "99", http.StatusInternalServerError},
+	{"invalid-id", "abc", http.StatusBadRequest},
+}
+
+// TestAdminShowBookingRule tests the AdminShowBookingRule handler
+func TestAdminShowBookingRule(t *testing.T) {
+	for _, e := range adminShowBookingRuleTests {
+		req, _ := http.NewRequest("GET", "/admin/booking-rules/"+e.id, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowBookingRule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// TestAdminDeleteBookingRule tests the AdminDeleteBookingRule handler
+func TestAdminDeleteBookingRule(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/booking-rules/2/delete", nil)
+	ctx := getCtx(req)
+	req = withURLParams(req.WithContext(ctx), map[string]string{"id": "2"})
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminDeleteBookingRule)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteBookingRule returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	actualLoc, _ := rr.Result().Location()
+	if actualLoc.String() != "/admin/booking-rules" {
+		t.Errorf("AdminDeleteBookingRule redirected to %s, wanted /admin/booking-rules", actualLoc.String())
+	}
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/cancellation"
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/payments"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+	"github.com/go-chi/chi"
+)
+
+// errRefundFailed is returned when a reservation was cancelled but what it refunds couldn't be sent back
+var errRefundFailed = errors.New("reservation cancelled but the refund failed")
+
+// newCancelToken returns a random token for the link a guest cancels their reservation from
+func newCancelToken() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// cancelURL returns the link a guest cancels a reservation from
+func (repository *Repository) cancelURL(reservation models.Reservation) string {
+	return repository.App.BaseURL + "/reservations/cancel/" + reservation.CancelToken
+}
+
+// cancellationPolicy returns the cancellation policy of a room, the zero policy of free cancellation
+// until arrival when it has none
+func (repository *Repository) cancellationPolicy(ctx context.Context, room models.Room) (models.CancellationPolicy, error) {
+	if room.CancellationPolicyID == 0 {
+		return models.CancellationPolicy{}, nil
+	}
+	return repository.DB.GetCancellationPolicyByID(ctx, room.CancellationPolicyID)
+}
+
+// quoteCancellation returns the cancellation policy of a reservation and what cancelling it now costs
+func (repository *Repository) quoteCancellation(ctx context.Context, reservation models.Reservation) (models.CancellationPolicy, cancellation.Quote, error) {
+	room, err := repository.DB.GetRoomByID(ctx, reservation.RoomID)
+	if err != nil {
+		return models.CancellationPolicy{}, cancellation.Quote{}, err
+	}
+
+	policy, err := repository.cancellationPolicy(ctx, room)
+	if err != nil {
+		return models.CancellationPolicy{}, cancellation.Quote{}, err
+	}
+
+	reservationPayments, refunded, err := repository.paymentBalance(ctx, reservation.ID)
+	if err != nil {
+		return models.CancellationPolicy{}, cancellation.Quote{}, err
+	}
+
+	paid := 0
+	for _, p := range reservationPayments {
+		if p.Status == models.PaymentSucceeded {
+			paid += p.Amount - refunded[p.ID]
+		}
+	}
+
+	return policy, cancellation.Compute(policy, reservation.Total, paid, reservation.StartDate, time.Now()), nil
+}
+
+// paymentBalance returns the payments of a reservation with what was already refunded of each, by payment id
+func (repository *Repository) paymentBalance(ctx context.Context, reservationID int) ([]models.Payment, map[int]int, error) {
+	reservationPayments, err := repository.DB.GetPaymentsForReservation(ctx, reservationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refunds, err := repository.DB.GetRefundsForReservation(ctx, reservationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refunded := make(map[int]int)
+	for _, refund := range refunds {
+		if refund.Status != models.PaymentFailed {
+			refunded[refund.PaymentID] += refund.Amount
+		}
+	}
+
+	return reservationPayments, refunded, nil
+}
+
+// cancelReservation cancels a reservation, refunds what its cancellation policy gives back and emails the guest.
+// It returns dbrepo.ErrNotCancellable for reservations that were already cancelled or expired, and an error
+// wrapping errRefundFailed when the reservation was cancelled but the refund couldn't be sent.
+func (repository *Repository) cancelReservation(ctx context.Context, reservation models.Reservation, reason string) (cancellation.Quote, error) {
+	if !reservation.Cancellable() {
+		return cancellation.Quote{}, dbrepo.ErrNotCancellable
+	}
+
+	_, quote, err := repository.quoteCancellation(ctx, reservation)
+	if err != nil {
+		return quote, err
+	}
+
+	err = repository.DB.CancelReservation(ctx, reservation.ID)
+	if err != nil {
+		return quote, err
+	}
+
+	repository.offerFreedNights(ctx, reservation)
+
+	refundErr := repository.refund(ctx, reservation.ID, quote.Refund, reason)
+
+	content := fmt.Sprintf("<p>Hello, your reservation at %s from %s to %s was cancelled.</p>",
+		template.HTMLEscapeString(reservation.Room.RoomName),
+		reservation.StartDate.Format(dateLayout), reservation.EndDate.Format(dateLayout))
+	if quote.Refund > 0 && refundErr == nil {
+		content += fmt.Sprintf("<p>%s will be refunded to you.</p>",
+			currency.Format(quote.Refund, currency.Get(repository.App.Currency), i18n.Default))
+	}
+
+	repository.App.MailChan <- models.MailData{
+		To:       reservation.Email,
+		From:     "go_reservation@email.com",
+		Subject:  "Reservation cancelled",
+		Content:  content,
+		Template: "basic.html",
+	}
+
+	if refundErr != nil {
+		return quote, fmt.Errorf("%w: %v", errRefundFailed, refundErr)
+	}
+
+	return quote, nil
+}
+
+// refund gives an amount back through the payments of a reservation, the most recent ones first
+func (repository *Repository) refund(ctx context.Context, reservationID, amount int, reason string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	if repository.App.Payments == nil {
+		return errors.New("payments are disabled")
+	}
+
+	reservationPayments, refunded, err := repository.paymentBalance(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+
+	for i := len(reservationPayments) - 1; i >= 0 && amount > 0; i-- {
+		p := reservationPayments[i]
+		refundable := p.Amount - refunded[p.ID]
+		if p.Status != models.PaymentSucceeded || refundable <= 0 {
+			continue
+		}
+
+		part := refundable
+		if amount < part {
+			part = amount
+		}
+
+		err = repository.refundPayment(ctx, p, part, reason)
+		if err != nil {
+			return err
+		}
+
+		amount -= part
+	}
+
+	if amount > 0 {
+		return fmt.Errorf("can't refund %d more than was paid", amount)
+	}
+
+	return nil
+}
+
+// refundPayment gives an amount of a payment back through the gateway that took it and records the refund
+func (repository *Repository) refundPayment(ctx context.Context, p models.Payment, amount int, reason string) error {
+	gateway := repository.App.Payments
+	if gateway == nil {
+		return errors.New("payments are disabled")
+	}
+	if p.Gateway != gateway.Name() {
+		return fmt.Errorf("payment %d was taken through %s", p.ID, p.Gateway)
+	}
+
+	result, err := gateway.Refund(ctx, payments.RefundRequest{
+		CheckoutID: p.CheckoutID,
+		Amount:     amount,
+		Currency:   p.Currency,
+		Reason:     reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = repository.DB.InsertRefund(ctx, models.Refund{
+		ReservationID: p.ReservationID,
+		PaymentID:     p.ID,
+		Gateway:       gateway.Name(),
+		RefundID:      result.ID,
+		Amount:        amount,
+		Currency:      p.Currency,
+		Status:        result.Status,
+		Reason:        reason,
+	})
+	return err
+}
+
+// confirmationMail returns the email confirming a reservation to the guest, with the cancellation policy
+// of the room and the link to cancel it, and with the invoice attached when the app is set to attach it
+func (repository *Repository) confirmationMail(ctx context.Context, reservation models.Reservation, subject, intro string) models.MailData {
+	content := "<p>" + intro + "</p>"
+
+	room, err := repository.DB.GetRoomByID(ctx, reservation.RoomID)
+	if err == nil {
+		var policy models.CancellationPolicy
+		policy, err = repository.cancellationPolicy(ctx, room)
+		if err == nil {
+			content += "<p>" + template.HTMLEscapeString(cancellation.Terms(policy).In(i18n.Default)) + "</p>"
+		}
+	}
+	if err != nil {
+		// the guest still gets the link, and the policy is shown when they follow it
+		repository.App.ErrorLog.Println(err)
+	}
+
+	if reservation.CancelToken != "" {
+		link := template.HTMLEscapeString(repository.cancelURL(reservation))
+		content += fmt.Sprintf(`<p>To cancel your reservation, go to <a href="%s">%s</a></p>`, link, link)
+	}
+
+	mail := models.MailData{
+		To:       reservation.Email,
+		From:     "go_reservation@email.com",
+		Subject:  subject,
+		Content:  content,
+		Template: "basic.html",
+	}
+
+	if repository.App.AttachInvoices {
+		attachment, err := repository.invoiceAttachment(ctx, reservation)
+		if err != nil {
+			// the guest can still download it from the link
+			repository.App.ErrorLog.Println(err)
+		} else {
+			mail.Attachments = append(mail.Attachments, attachment)
+		}
+	}
+
+	return mail
+}
+
+// CancelReservation shows a guest the reservation their cancel link is for with what cancelling it costs
+func (repository *Repository) CancelReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, err := repository.DB.GetReservationByCancelToken(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't find reservation")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	policy, quote, err := repository.quoteCancellation(r.Context(), reservation)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't get the cancellation policy")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["terms"] = cancellation.Terms(policy).In(i18n.FromContext(r.Context()))
+
+	data := make(map[string]interface{})
+	data["reservation"] = reservation
+	data["quote"] = quote
+	data["cancellable"] = reservation.Cancellable() && cancellation.Open(reservation.StartDate, time.Now())
+
+	// confirmed reservations are invoiced when the guest first downloads the invoice
+	_, issued, err := repository.issuedInvoice(r.Context(), reservation.ID)
+	if err != nil {
+		repository.App.ErrorLog.Println(err)
+	}
+	data["invoice"] = invoiceable(reservation) || issued
+
+	// the last day to cancel for free, while it hasn't passed
+	if deadline, ok := cancellation.Deadline(policy, reservation.StartDate); ok && quote.Free() {
+		data["deadline"] = deadline
+	}
+
+	render.Template(w, r, "cancel-reservation.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// PostCancelReservation cancels the reservation of a cancel link for the guest
+func (repository *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	reservation, err := repository.DB.GetReservationByCancelToken(r.Context(), token)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't find reservation")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	back := "/reservations/cancel/" + token
+
+	// guests can't cancel a stay that has begun, only staff can
+	if !cancellation.Open(reservation.StartDate, time.Now()) {
+		repository.App.Session.Put(r.Context(), "error", "this reservation can no longer be cancelled")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	_, err = repository.cancelReservation(r.Context(), reservation, "cancelled by guest")
+	switch {
+	case errors.Is(err, dbrepo.ErrNotCancellable):
+		repository.App.Session.Put(r.Context(), "error", "this reservation can no longer be cancelled")
+	case errors.Is(err, errRefundFailed):
+		repository.App.ErrorLog.Println(err)
+		repository.App.Session.Put(r.Context(), "warning", "your reservation was cancelled, we'll contact you about the refund")
+	case err != nil:
+		repository.App.ErrorLog.Println(err)
+		repository.App.Session.Put(r.Context(), "error", "can't cancel reservation")
+	default:
+		repository.App.Session.Put(r.Context(), "flash", "your reservation was cancelled")
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminCancelReservation cancels a reservation under the cancellation policy of its room and refunds the guest
+func (repository *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	reservation, err := repository.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	quote, err := repository.cancelReservation(r.Context(), reservation, "cancelled by staff")
+	switch {
+	case errors.Is(err, dbrepo.ErrNotCancellable):
+		repository.App.Session.Put(r.Context(), "error", "This reservation was already cancelled or expired")
+	case errors.Is(err, errRefundFailed):
+		repository.App.ErrorLog.Println(err)
+		repository.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation cancelled, but refunding %s failed: %v",
+			render.FormatMoney(quote.Refund), errors.Unwrap(err)))
+	case err != nil:
+		helpers.ServerError(w, err)
+		return
+	default:
+		repository.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation cancelled, %s refunded",
+			render.FormatMoney(quote.Refund)))
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// AdminCancellationPolicies lists every cancellation policy
+func (repository *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := repository.DB.AllCancellationPolicies(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+
+	render.Template(w, r, "admin-cancellation-policies.page.tmpl.html", &models.TemplateData{Data: data})
+}
+
+// AdminNewCancellationPolicy shows the form to create a cancellation policy
+func (repository *Repository) AdminNewCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	renderCancellationPolicy(w, r, models.CancellationPolicy{FreeDays: 7, PenaltyPercent: 100}, forms.New(nil))
+}
+
+// AdminShowCancellationPolicy shows the form to edit a cancellation policy
+func (repository *Repository) AdminShowCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	policy, err := repository.DB.GetCancellationPolicyByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	renderCancellationPolicy(w, r, policy, forms.New(nil))
+}
+
+// AdminPostCancellationPolicy creates a cancellation policy, or updates it when the URL has a policy id
+func (repository *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id := 0
+	if param := chi.URLParam(r, "id"); param != "" {
+		id, err = strconv.Atoi(param)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	policy := cancellationPolicyFromForm(form)
+	policy.ID = id
+
+	if !form.Valid() {
+		renderCancellationPolicy(w, r, policy, form)
+		return
+	}
+
+	if id == 0 {
+		id, err = repository.DB.InsertCancellationPolicy(r.Context(), policy)
+	} else {
+		err = repository.DB.UpdateCancellationPolicy(r.Context(), policy)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Cancellation policy saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/cancellation-policies/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteCancellationPolicy deletes a cancellation policy
+func (repository *Repository) AdminDeleteCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repository.DB.DeleteCancellationPolicy(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Cancellation policy deleted")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// renderCancellationPolicy shows the cancellation policy form
+func renderCancellationPolicy(w http.ResponseWriter, r *http.Request, policy models.CancellationPolicy, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["policy"] = policy
+
+	render.Template(w, r, "admin-cancellation-policy.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// cancellationPolicyFromForm validates the posted cancellation policy form and builds the policy from it
+func cancellationPolicyFromForm(form *forms.Form) models.CancellationPolicy {
+	form.Required("name")
+	form.MaxLength("name", 255)
+
+	policy := models.CancellationPolicy{
+		Name:          strings.TrimSpace(form.Get("name")),
+		NonRefundable: form.Has("non_refundable"),
+	}
+
+	policy.FreeDays = optionalInt(form, "free_days", 0, math.MaxInt16, 0)
+	policy.PenaltyPercent = optionalInt(form, "penalty_percent", 0, 100, 0)
+
+	return policy
+}
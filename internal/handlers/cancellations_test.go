@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// cancelReservationTests is the data for the CancelReservation handler tests, /reservations/cancel/{token}
+var cancelReservationTests = []struct {
+	name               string
+	token              string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"confirmed-reservation", "token-3", http.StatusOK, ""},
+	{"cancelled-reservation", "token-4", http.StatusOK, ""},
+	{"arriving-today", "token-arriving-today", http.StatusOK, ""},
+	{"unknown-token", "nope", http.StatusSeeOther, "/"},
+}
+
+// TestCancelReservation tests the CancelReservation handler
+func TestCancelReservation(t *testing.T) {
+	for _, e := range cancelReservationTests {
+		req, _ := http.NewRequest("GET", "/reservations/cancel/"+e.token, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"token": e.token})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.CancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// postCancelReservationTests is the data for the PostCancelReservation handler tests
+var postCancelReservationTests = []struct {
+	name             string
+	token            string
+	payments         bool
+	expectedLocation string
+	expectedKey      string
+}{
+	{"refunded", "token-3", true, "/reservations/cancel/token-3", "flash"},
+	{"refund-fails", "token-3", false, "/reservations/cancel/token-3", "warning"},
+	{"already-cancelled", "token-4", true, "/reservations/cancel/token-4", "error"},
+	{"arriving-today", "token-arriving-today", true, "/reservations/cancel/token-arriving-today", "error"},
+	{"after-checkout", "token-stayed", true, "/reservations/cancel/token-stayed", "error"},
+	{"database-fails", "token-5", true, "/reservations/cancel/token-5", "error"},
+	{"unknown-token", "nope", true, "/", "error"},
+}
+
+// TestPostCancelReservation tests the PostCancelReservation handler
+func TestPostCancelReservation(t *testing.T) {
+	for _, e := range postCancelReservationTests {
+		t.Run(e.name, func(t *testing.T) {
+			if e.payments {
+				withPayments(t)
+			}
+
+			req, _ := http.NewRequest("POST", "/reservations/cancel/"+e.token, nil)
+			ctx := getCtx(req)
+			req = withURLParams(req.WithContext(ctx), map[string]string{"token": e.token})
+
+			rr := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(Repo.PostCancelReservation)
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusSeeOther {
+				t.Errorf("returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+			}
+
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("expected location %s, but got location %s", e.expectedLocation, actualLoc.String())
+			}
+
+			if !session.Exists(ctx, e.expectedKey) {
+				t.Errorf("expected a %s message in the session", e.expectedKey)
+			}
+		})
+	}
+}
+
+// adminCancelReservationTests is the data for the AdminCancelReservation handler tests
+var adminCancelReservationTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedFlash      string
+}{
+	{"refunded", "3", http.StatusSeeOther, "Reservation cancelled, $108.00 refunded"},
+	{"already-cancelled", "4", http.StatusSeeOther, ""},
+	{"database-fails", "5", http.StatusInternalServerError, ""},
+	{"invalid-id", "abc", http.StatusBadRequest, ""},
+}
+
+// TestAdminCancelReservation tests the AdminCancelReservation handler
+func TestAdminCancelReservation(t *testing.T) {
+	withPayments(t)
+
+	for _, e := range adminCancelReservationTests {
+		req, _ := http.NewRequest("GET", "/admin/cancel-reservation/all/"+e.id+"/do", nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": "all", "id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminCancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedFlash != "" {
+			if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+				t.Errorf("%s: expected flash %q, got %q", e.name, e.expectedFlash, flash)
+			}
+		}
+	}
+}
+
+// adminPostCancellationPolicyTests is the data for the AdminPostCancellationPolicy handler tests
+var adminPostCancellationPolicyTests = []struct {
+	name               string
+	id                 string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name:               "new-policy",
+		postedData:         url.Values{"name": {"Moderate"}, "free_days": {"5"}, "penalty_percent": {"50"}},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/cancellation-policies/3",
+	},
+	{
+		name:               "update-policy",
+		id:                 "2",
+		postedData:         url.Values{"name": {"Non-refundable"}, "non_refundable": {"1"}},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/cancellation-policies/2",
+	},
+	{
+		name:               "missing-name",
+		postedData:         url.Values{"free_days": {"5"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "penalty-above-total",
+		postedData:         url.Values{"name": {"Strict"}, "penalty_percent": {"150"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "negative-days",
+		postedData:         url.Values{"name": {"Strict"}, "free_days": {"-1"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "database-fails",
+		postedData:         url.Values{"name": {"fail"}},
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+	{
+		name:               "invalid-id",
+		id:                 "abc",
+		postedData:         url.Values{},
+		expectedStatusCode: http.StatusBadRequest,
+	},
+}
+
+// TestAdminPostCancellationPolicy tests the AdminPostCancellationPolicy handler
+func TestAdminPostCancellationPolicy(t *testing.T) {
+	for _, e := range adminPostCancellationPolicyTests {
+		req, _ := http.NewRequest("POST", "/admin/cancellation-policies/new", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.id != "" {
+			req = withURLParams(req, map[string]string{"id": e.id})
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminShowCancellationPolicyTests is the data for the AdminShowCancellationPolicy handler tests
+var adminShowCancellationPolicyTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+}{
+	{"existing-policy", "1", http.StatusOK},
+	{"unknown-policy", "99", http.StatusInternalServerError},
+	{"invalid-id", "abc", http.StatusBadRequest},
+}
+
+// TestAdminShowCancellationPolicy tests the AdminShowCancellationPolicy handler
+func TestAdminShowCancellationPolicy(t *testing.T) {
+	for _, e := range adminShowCancellationPolicyTests {
+		req, _ := http.NewRequest("GET", "/admin/cancellation-policies/"+e.id, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// TestAdminDeleteCancellationPolicy tests the AdminDeleteCancellationPolicy handler
+func TestAdminDeleteCancellationPolicy(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/cancellation-policies/2/delete", nil)
+	ctx := getCtx(req)
+	req = withURLParams(req.WithContext(ctx), map[string]string{"id": "2"})
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminDeleteCancellationPolicy)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteCancellationPolicy returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	actualLoc, _ := rr.Result().Location()
+	if actualLoc.String() != "/admin/cancellation-policies" {
+		t.Errorf("AdminDeleteCancellationPolicy redirected to %s, wanted /admin/cancellation-policies", actualLoc.String())
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/go-chi/chi"
+)
+
+// ratePattern matches the exchange rates an admin can enter, such as 0.92 or 5.1234
+var ratePattern = regexp.MustCompile(`^\s*[0-9]+(\.[0-9]{1,8})?\s*$`)
+
+// priceDisplay returns how prices are shown to the guest of a request: in the currency they picked when the
+// property has an exchange rate for it, otherwise in the currency of the property
+func (repository *Repository) priceDisplay(r *http.Request) currency.Display {
+	base := currency.Get(repository.App.Currency)
+	display := currency.Display{
+		Base:     base,
+		Currency: base,
+		Rate:     1,
+		Locale:   i18n.FromContext(r.Context()),
+		Options:  []string{base.Code},
+	}
+
+	rates, err := repository.DB.AllExchangeRates(r.Context())
+	if err != nil {
+		// the prices can still be shown in the currency they are charged in
+		repository.App.ErrorLog.Println(err)
+		return display
+	}
+
+	picked := currency.FromContext(r.Context())
+	for _, rate := range rates {
+		c, ok := currency.Lookup(rate.Currency)
+		if !ok || c.Code == base.Code {
+			continue
+		}
+
+		display.Options = append(display.Options, c.Code)
+		if c.Code == picked {
+			display.Currency, display.Rate = c, rate.Rate
+		}
+	}
+
+	return display
+}
+
+// AdminExchangeRates lists the exchange rates with the form to add or change one
+func (repository *Repository) AdminExchangeRates(w http.ResponseWriter, r *http.Request) {
+	repository.renderExchangeRates(w, r, forms.New(nil))
+}
+
+// AdminPostExchangeRate saves the rate of a currency, replacing the rate it had
+func (repository *Repository) AdminPostExchangeRate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("currency", "rate")
+
+	c, ok := currency.Lookup(form.Get("currency"))
+	if form.Has("currency") {
+		if !ok {
+			form.Errors.Add("currency", "Unknown currency")
+		} else if c.Code == currency.Get(repository.App.Currency).Code {
+			form.Errors.Add("currency", "Prices are already charged in this currency")
+		}
+	}
+
+	var rate float64
+	if form.Has("rate") && form.Matches("rate", ratePattern, "Rate must be a number such as 0.92") {
+		rate, _ = strconv.ParseFloat(strings.TrimSpace(form.Get("rate")), 64)
+		if rate <= 0 {
+			form.Errors.Add("rate", "Rate must be greater than zero")
+		}
+	}
+
+	if !form.Valid() {
+		repository.renderExchangeRates(w, r, form)
+		return
+	}
+
+	err = repository.DB.SaveExchangeRate(r.Context(), models.ExchangeRate{Currency: c.Code, Rate: rate})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Exchange rate saved")
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// AdminDeleteExchangeRate deletes an exchange rate, so prices can no longer be shown in its currency
+func (repository *Repository) AdminDeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repository.DB.DeleteExchangeRate(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Exchange rate deleted")
+	http.Redirect(w, r, "/admin/exchange-rates", http.StatusSeeOther)
+}
+
+// renderExchangeRates shows the exchange rates page with the currencies a rate can be set for
+func (repository *Repository) renderExchangeRates(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rates, err := repository.DB.AllExchangeRates(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	base := currency.Get(repository.App.Currency)
+
+	var codes []string
+	for _, code := range currency.Codes() {
+		if code != base.Code {
+			codes = append(codes, code)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["rates"] = rates
+	data["currencies"] = codes
+
+	render.Template(w, r, "admin-exchange-rates.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: map[string]string{"base": base.Code},
+	})
+}
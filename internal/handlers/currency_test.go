@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/crislainesc/bookings/internal/currency"
+)
+
+// priceDisplayTests is the data for the priceDisplay tests
+var priceDisplayTests = []struct {
+	name             string
+	picked           string
+	expectedCurrency string
+	expectedRate     float64
+}{
+	{"nothing-picked", "", "USD", 1},
+	{"currency-with-rate", "EUR", "EUR", 0.9},
+	{"currency-without-rate", "GBP", "USD", 1},
+}
+
+// TestPriceDisplay tests picking the currency prices are shown in
+func TestPriceDisplay(t *testing.T) {
+	for _, e := range priceDisplayTests {
+		req, _ := http.NewRequest("GET", "/rooms", nil)
+		ctx := currency.WithCode(getCtx(req), e.picked)
+		req = req.WithContext(ctx)
+
+		display := Repo.priceDisplay(req)
+
+		if display.Currency.Code != e.expectedCurrency || display.Rate != e.expectedRate {
+			t.Errorf("%s: expected %s at %v, got %s at %v", e.name, e.expectedCurrency, e.expectedRate, display.Currency.Code, display.Rate)
+		}
+
+		if !reflect.DeepEqual(display.Options, []string{"USD", "BRL", "EUR"}) {
+			t.Errorf("%s: unexpected options %v", e.name, display.Options)
+		}
+	}
+}
+
+// TestAdminExchangeRates tests the AdminExchangeRates handler
+func TestAdminExchangeRates(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/exchange-rates", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminExchangeRates)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminExchangeRates returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+// adminPostExchangeRateTests is the data for the AdminPostExchangeRate handler tests
+var adminPostExchangeRateTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+}{
+	{"new-rate", url.Values{"currency": {"GBP"}, "rate": {"0.79"}}, http.StatusSeeOther},
+	{"lowercase-code", url.Values{"currency": {"eur"}, "rate": {"0.92"}}, http.StatusSeeOther},
+	{"missing-rate", url.Values{"currency": {"GBP"}}, http.StatusOK},
+	{"unknown-currency", url.Values{"currency": {"XYZ"}, "rate": {"2"}}, http.StatusOK},
+	{"base-currency", url.Values{"currency": {"USD"}, "rate": {"1"}}, http.StatusOK},
+	{"invalid-rate", url.Values{"currency": {"GBP"}, "rate": {"0,79"}}, http.StatusOK},
+	{"zero-rate", url.Values{"currency": {"GBP"}, "rate": {"0"}}, http.StatusOK},
+	{"database-fails", url.Values{"currency": {"CHF"}, "rate": {"0.88"}}, http.StatusInternalServerError},
+}
+
+// TestAdminPostExchangeRate tests the AdminPostExchangeRate handler
+func TestAdminPostExchangeRate(t *testing.T) {
+	for _, e := range adminPostExchangeRateTests {
+		req, _ := http.NewRequest("POST", "/admin/exchange-rates", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostExchangeRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// TestAdminDeleteExchangeRate tests the AdminDeleteExchangeRate handler
+func TestAdminDeleteExchangeRate(t *testing.T) {
+	tests := []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+	}{
+		{"existing-rate", "1", http.StatusSeeOther},
+		{"invalid-id", "abc", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/exchange-rates/"+e.id+"/delete", nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteExchangeRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+)
+
+// dashboardChartDays is how many days back the chart of bookings on the dashboard goes
+const dashboardChartDays = 30
+
+// dashboardChart is the chart of the reservations booked each day, ready to be handed to Chart.js
+type dashboardChart struct {
+	Labels []string `json:"labels"`
+	Counts []int    `json:"counts"`
+}
+
+// AdminDashboard shows today's arrivals, departures and guests in house, the occupancy of the coming days,
+// the reservations waiting to be processed, the revenue booked this month and last, and the bookings of
+// the last days
+func (repository *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	today := dates.Day(time.Now())
+	ctx := r.Context()
+
+	// the stays ending today or later that began today or earlier
+	var stays []models.Reservation
+	err := repository.DB.EachReservation(ctx, models.ReservationQuery{
+		From: today.AddDate(0, 0, -1),
+		To:   today,
+		Sort: models.SortByArrival,
+	}, func(res models.Reservation) error {
+		if res.Cancellable() {
+			stays = append(stays, res)
+		}
+		return nil
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	arrivals, departures, inHouse := splitStays(stays, today)
+
+	_, newReservations, err := repository.DB.SearchReservations(ctx, models.ReservationQuery{NewOnly: true, PerPage: 1})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	week, err := repository.DB.GetOccupancy(ctx, today, today.AddDate(0, 0, 7))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	month, err := repository.DB.GetOccupancy(ctx, today, today.AddDate(0, 0, 30))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	thisMonth := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	lastMonth := thisMonth.AddDate(0, -1, 0)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	revenue, err := repository.DB.GetRevenueBooked(ctx, thisMonth, tomorrow)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	lastRevenue, err := repository.DB.GetRevenueBooked(ctx, lastMonth, thisMonth)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	bookings, err := repository.DB.GetBookingsPerDay(ctx, tomorrow.AddDate(0, 0, -dashboardChartDays), tomorrow)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var chart dashboardChart
+	for _, day := range bookings {
+		chart.Labels = append(chart.Labels, day.Day.Format("Jan 2"))
+		chart.Counts = append(chart.Counts, day.Count)
+	}
+
+	guests := 0
+	for _, res := range inHouse {
+		guests += res.Guests()
+	}
+
+	data := make(map[string]interface{})
+	data["arrivals"] = arrivals
+	data["departures"] = departures
+	data["in_house"] = inHouse
+	data["week"] = week
+	data["month"] = month
+	data["chart"] = chart
+
+	intMap := make(map[string]int)
+	intMap["guests"] = guests
+	intMap["new"] = newReservations
+	intMap["revenue"] = revenue
+	intMap["last_revenue"] = lastRevenue
+
+	stringMap := make(map[string]string)
+	stringMap["today"] = today.Format(dateLayout)
+	stringMap["this_month"] = thisMonth.Format("January")
+	stringMap["last_month"] = lastMonth.Format("January")
+	if lastRevenue > 0 {
+		stringMap["revenue_change"] = fmt.Sprintf("%+.0f%%", float64(revenue-lastRevenue)*100/float64(lastRevenue))
+	}
+
+	render.Template(w, r, "admin-dashboard.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// splitStays sorts the stays around a day into the guests arriving that day, the guests leaving that day
+// and the guests staying that night, who include the arrivals
+func splitStays(stays []models.Reservation, day time.Time) (arrivals, departures, inHouse []models.Reservation) {
+	for _, res := range stays {
+		if res.StartDate.Equal(day) {
+			arrivals = append(arrivals, res)
+		}
+		if res.EndDate.Equal(day) {
+			departures = append(departures, res)
+		}
+		if !res.StartDate.After(day) && res.EndDate.After(day) {
+			inHouse = append(inHouse, res)
+		}
+	}
+	return arrivals, departures, inHouse
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// TestAdminDashboard tests the AdminDashboard handler
+func TestAdminDashboard(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/dashboard", nil)
+	req = req.WithContext(getCtx(req))
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminDashboard)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminDashboard returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+// TestSplitStays tests that the stays around a day are sorted into arrivals, departures and guests in house
+func TestSplitStays(t *testing.T) {
+	day := parseDate("2050-01-10")
+	stays := []models.Reservation{
+		{ID: 1, StartDate: parseDate("2050-01-10"), EndDate: parseDate("2050-01-12")},
+		{ID: 2, StartDate: parseDate("2050-01-08"), EndDate: parseDate("2050-01-10")},
+		{ID: 3, StartDate: parseDate("2050-01-09"), EndDate: parseDate("2050-01-11")},
+		{ID: 4, StartDate: parseDate("2050-01-10"), EndDate: parseDate("2050-01-11")},
+	}
+
+	arrivals, departures, inHouse := splitStays(stays, day)
+
+	ids := func(reservations []models.Reservation) []int {
+		var ids []int
+		for _, res := range reservations {
+			ids = append(ids, res.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		got      []int
+		expected []int
+	}{
+		{"arrivals", ids(arrivals), []int{1, 4}},
+		{"departures", ids(departures), []int{2}},
+		{"in-house", ids(inHouse), []int{1, 3, 4}},
+	}
+
+	for _, e := range tests {
+		if fmt.Sprint(e.got) != fmt.Sprint(e.expected) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, e.got)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+	"github.com/go-chi/chi"
+)
+
+// guestsPerPage is the number of guests on each page of the admin guest list
+const guestsPerPage = 25
+
+// maxGuestNotesLength is the longest notes staff can keep on a guest
+const maxGuestNotesLength = 5000
+
+// AdminGuests lists the guests by name, one page at a time, searched by name, email or phone and filtered
+// by tag
+func (repository *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+
+	search := models.GuestQuery{
+		Search:  strings.TrimSpace(form.Get("q")),
+		Page:    1,
+		PerPage: guestsPerPage,
+	}
+	if tag := form.Get("tag"); tag != "" {
+		if contains(models.GuestTags, tag) {
+			search.Tag = tag
+		} else {
+			form.Errors.Add("tag", "Unknown tag")
+		}
+	}
+	if form.Has("page") && form.InRange("page", 1, math.MaxInt32) {
+		search.Page = form.Int("page")
+	}
+
+	guests, total, err := repository.DB.SearchGuests(r.Context(), search)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var pages []reservationsPage
+	for page := 1; page <= (total+guestsPerPage-1)/guestsPerPage; page++ {
+		query := url.Values{}
+		if search.Search != "" {
+			query.Set("q", search.Search)
+		}
+		if search.Tag != "" {
+			query.Set("tag", search.Tag)
+		}
+		query.Set("page", strconv.Itoa(page))
+		pages = append(pages, reservationsPage{Number: page, URL: "/admin/guests?" + query.Encode()})
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = guests
+	data["search"] = search
+	data["tags"] = models.GuestTags
+	data["tag_labels"] = models.GuestTagLabels
+	data["pages"] = pages
+
+	intMap := make(map[string]int)
+	intMap["total"] = total
+
+	render.Template(w, r, "admin-guests.page.tmpl.html", &models.TemplateData{
+		Form:   form,
+		Data:   data,
+		IntMap: intMap,
+	})
+}
+
+// AdminShowGuest shows the profile of a guest: their details, notes and tags, what they spent, their stays
+// and the guests that may be duplicates of them. A guest that was merged into another leads to that guest.
+func (repository *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	guest, ok := repository.guestFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if guest.MergedIntoID != 0 {
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", guest.MergedIntoID), http.StatusSeeOther)
+		return
+	}
+
+	repository.renderGuest(w, r, guest, forms.New(nil))
+}
+
+// AdminPostGuest updates the name, phone, notes and tags of a guest
+func (repository *Repository) AdminPostGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, ok := repository.guestFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.MaxLength("first_name", 255)
+	form.MaxLength("last_name", 255)
+	form.MaxLength("notes", maxGuestNotesLength)
+	if form.Has("phone") {
+		form.IsPhone("phone")
+	}
+
+	guest.FirstName = strings.TrimSpace(form.Get("first_name"))
+	guest.LastName = strings.TrimSpace(form.Get("last_name"))
+	guest.Phone = strings.TrimSpace(form.Get("phone"))
+	guest.Notes = strings.TrimSpace(form.Get("notes"))
+	guest.Tags = nil
+	for _, tag := range r.PostForm["tags"] {
+		if !contains(models.GuestTags, tag) {
+			form.Errors.Add("tags", "Unknown tag")
+			continue
+		}
+		guest.Tags = append(guest.Tags, tag)
+	}
+
+	if !form.Valid() {
+		repository.renderGuest(w, r, guest, form)
+		return
+	}
+
+	err = repository.DB.UpdateGuest(r.Context(), guest)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Guest saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", guest.ID), http.StatusSeeOther)
+}
+
+// AdminMergeGuest merges a duplicate guest into the guest of the URL, which keeps the reservations, tags
+// and notes of both
+func (repository *Repository) AdminMergeGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("duplicate_id")
+	if !form.Valid() || !form.InRange("duplicate_id", 1, math.MaxInt32) {
+		repository.App.Session.Put(r.Context(), "error", "Pick the guest to merge")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = repository.DB.MergeGuests(r.Context(), id, form.Int("duplicate_id"))
+	if errors.Is(err, dbrepo.ErrGuestMerged) {
+		repository.App.Session.Put(r.Context(), "error", "These guests can't be merged, one was already merged or they are the same guest")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Guests merged")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// guestFromURL returns the guest whose id is in the URL, or writes the error response and returns false
+// when there is no such guest
+func (repository *Repository) guestFromURL(w http.ResponseWriter, r *http.Request) (models.Guest, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Guest{}, false
+	}
+
+	guest, err := repository.DB.GetGuestByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return guest, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return guest, false
+	}
+
+	return guest, true
+}
+
+// renderGuest shows the profile of a guest with the form to edit it, their stays, latest arrival first, and
+// the guests that may be duplicates of them
+func (repository *Repository) renderGuest(w http.ResponseWriter, r *http.Request, guest models.Guest, form *forms.Form) {
+	var stays []models.Reservation
+	err := repository.DB.EachReservation(r.Context(), models.ReservationQuery{
+		GuestID: guest.ID,
+		Sort:    models.SortByArrival,
+		Desc:    true,
+	}, func(res models.Reservation) error {
+		stays = append(stays, res)
+		return nil
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	duplicates, err := repository.DB.GetDuplicateGuests(r.Context(), guest)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["stays"] = stays
+	data["duplicates"] = duplicates
+	data["tags"] = models.GuestTags
+	data["tag_labels"] = models.GuestTagLabels
+
+	render.Template(w, r, "admin-guest.page.tmpl.html", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// adminGuestsTests is the data for the AdminGuests handler tests
+var adminGuestsTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+}{
+	{"all", "/admin/guests", http.StatusOK},
+	{"search", "/admin/guests?q=smith.com", http.StatusOK},
+	{"tag", "/admin/guests?tag=vip", http.StatusOK},
+	{"unknown-tag", "/admin/guests?tag=gold", http.StatusOK},
+	{"past-the-last-page", "/admin/guests?page=9", http.StatusOK},
+	{"database-fails", "/admin/guests?q=fail", http.StatusInternalServerError},
+}
+
+// TestAdminGuests tests the AdminGuests handler
+func TestAdminGuests(t *testing.T) {
+	for _, e := range adminGuestsTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminGuests)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// adminShowGuestTests is the data for the AdminShowGuest handler tests
+var adminShowGuestTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"valid", "1", http.StatusOK, ""},
+	{"merged", "3", http.StatusSeeOther, "/admin/guests/1"},
+	{"not-found", "50", http.StatusNotFound, ""},
+	{"database-fails", "99", http.StatusInternalServerError, ""},
+	{"invalid-id", "x", http.StatusBadRequest, ""},
+}
+
+// TestAdminShowGuest tests the AdminShowGuest handler
+func TestAdminShowGuest(t *testing.T) {
+	for _, e := range adminShowGuestTests {
+		req, _ := http.NewRequest("GET", "/admin/guests/"+e.id, nil)
+		req = req.WithContext(getCtx(req))
+		req = withURLParams(req, map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminPostGuestTests is the data for the AdminPostGuest handler tests
+var adminPostGuestTests = []struct {
+	name               string
+	id                 string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		"valid",
+		"1",
+		url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"phone":      {"555-555-5555"},
+			"notes":      {"Allergic to feathers"},
+			"tags":       {"vip", "do-not-rent"},
+		},
+		http.StatusSeeOther,
+		"/admin/guests/1",
+	},
+	{"no-phone-nor-tags", "2", url.Values{"first_name": {"John"}, "last_name": {"Smith"}}, http.StatusSeeOther, "/admin/guests/2"},
+	{"invalid-phone", "1", url.Values{"phone": {"not a phone"}}, http.StatusOK, ""},
+	{"unknown-tag", "1", url.Values{"tags": {"gold"}}, http.StatusOK, ""},
+	{"notes-too-long", "1", url.Values{"notes": {strings.Repeat("a", maxGuestNotesLength+1)}}, http.StatusOK, ""},
+	{"not-found", "50", url.Values{}, http.StatusNotFound, ""},
+	{"database-fails", "1", url.Values{"notes": {"fail"}}, http.StatusInternalServerError, ""},
+}
+
+// TestAdminPostGuest tests the AdminPostGuest handler
+func TestAdminPostGuest(t *testing.T) {
+	for _, e := range adminPostGuestTests {
+		req, _ := http.NewRequest("POST", "/admin/guests/"+e.id, strings.NewReader(e.postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req = withURLParams(req, map[string]string{"id": e.id})
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminMergeGuestTests is the data for the AdminMergeGuest handler tests
+var adminMergeGuestTests = []struct {
+	name               string
+	id                 string
+	duplicateID        string
+	expectedStatusCode int
+	expectedFlash      string
+	expectedError      string
+}{
+	{"valid", "1", "2", http.StatusSeeOther, "Guests merged", ""},
+	{"already-merged", "1", "3", http.StatusSeeOther, "", "These guests can't be merged, one was already merged or they are the same guest"},
+	{"same-guest", "1", "1", http.StatusSeeOther, "", "These guests can't be merged, one was already merged or they are the same guest"},
+	{"no-duplicate", "1", "", http.StatusSeeOther, "", "Pick the guest to merge"},
+	{"invalid-duplicate", "1", "x", http.StatusSeeOther, "", "Pick the guest to merge"},
+	{"invalid-id", "x", "2", http.StatusBadRequest, "", ""},
+	{"database-fails", "1", "99", http.StatusInternalServerError, "", ""},
+}
+
+// TestAdminMergeGuest tests the AdminMergeGuest handler
+func TestAdminMergeGuest(t *testing.T) {
+	for _, e := range adminMergeGuestTests {
+		postedData := url.Values{"duplicate_id": {e.duplicateID}}
+
+		req, _ := http.NewRequest("POST", "/admin/guests/"+e.id+"/merge", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req = withURLParams(req, map[string]string{"id": e.id})
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminMergeGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.expectedStatusCode != http.StatusSeeOther {
+			continue
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != "/admin/guests/"+e.id {
+			t.Errorf("failed %s: expected location /admin/guests/%s, but got location %s", e.name, e.id, actualLoc.String())
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := session.GetString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
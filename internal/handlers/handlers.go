@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/crislainesc/bookings/internal/cancellation"
 	"github.com/crislainesc/bookings/internal/config"
 	"github.com/crislainesc/bookings/internal/driver"
 	"github.com/crislainesc/bookings/internal/forms"
 	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
 	"github.com/crislainesc/bookings/internal/models"
 	"github.com/crislainesc/bookings/internal/render"
 	"github.com/crislainesc/bookings/internal/repository"
@@ -21,9 +26,13 @@ import (
 
 var (
 	Repo       *Repository
-	dateLayout = "2006-01-02"
+	dateLayout = forms.DateLayout
 )
 
+// calendarDateLayout is the layout of the dates in the names of the reservations calendar checkboxes, which
+// don't pad the day of the month; it parses padded days as well
+const calendarDateLayout = "2006-01-2"
+
 type Repository struct {
 	App *config.AppConfig
 	DB  repository.DatabaseRepo
@@ -35,6 +44,46 @@ type JsonResponse struct {
 	RoomID    string `json:"room_id"`
 	StartDate string `json:"start_date"`
 	EndDate   string `json:"end_date"`
+	Adults    int    `json:"adults"`
+	Children  int    `json:"children"`
+}
+
+const (
+	// maxGuests is the largest party the availability search accepts
+	maxGuests = 20
+	// maxStayNights is the longest stay a search or reservation can ask for, whatever the booking rules
+	maxStayNights = 365
+	// roomsPerPage is the number of rooms on each page of availability results
+	roomsPerPage = 10
+)
+
+var errInvalidGuests = errors.New("invalid number of guests")
+
+// parseGuests reads the number of adults and children of a search from two form fields.
+// Missing values mean one adult and no children.
+func parseGuests(form *forms.Form, adultsField, childrenField string) (int, int, error) {
+	adults, children := 1, 0
+
+	if form.Has(adultsField) {
+		if !form.InRange(adultsField, 1, maxGuests) {
+			return 0, 0, errInvalidGuests
+		}
+		adults = form.Int(adultsField)
+	}
+
+	if form.Has(childrenField) {
+		if !form.InRange(childrenField, 0, maxGuests) {
+			return 0, 0, errInvalidGuests
+		}
+		children = form.Int(childrenField)
+	}
+
+	if adults+children > maxGuests {
+		form.Errors.Add(childrenField, fmt.Sprintf("Parties are limited to %d guests", maxGuests))
+		return 0, 0, errInvalidGuests
+	}
+
+	return adults, children, nil
 }
 
 func NewRepository(app *config.AppConfig, db *driver.Database) *Repository {
@@ -76,7 +125,7 @@ func (repository *Repository) Reservation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	room, err := repository.DB.GetRoomByID(reservation.RoomID)
+	room, err := repository.DB.GetRoomByID(r.Context(), reservation.RoomID)
 
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "can't find room")
@@ -97,11 +146,39 @@ func (repository *Repository) Reservation(w http.ResponseWriter, r *http.Request
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	if reservation.HoldID != 0 {
+		stringMap["hold_expires"] = reservation.HoldExpiresAt.Format(time.RFC3339)
+	}
+
+	policy, err := repository.cancellationPolicy(r.Context(), room)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't get the cancellation policy")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	stringMap["cancellation"] = cancellation.Terms(policy).In(i18n.FromContext(r.Context()))
+
+	// show the booking rules the stay breaks before the guest fills in the form
+	form := forms.New(nil)
+	err = repository.checkBookingRules(r.Context(), form, reservation.RoomID, reservation.StartDate, reservation.EndDate)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't check booking rules")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// with online payments the guest is told what they pay when booking
+	intMap := make(map[string]int)
+	if repository.App.Payments != nil {
+		intMap["total"] = room.Price * reservation.Nights()
+		intMap["due"] = room.AmountDue(intMap["total"])
+	}
 
 	render.Template(w, r, "make-reservation.page.tmpl.html", &models.TemplateData{
 		Data:      data,
-		Form:      forms.New(nil),
+		Form:      form,
 		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
@@ -114,110 +191,215 @@ func (repository *Repository) PostReservation(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	sd := r.Form.Get("start_date")
-	ed := r.Form.Get("end_date")
+	form := forms.New(r.PostForm)
 
-	startDate, err := time.Parse(dateLayout, sd)
-	if err != nil {
+	sd := form.Get("start_date")
+	ed := form.Get("end_date")
+
+	if !form.IsDate("start_date") {
 		repository.App.Session.Put(r.Context(), "error", "can't parse start date")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	endDate, err := time.Parse(dateLayout, ed)
-	if err != nil {
+	if !form.IsDate("end_date") {
 		repository.App.Session.Put(r.Context(), "error", "can't parse end date")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	startDate, endDate := form.Date("start_date"), form.Date("end_date")
 
-	roomID, err := strconv.Atoi(r.Form.Get("room_id"))
-
-	if err != nil {
+	if !form.IsInt("room_id") {
 		repository.App.Session.Put(r.Context(), "error", "can't find room")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	roomID := form.Int("room_id")
 
-	room, err := repository.DB.GetRoomByID(roomID)
+	room, err := repository.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "can't find room")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	adults, children, err := parseGuests(form, "adults", "children")
+	if err != nil || !room.Fits(adults, children) {
+		repository.App.Session.Put(r.Context(), "error", "the room can't fit this many guests")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	reservation := models.Reservation{
-		FirstName: r.Form.Get("first_name"),
-		LastName:  r.Form.Get("last_name"),
-		Phone:     r.Form.Get("phone"),
-		Email:     r.Form.Get("email"),
-		StartDate: startDate,
-		EndDate:   endDate,
-		RoomID:    roomID,
-		Room:      room,
+		FirstName:       form.Get("first_name"),
+		LastName:        form.Get("last_name"),
+		Phone:           form.Get("phone"),
+		Email:           form.Get("email"),
+		StartDate:       startDate,
+		EndDate:         endDate,
+		RoomID:          roomID,
+		Adults:          adults,
+		Children:        children,
+		Room:            room,
+		SpecialRequests: form.Get("special_requests"),
+	}
+	// rooms have one flat nightly price, so the total is the whole quote the invoice itemises the nights from
+	reservation.Total = room.Price * reservation.Nights()
+
+	// the hold the guest got when picking the room is kept as long as they book the same room and dates, and
+	// released otherwise so it doesn't keep the room from anybody else
+	held, _ := repository.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if held.HoldID != 0 {
+		if held.RoomID == roomID && held.StartDate.Equal(startDate) && held.EndDate.Equal(endDate) {
+			reservation.HoldID, reservation.HoldExpiresAt = held.HoldID, held.HoldExpiresAt
+		} else if err := repository.DB.DeleteHold(r.Context(), held.HoldID); err != nil {
+			repository.App.ErrorLog.Println(err)
+		}
 	}
 
 	repository.App.Session.Put(r.Context(), "reservation", reservation)
 
-	form := forms.New(r.PostForm)
-
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
+	form.MaxLength("first_name", 255)
+	form.MaxLength("last_name", 255)
 	form.IsEmail("email")
+	if form.Has("phone") {
+		form.IsPhone("phone")
+	}
+	form.MaxLength("special_requests", 1000)
+
+	err = repository.checkBookingRules(r.Context(), form, roomID, startDate, endDate)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't check booking rules")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if form.Has("promo_code") {
+		err = repository.applyPromoCode(r.Context(), form, &reservation)
+		if err != nil {
+			repository.App.Session.Put(r.Context(), "error", "can't check the promo code")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
 
 	if !form.Valid() {
-		data := make(map[string]interface{})
-		data["reservation"] = reservation
-		render.Template(w, r, "make-reservation.page.tmpl.html", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+		repository.renderReservationForm(w, r, reservation, form, sd, ed)
 		return
 	}
 
-	newReservationID, err := repository.DB.InsertReservation(reservation)
+	// with online payments the room is only held until the reservation is paid, unless there is nothing to pay
+	reservation.Status = models.ReservationConfirmed
+	needsPayment := repository.App.Payments != nil && reservation.Total > 0
+	if needsPayment {
+		reservation.Status = models.ReservationPending
+		reservation.ExpiresAt = time.Now().Add(paymentHoldTime)
+	}
+
+	reservation.CancelToken, err = newCancelToken()
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "can't create new reservation")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     startDate,
-		EndDate:       endDate,
-		RoomID:        roomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	// a guest booking without a hold of the room and dates gets one first, so the room is only booked when
+	// it is free
+	if reservation.HoldID == 0 {
+		err = repository.holdRoom(r.Context(), &reservation)
+		if errors.Is(err, dbrepo.ErrRoomUnavailable) {
+			repository.App.Session.Put(r.Context(), "error", "the room is no longer available for these dates")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			repository.App.Session.Put(r.Context(), "error", "can't create new reservation")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		repository.App.Session.Put(r.Context(), "reservation", reservation)
+	}
+
+	newReservationID, err := repository.DB.InsertReservation(r.Context(), reservation)
+	if errors.Is(err, dbrepo.ErrPromoCodeUnavailable) || errors.Is(err, dbrepo.ErrPromoCodeAlreadyUsed) {
+		form.Errors.Add("promo_code", promoCodeError(err))
+		repository.renderReservationForm(w, r, reservation, form, sd, ed)
+		return
+	}
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't create new reservation")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	err = repository.DB.InsertRoomRestriction(restriction)
+	holdID := reservation.HoldID
+	err = repository.convertHold(r.Context(), &reservation, newReservationID)
 	if err != nil {
+		_ = repository.DB.DeleteReservation(r.Context(), newReservationID)
+		if errors.Is(err, dbrepo.ErrRoomUnavailable) {
+			repository.App.Session.Put(r.Context(), "error", "the hold on the room expired and somebody else booked it")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
 		repository.App.Session.Put(r.Context(), "error", "can't finish reservation")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// send notifications
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "go_reservation@email.com",
-		Subject:  "Reservation successfully",
-		Content:  "<p>Hello, your reservation is completed</p>",
-		Template: "base.html",
+	// a room offered from the waitlist is off the guest's waitlist once booked
+	err = repository.DB.BookWaitlistOffer(r.Context(), holdID)
+	if err != nil {
+		repository.App.ErrorLog.Println(err)
 	}
+
+	reservation.ID = newReservationID
+
+	if needsPayment {
+		checkoutURL, err := repository.startCheckout(r.Context(), reservation)
+		if err != nil {
+			// release the room so the guest can try again
+			repository.App.ErrorLog.Println(err)
+			_ = repository.DB.DeleteReservation(r.Context(), newReservationID)
+			repository.App.Session.Put(r.Context(), "error", "can't start the payment, please try again")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		repository.App.Session.Put(r.Context(), "reservation", reservation)
+		http.Redirect(w, r, checkoutURL, http.StatusSeeOther)
+		return
+	}
+
+	// send notifications
+	msg := repository.confirmationMail(r.Context(), reservation, "Reservation successfully", "Hello, your reservation is completed")
 	repository.App.MailChan <- msg
 
 	repository.App.Session.Put(r.Context(), "reservation", reservation)
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
 
-// Generals is the handler for the generals page
-func (repository *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.tmpl.html", &models.TemplateData{})
-}
+// renderReservationForm shows the reservation form again with the errors of what the guest posted
+func (repository *Repository) renderReservationForm(w http.ResponseWriter, r *http.Request, reservation models.Reservation,
+	form *forms.Form, sd, ed string) {
+	data := make(map[string]interface{})
+	data["reservation"] = reservation
 
-// Majors is the handler for the majors page
-func (repository *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl.html", &models.TemplateData{})
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = sd
+	stringMap["end_date"] = ed
+	if reservation.HoldID != 0 {
+		stringMap["hold_expires"] = reservation.HoldExpiresAt.Format(time.RFC3339)
+	}
+	if policy, err := repository.cancellationPolicy(r.Context(), reservation.Room); err == nil {
+		stringMap["cancellation"] = cancellation.Terms(policy).In(i18n.FromContext(r.Context()))
+	}
+
+	render.Template(w, r, "make-reservation.page.tmpl.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
 }
 
 // Availability is the handler for the search availability page
@@ -234,32 +416,87 @@ func (repository *Repository) PostAvailability(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
+	form := forms.New(r.PostForm)
+	form.Locale = i18n.FromContext(r.Context())
 
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
-	if err != nil {
+	start := form.Get("start")
+	end := form.Get("end")
+
+	if !form.IsDate("start") {
 		repository.App.Session.Put(r.Context(), "error", "can't parse start date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
+	if !form.DateRange("start", "end", maxStayNights) {
 		repository.App.Session.Put(r.Context(), "error", "can't parse end date!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	startDate, endDate := form.Date("start"), form.Date("end")
+
+	adults, children, err := parseGuests(form, "adults", "children")
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "invalid number of guests")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 
-	rooms, err := repository.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	err = repository.checkBookingRules(r.Context(), form, 0, startDate, endDate)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't check booking rules")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if !form.Valid() {
+		repository.App.Session.Put(r.Context(), "error", dateError(form))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	page := 1
+	if form.Has("page") && form.InRange("page", 1, math.MaxInt32) {
+		page = form.Int("page")
+	}
+
+	search := models.AvailabilityQuery{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+		Sort:      form.Get("sort"),
+		Page:      page,
+		PerPage:   roomsPerPage,
+	}
+	if search.Sort == "" {
+		search.Sort = models.SortByPrice
+	}
+
+	// a room the guest held earlier is free for them again
+	repository.releaseHold(r.Context())
+
+	rooms, total, err := repository.DB.SearchAvailabilityForAllRooms(r.Context(), search)
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	if len(rooms) == 0 {
-		// no availability
+	if total == 0 {
+		// guests can wait for a room to free up, unless no room is big enough for the party
+		activeRooms, err := repository.DB.GetActiveRooms(r.Context())
+		if err != nil {
+			repository.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		for _, room := range activeRooms {
+			if room.Fits(adults, children) {
+				http.Redirect(w, r, waitlistURL(search), http.StatusSeeOther)
+				return
+			}
+		}
+
 		repository.App.Session.Put(r.Context(), "error", "No availability")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
@@ -267,15 +504,34 @@ func (repository *Repository) PostAvailability(w http.ResponseWriter, r *http.Re
 
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["search"] = search
+
+	intMap := make(map[string]int)
+	intMap["total"] = total
+	intMap["pages"] = (total + roomsPerPage - 1) / roomsPerPage
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = start
+	stringMap["end"] = end
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
 	}
 	repository.App.Session.Put(r.Context(), "reservation", res)
 
+	// search results can't be reloaded from a link, so the currency is picked in the sort form instead of the menu
+	money := repository.priceDisplay(r)
+	data["currencies"] = money.Options
+	money.Options = nil
+
 	render.Template(w, r, "choose-room.page.tmpl.html", &models.TemplateData{
-		Data: data,
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+		Money:     money,
 	})
 }
 
@@ -295,16 +551,65 @@ func (repository *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
+	form := forms.New(r.PostForm)
+	form.Locale = i18n.FromContext(r.Context())
 
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	sd := form.Get("start")
+	ed := form.Get("end")
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	if !form.DateRange("start", "end", maxStayNights) || !form.IsInt("room_id") {
+		resp := JsonResponse{
+			OK:      false,
+			Message: "Invalid dates or room",
+		}
 
-	available, err := repository.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+	startDate, endDate := form.Date("start"), form.Date("end")
+	roomID := form.Int("room_id")
+
+	adults, children, err := parseGuests(form, "adults", "children")
+	if err != nil {
+		resp := JsonResponse{
+			OK:      false,
+			Message: "Invalid number of guests",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	err = repository.checkBookingRules(r.Context(), form, roomID, startDate, endDate)
+	if err != nil {
+		resp := JsonResponse{
+			OK:      false,
+			Message: "Error querying database",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	if !form.Valid() {
+		resp := JsonResponse{
+			OK:      false,
+			Message: dateError(form),
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	available, err := repository.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID, adults, children)
 	if err != nil {
 		// got a database error, so return appropriate json
 		resp := JsonResponse{
@@ -323,6 +628,8 @@ func (repository *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Re
 		StartDate: sd,
 		EndDate:   ed,
 		RoomID:    strconv.Itoa(roomID),
+		Adults:    adults,
+		Children:  children,
 	}
 
 	out, _ := json.MarshalIndent(resp, "", "     ")
@@ -345,8 +652,7 @@ func (repository *Repository) ReservationSummary(w http.ResponseWriter, r *http.
 		return
 	}
 
-	repository.App.Session.Remove(r.Context(), "reservation")
-	room, err := repository.DB.GetRoomByID(reservation.RoomID)
+	room, err := repository.DB.GetRoomByID(r.Context(), reservation.RoomID)
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "Can't get room name")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -356,6 +662,29 @@ func (repository *Repository) ReservationSummary(w http.ResponseWriter, r *http.
 	reservation.Room.RoomName = room.RoomName
 
 	data := make(map[string]interface{})
+
+	// the payment may have been confirmed since the reservation was put in the session
+	if reservation.ID != 0 && repository.App.Payments != nil {
+		current, err := repository.DB.GetReservationByID(r.Context(), reservation.ID)
+		if err == nil && current.Status != "" {
+			reservation.Status = current.Status
+			reservation.ExpiresAt = current.ExpiresAt
+		}
+
+		reservationPayments, err := repository.DB.GetPaymentsForReservation(r.Context(), reservation.ID)
+		if err != nil {
+			repository.App.Session.Put(r.Context(), "error", "Can't get payments")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		data["payments"] = reservationPayments
+	}
+
+	// a guest coming back from the payment page sees the summary again until the reservation is paid
+	if reservation.Status != models.ReservationPending {
+		repository.App.Session.Remove(r.Context(), "reservation")
+	}
+
 	data["reservation"] = reservation
 
 	sd := reservation.StartDate.Format("2006-01-02")
@@ -389,6 +718,18 @@ func (repository *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request)
 
 	res.RoomID = roomID
 
+	err = repository.holdRoom(r.Context(), &res)
+	if errors.Is(err, dbrepo.ErrRoomUnavailable) {
+		repository.App.Session.Put(r.Context(), "error", "somebody else just booked this room, please choose another")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't hold the room")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
 	repository.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
@@ -396,17 +737,25 @@ func (repository *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request)
 
 // BookRoom takes URL parameters, builds a sessional variable, and takes user to make res screen
 func (repository *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+	form := forms.New(r.URL.Query())
+	if !form.IsInt("id") || !form.DateRange("s", "e", maxStayNights) {
+		repository.App.Session.Put(r.Context(), "error", "invalid booking link")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	roomID := form.Int("id")
+	startDate, endDate := form.Date("s"), form.Date("e")
 
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	adults, children, err := parseGuests(form, "a", "c")
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "invalid number of guests")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
 	var res models.Reservation
 
-	room, err := repository.DB.GetRoomByID(roomID)
+	room, err := repository.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "Can't get room from db!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -417,6 +766,22 @@ func (repository *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	res.RoomID = roomID
 	res.StartDate = startDate
 	res.EndDate = endDate
+	res.Adults = adults
+	res.Children = children
+
+	repository.releaseHold(r.Context())
+
+	err = repository.holdRoom(r.Context(), &res)
+	if errors.Is(err, dbrepo.ErrRoomUnavailable) {
+		repository.App.Session.Put(r.Context(), "error", "somebody else just booked this room for these dates")
+		http.Redirect(w, r, "/rooms/"+room.Slug, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't hold the room")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
 	repository.App.Session.Put(r.Context(), "reservation", res)
 
@@ -451,7 +816,7 @@ func (repository *Repository) PostLogin(w http.ResponseWriter, r *http.Request)
 		render.Template(w, r, "login.page.tmpl.html", &models.TemplateData{Form: form})
 		return
 	}
-	id, _, err := repository.DB.Authenticate(email, password)
+	id, _, err := repository.DB.Authenticate(r.Context(), email, password)
 
 	if err != nil {
 		repository.App.Session.Put(r.Context(), "error", "Invalid login credentials")
@@ -471,45 +836,12 @@ func (repository *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-func (repository *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl.html", &models.TemplateData{})
-}
-
-func (repository *Repository) AdminNewReservation(w http.ResponseWriter, r *http.Request) {
-	reservations, err := repository.DB.GetAllNewReservations()
-
-	if err != nil {
-		helpers.ServerError(w, err)
-	}
-
-	println(reservations)
-
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-
-	render.Template(w, r, "admin-new-reservation.page.tmpl.html", &models.TemplateData{Data: data})
-}
-
-func (repository *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := repository.DB.GetAllReservations()
-
-	if err != nil {
-		helpers.ServerError(w, err)
-	}
-
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-
-	render.Template(w, r, "admin-all-reservations.page.tmpl.html", &models.TemplateData{Data: data})
-}
-
 func (repository *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 
-	if r.URL.Query().Get("y") != "" {
-		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
-		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	form := forms.New(r.URL.Query())
+	if form.Has("y") && form.InRange("y", 1, 9999) && form.InRange("m", 1, 12) {
+		now = time.Date(form.Int("y"), time.Month(form.Int("m")), 1, 0, 0, 0, 0, time.UTC)
 	}
 
 	data := make(map[string]interface{})
@@ -541,7 +873,7 @@ func (repository *Repository) AdminReservationsCalendar(w http.ResponseWriter, r
 	intMap := make(map[string]int)
 	intMap["days_in_month"] = lastOfMonth.Day()
 
-	rooms, err := repository.DB.GetAllRooms()
+	rooms, err := repository.DB.GetAllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -558,7 +890,7 @@ func (repository *Repository) AdminReservationsCalendar(w http.ResponseWriter, r
 			blockMap[d.Format("2006-01-02")] = 0
 		}
 
-		restrictions, err := repository.DB.GetRestrictionsForRoomByDate(room.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := repository.DB.GetRestrictionsForRoomByDate(r.Context(), room.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
@@ -608,14 +940,63 @@ func (repository *Repository) AdminShowReservation(w http.ResponseWriter, r *htt
 	stringMap["year"] = year
 
 	// get reservation from the database
-	res, err := repository.DB.GetReservationByID(id)
+	res, err := repository.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	reservationPayments, err := repository.DB.GetPaymentsForReservation(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	refunds, err := repository.DB.GetRefundsForReservation(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	issued, ok, err := repository.issuedInvoice(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if ok {
+		stringMap["invoice"] = issued.Reference()
+	}
+
+	// the tags of the guest warn staff about VIPs and guests not to rent to again
+	var guest *models.Guest
+	if res.GuestID != 0 {
+		g, err := repository.DB.GetGuestByID(r.Context(), res.GuestID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, err)
+			return
+		}
+		if err == nil {
+			guest = &g
+		}
+	}
+
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["guest"] = guest
+	data["payments"] = reservationPayments
+	data["refunds"] = refunds
+	data["invoice"] = ok || invoiceable(res)
+
+	// show what cancelling costs before the reservation is cancelled
+	if res.Cancellable() {
+		policy, quote, err := repository.quoteCancellation(r.Context(), res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		stringMap["cancellation"] = cancellation.Terms(policy).In(i18n.Default)
+		data["quote"] = quote
+	}
 
 	render.Template(w, r, "admin-reservations-show.page.tmpl.html", &models.TemplateData{
 		StringMap: stringMap,
@@ -644,18 +1025,45 @@ func (repository *Repository) AdminPostShowReservation(w http.ResponseWriter, r
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
 
-	res, err := repository.DB.GetReservationByID(id)
+	res, err := repository.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone_number")
+	form := forms.New(r.PostForm)
+
+	res.FirstName = form.Get("first_name")
+	res.LastName = form.Get("last_name")
+	res.Email = form.Get("email")
+	res.Phone = form.Get("phone")
+	res.SpecialRequests = form.Get("special_requests")
+
+	form.Required("first_name", "last_name", "email")
+	form.MaxLength("first_name", 255)
+	form.MaxLength("last_name", 255)
+	form.IsEmail("email")
+	if form.Has("phone") {
+		form.IsPhone("phone")
+	}
+	form.MaxLength("special_requests", 1000)
+
+	if !form.Valid() {
+		stringMap["month"] = form.Get("month")
+		stringMap["year"] = form.Get("year")
+
+		data := make(map[string]interface{})
+		data["reservation"] = res
+
+		render.Template(w, r, "admin-reservations-show.page.tmpl.html", &models.TemplateData{
+			StringMap: stringMap,
+			Data:      data,
+			Form:      form,
+		})
+		return
+	}
 
-	err = repository.DB.UpdateReservation(res)
+	err = repository.DB.UpdateReservation(r.Context(), res)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -674,12 +1082,17 @@ func (repository *Repository) AdminPostShowReservation(w http.ResponseWriter, r
 }
 
 func (repository *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
 	src := chi.URLParam(r, "src")
 
-	err := repository.DB.UpdateProcessedForReservation(id, 1)
+	err = repository.DB.UpdateProcessedForReservation(r.Context(), id, 1)
 	if err != nil {
 		helpers.ServerError(w, err)
+		return
 	}
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
@@ -693,10 +1106,29 @@ func (repository *Repository) AdminProcessReservation(w http.ResponseWriter, r *
 }
 
 func (repository *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
 	src := chi.URLParam(r, "src")
 
-	_ = repository.DB.DeleteReservation(id)
+	res, err := repository.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = repository.DB.DeleteReservation(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// a reservation that still held its room frees it for the guests waiting for those dates
+	if res.Cancellable() {
+		repository.offerFreedNights(r.Context(), res)
+	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
@@ -710,6 +1142,32 @@ func (repository *Repository) AdminDeleteReservation(w http.ResponseWriter, r *h
 	}
 }
 
+// parseBlockName returns the room and night of a new block from the name of its calendar checkbox,
+// add_block_{room id}_{date}, and false when the name is malformed or the room isn't one of rooms
+func parseBlockName(name string, rooms []models.Room) (models.RoomRestriction, bool) {
+	exploded := strings.Split(name, "_")
+	if len(exploded) != 4 {
+		return models.RoomRestriction{}, false
+	}
+
+	roomID, err := strconv.Atoi(exploded[2])
+	if err != nil {
+		return models.RoomRestriction{}, false
+	}
+
+	night, err := time.Parse(calendarDateLayout, exploded[3])
+	if err != nil {
+		return models.RoomRestriction{}, false
+	}
+
+	for _, room := range rooms {
+		if room.ID == roomID {
+			return models.RoomRestriction{RoomID: roomID, StartDate: night, EndDate: night}, true
+		}
+	}
+	return models.RoomRestriction{}, false
+}
+
 func (repository *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -717,23 +1175,41 @@ func (repository *Repository) AdminPostReservationsCalendar(w http.ResponseWrite
 		return
 	}
 
-	year, _ := strconv.Atoi(r.Form.Get("y"))
-	month, _ := strconv.Atoi(r.Form.Get("m"))
+	form := forms.New(r.PostForm)
+
+	// go back to the month the calendar was showing, or the current one when it wasn't posted
+	year, month := time.Now().Year(), int(time.Now().Month())
+	if form.InRange("y", 1, 9999) && form.InRange("m", 1, 12) {
+		year, month = form.Int("y"), form.Int("m")
+	}
 
 	// process blocks
-	rooms, err := repository.DB.GetAllRooms()
+	rooms, err := repository.DB.GetAllRooms(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	form := forms.New(r.PostForm)
+	// check every new block before changing anything, a malformed one means the form was tampered with
+	var newBlocks []models.RoomRestriction
+	for name := range r.PostForm {
+		if !strings.HasPrefix(name, "add_block") {
+			continue
+		}
+		block, ok := parseBlockName(name, rooms)
+		if !ok {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		newBlocks = append(newBlocks, block)
+	}
 
 	for _, x := range rooms {
 		// Get the block map from the session. Loop through entire map, if we have an entry in the map
 		// that does not exist in our posted data, and if the restriction id > 0, then it is a block we need to
 		// remove.
-		curMap := repository.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
+		// a room added since the calendar was shown has no map, and no blocks to remove
+		curMap, _ := repository.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
 		for name, value := range curMap {
 			// ok will be false if the value is not in the map
 			if val, ok := curMap[name]; ok {
@@ -741,8 +1217,21 @@ func (repository *Repository) AdminPostReservationsCalendar(w http.ResponseWrite
 				// the rest are just placeholders for days without blocks
 				if val > 0 {
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
+						night, err := time.Parse(calendarDateLayout, name)
+						if err != nil {
+							helpers.ServerError(w, err)
+							return
+						}
+
 						// delete the restriction by id
-						err := repository.DB.DeleteBlockByID(value)
+						err = repository.DB.DeleteBlockByID(r.Context(), value)
+						if err != nil {
+							repository.App.ErrorLog.Println(err)
+							continue
+						}
+
+						// the night the block covered may be what a waitlisted guest was waiting for
+						_, err = repository.notifyWaitlist(r.Context(), x.ID, night, night.AddDate(0, 0, 1))
 						if err != nil {
 							repository.App.ErrorLog.Println(err)
 						}
@@ -753,16 +1242,10 @@ func (repository *Repository) AdminPostReservationsCalendar(w http.ResponseWrite
 	}
 
 	// now handle new blocks
-	for name := range r.PostForm {
-		if strings.HasPrefix(name, "add_block") {
-			exploded := strings.Split(name, "_")
-			roomID, _ := strconv.Atoi(exploded[2])
-			t, _ := time.Parse("2006-01-2", exploded[3])
-			// insert a new block
-			err := repository.DB.InsertBlockForRoom(roomID, t)
-			if err != nil {
-				repository.App.ErrorLog.Println(err)
-			}
+	for _, block := range newBlocks {
+		err := repository.DB.InsertBlockForRoom(r.Context(), block.RoomID, block.StartDate)
+		if err != nil {
+			repository.App.ErrorLog.Println(err)
 		}
 	}
 
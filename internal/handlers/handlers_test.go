@@ -27,6 +27,9 @@ var theTests = []struct {
 	{"about", "/about", "GET", http.StatusOK},
 	{"gq", "/generals-quarters", "GET", http.StatusOK},
 	{"ms", "/majors-suite", "GET", http.StatusOK},
+	{"rooms", "/rooms", "GET", http.StatusOK},
+	{"room", "/rooms/generals-quarters", "GET", http.StatusOK},
+	{"non-existent room", "/rooms/broom-closet", "GET", http.StatusNotFound},
 	{"sa", "/search-availability", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
 	{"non-existent", "/green/eggs/and/ham", "GET", http.StatusNotFound},
@@ -38,6 +41,9 @@ var theTests = []struct {
 	{"show res", "/admin/reservations/new/1/show", "GET", http.StatusOK},
 	{"show res cal", "/admin/reservations-calendar", "GET", http.StatusOK},
 	{"show res cal with params", "/admin/reservations-calendar?y=2020&m=1", "GET", http.StatusOK},
+	{"admin rooms", "/admin/rooms", "GET", http.StatusOK},
+	{"admin new room", "/admin/rooms/new", "GET", http.StatusOK},
+	{"admin show room", "/admin/rooms/1", "GET", http.StatusOK},
 }
 
 // TestHandlers tests all routes that don't require extra tests (gets)
@@ -161,6 +167,23 @@ var postReservationTests = []struct {
 		expectedHTML:         "",
 		expectedLocation:     "/reservation-summary",
 	},
+	{
+		name: "too-many-guests",
+		postedData: url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+			"adults":     {"2"},
+			"children":   {"2"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedHTML:         "",
+		expectedLocation:     "/search-availability",
+	},
 	{
 		name:                 "missing-post-body",
 		postedData:           nil,
@@ -228,6 +251,52 @@ var postReservationTests = []struct {
 		expectedHTML:         "",
 		expectedLocation:     "",
 	},
+	{
+		name: "special-requests-too-long",
+		postedData: url.Values{
+			"start_date":       {"2050-01-01"},
+			"end_date":         {"2050-01-02"},
+			"first_name":       {"John"},
+			"last_name":        {"Smith"},
+			"email":            {"john@smith.com"},
+			"phone":            {"555-555-5555"},
+			"room_id":          {"1"},
+			"special_requests": {strings.Repeat("x", 1001)},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "",
+		expectedLocation:     "",
+	},
+	{
+		name: "invalid-phone",
+		postedData: url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"call me"},
+			"room_id":    {"1"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "",
+		expectedLocation:     "",
+	},
+	{
+		name: "breaks-booking-rules",
+		postedData: url.Values{
+			"start_date": {"2045-01-08"},
+			"end_date":   {"2045-01-10"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "",
+		expectedLocation:     "",
+	},
 	{
 		name: "database-insert-fails-reservation",
 		postedData: url.Values{
@@ -244,7 +313,7 @@ var postReservationTests = []struct {
 		expectedLocation:     "/",
 	},
 	{
-		name: "database-insert-fails-restriction",
+		name: "database-insert-fails-hold",
 		postedData: url.Values{
 			"start_date": {"2050-01-01"},
 			"end_date":   {"2050-01-02"},
@@ -336,11 +405,63 @@ var testAvailabilityJSONData = []struct {
 		},
 		expectedOK: true,
 	},
+	{
+		name: "party fits the room",
+		postedData: url.Values{
+			"start":    {"2040-01-01"},
+			"end":      {"2040-01-02"},
+			"room_id":  {"1"},
+			"adults":   {"2"},
+			"children": {"1"},
+		},
+		expectedOK: true,
+	},
+	{
+		name: "party too large for the room",
+		postedData: url.Values{
+			"start":   {"2040-01-01"},
+			"end":     {"2040-01-02"},
+			"room_id": {"1"},
+			"adults":  {"3"},
+		},
+		expectedOK: false,
+	},
+	{
+		name: "invalid number of guests",
+		postedData: url.Values{
+			"start":   {"2040-01-01"},
+			"end":     {"2040-01-02"},
+			"room_id": {"1"},
+			"adults":  {"0"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Invalid number of guests",
+	},
+	{
+		name: "end before start",
+		postedData: url.Values{
+			"start":   {"2040-01-02"},
+			"end":     {"2040-01-01"},
+			"room_id": {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Invalid dates or room",
+	},
+	{
+		name: "stay shorter than the season minimum",
+		postedData: url.Values{
+			"start":   {"2045-01-09"},
+			"end":     {"2045-01-10"},
+			"room_id": {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Stays must be at least 3 nights",
+	},
 	{
 		name:            "empty post body",
 		postedData:      nil,
 		expectedOK:      false,
-		expectedMessage: "Internal Server Error",
+		expectedMessage: "Internal server error",
 	},
 	{
 		name: "database query fails",
@@ -352,6 +473,16 @@ var testAvailabilityJSONData = []struct {
 		expectedOK:      false,
 		expectedMessage: "Error querying database",
 	},
+	{
+		name: "booking rules query fails",
+		postedData: url.Values{
+			"start":   {"2040-01-01"},
+			"end":     {"2040-01-02"},
+			"room_id": {"99"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Error querying database",
+	},
 }
 
 // TestAvailabilityJSON tests the AvailabilityJSON handler
@@ -382,6 +513,10 @@ func TestAvailabilityJSON(t *testing.T) {
 		if j.OK != e.expectedOK {
 			t.Errorf("%s: expected %v but got %v", e.name, e.expectedOK, j.OK)
 		}
+
+		if e.expectedMessage != "" && j.Message != e.expectedMessage {
+			t.Errorf("%s: expected message %q but got %q", e.name, e.expectedMessage, j.Message)
+		}
 	}
 }
 
@@ -409,6 +544,56 @@ var testPostAvailabilityData = []struct {
 		},
 		expectedStatusCode: http.StatusOK,
 	},
+	{
+		name: "family fits a room",
+		postedData: url.Values{
+			"start":    {"2040-01-01"},
+			"end":      {"2040-01-02"},
+			"adults":   {"2"},
+			"children": {"1"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "sorted page past the last room",
+		postedData: url.Values{
+			"start": {"2040-01-01"},
+			"end":   {"2040-01-02"},
+			"sort":  {"capacity"},
+			"page":  {"3"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "party too large for every room",
+		postedData: url.Values{
+			"start":    {"2040-01-01"},
+			"end":      {"2040-01-02"},
+			"adults":   {"2"},
+			"children": {"3"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "stay longer than the booking rules allow",
+		postedData: url.Values{
+			"start": {"2040-01-01"},
+			"end":   {"2040-03-01"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
+	{
+		name: "invalid number of guests",
+		postedData: url.Values{
+			"start":  {"2040-01-01"},
+			"end":    {"2040-01-02"},
+			"adults": {"none"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/search-availability",
+	},
 	{
 		name:               "empty post body",
 		postedData:         url.Values{},
@@ -461,6 +646,13 @@ func TestPostAvailability(t *testing.T) {
 		if rr.Code != e.expectedStatusCode {
 			t.Errorf("%s gave wrong status code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
 		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
 	}
 }
 
@@ -606,6 +798,16 @@ var bookRoomTests = []struct {
 		url:                "/book-room?s=2040-01-01&e=2040-01-02&id=4",
 		expectedStatusCode: http.StatusSeeOther,
 	},
+	{
+		name:               "end-before-start",
+		url:                "/book-room?s=2040-01-02&e=2040-01-01&id=1",
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:               "invalid-room",
+		url:                "/book-room?s=2040-01-01&e=2040-01-02&id=first",
+		expectedStatusCode: http.StatusSeeOther,
+	},
 }
 
 // TestBookRoom tests the BookRoom handler
@@ -759,6 +961,18 @@ var adminPostShowReservationTests = []struct {
 		expectedLocation:     "/admin/reservations-calendar?y=2022&m=01",
 		expectedHTML:         "",
 	},
+	{
+		name: "invalid-email",
+		url:  "/admin/reservations/all/1/show",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john"},
+			"phone":      {"555-555-5555"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         "",
+	},
 }
 
 // TestAdminPostShowReservation tests the AdminPostReservation handler
@@ -835,6 +1049,26 @@ var adminPostReservationCalendarTests = []struct {
 		expectedResponseCode: http.StatusSeeOther,
 		reservations:         1,
 	},
+	{
+		name:                 "malformed-block-date",
+		postedData:           url.Values{"add_block_1_2040-13-45": {"1"}},
+		expectedResponseCode: http.StatusBadRequest,
+	},
+	{
+		name:                 "malformed-block-room",
+		postedData:           url.Values{"add_block_x_2040-01-5": {"1"}},
+		expectedResponseCode: http.StatusBadRequest,
+	},
+	{
+		name:                 "block-without-date",
+		postedData:           url.Values{"add_block_1": {"1"}},
+		expectedResponseCode: http.StatusBadRequest,
+	},
+	{
+		name:                 "block-of-unknown-room",
+		postedData:           url.Values{"add_block_99_2040-01-5": {"1"}},
+		expectedResponseCode: http.StatusBadRequest,
+	},
 }
 
 func TestPostReservationCalendar(t *testing.T) {
@@ -891,36 +1125,46 @@ func TestPostReservationCalendar(t *testing.T) {
 
 var adminProcessReservationTests = []struct {
 	name                 string
+	id                   string
 	queryParams          string
 	expectedResponseCode int
 	expectedLocation     string
 }{
 	{
 		name:                 "process-reservation",
+		id:                   "1",
 		queryParams:          "",
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "",
 	},
 	{
 		name:                 "process-reservation-back-to-cal",
+		id:                   "1",
 		queryParams:          "?y=2021&m=12",
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "",
 	},
+	{
+		name:                 "invalid-id",
+		id:                   "abc",
+		queryParams:          "",
+		expectedResponseCode: http.StatusBadRequest,
+		expectedLocation:     "",
+	},
 }
 
 func TestAdminProcessReservation(t *testing.T) {
 	for _, e := range adminProcessReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/%s/do%s", e.id, e.queryParams), nil)
 		ctx := getCtx(req)
-		req = req.WithContext(ctx)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": "cal", "id": e.id})
 
 		rr := httptest.NewRecorder()
 
 		handler := http.HandlerFunc(Repo.AdminProcessReservation)
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusSeeOther {
+		if rr.Code != e.expectedResponseCode {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
 	}
@@ -928,38 +1172,69 @@ func TestAdminProcessReservation(t *testing.T) {
 
 var adminDeleteReservationTests = []struct {
 	name                 string
+	id                   string
 	queryParams          string
 	expectedResponseCode int
 	expectedLocation     string
 }{
 	{
 		name:                 "delete-reservation",
+		id:                   "3",
 		queryParams:          "",
 		expectedResponseCode: http.StatusSeeOther,
-		expectedLocation:     "",
+		expectedLocation:     "/admin/reservations-cal",
 	},
 	{
 		name:                 "delete-reservation-back-to-cal",
+		id:                   "3",
 		queryParams:          "?y=2021&m=12",
 		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-calendar?y=2021&m=12",
+	},
+	{
+		name:                 "delete-cancelled-reservation",
+		id:                   "4",
+		queryParams:          "",
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations-cal",
+	},
+	{
+		name:                 "database-fails",
+		id:                   "5",
+		queryParams:          "",
+		expectedResponseCode: http.StatusInternalServerError,
+		expectedLocation:     "",
+	},
+	{
+		name:                 "invalid-id",
+		id:                   "abc",
+		queryParams:          "",
+		expectedResponseCode: http.StatusBadRequest,
 		expectedLocation:     "",
 	},
 }
 
 func TestAdminDeleteReservation(t *testing.T) {
 	for _, e := range adminDeleteReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/delete-reservation/cal/%s/do%s", e.id, e.queryParams), nil)
 		ctx := getCtx(req)
-		req = req.WithContext(ctx)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": "cal", "id": e.id})
 
 		rr := httptest.NewRecorder()
 
 		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
 		handler.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusSeeOther {
+		if rr.Code != e.expectedResponseCode {
 			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
 		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
 	}
 }
 
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+)
+
+// holdTime is how long a room is held for a guest while they fill in the reservation form
+const holdTime = 15 * time.Minute
+
+// holdRoom releases the reservation's previous hold, if any, and holds its room for the dates until holdTime
+// from now. It returns dbrepo.ErrRoomUnavailable when the room was booked or held by somebody else first.
+func (repository *Repository) holdRoom(ctx context.Context, reservation *models.Reservation) error {
+	if reservation.HoldID != 0 {
+		err := repository.DB.DeleteHold(ctx, reservation.HoldID)
+		if err != nil {
+			return err
+		}
+		reservation.HoldID, reservation.HoldExpiresAt = 0, time.Time{}
+	}
+
+	expiresAt := time.Now().Add(holdTime)
+	id, err := repository.DB.InsertHold(ctx, models.RoomRestriction{
+		StartDate: reservation.StartDate,
+		EndDate:   reservation.EndDate,
+		RoomID:    reservation.RoomID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	reservation.HoldID, reservation.HoldExpiresAt = id, expiresAt
+	return nil
+}
+
+// releaseHold releases the hold of the reservation in the session, if any, so the guest's own hold doesn't
+// keep the room from them when they search again
+func (repository *Repository) releaseHold(ctx context.Context) {
+	reservation, ok := repository.App.Session.Get(ctx, "reservation").(models.Reservation)
+	if !ok || reservation.HoldID == 0 {
+		return
+	}
+
+	err := repository.DB.DeleteHold(ctx, reservation.HoldID)
+	if err != nil {
+		repository.App.ErrorLog.Println(err)
+	}
+}
+
+// convertHold turns the guest's hold into the room restriction of the reservation made from it. When the
+// hold expired in the meantime, the room is held again if nobody else took it, so the reservation still
+// goes through; otherwise dbrepo.ErrRoomUnavailable is returned.
+func (repository *Repository) convertHold(ctx context.Context, reservation *models.Reservation, reservationID int) error {
+	err := repository.DB.ConvertHold(ctx, reservation.HoldID, reservationID)
+	if errors.Is(err, dbrepo.ErrHoldExpired) {
+		err = repository.holdRoom(ctx, reservation)
+		if err == nil {
+			err = repository.DB.ConvertHold(ctx, reservation.HoldID, reservationID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	reservation.HoldID, reservation.HoldExpiresAt = 0, time.Time{}
+	return nil
+}
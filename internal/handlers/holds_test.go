@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// holdRoomTests is the data for the tests of the holds placed when a guest picks a room
+var holdRoomTests = []struct {
+	name             string
+	url              string
+	start            string
+	end              string
+	expectedLocation string
+	expectedHoldID   int
+}{
+	{"choose-room", "/choose-room/1", "2050-01-01", "2050-01-03", "/make-reservation", 1},
+	{"choose-room-taken", "/choose-room/1", "2040-01-12", "2040-01-14", "/search-availability", 0},
+	{"choose-room-fails", "/choose-room/1000", "2050-01-01", "2050-01-03", "/", 0},
+	{"book-room", "/book-room?s=2050-01-01&e=2050-01-03&id=1", "", "", "/make-reservation", 1},
+	{"book-room-taken", "/book-room?s=2040-01-09&e=2040-01-11&id=1", "", "", "/rooms/generals-quarters", 0},
+}
+
+// TestHoldRoom tests that choosing or booking a room holds it, unless somebody else took it first
+func TestHoldRoom(t *testing.T) {
+	for _, e := range holdRoomTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.RequestURI = e.url
+
+		session.Put(ctx, "reservation", models.Reservation{
+			StartDate: parseDate(e.start),
+			EndDate:   parseDate(e.end),
+			HoldID:    5,
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ChooseRoom)
+		if strings.HasPrefix(e.url, "/book-room") {
+			handler = Repo.BookRoom
+		}
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			continue
+		}
+
+		if e.expectedHoldID == 0 {
+			continue
+		}
+
+		reservation, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if reservation.HoldID != e.expectedHoldID {
+			t.Errorf("%s: expected hold %d, got %d", e.name, e.expectedHoldID, reservation.HoldID)
+		}
+		if left := time.Until(reservation.HoldExpiresAt); left <= 0 || left > holdTime {
+			t.Errorf("%s: expected the hold to expire within %s, got %s", e.name, holdTime, reservation.HoldExpiresAt)
+		}
+	}
+}
+
+// postReservationHoldTests is the data for the tests of reservations made from a hold
+var postReservationHoldTests = []struct {
+	name             string
+	holdID           int
+	roomID           int
+	start            string
+	end              string
+	expectedLocation string
+}{
+	{"converted", 1, 1, "2050-01-01", "2050-01-03", "/reservation-summary"},
+	{"expired-but-free", 2, 1, "2050-01-01", "2050-01-03", "/reservation-summary"},
+	{"expired-and-taken", 2, 1, "2040-01-12", "2040-01-14", "/search-availability"},
+	{"convert-fails", 3, 1, "2050-01-01", "2050-01-03", "/"},
+	{"other-dates", 3, 1, "2050-02-01", "2050-02-03", "/reservation-summary"},
+	{"no-hold", 0, 1, "2050-01-01", "2050-01-03", "/reservation-summary"},
+	{"no-hold-and-taken", 0, 1, "2040-01-12", "2040-01-14", "/search-availability"},
+}
+
+// TestPostReservationWithHold tests that the hold the guest got when picking the room becomes their reservation
+func TestPostReservationWithHold(t *testing.T) {
+	for _, e := range postReservationHoldTests {
+		postedData := url.Values{
+			"start_date": {e.start},
+			"end_date":   {e.end},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+		}
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		// the guest held the room for 2050-01-01 to 2050-01-03, or the dates they posted when it was taken
+		held := models.Reservation{
+			RoomID:        e.roomID,
+			StartDate:     parseDate("2050-01-01"),
+			EndDate:       parseDate("2050-01-03"),
+			HoldID:        e.holdID,
+			HoldExpiresAt: time.Now().Add(time.Minute),
+		}
+		if e.expectedLocation == "/search-availability" {
+			held.StartDate, held.EndDate = parseDate(e.start), parseDate(e.end)
+		}
+		session.Put(ctx, "reservation", held)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			continue
+		}
+
+		if e.expectedLocation != "/reservation-summary" {
+			continue
+		}
+
+		reservation, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if reservation.HoldID != 0 {
+			t.Errorf("%s: expected the hold to be converted, but the reservation still has hold %d", e.name, reservation.HoldID)
+		}
+	}
+}
+
+// parseDate parses a date of a test, or returns the zero time for an empty one
+func parseDate(s string) time.Time {
+	t, _ := time.Parse(dateLayout, s)
+	return t
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/invoice"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/go-chi/chi"
+)
+
+// errNoInvoice is returned for reservations that can't be invoiced: the unpaid ones, and the ones
+// cancelled before they were invoiced
+var errNoInvoice = errors.New("reservation has no invoice")
+
+// invoiceable reports whether an invoice can be issued for a reservation
+func invoiceable(reservation models.Reservation) bool {
+	return reservation.Status == models.ReservationConfirmed && reservation.Total > 0
+}
+
+// issuedInvoice returns the invoice issued for a reservation, and false when it wasn't invoiced yet
+func (repository *Repository) issuedInvoice(ctx context.Context, reservationID int) (models.Invoice, bool, error) {
+	issued, err := repository.DB.GetInvoiceForReservation(ctx, reservationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Invoice{}, false, nil
+	}
+	if err != nil {
+		return models.Invoice{}, false, err
+	}
+	return issued, true, nil
+}
+
+// invoiceFor returns the invoice of a reservation, issuing it when the reservation is confirmed and wasn't
+// invoiced yet
+func (repository *Repository) invoiceFor(ctx context.Context, reservation models.Reservation) (models.Invoice, error) {
+	if !invoiceable(reservation) {
+		issued, ok, err := repository.issuedInvoice(ctx, reservation.ID)
+		if err == nil && !ok {
+			return models.Invoice{}, errNoInvoice
+		}
+		return issued, err
+	}
+
+	property := repository.App.Property
+
+	return repository.DB.IssueInvoice(ctx, models.Invoice{
+		ReservationID: reservation.ID,
+		Name:          reservation.FirstName + " " + reservation.LastName,
+		Email:         reservation.Email,
+		Currency:      currency.Get(repository.App.Currency).Code,
+		Total:         reservation.Total,
+		TaxName:       property.TaxName,
+		TaxRate:       property.TaxRate,
+	})
+}
+
+// invoicePDF returns the invoice of a reservation as a PDF document in the language of locale
+func (repository *Repository) invoicePDF(ctx context.Context, reservation models.Reservation, locale string) (models.Invoice, []byte, error) {
+	issued, err := repository.invoiceFor(ctx, reservation)
+	if err != nil {
+		return models.Invoice{}, nil, err
+	}
+
+	reservationPayments, err := repository.DB.GetPaymentsForReservation(ctx, reservation.ID)
+	if err != nil {
+		return models.Invoice{}, nil, err
+	}
+
+	refunds, err := repository.DB.GetRefundsForReservation(ctx, reservation.ID)
+	if err != nil {
+		return models.Invoice{}, nil, err
+	}
+
+	var buf bytes.Buffer
+	err = invoice.Write(&buf, invoice.Data{
+		Invoice:     issued,
+		Reservation: reservation,
+		Property:    repository.App.Property,
+		Payments:    reservationPayments,
+		Refunds:     refunds,
+	}, locale)
+	if err != nil {
+		return models.Invoice{}, nil, err
+	}
+
+	return issued, buf.Bytes(), nil
+}
+
+// invoiceAttachment returns the invoice of a reservation to attach to an email
+func (repository *Repository) invoiceAttachment(ctx context.Context, reservation models.Reservation) (models.Attachment, error) {
+	issued, data, err := repository.invoicePDF(ctx, reservation, i18n.Default)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	return models.Attachment{Name: invoice.Filename(issued), ContentType: "application/pdf", Data: data}, nil
+}
+
+// writeInvoice sends an invoice to be downloaded
+func writeInvoice(w http.ResponseWriter, issued models.Invoice, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, invoice.Filename(issued)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+// ReservationInvoice downloads the invoice of the reservation of a guest's link, in their language
+func (repository *Repository) ReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	reservation, err := repository.DB.GetReservationByCancelToken(r.Context(), token)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't find reservation")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	issued, data, err := repository.invoicePDF(r.Context(), reservation, i18n.FromContext(r.Context()))
+	if err != nil {
+		if errors.Is(err, errNoInvoice) {
+			repository.App.Session.Put(r.Context(), "error", "there is no invoice for this reservation")
+		} else {
+			repository.App.ErrorLog.Println(err)
+			repository.App.Session.Put(r.Context(), "error", "can't get the invoice")
+		}
+		http.Redirect(w, r, "/reservations/cancel/"+token, http.StatusSeeOther)
+		return
+	}
+
+	writeInvoice(w, issued, data)
+}
+
+// AdminReservationInvoice downloads the invoice of a reservation, issuing it if it wasn't yet
+func (repository *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	reservation, err := repository.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	issued, data, err := repository.invoicePDF(r.Context(), reservation, i18n.Default)
+	if errors.Is(err, errNoInvoice) {
+		repository.App.Session.Put(r.Context(), "error", "Only confirmed reservations can be invoiced")
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d/show", src, id), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	writeInvoice(w, issued, data)
+}
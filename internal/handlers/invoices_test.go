@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// reservationInvoiceTests is the data for the ReservationInvoice handler tests, /reservations/invoice/{token}
+var reservationInvoiceTests = []struct {
+	name               string
+	token              string
+	expectedStatusCode int
+	expectedLocation   string
+	expectedFilename   string
+}{
+	{"confirmed-reservation", "token-3", http.StatusOK, "", "INV-000042.pdf"},
+	{"invoiced-before-cancelling", "token-4", http.StatusOK, "", "INV-000041.pdf"},
+	{"database-fails", "token-5", http.StatusSeeOther, "/reservations/cancel/token-5", ""},
+	{"unknown-token", "nope", http.StatusSeeOther, "/", ""},
+}
+
+// TestReservationInvoice tests the ReservationInvoice handler
+func TestReservationInvoice(t *testing.T) {
+	for _, e := range reservationInvoiceTests {
+		req, _ := http.NewRequest("GET", "/reservations/invoice/"+e.token, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"token": e.token})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ReservationInvoice)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedFilename != "" {
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/pdf" {
+				t.Errorf("%s: expected a PDF, got %s", e.name, contentType)
+			}
+			if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename="`+e.expectedFilename+`"` {
+				t.Errorf("%s: unexpected content disposition %s", e.name, disposition)
+			}
+		}
+	}
+}
+
+// adminReservationInvoiceTests is the data for the AdminReservationInvoice handler tests
+var adminReservationInvoiceTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"confirmed-reservation", "3", http.StatusOK, ""},
+	{"invoiced-before-cancelling", "4", http.StatusOK, ""},
+	{"not-invoiceable", "1", http.StatusSeeOther, "/admin/reservations/all/1/show"},
+	{"database-fails", "5", http.StatusInternalServerError, ""},
+	{"invalid-id", "abc", http.StatusBadRequest, ""},
+}
+
+// TestAdminReservationInvoice tests the AdminReservationInvoice handler
+func TestAdminReservationInvoice(t *testing.T) {
+	for _, e := range adminReservationInvoiceTests {
+		req, _ := http.NewRequest("GET", "/admin/reservations/all/"+e.id+"/invoice", nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"src": "all", "id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminReservationInvoice)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// TestConfirmationMailInvoice tests that the invoice is attached to the confirmation email when the app is set to
+func TestConfirmationMailInvoice(t *testing.T) {
+	reservation, _ := Repo.DB.GetReservationByID(context.Background(), 3)
+
+	mail := Repo.confirmationMail(context.Background(), reservation, "Reservation confirmed", "Hello")
+	if len(mail.Attachments) != 0 {
+		t.Errorf("expected no attachments by default, got %d", len(mail.Attachments))
+	}
+
+	Repo.App.AttachInvoices = true
+	t.Cleanup(func() { Repo.App.AttachInvoices = false })
+
+	mail = Repo.confirmationMail(context.Background(), reservation, "Reservation confirmed", "Hello")
+	if len(mail.Attachments) != 1 {
+		t.Fatalf("expected the invoice to be attached, got %d attachments", len(mail.Attachments))
+	}
+
+	attachment := mail.Attachments[0]
+	if attachment.Name != "INV-000042.pdf" || attachment.ContentType != "application/pdf" || len(attachment.Data) == 0 {
+		t.Errorf("unexpected attachment %s of type %s", attachment.Name, attachment.ContentType)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/payments"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+)
+
+// paymentHoldTime is how long a reservation holds its room while waiting to be paid
+const paymentHoldTime = 30 * time.Minute
+
+// startCheckout creates the checkout for the amount a pending reservation owes, records the payment
+// and returns the URL the guest pays at
+func (repository *Repository) startCheckout(ctx context.Context, reservation models.Reservation) (string, error) {
+	gateway := repository.App.Payments
+	room := reservation.Room
+
+	checkout, err := gateway.CreateCheckout(ctx, payments.CheckoutRequest{
+		Reference: strconv.Itoa(reservation.ID),
+		Amount:    room.AmountDue(reservation.Total),
+		Currency:  currency.Get(repository.App.Currency).Code,
+		Description: fmt.Sprintf("%s, %s to %s", room.RoomName,
+			reservation.StartDate.Format(dateLayout), reservation.EndDate.Format(dateLayout)),
+		Email:      reservation.Email,
+		SuccessURL: repository.App.BaseURL + "/reservation-summary",
+		CancelURL:  repository.App.BaseURL + "/reservation-summary",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = repository.DB.InsertPayment(ctx, models.Payment{
+		ReservationID: reservation.ID,
+		Gateway:       gateway.Name(),
+		CheckoutID:    checkout.ID,
+		CheckoutURL:   checkout.URL,
+		Kind:          room.PaymentKind(),
+		Amount:        room.AmountDue(reservation.Total),
+		Currency:      currency.Get(repository.App.Currency).Code,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return checkout.URL, nil
+}
+
+// PaymentWebhook applies the payment events a gateway reports and emails the guest when their reservation
+// is confirmed. Events that were already applied are acknowledged without doing anything; errors make the
+// gateway deliver the event again later.
+func (repository *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if repository.App.Payments == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	event, err := repository.App.Payments.ParseWebhook(r)
+	if err != nil {
+		if !errors.Is(err, payments.ErrInvalidSignature) {
+			repository.App.ErrorLog.Println(err)
+		}
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reservationID, err := repository.DB.ApplyPaymentEvent(r.Context(), event)
+	var late *dbrepo.PaidTooLateError
+	if errors.As(err, &late) {
+		// the event was applied, so the gateway won't deliver it again: a refund that fails is left to staff
+		repository.App.ErrorLog.Printf("%v, refunding checkout %s", late, event.CheckoutID)
+		err = repository.refundLatePayment(r.Context(), late.ReservationID, event.CheckoutID)
+		if err != nil {
+			repository.App.ErrorLog.Printf("can't refund checkout %s of reservation %d: %v", event.CheckoutID, late.ReservationID, err)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if reservationID != 0 {
+		reservation, err := repository.DB.GetReservationByID(r.Context(), reservationID)
+		if err != nil {
+			// the reservation is confirmed either way, only the email is missing
+			repository.App.ErrorLog.Println(err)
+		} else {
+			repository.App.MailChan <- repository.confirmationMail(r.Context(), reservation, "Reservation confirmed",
+				"Hello, we received your payment and your reservation is confirmed")
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// refundLatePayment refunds what was left of the payment taken through a checkout for a reservation that expired
+// or was cancelled before it was paid, and emails the guest that their payment is given back
+func (repository *Repository) refundLatePayment(ctx context.Context, reservationID int, checkoutID string) error {
+	reservationPayments, refunded, err := repository.paymentBalance(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range reservationPayments {
+		if p.CheckoutID != checkoutID || p.Status != models.PaymentSucceeded {
+			continue
+		}
+
+		amount := p.Amount - refunded[p.ID]
+		if amount <= 0 {
+			return nil
+		}
+
+		err = repository.refundPayment(ctx, p, amount, "reservation no longer available when paid")
+		if err != nil {
+			return err
+		}
+
+		reservation, err := repository.DB.GetReservationByID(ctx, reservationID)
+		if err != nil {
+			return err
+		}
+
+		repository.App.MailChan <- models.MailData{
+			To:      reservation.Email,
+			From:    "go_reservation@email.com",
+			Subject: "Payment refunded",
+			Content: fmt.Sprintf("<p>Hello, your payment arrived after your reservation from %s to %s was no longer held, "+
+				"and the room couldn't be booked for you. %s will be refunded to you.</p>",
+				reservation.StartDate.Format(dateLayout), reservation.EndDate.Format(dateLayout),
+				currency.Format(amount, currency.Get(repository.App.Currency), i18n.Default)),
+			Template: "basic.html",
+		}
+		return nil
+	}
+
+	return fmt.Errorf("no succeeded payment for checkout %s", checkoutID)
+}
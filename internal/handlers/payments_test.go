@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/payments"
+)
+
+// withPayments takes payments through a fake gateway for the rest of the test
+func withPayments(t *testing.T) *payments.FakeGateway {
+	gateway := payments.NewFakeGateway("secret", "http://localhost/fake-gateway", "http://localhost/payments/webhook")
+	app.Payments = gateway
+	app.BaseURL = "http://localhost"
+	t.Cleanup(func() {
+		app.Payments = nil
+		app.BaseURL = ""
+	})
+	return gateway
+}
+
+// paymentWebhookTests is the data for the PaymentWebhook handler tests
+var paymentWebhookTests = []struct {
+	name               string
+	payload            string
+	secret             string
+	expectedStatusCode int
+}{
+	{"payment-succeeded", `{"id":"evt_1","type":"checkout.succeeded","checkout_id":"cs_fake_1"}`, "secret", http.StatusOK},
+	{"payment-failed", `{"id":"evt_2","type":"checkout.failed","checkout_id":"cs_fake_1"}`, "secret", http.StatusOK},
+	{"already-applied", `{"id":"duplicate","type":"checkout.succeeded","checkout_id":"cs_fake_1"}`, "secret", http.StatusOK},
+	{"paid-too-late", `{"id":"evt_5","type":"checkout.succeeded","checkout_id":"cs_late_4"}`, "secret", http.StatusOK},
+	{"paid-too-late-unknown-payment", `{"id":"evt_6","type":"checkout.succeeded","checkout_id":"cs_late_9"}`, "secret", http.StatusOK},
+	{"wrong-signature", `{"id":"evt_3","type":"checkout.succeeded","checkout_id":"cs_fake_1"}`, "other", http.StatusBadRequest},
+	{"invalid-payload", `not json`, "secret", http.StatusBadRequest},
+	{"database-fails", `{"id":"evt_4","type":"checkout.succeeded","checkout_id":"fail"}`, "secret", http.StatusInternalServerError},
+}
+
+// TestPaymentWebhook tests the PaymentWebhook handler
+func TestPaymentWebhook(t *testing.T) {
+	withPayments(t)
+
+	for _, e := range paymentWebhookTests {
+		req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader(e.payload))
+		req.Header.Set("Fake-Signature", payments.Sign(e.secret, []byte(e.payload), time.Now()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PaymentWebhook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// TestPaymentWebhookWithoutGateway tests that the webhook isn't served when payments are disabled
+func TestPaymentWebhookWithoutGateway(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader("{}"))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PaymentWebhook)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("PaymentWebhook returned wrong response code: got %d, wanted %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+// TestPostReservationWithPayments tests that the guest is sent to the checkout when payments are enabled
+func TestPostReservationWithPayments(t *testing.T) {
+	withPayments(t)
+
+	postedData := url.Values{
+		"start_date": {"2040-01-01"},
+		"end_date":   {"2040-01-03"},
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@smith.com"},
+		"phone":      {"555-555-5555"},
+		"room_id":    {"1"},
+	}
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostReservation returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	actualLoc, _ := rr.Result().Location()
+	if !strings.HasPrefix(actualLoc.String(), "http://localhost/fake-gateway/checkout/cs_fake_") {
+		t.Errorf("expected to be sent to the checkout, but got location %s", actualLoc.String())
+	}
+
+	reservation, ok := session.Get(ctx, "reservation").(models.Reservation)
+	if !ok {
+		t.Fatal("expected the reservation to be kept in the session")
+	}
+	if reservation.Status != models.ReservationPending || reservation.Total != 24000 {
+		t.Errorf("expected a pending reservation of 24000, got %s of %d", reservation.Status, reservation.Total)
+	}
+}
+
+// TestReservationSummaryWithPayments tests the summary of a reservation waiting to be paid
+func TestReservationSummaryWithPayments(t *testing.T) {
+	withPayments(t)
+
+	req, _ := http.NewRequest("GET", "/reservation-summary", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	session.Put(ctx, "reservation", models.Reservation{
+		ID:        1,
+		RoomID:    1,
+		Status:    models.ReservationPending,
+		ExpiresAt: time.Now().Add(paymentHoldTime),
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+	})
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.ReservationSummary)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("ReservationSummary returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	if _, ok := session.Get(ctx, "reservation").(models.Reservation); !ok {
+		t.Error("expected a pending reservation to stay in the session until it is paid")
+	}
+}
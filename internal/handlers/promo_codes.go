@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/promo"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+	"github.com/go-chi/chi"
+)
+
+// maxPromoCodeLength is the longest promo code that can be created
+const maxPromoCodeLength = 50
+
+// applyPromoCode takes the discount of the promo code posted with a reservation off its total, or adds the
+// reason the code can't be used to the form errors
+func (repository *Repository) applyPromoCode(ctx context.Context, form *forms.Form, reservation *models.Reservation) error {
+	code, err := repository.DB.GetPromoCodeByCode(ctx, promo.Normalize(form.Get("promo_code")))
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("promo_code", "promo.invalid")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if msg, ok := promo.Check(code, reservation.RoomID, reservation.StartDate, reservation.EndDate); !ok {
+		form.Errors.Add("promo_code", msg.Key, msg.Args...)
+		return nil
+	}
+
+	reservation.PromoCodeID = code.ID
+	reservation.PromoCode = code.Code
+	reservation.Discount = promo.Discount(code, reservation.Total)
+	reservation.Total -= reservation.Discount
+
+	return nil
+}
+
+// promoCodeError returns the catalog key of the message for a promo code that couldn't be redeemed
+func promoCodeError(err error) string {
+	if errors.Is(err, dbrepo.ErrPromoCodeAlreadyUsed) {
+		return "promo.already_used"
+	}
+	return "promo.used_up"
+}
+
+// AdminPromoCodes lists every promo code with how much it was used
+func (repository *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	codes, err := repository.DB.AllPromoCodes(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["codes"] = codes
+
+	render.Template(w, r, "admin-promo-codes.page.tmpl.html", &models.TemplateData{Data: data})
+}
+
+// AdminNewPromoCode shows the form to create a promo code
+func (repository *Repository) AdminNewPromoCode(w http.ResponseWriter, r *http.Request) {
+	code := models.PromoCode{Kind: models.PromoPercent, MinNights: 1, Active: true}
+	repository.renderPromoCode(w, r, code, forms.New(nil))
+}
+
+// AdminShowPromoCode shows the form to edit a promo code and the reservations it was redeemed for
+func (repository *Repository) AdminShowPromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	code, err := repository.DB.GetPromoCodeByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.renderPromoCode(w, r, code, forms.New(nil))
+}
+
+// AdminPostPromoCode creates a promo code, or updates it when the URL has a promo code id
+func (repository *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id := 0
+	if param := chi.URLParam(r, "id"); param != "" {
+		id, err = strconv.Atoi(param)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	code := promoCodeFromForm(form, currency.Get(repository.App.Currency))
+	code.ID = id
+
+	if !form.Valid() {
+		repository.renderPromoCode(w, r, code, form)
+		return
+	}
+
+	if id == 0 {
+		id, err = repository.DB.InsertPromoCode(r.Context(), code)
+	} else {
+		err = repository.DB.UpdatePromoCode(r.Context(), code)
+	}
+	if errors.Is(err, dbrepo.ErrPromoCodeExists) {
+		form.Errors.Add("code", "Another promo code already has this code")
+		repository.renderPromoCode(w, r, code, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Promo code saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/promo-codes/%d", id), http.StatusSeeOther)
+}
+
+// AdminDeletePromoCode deletes a promo code that was never redeemed
+func (repository *Repository) AdminDeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repository.DB.DeletePromoCode(r.Context(), id)
+	if errors.Is(err, dbrepo.ErrPromoCodeRedeemed) {
+		repository.App.Session.Put(r.Context(), "error", "This promo code was used, deactivate it instead")
+		http.Redirect(w, r, fmt.Sprintf("/admin/promo-codes/%d", id), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// roomOption is a room checkbox of the promo code form
+type roomOption struct {
+	ID       int
+	RoomName string
+	Checked  bool
+}
+
+// renderPromoCode shows the promo code form with the rooms a code can be limited to and, for saved codes,
+// the reservations it was redeemed for
+func (repository *Repository) renderPromoCode(w http.ResponseWriter, r *http.Request, code models.PromoCode, form *forms.Form) {
+	rooms, err := repository.DB.GetAllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var redemptions []models.PromoRedemption
+	if code.ID != 0 {
+		redemptions, err = repository.DB.GetRedemptionsForPromoCode(r.Context(), code.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	var roomOptions []roomOption
+	for _, room := range rooms {
+		roomOptions = append(roomOptions, roomOption{ID: room.ID, RoomName: room.RoomName, Checked: containsInt(code.RoomIDs, room.ID)})
+	}
+
+	stringMap := make(map[string]string)
+	switch {
+	case form.Has("amount"):
+		stringMap["amount"] = form.Get("amount")
+	case code.ID != 0 && code.Kind == models.PromoFixed:
+		stringMap["amount"] = currency.FormatAmount(code.Amount, currency.Get(repository.App.Currency))
+	case code.ID != 0:
+		stringMap["amount"] = strconv.Itoa(code.Amount)
+	}
+	if !code.StartsOn.IsZero() {
+		stringMap["starts_on"] = code.StartsOn.Format(dateLayout)
+	}
+	if !code.EndsOn.IsZero() {
+		stringMap["ends_on"] = code.EndsOn.Format(dateLayout)
+	}
+
+	data := make(map[string]interface{})
+	data["code"] = code
+	data["rooms"] = roomOptions
+	data["redemptions"] = redemptions
+
+	render.Template(w, r, "admin-promo-code.page.tmpl.html", &models.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: stringMap,
+	})
+}
+
+// promoCodeFromForm validates the posted promo code form and builds the code from it, reading fixed
+// discounts in the base currency
+func promoCodeFromForm(form *forms.Form, base currency.Currency) models.PromoCode {
+	form.Required("code", "amount")
+	form.MaxLength("code", maxPromoCodeLength)
+	form.MaxLength("description", 255)
+
+	code := models.PromoCode{
+		Code:         promo.Normalize(form.Get("code")),
+		Description:  strings.TrimSpace(form.Get("description")),
+		Kind:         models.PromoPercent,
+		OncePerEmail: form.Has("once_per_email"),
+		Active:       form.Has("active"),
+	}
+
+	if strings.ContainsAny(code.Code, " \t") {
+		form.Errors.Add("code", "Codes can't have spaces")
+	}
+
+	if form.Get("kind") == models.PromoFixed {
+		code.Kind = models.PromoFixed
+		if form.Has("amount") && form.Matches("amount", pricePattern, "Amount must be such as 20.00") {
+			amount, _ := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(form.Get("amount")), "$"), 64)
+			code.Amount = int(math.Round(amount * math.Pow10(base.Decimals)))
+			if code.Amount <= 0 {
+				form.Errors.Add("amount", "Amount must be more than zero")
+			}
+		}
+	} else if form.Has("amount") && form.InRange("amount", 1, 100) {
+		code.Amount = form.Int("amount")
+	}
+
+	if form.Has("starts_on") && form.IsDate("starts_on") {
+		code.StartsOn = form.Date("starts_on")
+	}
+	if form.Has("ends_on") && form.IsDate("ends_on") {
+		code.EndsOn = form.Date("ends_on")
+		if !code.StartsOn.IsZero() && code.EndsOn.Before(code.StartsOn) {
+			form.Errors.Add("ends_on", "The last arrival can't be before the first")
+		}
+	}
+
+	code.MinNights = optionalInt(form, "min_nights", 1, maxStayNights, 1)
+	code.MaxUses = optionalInt(form, "max_uses", 0, math.MaxInt32, 0)
+
+	for _, value := range form.Values["room_ids"] {
+		if id, err := strconv.Atoi(value); err == nil && id > 0 && !containsInt(code.RoomIDs, id) {
+			code.RoomIDs = append(code.RoomIDs, id)
+		}
+	}
+
+	return code
+}
+
+func containsInt(ids []int, id int) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// postReservationPromoCodeTests is the data for the tests of reservations booked with a promo code, for a
+// two night stay in room 1 at 12000 a night
+var postReservationPromoCodeTests = []struct {
+	name               string
+	code               string
+	expectedStatusCode int
+	expectedDiscount   int
+}{
+	{"percent", "SUMMER10", http.StatusSeeOther, 2400},
+	{"any-case", " summer10 ", http.StatusSeeOther, 2400},
+	{"whole-price", "FREE", http.StatusSeeOther, 24000},
+	{"unknown-code", "NOPE", http.StatusOK, 0},
+	{"other-room", "SUITE", http.StatusOK, 0},
+	{"inactive", "OLD", http.StatusOK, 0},
+	{"used-up", "FULL", http.StatusOK, 0},
+	{"used-up-while-booking", "GONE", http.StatusOK, 0},
+	{"already-used-by-the-guest", "ONCE", http.StatusOK, 0},
+}
+
+// TestPostReservationWithPromoCode tests that promo codes are checked and taken off the total of a reservation
+func TestPostReservationWithPromoCode(t *testing.T) {
+	for _, e := range postReservationPromoCodeTests {
+		postedData := url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-03"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"room_id":    {"1"},
+			"promo_code": {e.code},
+		}
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.expectedStatusCode != http.StatusSeeOther {
+			continue
+		}
+
+		reservation, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if reservation.Discount != e.expectedDiscount || reservation.Total != 24000-e.expectedDiscount {
+			t.Errorf("%s: expected %d off 24000, got %d off for a total of %d",
+				e.name, e.expectedDiscount, reservation.Discount, reservation.Total)
+		}
+	}
+}
+
+// TestPostReservationFreeWithPayments tests that a reservation with nothing to pay is confirmed without a checkout
+func TestPostReservationFreeWithPayments(t *testing.T) {
+	withPayments(t)
+
+	postedData := url.Values{
+		"start_date": {"2050-01-01"},
+		"end_date":   {"2050-01-03"},
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@smith.com"},
+		"room_id":    {"1"},
+		"promo_code": {"FREE"},
+	}
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	actualLoc, _ := rr.Result().Location()
+	if rr.Code != http.StatusSeeOther || actualLoc.String() != "/reservation-summary" {
+		t.Fatalf("expected to be sent to the summary, got %d to %s", rr.Code, actualLoc.String())
+	}
+
+	reservation, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if reservation.Status != models.ReservationConfirmed {
+		t.Errorf("expected the reservation to be confirmed, got %s", reservation.Status)
+	}
+}
+
+// adminPostPromoCodeTests is the data for the AdminPostPromoCode handler tests
+var adminPostPromoCodeTests = []struct {
+	name               string
+	id                 string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name: "new-code",
+		postedData: url.Values{
+			"code":           {"winter25"},
+			"kind":           {"percent"},
+			"amount":         {"25"},
+			"starts_on":      {"2045-01-01"},
+			"ends_on":        {"2045-03-31"},
+			"min_nights":     {"3"},
+			"max_uses":       {"100"},
+			"room_ids":       {"1", "2"},
+			"once_per_email": {"1"},
+			"active":         {"1"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/promo-codes/8",
+	},
+	{
+		name:               "fixed-amount",
+		id:                 "3",
+		postedData:         url.Values{"code": {"SUITE"}, "kind": {"fixed"}, "amount": {"50.00"}},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/promo-codes/3",
+	},
+	{
+		name:               "missing-code",
+		postedData:         url.Values{"amount": {"10"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "code-with-spaces",
+		postedData:         url.Values{"code": {"summer ten"}, "amount": {"10"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "percent-above-100",
+		postedData:         url.Values{"code": {"MORE"}, "amount": {"120"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "invalid-fixed-amount",
+		postedData:         url.Values{"code": {"MORE"}, "kind": {"fixed"}, "amount": {"lots"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "ends-before-it-starts",
+		postedData:         url.Values{"code": {"MORE"}, "amount": {"10"}, "starts_on": {"2045-03-01"}, "ends_on": {"2045-01-01"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "code-taken",
+		postedData:         url.Values{"code": {"summer10"}, "amount": {"10"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "code-taken-by-another",
+		id:                 "1",
+		postedData:         url.Values{"code": {"FREE"}, "amount": {"10"}},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "database-fails",
+		postedData:         url.Values{"code": {"fail"}, "amount": {"10"}},
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+	{
+		name:               "invalid-id",
+		id:                 "abc",
+		postedData:         url.Values{},
+		expectedStatusCode: http.StatusBadRequest,
+	},
+}
+
+// TestAdminPostPromoCode tests the AdminPostPromoCode handler
+func TestAdminPostPromoCode(t *testing.T) {
+	for _, e := range adminPostPromoCodeTests {
+		req, _ := http.NewRequest("POST", "/admin/promo-codes/new", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.id != "" {
+			req = withURLParams(req, map[string]string{"id": e.id})
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostPromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// TestPromoCodeFromForm tests that a fixed discount is read in the minor units of the base currency
+func TestPromoCodeFromForm(t *testing.T) {
+	form := forms.New(url.Values{
+		"code":     {" spring "},
+		"kind":     {"fixed"},
+		"amount":   {"20.50"},
+		"room_ids": {"2", "2", "x"},
+	})
+
+	code := promoCodeFromForm(form, currency.Get("USD"))
+	if !form.Valid() {
+		t.Fatalf("expected the form to be valid, got %v", form.Errors)
+	}
+	if code.Code != "SPRING" || code.Amount != 2050 || len(code.RoomIDs) != 1 || code.MinNights != 1 {
+		t.Errorf("unexpected promo code %+v", code)
+	}
+}
+
+// adminShowPromoCodeTests is the data for the AdminShowPromoCode handler tests
+var adminShowPromoCodeTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+}{
+	{"redeemed-code", "1", http.StatusOK},
+	{"unused-code", "2", http.StatusOK},
+	{"unknown-code", "99", http.StatusInternalServerError},
+	{"invalid-id", "abc", http.StatusBadRequest},
+}
+
+// TestAdminShowPromoCode tests the AdminShowPromoCode handler
+func TestAdminShowPromoCode(t *testing.T) {
+	for _, e := range adminShowPromoCodeTests {
+		req, _ := http.NewRequest("GET", "/admin/promo-codes/"+e.id, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowPromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// adminDeletePromoCodeTests is the data for the AdminDeletePromoCode handler tests
+var adminDeletePromoCodeTests = []struct {
+	name             string
+	id               string
+	expectedLocation string
+}{
+	{"unused-code", "2", "/admin/promo-codes"},
+	{"redeemed-code", "1", "/admin/promo-codes/1"},
+}
+
+// TestAdminDeletePromoCode tests the AdminDeletePromoCode handler
+func TestAdminDeletePromoCode(t *testing.T) {
+	for _, e := range adminDeletePromoCodeTests {
+		req, _ := http.NewRequest("GET", "/admin/promo-codes/"+e.id+"/delete", nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeletePromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("%s redirected to %s, wanted %s", e.name, actualLoc.String(), e.expectedLocation)
+		}
+	}
+}
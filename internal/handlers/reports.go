@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/export"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/reporting"
+)
+
+// Kinds of daily report
+const (
+	reportArrivals   = "arrivals"
+	reportDepartures = "departures"
+)
+
+// reportColumns are the export columns of the daily reports
+var reportColumns = []string{"first_name", "last_name", "phone", "room", "arrival", "departure", "nights", "adults",
+	"children", "balance", "special_requests"}
+
+// AdminArrivalsReport lists the guests arriving on a day, today unless another date is picked
+func (repository *Repository) AdminArrivalsReport(w http.ResponseWriter, r *http.Request) {
+	repository.adminDailyReport(w, r, reportArrivals)
+}
+
+// AdminDeparturesReport lists the guests leaving on a day, today unless another date is picked
+func (repository *Repository) AdminDeparturesReport(w http.ResponseWriter, r *http.Request) {
+	repository.adminDailyReport(w, r, reportDepartures)
+}
+
+// adminDailyReport shows the daily report of a kind for the date picked, or downloads it when a format is
+// asked for
+func (repository *Repository) adminDailyReport(w http.ResponseWriter, r *http.Request, kind string) {
+	form := forms.New(r.URL.Query())
+
+	day := dates.Day(time.Now())
+	if form.Has("date") && form.IsDate("date") {
+		day = form.Date("date")
+	}
+
+	stays, err := repository.dailyReport(r.Context(), kind, day)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if form.Has("format") {
+		format, ok := export.ParseFormat(form.Get("format"))
+		if !ok || !form.Valid() {
+			repository.App.Session.Put(r.Context(), "error", "Invalid export")
+			http.Redirect(w, r, "/admin/reports/"+kind, http.StatusSeeOther)
+			return
+		}
+
+		filename := kind + "-" + day.Format(dateLayout) + "." + string(format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		err = repository.writeDailyReport(w, format, stays)
+		if err != nil {
+			repository.App.ErrorLog.Println(err)
+		}
+		return
+	}
+
+	guests := 0
+	for _, res := range stays {
+		guests += res.Guests()
+	}
+
+	data := make(map[string]interface{})
+	data["stays"] = stays
+
+	intMap := make(map[string]int)
+	intMap["guests"] = guests
+
+	stringMap := make(map[string]string)
+	stringMap["kind"] = kind
+	stringMap["date"] = day.Format(dateLayout)
+	stringMap["title"] = "Arrivals"
+	if kind == reportDepartures {
+		stringMap["title"] = "Departures"
+	}
+
+	render.Template(w, r, "admin-daily-report.page.tmpl.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// dailyReport returns the stays that arrive or leave on a day, depending on the kind of report, in room
+// order. Reservations that no longer hold their room aren't on it.
+func (repository *Repository) dailyReport(ctx context.Context, kind string, day time.Time) ([]models.Reservation, error) {
+	// the search keeps the stays that overlap the night of the day, or the night before for departures
+	night := day
+	if kind == reportDepartures {
+		night = day.AddDate(0, 0, -1)
+	}
+
+	var stays []models.Reservation
+	err := repository.DB.EachReservation(ctx, models.ReservationQuery{
+		From: night,
+		To:   night,
+		Sort: models.SortByRoom,
+	}, func(res models.Reservation) error {
+		on := res.StartDate
+		if kind == reportDepartures {
+			on = res.EndDate
+		}
+		if res.Cancellable() && on.Equal(day) {
+			stays = append(stays, res)
+		}
+		return nil
+	})
+
+	return stays, err
+}
+
+// writeDailyReport writes the stays of a daily report to a file in a format
+func (repository *Repository) writeDailyReport(w io.Writer, format export.Format, stays []models.Reservation) error {
+	columns, err := export.ColumnsFor(reportColumns)
+	if err != nil {
+		return err
+	}
+
+	ew, err := export.NewWriter(w, export.Options{
+		Format:   format,
+		Columns:  columns,
+		Currency: currency.Get(repository.App.Currency),
+		Locale:   i18n.Default,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, res := range stays {
+		err := ew.Write(res)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ew.Close()
+}
+
+// SendArrivalsReport emails the list of the guests arriving on a day to the staff in ArrivalsReportTo, with
+// the list attached as CSV. It returns the number of arrivals.
+func (repository *Repository) SendArrivalsReport(ctx context.Context, day time.Time) (int, error) {
+	stays, err := repository.dailyReport(ctx, reportArrivals, day)
+	if err != nil {
+		return 0, err
+	}
+
+	var file bytes.Buffer
+	err = repository.writeDailyReport(&file, export.CSV, stays)
+	if err != nil {
+		return 0, err
+	}
+
+	base := currency.Get(repository.App.Currency)
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "<p>%d arrival(s) on %s.</p>\n", len(stays), day.Format(dateLayout))
+	if len(stays) > 0 {
+		content.WriteString("<table>\n<tr><th>Guest</th><th>Room</th><th>Nights</th><th>Guests</th><th>Balance due</th><th>Special requests</th></tr>\n")
+		for _, res := range stays {
+			fmt.Fprintf(&content, "<tr><td>%s %s</td><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>\n",
+				template.HTMLEscapeString(res.FirstName), template.HTMLEscapeString(res.LastName),
+				template.HTMLEscapeString(res.Room.RoomName), res.Nights(), res.Guests(),
+				currency.Format(res.Balance(), base, i18n.Default), template.HTMLEscapeString(res.SpecialRequests))
+		}
+		content.WriteString("</table>")
+	}
+
+	for _, to := range repository.App.ArrivalsReportTo {
+		repository.App.MailChan <- models.MailData{
+			To:       to,
+			From:     "go_reservation@email.com",
+			Subject:  "Arrivals on " + day.Format(dateLayout),
+			Content:  content.String(),
+			Template: "basic.html",
+			Attachments: []models.Attachment{{
+				Name:        "arrivals-" + day.Format(dateLayout) + ".csv",
+				ContentType: export.CSV.ContentType(),
+				Data:        file.Bytes(),
+			}},
+		}
+	}
+
+	return len(stays), nil
+}
+
+// occupancyReportMonths is how many months the occupancy report covers when no period is picked, the
+// current month included
+const occupancyReportMonths = 6
+
+// occupancyReportMaxDays is the longest period the occupancy report covers, about three years
+const occupancyReportMaxDays = 3 * 366
+
+// occupancyChart is the occupancy, average daily rate and lead times of the occupancy report, ready to be
+// handed to Chart.js. Rates are in major units of the currency.
+type occupancyChart struct {
+	Months    []string  `json:"months"`
+	Occupancy []float64 `json:"occupancy"`
+	ADR       []float64 `json:"adr"`
+	LeadTimes []string  `json:"lead_times"`
+	Bookings  []int     `json:"bookings"`
+}
+
+// AdminOccupancyReport shows the occupancy, average daily rate, revenue per available room, nights sold,
+// cancellations and lead times of each room and month from one date to another, both included, or
+// downloads them when a format is asked for. The last months up to the end of this one are shown unless
+// another period is picked.
+func (repository *Repository) AdminOccupancyReport(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+
+	now := time.Now()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	start := thisMonth.AddDate(0, 1-occupancyReportMonths, 0)
+	end := thisMonth.AddDate(0, 1, 0)
+
+	if form.Has("from") || form.Has("to") {
+		form.Required("from", "to")
+		if form.IsDate("from") && form.IsDate("to") {
+			// to is the last night of the period, the report ends the day after it
+			from, until := form.Date("from"), form.Date("to").AddDate(0, 0, 1)
+			if !until.After(from) {
+				form.Errors.Add("to", "forms.date_order")
+			} else if until.Sub(from) > occupancyReportMaxDays*24*time.Hour {
+				form.Errors.Add("to", "forms.date_span", occupancyReportMaxDays)
+			}
+			if form.Valid() {
+				start, end = from, until
+			}
+		}
+	}
+
+	report, err := repository.occupancyReport(r.Context(), start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if form.Has("format") {
+		format, ok := export.ParseFormat(form.Get("format"))
+		if !ok || !form.Valid() {
+			repository.App.Session.Put(r.Context(), "error", "Invalid export")
+			http.Redirect(w, r, "/admin/reports/occupancy", http.StatusSeeOther)
+			return
+		}
+
+		filename := "occupancy-" + start.Format(dateLayout) + "-" + end.AddDate(0, 0, -1).Format(dateLayout) + "." +
+			string(format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		err = repository.writeOccupancyReport(w, format, report)
+		if err != nil {
+			repository.App.ErrorLog.Println(err)
+		}
+		return
+	}
+
+	base := currency.Get(repository.App.Currency)
+
+	var chart occupancyChart
+	for _, s := range report.ByMonth() {
+		chart.Months = append(chart.Months, s.Month.Format("Jan 2006"))
+		chart.Occupancy = append(chart.Occupancy, math.Round(s.Occupancy()*10)/10)
+		chart.ADR = append(chart.ADR, float64(s.ADR())/math.Pow10(base.Decimals))
+	}
+	total := report.Total()
+	for i, l := range reporting.LeadTimes {
+		chart.LeadTimes = append(chart.LeadTimes, l.Label)
+		chart.Bookings = append(chart.Bookings, total.LeadTimes[i])
+	}
+
+	data := make(map[string]interface{})
+	data["total"] = total
+	data["by_month"] = report.ByMonth()
+	data["by_room"] = report.ByRoom()
+	data["rows"] = report.Rows()
+	data["lead_times"] = reporting.LeadTimes
+	data["chart"] = chart
+
+	stringMap := make(map[string]string)
+	stringMap["from"] = start.Format(dateLayout)
+	stringMap["to"] = end.AddDate(0, 0, -1).Format(dateLayout)
+
+	render.Template(w, r, "admin-occupancy-report.page.tmpl.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// occupancyReport gathers the statistics of the rooms from start to end, not including end, from the
+// reservations staying in that period
+func (repository *Repository) occupancyReport(ctx context.Context, start, end time.Time) (*reporting.Report, error) {
+	rooms, err := repository.DB.GetAllRooms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := reporting.New(start, end, rooms)
+
+	// the search keeps the stays that overlap the nights from start to the night before end
+	err = repository.DB.EachReservation(ctx, models.ReservationQuery{
+		From: start,
+		To:   end.AddDate(0, 0, -1),
+		Sort: models.SortByRoom,
+	}, func(res models.Reservation) error {
+		report.Add(res)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// writeOccupancyReport writes the statistics of each room in each month of a report to a file in a format,
+// followed by those of all the rooms in each month and over the whole period
+func (repository *Repository) writeOccupancyReport(w io.Writer, format export.Format, report *reporting.Report) error {
+	headers := []string{"Room", "Month", "Nights available", "Nights sold", "Occupancy %", "Revenue", "ADR",
+		"RevPAR", "Bookings", "Cancellations", "Cancellation %"}
+	for _, l := range reporting.LeadTimes {
+		headers = append(headers, "Booked "+strings.ToLower(l.Label))
+	}
+
+	ew, err := export.NewTableWriter(w, export.Options{
+		Format:   format,
+		Currency: currency.Get(repository.App.Currency),
+		Locale:   i18n.Default,
+		Sheet:    "Occupancy",
+	}, headers)
+	if err != nil {
+		return err
+	}
+
+	rows := append(report.Rows(), report.ByMonth()...)
+	rows = append(rows, report.Total())
+	for _, s := range rows {
+		room, month := s.RoomName, "Total"
+		if s.RoomID == 0 {
+			room = "All rooms"
+		}
+		if !s.Month.IsZero() {
+			month = s.Month.Format("2006-01")
+		}
+
+		values := []export.Value{
+			export.Text(room),
+			export.Text(month),
+			export.Number(s.AvailableNights),
+			export.Number(s.NightsSold),
+			export.Decimal(s.Occupancy()),
+			export.Amount(s.Revenue),
+			export.Amount(s.ADR()),
+			export.Amount(s.RevPAR()),
+			export.Number(s.Bookings),
+			export.Number(s.Cancellations),
+			export.Decimal(s.CancellationRate()),
+		}
+		for _, n := range s.LeadTimes {
+			values = append(values, export.Number(n))
+		}
+
+		err := ew.WriteRow(values...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ew.Close()
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dailyReportTests is the data for the tests of the daily reports
+var dailyReportTests = []struct {
+	name     string
+	kind     string
+	date     string
+	expected []int
+}{
+	{"arrivals", reportArrivals, "2040-01-10", []int{3, 5}},
+	{"departures", reportDepartures, "2040-01-13", []int{3, 5}},
+	{"no-arrivals", reportArrivals, "2040-01-11", nil},
+	{"no-departures", reportDepartures, "2040-01-12", nil},
+}
+
+// TestDailyReport tests that the daily reports list the stays arriving or leaving on the day that still
+// hold their room
+func TestDailyReport(t *testing.T) {
+	for _, e := range dailyReportTests {
+		stays, err := Repo.dailyReport(context.Background(), e.kind, parseDate(e.date))
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		var got []int
+		for _, res := range stays {
+			got = append(got, res.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(e.expected) {
+			t.Errorf("%s: expected reservations %v, got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+// adminDailyReportTests is the data for the AdminArrivalsReport and AdminDeparturesReport handler tests
+var adminDailyReportTests = []struct {
+	name                string
+	url                 string
+	expectedStatusCode  int
+	expectedContentType string
+	expectedRows        int
+}{
+	{"arrivals", "/admin/reports/arrivals?date=2040-01-10", http.StatusOK, "", 0},
+	{"departures", "/admin/reports/departures?date=2040-01-13", http.StatusOK, "", 0},
+	{"today", "/admin/reports/arrivals", http.StatusOK, "", 0},
+	{"invalid-date", "/admin/reports/arrivals?date=tomorrow", http.StatusOK, "", 0},
+	{"csv", "/admin/reports/arrivals?date=2040-01-10&format=csv", http.StatusOK, "text/csv; charset=utf-8", 3},
+	{"empty-csv", "/admin/reports/departures?date=2040-01-10&format=csv", http.StatusOK, "text/csv; charset=utf-8", 1},
+	{"unknown-format", "/admin/reports/arrivals?date=2040-01-10&format=pdf", http.StatusSeeOther, "", 0},
+	{"csv-invalid-date", "/admin/reports/arrivals?date=tomorrow&format=csv", http.StatusSeeOther, "", 0},
+	{"database-fails", "/admin/reports/arrivals?date=2060-01-01", http.StatusInternalServerError, "", 0},
+}
+
+// TestAdminDailyReport tests the AdminArrivalsReport and AdminDeparturesReport handlers
+func TestAdminDailyReport(t *testing.T) {
+	for _, e := range adminDailyReportTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminArrivalsReport)
+		if strings.Contains(e.url, "departures") {
+			handler = Repo.AdminDeparturesReport
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.expectedContentType == "" {
+			continue
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, got %s", e.name, e.expectedContentType, ct)
+		}
+		if rows := strings.Count(rr.Body.String(), "\r\n"); rows != e.expectedRows {
+			t.Errorf("%s: expected %d rows, got %d", e.name, e.expectedRows, rows)
+		}
+	}
+}
+
+// TestSendArrivalsReport tests that the arrivals of a day are emailed to the staff
+func TestSendArrivalsReport(t *testing.T) {
+	recipients := Repo.App.ArrivalsReportTo
+	Repo.App.ArrivalsReportTo = []string{"desk@example.com", "manager@example.com"}
+	defer func() { Repo.App.ArrivalsReportTo = recipients }()
+
+	arrivals, err := Repo.SendArrivalsReport(context.Background(), parseDate("2040-01-10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arrivals != 2 {
+		t.Errorf("expected 2 arrivals, got %d", arrivals)
+	}
+
+	_, err = Repo.SendArrivalsReport(context.Background(), parseDate("2060-01-01"))
+	if err == nil {
+		t.Error("expected an error when the reservations can't be read")
+	}
+}
+
+// TestOccupancyReport tests that the occupancy report counts the stays of the period that hold their room
+// and the cancellations of its arrivals
+func TestOccupancyReport(t *testing.T) {
+	report, err := Repo.occupancyReport(context.Background(), parseDate("2040-01-01"), parseDate("2040-02-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := report.Total()
+	if total.AvailableNights != 62 || total.NightsSold != 6 || total.Revenue != 72000 || total.Bookings != 3 ||
+		total.Cancellations != 1 {
+		t.Errorf("expected 6 of 62 nights sold for 72000 and 1 of 3 arrivals cancelled, got %+v", total)
+	}
+
+	_, err = Repo.occupancyReport(context.Background(), parseDate("2060-01-01"), parseDate("2060-02-01"))
+	if err == nil {
+		t.Error("expected an error when the reservations can't be read")
+	}
+}
+
+// adminOccupancyReportTests is the data for the AdminOccupancyReport handler tests
+var adminOccupancyReportTests = []struct {
+	name                string
+	url                 string
+	expectedStatusCode  int
+	expectedContentType string
+	expectedRows        int
+}{
+	{"default", "/admin/reports/occupancy", http.StatusOK, "", 0},
+	{"period", "/admin/reports/occupancy?from=2040-01-01&to=2040-03-31", http.StatusOK, "", 0},
+	{"one-day", "/admin/reports/occupancy?from=2040-01-10&to=2040-01-10", http.StatusOK, "", 0},
+	{"to-before-from", "/admin/reports/occupancy?from=2040-01-10&to=2040-01-09", http.StatusOK, "", 0},
+	{"too-long", "/admin/reports/occupancy?from=2040-01-01&to=2045-01-01", http.StatusOK, "", 0},
+	{"missing-to", "/admin/reports/occupancy?from=2040-01-01", http.StatusOK, "", 0},
+	{"csv", "/admin/reports/occupancy?from=2040-01-01&to=2040-01-31&format=csv", http.StatusOK, "text/csv; charset=utf-8", 5},
+	{"xlsx", "/admin/reports/occupancy?from=2040-01-01&to=2040-01-31&format=xlsx", http.StatusOK,
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", 0},
+	{"unknown-format", "/admin/reports/occupancy?format=pdf", http.StatusSeeOther, "", 0},
+	{"csv-invalid-period", "/admin/reports/occupancy?from=2040-01-10&to=2040-01-09&format=csv", http.StatusSeeOther, "", 0},
+	{"database-fails", "/admin/reports/occupancy?from=2060-01-01&to=2060-01-31", http.StatusInternalServerError, "", 0},
+}
+
+// TestAdminOccupancyReport tests the AdminOccupancyReport handler
+func TestAdminOccupancyReport(t *testing.T) {
+	for _, e := range adminOccupancyReportTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminOccupancyReport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.expectedContentType == "" {
+			continue
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, got %s", e.name, e.expectedContentType, ct)
+		}
+		if e.expectedRows == 0 {
+			continue
+		}
+		if rows := strings.Count(rr.Body.String(), "\r\n"); rows != e.expectedRows {
+			t.Errorf("%s: expected %d rows, got %d", e.name, e.expectedRows, rows)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+)
+
+const (
+	// maxImportSize is the largest file of reservations that can be imported
+	maxImportSize = 5 << 20
+	// maxImportRows is the most rows a file of reservations can have, since each is checked against the calendar
+	maxImportRows = 2000
+)
+
+// importFields maps the headers of the columns of an import file, in lower case with underscores for spaces,
+// to the fields of its rows. The headers of a reservation export are understood, and other columns ignored.
+var importFields = map[string]string{
+	"type":       "type",
+	"room":       "room",
+	"room_id":    "room",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"email":      "email",
+	"phone":      "phone",
+	"arrival":    "start",
+	"start_date": "start",
+	"departure":  "end",
+	"end_date":   "end",
+	"adults":     "adults",
+	"children":   "children",
+	"status":     "status",
+	"total":      "total",
+}
+
+// importLabels are the names errors give the fields of an import row, in the order errors are listed
+var importLabels = []struct{ field, label string }{
+	{"type", "Type"},
+	{"room", "Room"},
+	{"first_name", "First name"},
+	{"last_name", "Last name"},
+	{"email", "Email"},
+	{"phone", "Phone"},
+	{"start", "Arrival"},
+	{"end", "Departure"},
+	{"adults", "Adults"},
+	{"children", "Children"},
+	{"status", "Status"},
+	{"total", "Total"},
+}
+
+// importRow is a row of an import file with the reservation or block read from it and what's wrong with it
+type importRow struct {
+	models.ImportRow
+	Errors []string
+}
+
+// importError is a problem with a whole import file rather than one of its rows
+type importError string
+
+func (e importError) Error() string {
+	return string(e)
+}
+
+// AdminImportReservations shows the form to import reservations and blocks from a CSV file
+func (repository *Repository) AdminImportReservations(w http.ResponseWriter, r *http.Request) {
+	repository.renderImport(w, r, forms.New(nil), nil, "", i18n.Default)
+}
+
+// AdminPostImportReservations reads an uploaded CSV file of reservations and blocks and shows what it would
+// import, with the errors of each row. The preview posts the file back once confirmed; it is read and
+// checked again, and every row is imported in one transaction unless one has errors.
+func (repository *Repository) AdminPostImportReservations(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", fmt.Sprintf("Imports are limited to %d MB", maxImportSize>>20))
+		http.Redirect(w, r, "/admin/reservations-import", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.Form)
+
+	locale := form.Get("locale")
+	if !i18n.IsSupported(locale) {
+		locale = i18n.Default
+	}
+
+	// the preview posts back the content of the file it was made from
+	content := form.Get("content")
+	if file, _, err := r.FormFile("file"); err == nil {
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		content = string(data)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		form.Errors.Add("file", "Choose a CSV file to import")
+		repository.renderImport(w, r, form, nil, "", locale)
+		return
+	}
+
+	rows, err := repository.readImport(r, content, locale)
+	var fileErr importError
+	if errors.As(err, &fileErr) {
+		form.Errors.Add("file", fileErr.Error())
+		repository.renderImport(w, r, form, nil, "", locale)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if form.Get("confirm") != "" && importValid(rows) {
+		imported := make([]models.ImportRow, len(rows))
+		for i, row := range rows {
+			imported[i] = row.ImportRow
+		}
+
+		err = repository.DB.ImportReservations(r.Context(), imported)
+		var rowErr *dbrepo.ImportRowError
+		switch {
+		case errors.As(err, &rowErr) && errors.Is(err, dbrepo.ErrRoomUnavailable):
+			// somebody booked one of the rooms since the preview, so nothing was imported
+			for i := range rows {
+				if rows[i].Line == rowErr.Line {
+					rows[i].Errors = append(rows[i].Errors, "The room was booked or blocked for these dates in the meantime")
+				}
+			}
+		case err != nil:
+			helpers.ServerError(w, err)
+			return
+		default:
+			reservations, blocks := importCounts(rows)
+			repository.App.Session.Put(r.Context(), "flash",
+				fmt.Sprintf("Imported %d reservations and %d blocks", reservations, blocks))
+			http.Redirect(w, r, "/admin/reservations-all", http.StatusSeeOther)
+			return
+		}
+	}
+
+	repository.renderImport(w, r, form, rows, content, locale)
+}
+
+// renderImport shows the import form, and the preview of the rows of the file uploaded, if any
+func (repository *Repository) renderImport(w http.ResponseWriter, r *http.Request, form *forms.Form, rows []importRow, content, locale string) {
+	data := make(map[string]interface{})
+	data["rows"] = rows
+	data["valid"] = importValid(rows)
+
+	reservations, blocks := importCounts(rows)
+	intMap := make(map[string]int)
+	intMap["reservations"] = reservations
+	intMap["blocks"] = blocks
+
+	stringMap := make(map[string]string)
+	stringMap["content"] = content
+	stringMap["locale"] = locale
+
+	render.Template(w, r, "admin-reservations-import.page.tmpl.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// importValid reports whether there are rows to import and none of them has errors
+func importValid(rows []importRow) bool {
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			return false
+		}
+	}
+	return len(rows) > 0
+}
+
+// importCounts returns the number of reservations and blocks of an import
+func importCounts(rows []importRow) (int, int) {
+	reservations, blocks := 0, 0
+	for _, row := range rows {
+		if row.Kind == models.ImportBlock {
+			blocks++
+		} else {
+			reservations++
+		}
+	}
+	return reservations, blocks
+}
+
+// readImport reads the rows of a CSV import file, with fields separated by commas or semicolons and dates
+// and amounts written the way they are in locale, and checks each row like the reservation forms do. The
+// room of each reservation or block must be free for its dates, both in the calendar and in the rows
+// before it. Problems with the whole file are returned as an importError.
+func (repository *Repository) readImport(r *http.Request, content, locale string) ([]importRow, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, _, _ := strings.Cut(content, "\n")
+	if strings.Count(header, ";") > strings.Count(header, ",") {
+		reader.Comma = ';'
+	}
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, importError("The file isn't a CSV file with a header row")
+	}
+
+	fields := make([]string, len(headers))
+	found := make(map[string]bool)
+	for i, h := range headers {
+		fields[i] = importFields[strings.ReplaceAll(strings.ToLower(strings.TrimSpace(h)), " ", "_")]
+		found[fields[i]] = true
+	}
+	if !found["room"] || !found["start"] || !found["end"] {
+		return nil, importError("The file needs Room, Arrival and Departure columns")
+	}
+
+	rooms, err := repository.DB.GetAllRooms(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	roomsByKey := make(map[string]models.Room)
+	for _, room := range rooms {
+		roomsByKey[strconv.Itoa(room.ID)] = room
+		roomsByKey[room.Slug] = room
+		roomsByKey[strings.ToLower(room.RoomName)] = room
+	}
+
+	base := currency.Get(repository.App.Currency)
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, importError("The file isn't valid CSV: " + err.Error())
+		}
+		if len(rows) == maxImportRows {
+			return nil, importError(fmt.Sprintf("Imports are limited to %d rows", maxImportRows))
+		}
+
+		line, _ := reader.FieldPos(0)
+		values := url.Values{}
+		for i, value := range record {
+			if i < len(fields) && fields[i] != "" {
+				values.Set(fields[i], strings.TrimSpace(value))
+			}
+		}
+
+		row := importRow{ImportRow: models.ImportRow{Line: line}}
+		form := importForm(values, locale, base, roomsByKey, &row.ImportRow)
+
+		for _, l := range importLabels {
+			if msg := form.Errors.Get(l.field); msg != "" {
+				row.Errors = append(row.Errors, l.label+": "+msg)
+			}
+		}
+
+		if form.Valid() && row.TakesRoom() {
+			msg, err := repository.importAvailability(r, rows, row.ImportRow)
+			if err != nil {
+				return nil, err
+			}
+			if msg != "" {
+				row.Errors = append(row.Errors, msg)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, importError("The file has no rows to import")
+	}
+
+	return rows, nil
+}
+
+// importForm checks the fields of an import row with the form rules and fills in the row from them, reading
+// the total in the base currency
+func importForm(values url.Values, locale string, base currency.Currency, rooms map[string]models.Room, row *models.ImportRow) *forms.Form {
+	// dates and amounts are read the way the language of the file writes them
+	for _, field := range []string{"start", "end"} {
+		if d, err := time.Parse(i18n.T(locale, "date.format"), values.Get(field)); err == nil {
+			values.Set(field, d.Format(forms.DateLayout))
+		}
+	}
+	if i18n.T(locale, "number.decimal") == "," {
+		values.Set("total", strings.Replace(values.Get("total"), ",", ".", 1))
+	}
+
+	form := forms.New(values)
+
+	row.Kind = strings.ToLower(form.Get("type"))
+	if row.Kind == "" {
+		row.Kind = models.ImportReservation
+	}
+	if row.Kind != models.ImportReservation && row.Kind != models.ImportBlock {
+		form.Errors.Add("type", "Type must be reservation or block")
+	}
+
+	form.Required("room")
+	room, ok := rooms[strings.ToLower(form.Get("room"))]
+	if form.Has("room") && !ok {
+		form.Errors.Add("room", "Unknown room")
+	}
+
+	maxNights := 0
+	if row.Kind == models.ImportReservation {
+		maxNights = maxStayNights
+	}
+	form.DateRange("start", "end", maxNights)
+
+	res := &row.Reservation
+	res.RoomID, res.Room = room.ID, room
+	res.StartDate, res.EndDate = form.Date("start"), form.Date("end")
+
+	if row.Kind != models.ImportReservation {
+		return form
+	}
+
+	form.Required("first_name", "last_name", "email")
+	form.MaxLength("first_name", 255)
+	form.MaxLength("last_name", 255)
+	form.IsEmail("email")
+	if form.Has("phone") {
+		form.IsPhone("phone")
+	}
+
+	adults, children, err := parseGuests(form, "adults", "children")
+	if err == nil && ok && !room.Fits(adults, children) {
+		form.Errors.Add("children", fmt.Sprintf("%s sleeps at most %d guests", room.RoomName, room.MaxOccupancy))
+	}
+
+	res.Status = strings.ToLower(form.Get("status"))
+	if res.Status == "" {
+		res.Status = models.ReservationConfirmed
+	}
+	if res.Status != models.ReservationConfirmed && res.Status != models.ReservationCancelled {
+		form.Errors.Add("status", "Status must be confirmed or cancelled")
+	}
+
+	if form.Has("total") && form.Matches("total", pricePattern, "Total must be an amount such as 120.00") {
+		total, _ := strconv.ParseFloat(strings.TrimPrefix(form.Get("total"), "$"), 64)
+		res.Total = int(math.Round(total * math.Pow10(base.Decimals)))
+	}
+
+	res.FirstName = form.Get("first_name")
+	res.LastName = form.Get("last_name")
+	res.Email = form.Get("email")
+	res.Phone = form.Get("phone")
+	res.Adults, res.Children = adults, children
+
+	return form
+}
+
+// importAvailability returns why the room of an import row isn't free for its dates, or an empty string when
+// it is: it is booked or blocked in the calendar, or taken by one of the rows before it
+func (repository *Repository) importAvailability(r *http.Request, before []importRow, row models.ImportRow) (string, error) {
+	res := row.Reservation
+
+	for _, other := range before {
+		if len(other.Errors) == 0 && other.TakesRoom() && other.Reservation.RoomID == res.RoomID &&
+			res.StartDate.Before(other.Reservation.EndDate) && res.EndDate.After(other.Reservation.StartDate) {
+			return fmt.Sprintf("Overlaps line %d in the same room", other.Line), nil
+		}
+	}
+
+	// the restrictions are looked up by night, so a stay ending when another begins doesn't overlap it
+	restrictions, err := repository.DB.GetRestrictionsForRoomByDate(r.Context(), res.RoomID, res.StartDate, res.EndDate.AddDate(0, 0, -1))
+	if err != nil {
+		return "", err
+	}
+	if len(restrictions) > 0 {
+		return "The room is booked or blocked for these dates", nil
+	}
+
+	return "", nil
+}
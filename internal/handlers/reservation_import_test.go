@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// importHeader is the header row of the import files of the tests
+const importHeader = "Type,Room,First name,Last name,Email,Arrival,Departure,Adults,Total\n"
+
+// readImportTests is the data for the tests of reading an import file
+var readImportTests = []struct {
+	name           string
+	locale         string
+	content        string
+	expectedErrors []int
+	expectedFile   bool
+}{
+	{"valid", "en", importHeader +
+		"reservation,generals-quarters,Jane,Doe,jane@doe.com,2050-01-01,2050-01-03,2,240.00\n" +
+		"block,Major's Suite,,,,2050-01-01,2050-02-01,,\n" +
+		"Reservation,1,John,Smith,john@smith.com,2050-01-03,2050-01-05,,\n", []int{0, 0, 0}, false},
+	{"portuguese", "pt", "\ufeffTipo;Room;First name;Last name;Email;Arrival;Departure;Total\n" +
+		";generals-quarters;Jane;Doe;jane@doe.com;01/01/2050;03/01/2050;240,00\n", []int{0}, false},
+	{"row-errors", "en", importHeader +
+		"stay,generals-quarters,Jane,Doe,jane@doe.com,2050-01-01,2050-01-03,,\n" +
+		"reservation,penthouse,,Doe,jane,2050-01-03,2050-01-01,x,ten\n" +
+		"reservation,generals-quarters,Jane,Doe,jane@doe.com,2050-01-01,2050-01-03,4,\n", []int{1, 6, 1}, false},
+	{"overlaps", "en", importHeader +
+		"block,generals-quarters,,,,2050-01-01,2050-01-05,,\n" +
+		"reservation,generals-quarters,Jane,Doe,jane@doe.com,2050-01-04,2050-01-06,,\n" +
+		"reservation,generals-quarters,Jane,Doe,jane@doe.com,2050-01-05,2050-01-06,,\n" +
+		"reservation,majors-suite,Jane,Doe,jane@doe.com,2040-01-12,2040-01-14,,\n", []int{0, 1, 0, 1}, false},
+	{"cancelled-doesnt-take-the-room", "en", "Room,First name,Last name,Email,Arrival,Departure,Status\n" +
+		"majors-suite,Jane,Doe,jane@doe.com,2040-01-12,2040-01-14,cancelled\n" +
+		"majors-suite,Jane,Doe,jane@doe.com,2040-01-12,2040-01-14,pending\n", []int{0, 1}, false},
+	{"missing-columns", "en", "First name,Last name\nJane,Doe\n", nil, true},
+	{"no-rows", "en", importHeader, nil, true},
+	{"invalid-csv", "en", importHeader + "reservation,\"generals\n", nil, true},
+}
+
+// TestReadImport tests that each row of an import file is checked and the errors of the file are reported
+func TestReadImport(t *testing.T) {
+	for _, e := range readImportTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations-import", nil)
+		req = req.WithContext(getCtx(req))
+
+		rows, err := Repo.readImport(req, e.content, e.locale)
+
+		_, fileErr := err.(importError)
+		if fileErr != e.expectedFile || err != nil && !fileErr {
+			t.Errorf("%s: expected a file error to be %t, got %v", e.name, e.expectedFile, err)
+			continue
+		}
+
+		if len(rows) != len(e.expectedErrors) {
+			t.Errorf("%s: expected %d rows, got %d", e.name, len(e.expectedErrors), len(rows))
+			continue
+		}
+		for i, row := range rows {
+			if len(row.Errors) != e.expectedErrors[i] {
+				t.Errorf("%s: expected %d errors on line %d, got %v", e.name, e.expectedErrors[i], row.Line, row.Errors)
+			}
+		}
+	}
+}
+
+// TestReadImportRows tests that the reservations and blocks are read from the rows of an import file
+func TestReadImportRows(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/admin/reservations-import", nil)
+	req = req.WithContext(getCtx(req))
+
+	rows, err := Repo.readImport(req, readImportTests[1].content, "pt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := rows[0].Reservation
+	if rows[0].Line != 2 || rows[0].Kind != "reservation" || res.RoomID != 1 || res.Total != 24000 ||
+		res.Status != "confirmed" || res.Adults != 1 || res.StartDate.Format(dateLayout) != "2050-01-01" {
+		t.Errorf("expected a confirmed reservation of room 1 for 240.00 on line 2, got %+v", rows[0])
+	}
+}
+
+// postImportTests is the data for the AdminPostImportReservations handler tests
+var postImportTests = []struct {
+	name               string
+	file               string
+	fields             map[string]string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"preview", importHeader + "reservation,generals-quarters,Jane,Doe,jane@doe.com,2050-01-01,2050-01-03,2,\n", nil, http.StatusOK, ""},
+	{"no-file", "", nil, http.StatusOK, ""},
+	{"missing-columns", "First name\nJane\n", nil, http.StatusOK, ""},
+	{"import", "", map[string]string{"confirm": "1", "content": importHeader + "reservation,generals-quarters,Jane,Doe,jane@doe.com,2050-01-01,2050-01-03,2,\n"}, http.StatusSeeOther, "/admin/reservations-all"},
+	{"import-with-errors", "", map[string]string{"confirm": "1", "content": importHeader + "reservation,penthouse,Jane,Doe,jane@doe.com,2050-01-01,2050-01-03,2,\n"}, http.StatusOK, ""},
+	{"room-taken-meanwhile", "", map[string]string{"confirm": "1", "content": importHeader + "reservation,generals-quarters,Jane,Doe,taken@example.com,2050-01-01,2050-01-03,2,\n"}, http.StatusOK, ""},
+	{"database-fails", "", map[string]string{"confirm": "1", "content": importHeader + "reservation,generals-quarters,Jane,Doe,fail@example.com,2050-01-01,2050-01-03,2,\n"}, http.StatusInternalServerError, ""},
+}
+
+// TestAdminPostImportReservations tests the AdminPostImportReservations handler
+func TestAdminPostImportReservations(t *testing.T) {
+	for _, e := range postImportTests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, value := range e.fields {
+			mw.WriteField(name, value)
+		}
+		if e.file != "" {
+			fw, _ := mw.CreateFormFile("file", "reservations.csv")
+			fw.Write([]byte(e.file))
+		}
+		mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/reservations-import", &body)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostImportReservations)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc)
+			}
+			if flash := session.GetString(ctx, "flash"); !strings.HasPrefix(flash, "Imported 1 reservations") {
+				t.Errorf("%s: expected the import to be reported, got %q", e.name, flash)
+			}
+		}
+	}
+}
+
+// TestAdminImportReservations tests the AdminImportReservations handler
+func TestAdminImportReservations(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations-import", nil)
+	req = req.WithContext(getCtx(req))
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminImportReservations)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminImportReservations returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
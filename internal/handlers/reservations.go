@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/export"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+)
+
+// reservationsPerPage is the number of reservations on each page of the admin reservation lists
+const reservationsPerPage = 25
+
+// reservationStatuses are the statuses the admin reservation lists can be filtered by
+var reservationStatuses = []string{
+	models.ReservationPending,
+	models.ReservationConfirmed,
+	models.ReservationExpired,
+	models.ReservationCancelled,
+}
+
+// reservationSortColumns are the orders the admin reservation lists can be sorted in
+var reservationSortColumns = []string{
+	models.SortByID,
+	models.SortByGuest,
+	models.SortByRoom,
+	models.SortByArrival,
+	models.SortByDeparture,
+	models.SortByStatus,
+	models.SortByCreated,
+}
+
+// reservationFilters are the query parameters of an admin reservation list that are kept in its links
+var reservationFilters = []string{"q", "room", "from", "to", "status", "sort", "dir"}
+
+// ReservationSummary is a reservation in the JSON variant of the admin reservation lists
+type ReservationSummary struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	RoomID    int    `json:"room_id"`
+	Room      string `json:"room"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Status    string `json:"status"`
+	Total     int    `json:"total"`
+	Processed bool   `json:"processed"`
+	URL       string `json:"url"`
+}
+
+// ReservationsResponse is one page of an admin reservation list
+type ReservationsResponse struct {
+	OK           bool                 `json:"ok"`
+	Message      string               `json:"message"`
+	Reservations []ReservationSummary `json:"reservations"`
+	Total        int                  `json:"total"`
+	Page         int                  `json:"page"`
+	Pages        int                  `json:"pages"`
+	PerPage      int                  `json:"per_page"`
+}
+
+// reservationsPage is a link to one page of an admin reservation list
+type reservationsPage struct {
+	Number int
+	URL    string
+}
+
+// reservationSearch reads the search of an admin reservation list from its query string. Filters that
+// aren't valid are left out of the search and reported in the form errors. Without a sort the latest
+// arrivals come first.
+func reservationSearch(form *forms.Form, newOnly bool) models.ReservationQuery {
+	search := models.ReservationQuery{
+		Search:  strings.TrimSpace(form.Get("q")),
+		NewOnly: newOnly,
+		Sort:    form.Get("sort"),
+		Desc:    form.Get("dir") == "desc",
+		Page:    1,
+		PerPage: reservationsPerPage,
+	}
+
+	if search.Sort == "" {
+		search.Sort, search.Desc = models.SortByArrival, true
+	} else if !contains(reservationSortColumns, search.Sort) {
+		form.Errors.Add("sort", "Unknown sort order")
+		search.Sort = models.SortByArrival
+	}
+
+	if form.Has("room") && form.InRange("room", 1, math.MaxInt32) {
+		search.RoomID = form.Int("room")
+	}
+	if form.Has("from") && form.IsDate("from") {
+		search.From = form.Date("from")
+	}
+	if form.Has("to") && form.IsDate("to") {
+		search.To = form.Date("to")
+	}
+	if !search.From.IsZero() && !search.To.IsZero() && search.To.Before(search.From) {
+		form.Errors.Add("to", "forms.date_order")
+		search.To = time.Time{}
+	}
+	if status := form.Get("status"); status != "" {
+		if contains(reservationStatuses, status) {
+			search.Status = status
+		} else {
+			form.Errors.Add("status", "Unknown status")
+		}
+	}
+	if form.Has("page") && form.InRange("page", 1, math.MaxInt32) {
+		search.Page = form.Int("page")
+	}
+
+	return search
+}
+
+// contains reports whether value is one of values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// reservationListURL returns the link to an admin reservation list with the filters of query, changed by
+// the given parameters. An empty value removes the parameter.
+func reservationListURL(path string, query url.Values, params ...string) string {
+	values := url.Values{}
+	for _, key := range reservationFilters {
+		if value := strings.TrimSpace(query.Get(key)); value != "" {
+			values.Set(key, value)
+		}
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] == "" {
+			values.Del(params[i])
+		} else {
+			values.Set(params[i], params[i+1])
+		}
+	}
+
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+// AdminAllReservations lists every reservation, one page at a time
+func (repository *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	repository.adminReservations(w, r, "all")
+}
+
+// AdminNewReservation lists the reservations that weren't processed yet, one page at a time
+func (repository *Repository) AdminNewReservation(w http.ResponseWriter, r *http.Request) {
+	repository.adminReservations(w, r, "new")
+}
+
+// adminReservations shows a page of the admin reservation list of section, searched, filtered and sorted
+// by the query string
+func (repository *Repository) adminReservations(w http.ResponseWriter, r *http.Request, section string) {
+	form := forms.New(r.URL.Query())
+	search := reservationSearch(form, section == "new")
+
+	reservations, total, err := repository.DB.SearchReservations(r.Context(), search)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := repository.DB.GetAllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	path := "/admin/reservations-" + section
+	query := r.URL.Query()
+
+	// sorting by a column again reverses the order, and every new order starts from the first page
+	sorts := make(map[string]string)
+	for _, column := range reservationSortColumns {
+		dir := "asc"
+		if column == search.Sort && !search.Desc {
+			dir = "desc"
+		}
+		sorts[column] = reservationListURL(path, query, "sort", column, "dir", dir)
+	}
+
+	var pages []reservationsPage
+	for page := 1; page <= (total+reservationsPerPage-1)/reservationsPerPage; page++ {
+		pages = append(pages, reservationsPage{
+			Number: page,
+			URL:    reservationListURL(path, query, "page", strconv.Itoa(page)),
+		})
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+	data["search"] = search
+	data["rooms"] = rooms
+	data["statuses"] = reservationStatuses
+	data["sorts"] = sorts
+	data["pages"] = pages
+	data["columns"] = export.Columns
+
+	intMap := make(map[string]int)
+	intMap["total"] = total
+
+	stringMap := make(map[string]string)
+	stringMap["section"] = section
+	stringMap["title"] = "All Reservations"
+	if section == "new" {
+		stringMap["title"] = "New Reservations"
+	}
+
+	render.Template(w, r, "admin-reservations.page.tmpl.html", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// AdminAllReservationsJSON returns a page of every reservation as JSON, searched the same way as the list
+func (repository *Repository) AdminAllReservationsJSON(w http.ResponseWriter, r *http.Request) {
+	repository.adminReservationsJSON(w, r, "all")
+}
+
+// AdminNewReservationsJSON returns a page of the unprocessed reservations as JSON, searched the same way as
+// the list
+func (repository *Repository) AdminNewReservationsJSON(w http.ResponseWriter, r *http.Request) {
+	repository.adminReservationsJSON(w, r, "new")
+}
+
+// adminReservationsJSON writes a page of the admin reservation list of section as JSON. Unlike the list
+// page, it rejects a search with filters that aren't valid.
+func (repository *Repository) adminReservationsJSON(w http.ResponseWriter, r *http.Request, section string) {
+	form := forms.New(r.URL.Query())
+	search := reservationSearch(form, section == "new")
+
+	if !form.Valid() {
+		writeReservations(w, http.StatusBadRequest, ReservationsResponse{
+			OK:      false,
+			Message: "Invalid search",
+		})
+		return
+	}
+
+	reservations, total, err := repository.DB.SearchReservations(r.Context(), search)
+	if err != nil {
+		repository.App.ErrorLog.Println(err)
+		writeReservations(w, http.StatusInternalServerError, ReservationsResponse{
+			OK:      false,
+			Message: "Internal server error",
+		})
+		return
+	}
+
+	resp := ReservationsResponse{
+		OK:           true,
+		Reservations: []ReservationSummary{},
+		Total:        total,
+		Page:         search.Page,
+		Pages:        (total + reservationsPerPage - 1) / reservationsPerPage,
+		PerPage:      reservationsPerPage,
+	}
+	for _, res := range reservations {
+		resp.Reservations = append(resp.Reservations, ReservationSummary{
+			ID:        res.ID,
+			FirstName: res.FirstName,
+			LastName:  res.LastName,
+			Email:     res.Email,
+			RoomID:    res.RoomID,
+			Room:      res.Room.RoomName,
+			StartDate: res.StartDate.Format(dateLayout),
+			EndDate:   res.EndDate.Format(dateLayout),
+			Status:    res.Status,
+			Total:     res.Total,
+			Processed: res.Processed != 0,
+			URL:       "/admin/reservations/" + section + "/" + strconv.Itoa(res.ID) + "/show",
+		})
+	}
+
+	writeReservations(w, http.StatusOK, resp)
+}
+
+// writeReservations writes a page of an admin reservation list as JSON
+func writeReservations(w http.ResponseWriter, status int, resp ReservationsResponse) {
+	out, _ := json.MarshalIndent(resp, "", "     ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// AdminExportAllReservations downloads every reservation matching the search of the list as a CSV or XLSX file
+func (repository *Repository) AdminExportAllReservations(w http.ResponseWriter, r *http.Request) {
+	repository.adminExportReservations(w, r, "all")
+}
+
+// AdminExportNewReservations downloads the unprocessed reservations matching the search of the list as a CSV
+// or XLSX file
+func (repository *Repository) AdminExportNewReservations(w http.ResponseWriter, r *http.Request) {
+	repository.adminExportReservations(w, r, "new")
+}
+
+// adminExportReservations streams the reservations of the admin reservation list of section that match the
+// search of the query string, in the format, columns and language picked, without paging
+func (repository *Repository) adminExportReservations(w http.ResponseWriter, r *http.Request, section string) {
+	form := forms.New(r.URL.Query())
+	search := reservationSearch(form, section == "new")
+
+	format, ok := export.ParseFormat(form.Get("format"))
+	if !form.Has("format") {
+		format, ok = export.CSV, true
+	}
+	columns, err := export.ColumnsFor(form.Values["columns"])
+	locale := form.Get("locale")
+	if !form.Has("locale") {
+		locale = i18n.Default
+	}
+
+	if !ok || err != nil || !i18n.IsSupported(locale) || !form.Valid() {
+		repository.App.Session.Put(r.Context(), "error", "Invalid export")
+		http.Redirect(w, r, reservationListURL("/admin/reservations-"+section, r.URL.Query()), http.StatusSeeOther)
+		return
+	}
+
+	opts := export.Options{
+		Format:   format,
+		Columns:  columns,
+		Currency: currency.Get(repository.App.Currency),
+		Locale:   locale,
+	}
+
+	// the file is started with the first reservation, so a search that fails right away is still an error page
+	var ew *export.Writer
+	start := func() error {
+		filename := "reservations-" + section + "-" + time.Now().Format(dateLayout) + "." + string(format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		var err error
+		ew, err = export.NewWriter(w, opts)
+		return err
+	}
+
+	err = repository.DB.EachReservation(r.Context(), search, func(res models.Reservation) error {
+		if ew == nil {
+			err := start()
+			if err != nil {
+				return err
+			}
+		}
+		return ew.Write(res)
+	})
+	if err != nil && ew == nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if ew == nil {
+		// no reservation matched, so the file only has the headers
+		err = start()
+	}
+	if err == nil {
+		err = ew.Close()
+	}
+
+	// the download was under way, so it can only be cut short
+	if err != nil {
+		repository.App.ErrorLog.Println(err)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// reservationSearchTests is the data for the tests of the search of the admin reservation lists
+var reservationSearchTests = []struct {
+	name           string
+	query          string
+	expectedSort   string
+	expectedDesc   bool
+	expectedPage   int
+	expectedRoom   int
+	expectedStatus string
+	expectedErrors []string
+}{
+	{"default", "", models.SortByArrival, true, 1, 0, "", nil},
+	{"sorted", "sort=guest&dir=asc&page=3", models.SortByGuest, false, 3, 0, "", nil},
+	{"filtered", "room=2&status=pending&from=2040-01-01&to=2040-02-01", models.SortByArrival, true, 1, 2, models.ReservationPending, nil},
+	{"invalid-filters", "room=x&status=lost&from=soon&page=0", models.SortByArrival, true, 1, 0, "", []string{"room", "status", "from", "page"}},
+	{"unknown-sort", "sort=price", models.SortByArrival, false, 1, 0, "", []string{"sort"}},
+	{"dates-out-of-order", "from=2040-02-01&to=2040-01-01", models.SortByArrival, true, 1, 0, "", []string{"to"}},
+}
+
+// TestReservationSearch tests that the search of an admin reservation list is read from its query string
+func TestReservationSearch(t *testing.T) {
+	for _, e := range reservationSearchTests {
+		query, _ := url.ParseQuery(e.query)
+		form := forms.New(query)
+
+		search := reservationSearch(form, false)
+
+		if search.Sort != e.expectedSort || search.Desc != e.expectedDesc || search.Page != e.expectedPage {
+			t.Errorf("%s: expected sort %s, desc %t, page %d, got %s, %t, %d", e.name, e.expectedSort, e.expectedDesc, e.expectedPage, search.Sort, search.Desc, search.Page)
+		}
+		if search.RoomID != e.expectedRoom || search.Status != e.expectedStatus {
+			t.Errorf("%s: expected room %d and status %q, got %d and %q", e.name, e.expectedRoom, e.expectedStatus, search.RoomID, search.Status)
+		}
+		for _, field := range e.expectedErrors {
+			if form.Errors.Get(field) == "" {
+				t.Errorf("%s: expected an error for %s", e.name, field)
+			}
+		}
+		if len(e.expectedErrors) == 0 && !form.Valid() {
+			t.Errorf("%s: expected no errors, got %v", e.name, form.Errors)
+		}
+	}
+}
+
+// TestReservationListURL tests that the links of an admin reservation list keep its filters
+func TestReservationListURL(t *testing.T) {
+	query, _ := url.ParseQuery("q=smith&status=pending&page=2&csrf_token=x&room=")
+
+	got := reservationListURL("/admin/reservations-all", query, "sort", "guest", "dir", "desc")
+	expected := "/admin/reservations-all?dir=desc&q=smith&sort=guest&status=pending"
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+
+	got = reservationListURL("/admin/reservations-new", url.Values{}, "page", "3")
+	if got != "/admin/reservations-new?page=3" {
+		t.Errorf("expected the page link, got %s", got)
+	}
+
+	got = reservationListURL("/admin/reservations-new", url.Values{}, "status", "")
+	if got != "/admin/reservations-new" {
+		t.Errorf("expected the list without a query string, got %s", got)
+	}
+}
+
+// adminReservationsTests is the data for the admin reservation list handler tests
+var adminReservationsTests = []struct {
+	name               string
+	url                string
+	newOnly            bool
+	expectedStatusCode int
+}{
+	{"all", "/admin/reservations-all?q=smith&sort=guest", false, http.StatusOK},
+	{"new", "/admin/reservations-new?page=2", true, http.StatusOK},
+	{"invalid-filters", "/admin/reservations-all?status=lost", false, http.StatusOK},
+	{"database-fails", "/admin/reservations-all?q=fail", false, http.StatusInternalServerError},
+}
+
+// TestAdminReservations tests the handlers of the admin reservation lists
+func TestAdminReservations(t *testing.T) {
+	for _, e := range adminReservationsTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminAllReservations)
+		if e.newOnly {
+			handler = Repo.AdminNewReservation
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// adminReservationsJSONTests is the data for the tests of the JSON variant of the admin reservation lists
+var adminReservationsJSONTests = []struct {
+	name               string
+	url                string
+	newOnly            bool
+	expectedStatusCode int
+	expectedIDs        []int
+	expectedTotal      int
+}{
+	{"all", "/admin/reservations-all-json", false, http.StatusOK, []int{3, 4, 5}, 3},
+	{"status", "/admin/reservations-all-json?status=cancelled", false, http.StatusOK, []int{4}, 1},
+	{"past-the-last-page", "/admin/reservations-new-json?page=2", true, http.StatusOK, []int{}, 3},
+	{"invalid-filters", "/admin/reservations-all-json?from=soon", false, http.StatusBadRequest, nil, 0},
+	{"database-fails", "/admin/reservations-all-json?q=fail", false, http.StatusInternalServerError, nil, 0},
+}
+
+// TestAdminReservationsJSON tests the JSON variant of the admin reservation lists
+func TestAdminReservationsJSON(t *testing.T) {
+	for _, e := range adminReservationsJSONTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminAllReservationsJSON)
+		if e.newOnly {
+			handler = Repo.AdminNewReservationsJSON
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+
+		var resp ReservationsResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		if err != nil {
+			t.Errorf("%s: failed to parse json: %v", e.name, err)
+			continue
+		}
+
+		if resp.OK != (e.expectedStatusCode == http.StatusOK) {
+			t.Errorf("%s: expected ok to be %t, got %t", e.name, e.expectedStatusCode == http.StatusOK, resp.OK)
+		}
+		if !resp.OK {
+			continue
+		}
+
+		var ids []int
+		for _, res := range resp.Reservations {
+			ids = append(ids, res.ID)
+		}
+		if len(ids) != len(e.expectedIDs) || resp.Total != e.expectedTotal || resp.PerPage != reservationsPerPage {
+			t.Errorf("%s: expected reservations %v of %d, got %v of %d", e.name, e.expectedIDs, e.expectedTotal, ids, resp.Total)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != e.expectedIDs[i] {
+				t.Errorf("%s: expected reservations %v, got %v", e.name, e.expectedIDs, ids)
+				break
+			}
+		}
+	}
+}
+
+// adminExportReservationsTests is the data for the tests of the export of the admin reservation lists
+var adminExportReservationsTests = []struct {
+	name                string
+	url                 string
+	newOnly             bool
+	expectedStatusCode  int
+	expectedContentType string
+	expectedRows        int
+}{
+	{"csv", "/admin/reservations-all-export?status=cancelled&columns=id&columns=total", false, http.StatusOK, "text/csv; charset=utf-8", 2},
+	{"default-columns", "/admin/reservations-new-export", true, http.StatusOK, "text/csv; charset=utf-8", 4},
+	{"xlsx", "/admin/reservations-all-export?format=xlsx", false, http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", 0},
+	{"nothing-matches", "/admin/reservations-all-export?q=nobody", false, http.StatusOK, "text/csv; charset=utf-8", 1},
+	{"unknown-format", "/admin/reservations-all-export?format=pdf", false, http.StatusSeeOther, "", 0},
+	{"unknown-column", "/admin/reservations-all-export?columns=password", false, http.StatusSeeOther, "", 0},
+	{"unknown-locale", "/admin/reservations-all-export?locale=xx", false, http.StatusSeeOther, "", 0},
+	{"invalid-filters", "/admin/reservations-all-export?from=soon", false, http.StatusSeeOther, "", 0},
+	{"database-fails", "/admin/reservations-all-export?q=fail", false, http.StatusInternalServerError, "", 0},
+}
+
+// TestAdminExportReservations tests the export of the admin reservation lists
+func TestAdminExportReservations(t *testing.T) {
+	for _, e := range adminExportReservationsTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminExportAllReservations)
+		if e.newOnly {
+			handler = Repo.AdminExportNewReservations
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		if contentType := rr.Header().Get("Content-Type"); contentType != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, got %s", e.name, e.expectedContentType, contentType)
+		}
+		if disposition := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment; filename=\"reservations-") {
+			t.Errorf("%s: expected the file to be downloaded, got %q", e.name, disposition)
+		}
+
+		if strings.Contains(e.url, "xlsx") && !strings.HasPrefix(rr.Body.String(), "PK") {
+			t.Errorf("%s: expected a spreadsheet, got %q", e.name, rr.Body.String())
+		}
+
+		// a CSV file has a header row and a row per reservation
+		if e.expectedRows > 0 {
+			if rows := strings.Count(rr.Body.String(), "\r\n"); rows != e.expectedRows {
+				t.Errorf("%s: expected %d rows, got %d in %s", e.name, e.expectedRows, rows, rr.Body.String())
+			}
+		}
+	}
+}
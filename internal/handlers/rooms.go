@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/images"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+	"github.com/go-chi/chi"
+)
+
+// legacyRoomPaths maps the room pages that predate the room catalog to room slugs
+var legacyRoomPaths = map[string]string{
+	"/generals-quarters": "generals-quarters",
+	"/majors-suite":      "majors-suite",
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var pricePattern = regexp.MustCompile(`^\s*\$?[0-9]+(\.[0-9]{1,2})?\s*$`)
+
+const (
+	// maxPhotoSize is the largest photo that can be uploaded
+	maxPhotoSize = 10 << 20
+	// maxUploadSize is the largest request the photo form can post
+	maxUploadSize = 50 << 20
+)
+
+// Rooms is the handler for the room catalog page
+func (repository *Repository) Rooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := repository.DB.GetActiveRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "rooms.page.tmpl.html", &models.TemplateData{
+		Data:  data,
+		Money: repository.priceDisplay(r),
+	})
+}
+
+// RoomDetail is the handler for the page of a single room
+func (repository *Repository) RoomDetail(w http.ResponseWriter, r *http.Request) {
+	room, err := repository.DB.GetRoomBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil || !room.Active {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.Template(w, r, "room.page.tmpl.html", &models.TemplateData{
+		Data:  data,
+		Money: repository.priceDisplay(r),
+	})
+}
+
+// LegacyRoom redirects the old room pages to their room catalog page
+func (repository *Repository) LegacyRoom(w http.ResponseWriter, r *http.Request) {
+	slug, ok := legacyRoomPaths[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.Redirect(w, r, "/rooms/"+slug, http.StatusMovedPermanently)
+}
+
+// AdminRooms lists every room, active or not
+func (repository *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := repository.DB.GetAllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rooms.page.tmpl.html", &models.TemplateData{Data: data})
+}
+
+// AdminNewRoom shows the form to create a room
+func (repository *Repository) AdminNewRoom(w http.ResponseWriter, r *http.Request) {
+	repository.renderRoom(w, r, models.Room{Capacity: 2, MaxOccupancy: 2, Active: true}, forms.New(nil))
+}
+
+// AdminShowRoom shows the form to edit a room
+func (repository *Repository) AdminShowRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	room, err := repository.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.renderRoom(w, r, room, forms.New(nil))
+}
+
+// AdminPostRoom creates a room, or updates it when the URL has a room id
+func (repository *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id := 0
+	if param := chi.URLParam(r, "id"); param != "" {
+		id, err = strconv.Atoi(param)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := forms.New(r.PostForm)
+	room := roomFromForm(form, currency.Get(repository.App.Currency))
+	room.ID = id
+
+	if !form.Valid() {
+		repository.renderRoom(w, r, room, form)
+		return
+	}
+
+	if id == 0 {
+		id, err = repository.DB.InsertRoom(r.Context(), room)
+	} else {
+		err = repository.DB.UpdateRoom(r.Context(), room)
+	}
+	if errors.Is(err, dbrepo.ErrRoomSlugExists) {
+		form.Errors.Add("slug", "Another room already has this slug")
+		repository.renderRoom(w, r, room, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", id), http.StatusSeeOther)
+}
+
+// renderRoom shows the room form with the cancellation policies a room can follow
+func (repository *Repository) renderRoom(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	policies, err := repository.DB.AllCancellationPolicies(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["policies"] = policies
+
+	render.Template(w, r, "admin-room.page.tmpl.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminDeleteRoom deletes a room that has never been booked
+func (repository *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = repository.DB.DeleteRoom(r.Context(), id)
+	if errors.Is(err, dbrepo.ErrRoomHasReservations) {
+		repository.App.Session.Put(r.Context(), "error", "This room has reservations, deactivate it instead")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", id), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminPostRoomPhotos uploads new photos of a room and updates or deletes its existing ones
+func (repository *Repository) AdminPostRoomPhotos(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	roomURL := fmt.Sprintf("/admin/rooms/%d", id)
+
+	room, err := repository.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	err = r.ParseMultipartForm(maxPhotoSize)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", fmt.Sprintf("Uploads are limited to %d MB in total", maxUploadSize>>20))
+		http.Redirect(w, r, roomURL, http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.Form)
+
+	nextPosition := 0
+	for _, photo := range room.Photos {
+		if form.Has(fmt.Sprintf("delete_%d", photo.ID)) {
+			err = repository.DB.DeleteRoomPhoto(r.Context(), photo.ID)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			}
+			repository.deletePhotoFiles(r.Context(), photo)
+			continue
+		}
+
+		photo.AltText = strings.TrimSpace(form.Get(fmt.Sprintf("alt_text_%d", photo.ID)))
+		if position := fmt.Sprintf("position_%d", photo.ID); form.IsInt(position) {
+			photo.Position = form.Int(position)
+		}
+
+		err = repository.DB.UpdateRoomPhoto(r.Context(), photo)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if photo.Position >= nextPosition {
+			nextPosition = photo.Position + 1
+		}
+	}
+
+	for _, header := range r.MultipartForm.File["photos"] {
+		if header.Size > maxPhotoSize {
+			repository.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s is larger than %d MB", header.Filename, maxPhotoSize>>20))
+			http.Redirect(w, r, roomURL, http.StatusSeeOther)
+			return
+		}
+
+		photo, err := repository.storePhoto(r.Context(), id, header)
+		if errors.Is(err, images.ErrUnsupportedType) || errors.Is(err, images.ErrTooManyPixels) {
+			repository.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s: %s", header.Filename, err))
+			http.Redirect(w, r, roomURL, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		photo.AltText = room.RoomName
+		photo.Position = nextPosition
+		nextPosition++
+
+		photo.ID, err = repository.DB.InsertRoomPhoto(r.Context(), photo)
+		if err != nil {
+			repository.deletePhotoFiles(r.Context(), photo)
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "Photos saved")
+	http.Redirect(w, r, roomURL, http.StatusSeeOther)
+}
+
+// storePhoto resizes an uploaded photo and stores every variant under a new random key
+func (repository *Repository) storePhoto(ctx context.Context, roomID int, header *multipart.FileHeader) (models.RoomPhoto, error) {
+	photo := models.RoomPhoto{RoomID: roomID}
+
+	file, err := header.Open()
+	if err != nil {
+		return photo, err
+	}
+	defer file.Close()
+
+	variants, err := images.Process(file)
+	if err != nil {
+		return photo, err
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return photo, err
+	}
+	photo.StorageKey = fmt.Sprintf("rooms/%d/%s", roomID, hex.EncodeToString(random))
+
+	for name, data := range variants {
+		err := repository.App.Blobs.Put(ctx, variantKey(photo.StorageKey, name), bytes.NewReader(data))
+		if err != nil {
+			repository.deletePhotoFiles(ctx, photo)
+			return photo, err
+		}
+	}
+
+	photo.URL = repository.App.Blobs.URL(variantKey(photo.StorageKey, "large"))
+	photo.MediumURL = repository.App.Blobs.URL(variantKey(photo.StorageKey, "medium"))
+	photo.ThumbnailURL = repository.App.Blobs.URL(variantKey(photo.StorageKey, "thumbnail"))
+
+	return photo, nil
+}
+
+// deletePhotoFiles removes the stored variants of an uploaded photo. Failures are only logged,
+// since the photo is already gone from the room.
+func (repository *Repository) deletePhotoFiles(ctx context.Context, photo models.RoomPhoto) {
+	if photo.StorageKey == "" {
+		return
+	}
+
+	for _, v := range images.Variants {
+		err := repository.App.Blobs.Delete(ctx, variantKey(photo.StorageKey, v.Name))
+		if err != nil {
+			repository.App.ErrorLog.Println(err)
+		}
+	}
+}
+
+// variantKey returns the blob key of one variant of a stored photo
+func variantKey(storageKey, variant string) string {
+	return storageKey + "/" + variant + ".jpg"
+}
+
+// roomFromForm validates the posted room form and builds the room from it, reading the price in the base currency
+func roomFromForm(form *forms.Form, base currency.Currency) models.Room {
+	form.Required("room_name", "capacity", "price")
+
+	room := models.Room{
+		RoomName:    strings.TrimSpace(form.Get("room_name")),
+		Slug:        strings.TrimSpace(form.Get("slug")),
+		Description: strings.TrimSpace(form.Get("description")),
+		Active:      form.Has("active"),
+	}
+
+	if room.Slug == "" {
+		room.Slug = helpers.Slugify(room.RoomName)
+	}
+	if !slugPattern.MatchString(room.Slug) {
+		form.Errors.Add("slug", "Use only lowercase letters, numbers and hyphens")
+	}
+
+	form.MaxLength("room_name", 255)
+
+	if form.InRange("capacity", 1, maxGuests) {
+		room.Capacity = form.Int("capacity")
+	}
+
+	room.MaxOccupancy = room.Capacity
+	if form.Has("max_occupancy") && form.InRange("max_occupancy", room.Capacity, maxGuests) {
+		room.MaxOccupancy = form.Int("max_occupancy")
+	}
+
+	if form.Matches("price", pricePattern, "Price must be an amount such as 120.00") {
+		price, _ := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(form.Get("price")), "$"), 64)
+		room.Price = int(math.Round(price * math.Pow10(base.Decimals)))
+	}
+
+	room.PaymentPolicy = models.PaymentFull
+	if form.Get("payment_policy") == models.PaymentDeposit {
+		room.PaymentPolicy = models.PaymentDeposit
+		form.Required("deposit_percent")
+		if form.Has("deposit_percent") && form.InRange("deposit_percent", 1, 99) {
+			room.DepositPercent = form.Int("deposit_percent")
+		}
+	}
+
+	if form.Has("cancellation_policy_id") && form.InRange("cancellation_policy_id", 0, math.MaxInt32) {
+		room.CancellationPolicyID = form.Int("cancellation_policy_id")
+	}
+
+	for _, amenity := range strings.Split(form.Get("amenities"), ",") {
+		amenity = strings.TrimSpace(amenity)
+		if amenity != "" {
+			room.Amenities = append(room.Amenities, amenity)
+		}
+	}
+
+	return room
+}
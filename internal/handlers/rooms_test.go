@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// withURLParams adds chi URL parameters to the request context, as the router would
+func withURLParams(req *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for key, value := range params {
+		rctx.URLParams.Add(key, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+// legacyRoomTests is the data for the LegacyRoom handler tests
+var legacyRoomTests = []struct {
+	name               string
+	url                string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"generals", "/generals-quarters", http.StatusMovedPermanently, "/rooms/generals-quarters"},
+	{"majors", "/majors-suite", http.StatusMovedPermanently, "/rooms/majors-suite"},
+	{"unknown", "/colonels-cabin", http.StatusNotFound, ""},
+}
+
+// TestLegacyRoom tests the LegacyRoom handler
+func TestLegacyRoom(t *testing.T) {
+	for _, e := range legacyRoomTests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.LegacyRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminShowRoomTests is the data for the AdminShowRoom handler tests
+var adminShowRoomTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+}{
+	{"valid", "1", http.StatusOK},
+	{"not-found", "50", http.StatusNotFound},
+	{"database-fails", "5", http.StatusInternalServerError},
+	{"invalid-id", "abc", http.StatusBadRequest},
+}
+
+// TestAdminShowRoom tests the AdminShowRoom handler
+func TestAdminShowRoom(t *testing.T) {
+	for _, e := range adminShowRoomTests {
+		req, _ := http.NewRequest("GET", "/admin/rooms/"+e.id, nil)
+		req = req.WithContext(getCtx(req))
+		req = withURLParams(req, map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+	}
+}
+
+// adminPostRoomTests is the data for the AdminPostRoom handler tests
+var adminPostRoomTests = []struct {
+	name               string
+	id                 string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name: "create",
+		postedData: url.Values{
+			"room_name": {"Colonel's Cabin"},
+			"capacity":  {"3"},
+			"price":     {"180.00"},
+			"amenities": {"Wi-Fi, Sea view"},
+			"active":    {"1"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms/3",
+	},
+	{
+		name: "update",
+		id:   "1",
+		postedData: url.Values{
+			"room_name": {"General's Quarters"},
+			"slug":      {"generals-quarters"},
+			"capacity":  {"2"},
+			"price":     {"$120.00"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms/1",
+	},
+	{
+		name: "invalid-capacity",
+		postedData: url.Values{
+			"room_name": {"Colonel's Cabin"},
+			"capacity":  {"none"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "invalid-slug",
+		postedData: url.Values{
+			"room_name": {"Colonel's Cabin"},
+			"slug":      {"Colonel's Cabin"},
+			"capacity":  {"2"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "slug-taken",
+		postedData: url.Values{
+			"room_name": {"Colonel's Cabin"},
+			"slug":      {"majors-suite"},
+			"capacity":  {"2"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "slug-of-another-room",
+		id:   "1",
+		postedData: url.Values{
+			"room_name": {"General's Quarters"},
+			"slug":      {"majors-suite"},
+			"capacity":  {"2"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "invalid-price",
+		postedData: url.Values{
+			"room_name": {"Colonel's Cabin"},
+			"capacity":  {"2"},
+			"price":     {"cheap"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "deposit",
+		postedData: url.Values{
+			"room_name":       {"Colonel's Cabin"},
+			"capacity":        {"2"},
+			"price":           {"100"},
+			"payment_policy":  {"deposit"},
+			"deposit_percent": {"25"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms/3",
+	},
+	{
+		name: "invalid-deposit",
+		postedData: url.Values{
+			"room_name":       {"Colonel's Cabin"},
+			"capacity":        {"2"},
+			"price":           {"100"},
+			"payment_policy":  {"deposit"},
+			"deposit_percent": {"100"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "cancellation-policy",
+		postedData: url.Values{
+			"room_name":              {"Colonel's Cabin"},
+			"capacity":               {"2"},
+			"price":                  {"100"},
+			"cancellation_policy_id": {"1"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/rooms/3",
+	},
+	{
+		name: "invalid-cancellation-policy",
+		postedData: url.Values{
+			"room_name":              {"Colonel's Cabin"},
+			"capacity":               {"2"},
+			"price":                  {"100"},
+			"cancellation_policy_id": {"abc"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "database-fails",
+		postedData: url.Values{
+			"room_name": {"fail"},
+			"capacity":  {"2"},
+			"price":     {"100"},
+		},
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+	{
+		name:               "invalid-id",
+		id:                 "abc",
+		postedData:         url.Values{},
+		expectedStatusCode: http.StatusBadRequest,
+	},
+}
+
+// TestAdminPostRoom tests the AdminPostRoom handler
+func TestAdminPostRoom(t *testing.T) {
+	for _, e := range adminPostRoomTests {
+		req, _ := http.NewRequest("POST", "/admin/rooms/new", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		if e.id != "" {
+			req = withURLParams(req, map[string]string{"id": e.id})
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminDeleteRoomTests is the data for the AdminDeleteRoom handler tests
+var adminDeleteRoomTests = []struct {
+	name               string
+	id                 string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{"unbooked-room", "1", http.StatusSeeOther, "/admin/rooms"},
+	{"booked-room", "2", http.StatusSeeOther, "/admin/rooms/2"},
+	{"invalid-id", "abc", http.StatusBadRequest, ""},
+}
+
+// TestAdminDeleteRoom tests the AdminDeleteRoom handler
+func TestAdminDeleteRoom(t *testing.T) {
+	for _, e := range adminDeleteRoomTests {
+		req, _ := http.NewRequest("GET", "/admin/rooms/"+e.id+"/delete", nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminPostRoomPhotosTests is the data for the AdminPostRoomPhotos handler tests
+var adminPostRoomPhotosTests = []struct {
+	name               string
+	id                 string
+	fields             map[string]string
+	file               []byte
+	expectedStatusCode int
+	expectedLocation   string
+	expectedError      bool
+}{
+	{"upload", "1", map[string]string{"alt_text_1": "Bedroom", "position_1": "0"}, testPNG(), http.StatusSeeOther, "/admin/rooms/1", false},
+	{"delete", "1", map[string]string{"delete_1": "1"}, nil, http.StatusSeeOther, "/admin/rooms/1", false},
+	{"not-an-image", "1", nil, []byte("not an image"), http.StatusSeeOther, "/admin/rooms/1", true},
+	{"database-fails", "2", nil, testPNG(), http.StatusInternalServerError, "", false},
+	{"unknown-room", "50", nil, testPNG(), http.StatusNotFound, "", false},
+	{"database-fails-loading-room", "3", nil, nil, http.StatusInternalServerError, "", false},
+	{"invalid-id", "abc", nil, nil, http.StatusBadRequest, "", false},
+}
+
+// testPNG returns a small PNG image to upload
+func testPNG() []byte {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30)))
+	return buf.Bytes()
+}
+
+// TestAdminPostRoomPhotos tests the AdminPostRoomPhotos handler
+func TestAdminPostRoomPhotos(t *testing.T) {
+	for _, e := range adminPostRoomPhotosTests {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for key, value := range e.fields {
+			_ = writer.WriteField(key, value)
+		}
+		if e.file != nil {
+			part, _ := writer.CreateFormFile("photos", "photo.png")
+			_, _ = part.Write(e.file)
+		}
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/rooms/"+e.id+"/photos", &body)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"id": e.id})
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostRoomPhotos)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if hasError := app.Session.Exists(ctx, "error"); hasError != e.expectedError {
+			t.Errorf("failed %s: expected error in session to be %t", e.name, e.expectedError)
+		}
+	}
+}
@@ -13,8 +13,10 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/crislainesc/bookings/internal/config"
+	"github.com/crislainesc/bookings/internal/helpers"
 	"github.com/crislainesc/bookings/internal/models"
 	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/storage"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
@@ -29,6 +31,10 @@ var functions = template.FuncMap{
 	"formatDateWithLayout": render.FormatDateWithLayout,
 	"iterate":              render.Iterate,
 	"add":                  render.Add,
+	"formatMoney":          render.FormatMoney,
+	"formatAmount":         render.FormatAmount,
+	"formatPrice":          render.FormatPrice,
+	"formatCurrency":       render.FormatCurrency,
 }
 
 func TestMain(m *testing.M) {
@@ -69,11 +75,20 @@ func TestMain(m *testing.M) {
 	app.TemplateCache = tc
 	app.UseCache = true
 
+	uploadsDir, err := os.MkdirTemp("", "uploads")
+	if err != nil {
+		log.Fatal("cannot create uploads directory")
+	}
+	app.Blobs = storage.NewLocalStore(uploadsDir, "/uploads")
+
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
+	helpers.NewHelpers(&app)
 	render.NewRenderer(&app)
 
-	os.Exit(m.Run())
+	code := m.Run()
+	os.RemoveAll(uploadsDir)
+	os.Exit(code)
 }
 
 func listenForMail() {
@@ -93,18 +108,29 @@ func getRoutes() http.Handler {
 
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Get("/rooms", Repo.Rooms)
+	mux.Get("/rooms/{slug}", Repo.RoomDetail)
+	mux.Get("/rooms/{slug}/calendar", Repo.RoomCalendarJSON)
+	mux.Get("/generals-quarters", Repo.LegacyRoom)
+	mux.Get("/majors-suite", Repo.LegacyRoom)
 
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Post("/search-availability-flexible", Repo.PostFlexibleAvailability)
+	mux.Get("/waitlist", Repo.Waitlist)
+	mux.Post("/waitlist", Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", Repo.WaitlistOffer)
 
 	mux.Get("/contact", Repo.Contact)
 
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
+	mux.Get("/reservations/cancel/{token}", Repo.CancelReservation)
+	mux.Post("/reservations/cancel/{token}", Repo.PostCancelReservation)
+	mux.Get("/reservations/invoice/{token}", Repo.ReservationInvoice)
+	mux.Post("/payments/webhook", Repo.PaymentWebhook)
 
 	mux.Get("/user/login", Repo.ShowLogin)
 	mux.Post("/user/login", Repo.PostLogin)
@@ -114,14 +140,58 @@ func getRoutes() http.Handler {
 
 	mux.Get("/admin/reservations-new", Repo.AdminNewReservation)
 	mux.Get("/admin/reservations-all", Repo.AdminAllReservations)
+	mux.Get("/admin/reservations-new-json", Repo.AdminNewReservationsJSON)
+	mux.Get("/admin/reservations-all-json", Repo.AdminAllReservationsJSON)
+	mux.Get("/admin/reservations-new-export", Repo.AdminExportNewReservations)
+	mux.Get("/admin/reservations-all-export", Repo.AdminExportAllReservations)
+	mux.Get("/admin/reservations-import", Repo.AdminImportReservations)
+	mux.Post("/admin/reservations-import", Repo.AdminPostImportReservations)
+	mux.Get("/admin/reports/arrivals", Repo.AdminArrivalsReport)
+	mux.Get("/admin/reports/departures", Repo.AdminDeparturesReport)
+	mux.Get("/admin/reports/occupancy", Repo.AdminOccupancyReport)
 	mux.Get("/admin/reservations-calendar", Repo.AdminReservationsCalendar)
 	mux.Post("/admin/reservations-calendar", Repo.AdminPostReservationsCalendar)
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Get("/admin/cancel-reservation/{src}/{id}/do", Repo.AdminCancelReservation)
+	mux.Get("/admin/reservations/{src}/{id}/invoice", Repo.AdminReservationInvoice)
 
 	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
 	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
 
+	mux.Get("/admin/rooms", Repo.AdminRooms)
+	mux.Get("/admin/rooms/new", Repo.AdminNewRoom)
+	mux.Post("/admin/rooms/new", Repo.AdminPostRoom)
+	mux.Get("/admin/rooms/{id}", Repo.AdminShowRoom)
+	mux.Post("/admin/rooms/{id}", Repo.AdminPostRoom)
+	mux.Get("/admin/rooms/{id}/delete", Repo.AdminDeleteRoom)
+	mux.Post("/admin/rooms/{id}/photos", Repo.AdminPostRoomPhotos)
+	mux.Get("/admin/booking-rules", Repo.AdminBookingRules)
+	mux.Get("/admin/booking-rules/new", Repo.AdminNewBookingRule)
+	mux.Post("/admin/booking-rules/new", Repo.AdminPostBookingRule)
+	mux.Get("/admin/booking-rules/{id}", Repo.AdminShowBookingRule)
+	mux.Post("/admin/booking-rules/{id}", Repo.AdminPostBookingRule)
+	mux.Get("/admin/booking-rules/{id}/delete", Repo.AdminDeleteBookingRule)
+	mux.Get("/admin/cancellation-policies", Repo.AdminCancellationPolicies)
+	mux.Get("/admin/cancellation-policies/new", Repo.AdminNewCancellationPolicy)
+	mux.Post("/admin/cancellation-policies/new", Repo.AdminPostCancellationPolicy)
+	mux.Get("/admin/cancellation-policies/{id}", Repo.AdminShowCancellationPolicy)
+	mux.Post("/admin/cancellation-policies/{id}", Repo.AdminPostCancellationPolicy)
+	mux.Get("/admin/cancellation-policies/{id}/delete", Repo.AdminDeleteCancellationPolicy)
+	mux.Get("/admin/promo-codes", Repo.AdminPromoCodes)
+	mux.Get("/admin/promo-codes/new", Repo.AdminNewPromoCode)
+	mux.Post("/admin/promo-codes/new", Repo.AdminPostPromoCode)
+	mux.Get("/admin/promo-codes/{id}", Repo.AdminShowPromoCode)
+	mux.Post("/admin/promo-codes/{id}", Repo.AdminPostPromoCode)
+	mux.Get("/admin/promo-codes/{id}/delete", Repo.AdminDeletePromoCode)
+	mux.Get("/admin/guests", Repo.AdminGuests)
+	mux.Get("/admin/guests/{id}", Repo.AdminShowGuest)
+	mux.Post("/admin/guests/{id}", Repo.AdminPostGuest)
+	mux.Post("/admin/guests/{id}/merge", Repo.AdminMergeGuest)
+	mux.Get("/admin/exchange-rates", Repo.AdminExchangeRates)
+	mux.Post("/admin/exchange-rates", Repo.AdminPostExchangeRate)
+	mux.Get("/admin/exchange-rates/{id}/delete", Repo.AdminDeleteExchangeRate)
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
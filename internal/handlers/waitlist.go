@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/helpers"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/render"
+	"github.com/crislainesc/bookings/internal/repository/dbrepo"
+	"github.com/go-chi/chi"
+)
+
+// waitlistOfferTime is how long a room that freed up is held for the waitlisted guest it is offered to
+const waitlistOfferTime = 24 * time.Hour
+
+// waitlistURL returns the page to join the waitlist for the dates and party of a search
+func waitlistURL(search models.AvailabilityQuery) string {
+	query := url.Values{}
+	query.Set("start", search.StartDate.Format(dateLayout))
+	query.Set("end", search.EndDate.Format(dateLayout))
+	query.Set("adults", strconv.Itoa(search.Adults))
+	query.Set("children", strconv.Itoa(search.Children))
+	return "/waitlist?" + query.Encode()
+}
+
+// Waitlist shows the form to join the waitlist, filled in with the dates and party of the search that
+// found no room
+func (repository *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	repository.renderWaitlist(w, r, forms.New(r.URL.Query()))
+}
+
+// PostWaitlist adds the guest to the waitlist for their dates and room preference
+func (repository *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("first_name", "last_name", "email")
+	form.MaxLength("first_name", 255)
+	form.MaxLength("last_name", 255)
+	form.IsEmail("email")
+	if form.DateRange("start", "end", maxStayNights) {
+		form.NotInPast("start")
+	}
+	adults, children, _ := parseGuests(form, "adults", "children")
+
+	entry := models.WaitlistEntry{
+		FirstName: form.Get("first_name"),
+		LastName:  form.Get("last_name"),
+		Email:     form.Get("email"),
+		StartDate: form.Date("start"),
+		EndDate:   form.Date("end"),
+		Adults:    adults,
+		Children:  children,
+	}
+
+	if form.Get("room_id") != "" && form.IsInt("room_id") {
+		room, err := repository.DB.GetRoomByID(r.Context(), form.Int("room_id"))
+		if err != nil || room.ID == 0 || !room.Active {
+			form.Errors.Add("room_id", "waitlist.no_room")
+		} else if !room.Fits(adults, children) {
+			form.Errors.Add("room_id", "waitlist.room_too_small")
+		}
+		entry.RoomID = room.ID
+	}
+
+	if !form.Valid() {
+		repository.renderWaitlist(w, r, form)
+		return
+	}
+
+	_, err = repository.DB.InsertWaitlistEntry(r.Context(), entry)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't add you to the waitlist")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	repository.App.Session.Put(r.Context(), "flash", "you're on the waitlist, we'll email you if a room frees up")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// renderWaitlist shows the waitlist form with the rooms guests can wait for
+func (repository *Repository) renderWaitlist(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rooms, err := repository.DB.GetActiveRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "waitlist.page.tmpl.html", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// WaitlistOffer takes a waitlisted guest from the link they were emailed to the reservation form for the
+// room held for them
+func (repository *Repository) WaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	entry, err := repository.DB.GetWaitlistEntryByToken(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "invalid waitlist link")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if entry.Status != models.WaitlistOffered || !time.Now().Before(entry.ExpiresAt) {
+		repository.App.Session.Put(r.Context(), "error", "this offer expired, please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	room, err := repository.DB.GetRoomByID(r.Context(), entry.OfferedRoomID)
+	if err != nil {
+		repository.App.Session.Put(r.Context(), "error", "can't find room")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	reservation := models.Reservation{
+		FirstName:     entry.FirstName,
+		LastName:      entry.LastName,
+		Email:         entry.Email,
+		StartDate:     entry.StartDate,
+		EndDate:       entry.EndDate,
+		RoomID:        room.ID,
+		Adults:        entry.Adults,
+		Children:      entry.Children,
+		HoldID:        entry.HoldID,
+		HoldExpiresAt: entry.ExpiresAt,
+	}
+	reservation.Room.RoomName = room.RoomName
+
+	repository.App.Session.Put(r.Context(), "reservation", reservation)
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// offerFreedNights offers the room a reservation no longer holds to the guests waiting for it, for the nights
+// of the stay that haven't passed yet. The reservation is gone all the same when that fails, so the error is
+// only logged.
+func (repository *Repository) offerFreedNights(ctx context.Context, reservation models.Reservation) {
+	from := reservation.StartDate
+	if today := dates.Day(time.Now()); today.After(from) {
+		from = today
+	}
+	if !from.Before(reservation.EndDate) {
+		return
+	}
+
+	_, err := repository.notifyWaitlist(ctx, reservation.RoomID, from, reservation.EndDate)
+	if err != nil {
+		repository.App.ErrorLog.Println(err)
+	}
+}
+
+// notifyWaitlist offers a room whose dates freed up to the guests waiting for it, in the order they joined
+// the waitlist. Each guest whose whole stay is free gets the room held for them and an email with the link
+// to book it; guests whose dates are still taken keep waiting. It returns the number of guests offered the room.
+func (repository *Repository) notifyWaitlist(ctx context.Context, roomID int, start, end time.Time) (int, error) {
+	room, err := repository.DB.GetRoomByID(ctx, roomID)
+	if err != nil {
+		return 0, err
+	}
+	if !room.Active {
+		return 0, nil
+	}
+
+	entries, err := repository.DB.GetWaitingEntriesForRoom(ctx, roomID, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	offered := 0
+	for _, entry := range entries {
+		if !room.Fits(entry.Adults, entry.Children) {
+			continue
+		}
+
+		err := repository.offerRoom(ctx, entry, room)
+		if errors.Is(err, dbrepo.ErrRoomUnavailable) || errors.Is(err, dbrepo.ErrNotWaiting) {
+			continue
+		}
+		if err != nil {
+			return offered, err
+		}
+		offered++
+	}
+
+	return offered, nil
+}
+
+// offerRoom holds the room for the dates of a waitlist entry and emails the guest the link to book it
+func (repository *Repository) offerRoom(ctx context.Context, entry models.WaitlistEntry, room models.Room) error {
+	expiresAt := time.Now().Add(waitlistOfferTime)
+
+	holdID, err := repository.DB.InsertHold(ctx, models.RoomRestriction{
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		RoomID:    room.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the link is as hard to guess as a cancellation link
+	entry.Token, err = newCancelToken()
+	if err == nil {
+		entry.OfferedRoomID, entry.HoldID, entry.ExpiresAt = room.ID, holdID, expiresAt
+		err = repository.DB.OfferWaitlistEntry(ctx, entry)
+	}
+	if err != nil {
+		_ = repository.DB.DeleteHold(ctx, holdID)
+		return err
+	}
+
+	link := template.HTMLEscapeString(repository.App.BaseURL + "/waitlist/" + entry.Token)
+	content := fmt.Sprintf(`<p>Hello %s, %s is now free from %s to %s. We're holding it for you until %s.</p>
+<p>To book it, go to <a href="%s">%s</a></p>`,
+		template.HTMLEscapeString(entry.FirstName), template.HTMLEscapeString(room.RoomName),
+		entry.StartDate.Format(dateLayout), entry.EndDate.Format(dateLayout), expiresAt.Format("2006-01-02 15:04"),
+		link, link)
+
+	repository.App.MailChan <- models.MailData{
+		To:       entry.Email,
+		From:     "go_reservation@email.com",
+		Subject:  "A room freed up for your dates",
+		Content:  content,
+		Template: "basic.html",
+	}
+
+	return nil
+}
+
+// ExpireWaitlistOffers releases the rooms of the waitlist offers that weren't booked by now and offers them
+// to the next guests waiting. It returns the number of offers that expired.
+func (repository *Repository) ExpireWaitlistOffers(ctx context.Context, now time.Time) (int, error) {
+	entries, err := repository.DB.ExpireWaitlistOffers(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		err := repository.DB.DeleteHold(ctx, entry.HoldID)
+		if err != nil {
+			return len(entries), err
+		}
+
+		_, err = repository.notifyWaitlist(ctx, entry.OfferedRoomID, entry.StartDate, entry.EndDate)
+		if err != nil {
+			return len(entries), err
+		}
+	}
+
+	return len(entries), nil
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// TestPostAvailabilityWaitlist tests that a search with no free room takes the guest to the waitlist
+func TestPostAvailabilityWaitlist(t *testing.T) {
+	postedData := url.Values{
+		"start":  {"2050-01-01"},
+		"end":    {"2050-01-02"},
+		"adults": {"2"},
+	}
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostAvailability)
+	handler.ServeHTTP(rr, req)
+
+	expectedLocation := "/waitlist?adults=2&children=0&end=2050-01-02&start=2050-01-01"
+	actualLoc, _ := rr.Result().Location()
+	if rr.Code != http.StatusSeeOther || actualLoc.String() != expectedLocation {
+		t.Errorf("expected a redirect to %s, got %d to %s", expectedLocation, rr.Code, actualLoc)
+	}
+}
+
+// TestWaitlist tests the Waitlist handler
+func TestWaitlist(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/waitlist?start=2050-01-01&end=2050-01-02", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Waitlist)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Waitlist returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+// postWaitlistTests is the data for the PostWaitlist handler tests
+var postWaitlistTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedFlash      bool
+}{
+	{"any-room", url.Values{}, http.StatusSeeOther, true},
+	{"room", url.Values{"room_id": {"1"}}, http.StatusSeeOther, true},
+	{"missing-name", url.Values{"first_name": {""}}, http.StatusOK, false},
+	{"invalid-email", url.Values{"email": {"jane"}}, http.StatusOK, false},
+	{"departure-before-arrival", url.Values{"end": {"2049-12-31"}}, http.StatusOK, false},
+	{"arrival-in-the-past", url.Values{"start": {"2000-01-01"}, "end": {"2000-01-03"}}, http.StatusOK, false},
+	{"room-too-small", url.Values{"room_id": {"1"}, "adults": {"2"}, "children": {"2"}}, http.StatusOK, false},
+	{"unknown-room", url.Values{"room_id": {"5"}}, http.StatusOK, false},
+	{"database-fails", url.Values{"email": {"fail@example.com"}}, http.StatusSeeOther, false},
+}
+
+// TestPostWaitlist tests the PostWaitlist handler
+func TestPostWaitlist(t *testing.T) {
+	for _, e := range postWaitlistTests {
+		postedData := url.Values{
+			"start":      {"2050-01-01"},
+			"end":        {"2050-01-03"},
+			"first_name": {"Jane"},
+			"last_name":  {"Doe"},
+			"email":      {"jane@doe.com"},
+		}
+		for key, value := range e.postedData {
+			postedData[key] = value
+		}
+
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostWaitlist)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if joined := session.GetString(ctx, "flash") != ""; joined != e.expectedFlash {
+			t.Errorf("%s: expected the guest to join the waitlist to be %t, got %t", e.name, e.expectedFlash, joined)
+		}
+	}
+}
+
+// waitlistOfferTests is the data for the WaitlistOffer handler tests
+var waitlistOfferTests = []struct {
+	name             string
+	token            string
+	expectedLocation string
+}{
+	{"offered", "offered", "/make-reservation"},
+	{"expired", "expired", "/search-availability"},
+	{"unknown-token", "nope", "/"},
+}
+
+// TestWaitlistOffer tests that the link of a waitlist offer takes the guest to the room held for them
+func TestWaitlistOffer(t *testing.T) {
+	for _, e := range waitlistOfferTests {
+		req, _ := http.NewRequest("GET", "/waitlist/"+e.token, nil)
+		ctx := getCtx(req)
+		req = withURLParams(req.WithContext(ctx), map[string]string{"token": e.token})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.WaitlistOffer)
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			continue
+		}
+
+		if e.expectedLocation != "/make-reservation" {
+			continue
+		}
+
+		reservation, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if reservation.HoldID != 1 || reservation.RoomID != 1 || reservation.Email != "jane@doe.com" {
+			t.Errorf("%s: expected the reservation of the offer in the session, got %+v", e.name, reservation)
+		}
+	}
+}
+
+// TestNotifyWaitlist tests that a room is offered to the waiting guests whose whole stay is free and who fit in it
+func TestNotifyWaitlist(t *testing.T) {
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	offered, err := Repo.notifyWaitlist(context.Background(), 1, start, start.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offered != 1 {
+		t.Errorf("expected the room to be offered to 1 guest, got %d", offered)
+	}
+
+	_, err = Repo.notifyWaitlist(context.Background(), 2, start, start.AddDate(0, 0, 14))
+	if err == nil {
+		t.Error("expected an error when the waitlist can't be read")
+	}
+}
+
+// TestExpireWaitlistOffers tests that expired offers are counted and their rooms offered to the next guests
+func TestExpireWaitlistOffers(t *testing.T) {
+	expired, err := Repo.ExpireWaitlistOffers(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Errorf("expected 1 offer to expire, got %d", expired)
+	}
+}
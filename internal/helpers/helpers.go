@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/crislainesc/bookings/internal/config"
 )
@@ -31,3 +32,26 @@ func IsAuthenticated(r *http.Request) bool {
 
 	return exists > 0
 }
+
+// Slugify turns a name into a lowercase, hyphen separated identifier suitable for URLs
+func Slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			hyphen = false
+		case r == '\'':
+			// "General's" becomes "generals" rather than "general-s"
+		default:
+			if b.Len() > 0 && !hyphen {
+				b.WriteRune('-')
+				hyphen = true
+			}
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,21 @@
+package helpers
+
+import "testing"
+
+var slugifyTests = []struct {
+	name     string
+	expected string
+}{
+	{"General's Quarters", "generals-quarters"},
+	{"Major's Suite", "majors-suite"},
+	{"  Sea View -- Room 2 ", "sea-view-room-2"},
+	{"Çabana", "abana"},
+}
+
+func TestSlugify(t *testing.T) {
+	for _, e := range slugifyTests {
+		if got := Slugify(e.name); got != e.expected {
+			t.Errorf("Slugify(%q): expected %q but got %q", e.name, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the locale used when a request asks for none we support, and the one missing translations fall back to
+const Default = "en"
+
+// Supported are the locales with a message catalog, in the order they are offered to guests
+var Supported = []string{"en", "pt"}
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs maps each supported locale to its messages by key
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	catalogs := make(map[string]map[string]string)
+	for _, locale := range Supported {
+		data, err := files.ReadFile(path.Join("locales", locale+".json"))
+		if err != nil {
+			panic(err)
+		}
+
+		messages := make(map[string]string)
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", locale, err))
+		}
+		catalogs[locale] = messages
+	}
+	return catalogs
+}
+
+// Message is a catalog key with the arguments its translation is formatted with
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+// In returns the message translated to locale
+func (m Message) In(locale string) string {
+	return T(locale, m.Key, m.Args...)
+}
+
+// T returns the message with the key in the catalog of locale, formatted with args like fmt.Sprintf.
+// Arguments that are messages are translated to locale first.
+// Keys missing from the catalog fall back to the default locale, then to the key itself, so text that
+// was never added to a catalog is shown as it is.
+func T(locale, key string, args ...interface{}) string {
+	message, ok := catalogs[locale][key]
+	if !ok {
+		message, ok = catalogs[Default][key]
+	}
+	if !ok {
+		message = key
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	// messages given as arguments, such as weekday names, are translated too
+	translated := make([]interface{}, len(args))
+	for i, arg := range args {
+		if m, ok := arg.(Message); ok {
+			translated[i] = m.In(locale)
+		} else {
+			translated[i] = arg
+		}
+	}
+	return fmt.Sprintf(message, translated...)
+}
+
+// Has reports whether the catalog of locale has a message with the key
+func Has(locale, key string) bool {
+	_, ok := catalogs[locale][key]
+	return ok
+}
+
+// Keys returns the keys of the catalog of locale, sorted
+func Keys(locale string) []string {
+	var keys []string
+	for key := range catalogs[locale] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// IsSupported reports whether there is a catalog for locale
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Negotiate picks the supported locale a browser prefers from its Accept-Language header, matching
+// regional variants such as pt-BR to their language. It returns Default when none is acceptable.
+func Negotiate(acceptLanguage string) string {
+	best, bestQuality := Default, 0.0
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if IsSupported(language) && quality > bestQuality {
+			best, bestQuality = language, quality
+		}
+	}
+
+	return best
+}
+
+type contextKey struct{}
+
+// WithLocale returns a copy of ctx carrying the locale of a request
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale carried by ctx, or Default when there is none
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok {
+		return locale
+	}
+	return Default
+}
+
+// FormatDate formats t with a time layout, writing month and weekday names in the language of locale
+func FormatDate(t time.Time, layout, locale string) string {
+	if locale == Default || !IsSupported(locale) {
+		return t.Format(layout)
+	}
+
+	var b strings.Builder
+	for layout != "" {
+		i, name := nextName(layout)
+		if i < 0 {
+			b.WriteString(t.Format(layout))
+			break
+		}
+
+		b.WriteString(t.Format(layout[:i]))
+		switch name {
+		case "January":
+			b.WriteString(T(locale, fmt.Sprintf("date.month.%d", t.Month())))
+		case "Jan":
+			b.WriteString(T(locale, fmt.Sprintf("date.month_short.%d", t.Month())))
+		case "Monday":
+			b.WriteString(T(locale, fmt.Sprintf("date.weekday.%d", t.Weekday())))
+		case "Mon":
+			b.WriteString(T(locale, fmt.Sprintf("date.weekday_short.%d", t.Weekday())))
+		}
+		layout = layout[i+len(name):]
+	}
+	return b.String()
+}
+
+// nameElements are the layout elements that spell out names, longest first so January isn't read as Jan
+var nameElements = []string{"January", "Monday", "Jan", "Mon"}
+
+// nextName returns the position of the first name element in layout and the element, or -1 when there is none
+func nextName(layout string) (int, string) {
+	first, name := -1, ""
+	for _, element := range nameElements {
+		if i := strings.Index(layout, element); i >= 0 && (first < 0 || i < first) {
+			first, name = i, element
+		}
+	}
+	return first, name
+}
@@ -0,0 +1,121 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]string{
+		"":                           "en",
+		"pt-BR,pt;q=0.9,en-US;q=0.8": "pt",
+		"en-US,en;q=0.9,pt;q=0.8":    "en",
+		"fr-FR,fr;q=0.9,pt;q=0.5":    "pt",
+		"fr, de;q=0.5":               "en",
+		"en;q=0.2, PT;q=0.7":         "pt",
+		"pt;q=nonsense, en;q=0.1":    "en",
+	}
+
+	for header, expected := range tests {
+		if got := Negotiate(header); got != expected {
+			t.Errorf("Negotiate(%q): expected %s, got %s", header, expected, got)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("pt", "nav.home"); got != "Início" {
+		t.Errorf("expected the Portuguese message, got %q", got)
+	}
+
+	if got := T("fr", "nav.home"); got != "Home" {
+		t.Errorf("expected an unsupported locale to fall back to English, got %q", got)
+	}
+
+	if got := T("pt", "Text that is not a key"); got != "Text that is not a key" {
+		t.Errorf("expected text that is not a key as it is, got %q", got)
+	}
+
+	if got := T("pt", "forms.range", 1, 10); got != "Este campo deve estar entre 1 e 10" {
+		t.Errorf("expected a formatted message, got %q", got)
+	}
+
+	weekday := Message{Key: "date.weekday_plural.0"}
+	if got := T("pt", "rules.closed_to_arrival", weekday); got != "Não é possível chegar em domingos" {
+		t.Errorf("expected a translated argument, got %q", got)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	d := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		layout   string
+		locale   string
+		expected string
+	}{
+		{"Monday, January 2 2006", "en", "Monday, March 4 2030"},
+		{"Monday, 2 January 2006", "pt", "segunda-feira, 4 março 2030"},
+		{"Mon 2 Jan", "pt", "seg 4 mar"},
+		{"02/01/2006", "pt", "04/03/2030"},
+		{"Jan 2", "fr", "Mar 4"},
+	}
+
+	for _, e := range tests {
+		if got := FormatDate(d, e.layout, e.locale); got != e.expected {
+			t.Errorf("FormatDate(%q, %s): expected %q, got %q", e.layout, e.locale, e.expected, got)
+		}
+	}
+}
+
+// templateKey finds the message keys templates translate with .T
+var templateKey = regexp.MustCompile(`\.T "([^"]+)"`)
+
+func TestCatalogsHaveTemplateKeys(t *testing.T) {
+	pages, err := filepath.Glob("../../templates/*.html")
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("can't find the templates: %v", err)
+	}
+
+	// the language menu builds its keys from the supported locales
+	keys := make(map[string]string)
+	for _, locale := range Supported {
+		keys["locale."+locale] = "base.layout.tmpl.html"
+	}
+
+	for _, page := range pages {
+		content, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range templateKey.FindAllStringSubmatch(string(content), -1) {
+			keys[match[1]] = filepath.Base(page)
+		}
+	}
+
+	for _, locale := range Supported {
+		for key, page := range keys {
+			if !Has(locale, key) {
+				t.Errorf("%s uses %s, which is missing from the %s catalog", page, key, locale)
+			}
+		}
+	}
+}
+
+func TestCatalogsHaveTheSameKeys(t *testing.T) {
+	for _, locale := range Supported {
+		for _, key := range Keys(Default) {
+			if !Has(locale, key) {
+				t.Errorf("%s is missing from the %s catalog", key, locale)
+			}
+		}
+		for _, key := range Keys(locale) {
+			if !Has(Default, key) {
+				t.Errorf("%s is in the %s catalog but not the %s one", key, locale, Default)
+			}
+		}
+	}
+}
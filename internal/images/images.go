@@ -0,0 +1,166 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Variant is a resized copy of an uploaded image
+type Variant struct {
+	Name     string
+	MaxWidth int
+}
+
+// Variants are the sizes every uploaded room photo is stored in, smallest first
+var Variants = []Variant{
+	{Name: "thumbnail", MaxWidth: 320},
+	{Name: "medium", MaxWidth: 800},
+	{Name: "large", MaxWidth: 1600},
+}
+
+// AllowedTypes are the content types accepted for uploads
+var AllowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// jpegQuality is the quality variants are encoded with
+const jpegQuality = 85
+
+// maxPixels is the most pixels an uploaded image can have, since it is decoded whole to be resized
+const maxPixels = 30_000_000
+
+// ErrUnsupportedType is returned for uploads that are not a JPEG, PNG or GIF image
+var ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images can be uploaded")
+
+// ErrTooManyPixels is returned for images larger than maxPixels, whatever the size of their file
+var ErrTooManyPixels = errors.New("images are limited to 30 megapixels")
+
+// Process checks that data is a supported image and returns it resized to every variant, encoded as JPEG.
+// Images are never scaled up, so a variant may be smaller than its maximum width.
+func Process(r io.Reader) (map[string][]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !AllowedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	// the header tells the size of the image before any of it is decoded
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxPixels/config.Height {
+		return nil, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	src := toRGBA(img)
+
+	variants := make(map[string][]byte)
+	for _, v := range Variants {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, flatten(Resize(src, v.MaxWidth)), &jpeg.Options{Quality: jpegQuality})
+		if err != nil {
+			return nil, err
+		}
+		variants[v.Name] = buf.Bytes()
+	}
+
+	return variants, nil
+}
+
+// Resize scales src down to maxWidth, keeping its aspect ratio, by averaging the source pixels
+// that fall into each destination pixel. Images narrower than maxWidth are copied unscaled.
+func Resize(src image.Image, maxWidth int) *image.RGBA {
+	rgba := toRGBA(src)
+	bounds := rgba.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > maxWidth {
+		dstW = maxWidth
+		dstH = srcH * maxWidth / srcW
+		if dstH < 1 {
+			dstH = 1
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := bounds.Min.Y + (y+1)*srcH/dstH
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := bounds.Min.X + (x+1)*srcW/dstW
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[rgba.PixOffset(x0, sy):rgba.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					r += uint64(row[i])
+					g += uint64(row[i+1])
+					b += uint64(row[i+2])
+					a += uint64(row[i+3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// toRGBA returns img as an *image.RGBA, converting it when it is in another color model, so its pixels can
+// be read straight from memory
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// flatten composites img onto a white background, since JPEG has no transparency
+func flatten(img *image.RGBA) *image.RGBA {
+	for i := 0; i < len(img.Pix); i += 4 {
+		// pixels are alpha-premultiplied, so drawing over white adds the uncovered part
+		uncovered := 255 - img.Pix[i+3]
+		img.Pix[i] += uncovered
+		img.Pix[i+1] += uncovered
+		img.Pix[i+2] += uncovered
+		img.Pix[i+3] = 255
+	}
+	return img
+}
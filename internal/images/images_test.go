@@ -0,0 +1,92 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	variants, err := Process(bytes.NewReader(testPNG(t, 2000, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range Variants {
+		data, ok := variants[v.Name]
+		if !ok {
+			t.Fatalf("variant %s missing", v.Name)
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("variant %s is not a jpeg: %v", v.Name, err)
+		}
+
+		if img.Bounds().Dx() != v.MaxWidth || img.Bounds().Dy() != v.MaxWidth/2 {
+			t.Errorf("variant %s: expected %dx%d but got %dx%d", v.Name, v.MaxWidth, v.MaxWidth/2, img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	}
+}
+
+func TestProcessRejectsNonImages(t *testing.T) {
+	_, err := Process(strings.NewReader("<html>definitely not an image</html>"))
+	if err != ErrUnsupportedType {
+		t.Errorf("expected ErrUnsupportedType but got %v", err)
+	}
+}
+
+func TestProcessRejectsTooManyPixels(t *testing.T) {
+	// a small file whose header declares a 50000x50000 image
+	data := testPNG(t, 1, 1)
+	binary.BigEndian.PutUint32(data[16:], 50000)
+	binary.BigEndian.PutUint32(data[20:], 50000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	_, err := Process(bytes.NewReader(data))
+	if err != ErrTooManyPixels {
+		t.Errorf("expected ErrTooManyPixels but got %v", err)
+	}
+}
+
+func TestResizeDoesNotUpscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+
+	resized := Resize(img, 800)
+	if resized.Bounds().Dx() != 100 || resized.Bounds().Dy() != 50 {
+		t.Errorf("expected 100x50 but got %dx%d", resized.Bounds().Dx(), resized.Bounds().Dy())
+	}
+}
+
+func TestResizeAveragesColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 0, G: 0, B: 0, A: 255})
+	img.Set(1, 0, color.RGBA{R: 200, G: 200, B: 200, A: 255})
+
+	resized := Resize(img, 1)
+	c := resized.RGBAAt(0, 0)
+	if c.R < 95 || c.R > 105 {
+		t.Errorf("expected a mid grey but got %v", c)
+	}
+}
@@ -0,0 +1,246 @@
+// Package invoice lays out the invoices of reservations as PDF documents.
+package invoice
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/pdf"
+)
+
+// Data is what an invoice shows: the invoice issued for a reservation, the property issuing it and the
+// payments and refunds of the reservation
+type Data struct {
+	Invoice     models.Invoice
+	Reservation models.Reservation
+	Property    models.Property
+	Payments    []models.Payment
+	Refunds     []models.Refund
+}
+
+// Line is a line item of an invoice, in the minor units of the currency of the invoice
+type Line struct {
+	Description string
+	Quantity    int
+	UnitPrice   int
+	Amount      int
+}
+
+// Lines returns the line items of an invoice: the nights of the stay at the price they were booked at, less
+// the discount of the promo code the stay was booked with.
+//
+// Rooms have one flat nightly price, and a booking stores its quote as the total of its nights less the
+// discount, so the total and discount kept with the reservation give back the nightly price it was booked at
+// even after the room's price changes. Only reservations imported with a total of their own may not split
+// evenly into nights; they are billed as a single item.
+func Lines(data Data, locale string) []Line {
+	reservation := data.Reservation
+	total := data.Invoice.Total + reservation.Discount
+
+	line := Line{
+		Description: i18n.T(locale, "invoice.stay", reservation.Room.RoomName,
+			formatDate(reservation.StartDate, locale), formatDate(reservation.EndDate, locale)),
+		Quantity:  1,
+		UnitPrice: total,
+		Amount:    total,
+	}
+
+	if nights := reservation.Nights(); nights > 0 && total%nights == 0 {
+		line.Quantity, line.UnitPrice = nights, total/nights
+	}
+
+	lines := []Line{line}
+	if reservation.Discount > 0 {
+		lines = append(lines, Line{
+			Description: i18n.T(locale, "invoice.discount", reservation.PromoCode),
+			Quantity:    1,
+			UnitPrice:   -reservation.Discount,
+			Amount:      -reservation.Discount,
+		})
+	}
+
+	return lines
+}
+
+// Paid returns what was received for a reservation, less what was refunded
+func Paid(payments []models.Payment, refunds []models.Refund) int {
+	paid := 0
+	for _, p := range payments {
+		if p.Status == models.PaymentSucceeded {
+			paid += p.Amount
+		}
+	}
+	for _, refund := range refunds {
+		if refund.Status != models.PaymentFailed {
+			paid -= refund.Amount
+		}
+	}
+	return paid
+}
+
+// Filename returns the name an invoice is downloaded and attached as
+func Filename(invoice models.Invoice) string {
+	return invoice.Reference() + ".pdf"
+}
+
+// Positions on the page, in points from its top-left corner
+const (
+	left       = 50.0
+	right      = 545.0
+	labelsLeft = 340.0
+	// the right edges of the quantity and unit price columns of the line items
+	quantityRight  = 380.0
+	unitPriceRight = 465.0
+	lineHeight     = 14.0
+)
+
+// Write writes an invoice as a PDF document in the language of locale
+func Write(w io.Writer, data Data, locale string) error {
+	invoice := data.Invoice
+	property := data.Property
+	c := currency.Get(invoice.Currency)
+	money := func(amount int) string {
+		return currency.Format(amount, c, locale)
+	}
+
+	doc := pdf.New()
+	doc.Title = i18n.T(locale, "invoice.title") + " " + invoice.Reference()
+	page := doc.AddPage()
+
+	// the property on the left and the invoice details on the right
+	page.Text(left, 70, pdf.HelveticaBold, 16, property.Name)
+	y := 88.0
+	details := append([]string{}, property.Address...)
+	details = append(details, property.Email, property.Phone)
+	if property.TaxID != "" {
+		details = append(details, i18n.T(locale, "invoice.tax_id", property.TaxID))
+	}
+	for _, detail := range details {
+		if detail != "" {
+			page.Text(left, y, pdf.Helvetica, 9, detail)
+			y += 12
+		}
+	}
+
+	page.TextRight(right, 70, pdf.HelveticaBold, 16, strings.ToUpper(i18n.T(locale, "invoice.title")))
+	ry := 88.0
+	for _, row := range [][2]string{
+		{i18n.T(locale, "invoice.number"), invoice.Reference()},
+		{i18n.T(locale, "invoice.date"), formatDate(invoice.IssuedAt, locale)},
+		{i18n.T(locale, "invoice.reservation"), strconv.Itoa(invoice.ReservationID)},
+	} {
+		page.Text(labelsLeft, ry, pdf.Helvetica, 9, row[0])
+		page.TextRight(right, ry, pdf.HelveticaBold, 9, row[1])
+		ry += 12
+	}
+	if ry > y {
+		y = ry
+	}
+
+	y += 20
+	page.Text(left, y, pdf.HelveticaBold, 10, i18n.T(locale, "invoice.bill_to"))
+	y += lineHeight
+	page.Text(left, y, pdf.Helvetica, 10, invoice.Name)
+	y += lineHeight
+	page.Text(left, y, pdf.Helvetica, 10, invoice.Email)
+
+	// the line items
+	y += 30
+	page.FillRect(left, y-12, right-left, 18, 0.9)
+	page.Text(left+5, y, pdf.HelveticaBold, 9, i18n.T(locale, "invoice.description"))
+	page.TextRight(quantityRight, y, pdf.HelveticaBold, 9, i18n.T(locale, "invoice.nights"))
+	page.TextRight(unitPriceRight, y, pdf.HelveticaBold, 9, i18n.T(locale, "invoice.unit_price"))
+	page.TextRight(right-5, y, pdf.HelveticaBold, 9, i18n.T(locale, "invoice.amount"))
+	y += 6
+
+	for _, line := range Lines(data, locale) {
+		y += 18
+		page.Text(left+5, y, pdf.Helvetica, 10, line.Description)
+		page.TextRight(quantityRight, y, pdf.Helvetica, 10, strconv.Itoa(line.Quantity))
+		page.TextRight(unitPriceRight, y, pdf.Helvetica, 10, money(line.UnitPrice))
+		page.TextRight(right-5, y, pdf.Helvetica, 10, money(line.Amount))
+	}
+
+	y += 10
+	page.Line(left, y, right, y, 0.5)
+
+	// the totals, with the tax the prices include
+	row := func(label, value string, font pdf.Font) {
+		y += 18
+		page.Text(labelsLeft, y, font, 10, label)
+		page.TextRight(right-5, y, font, 10, value)
+	}
+
+	if invoice.TaxRate > 0 {
+		taxName := invoice.TaxName
+		if taxName == "" {
+			taxName = i18n.T(locale, "invoice.tax_name")
+		}
+		row(i18n.T(locale, "invoice.subtotal"), money(invoice.Subtotal()), pdf.Helvetica)
+		row(i18n.T(locale, "invoice.tax", taxName, percent(invoice.TaxRate, locale)), money(invoice.Tax()), pdf.Helvetica)
+	}
+	row(i18n.T(locale, "invoice.total"), money(invoice.Total), pdf.HelveticaBold)
+
+	// what was paid towards the total
+	y += 30
+	page.Text(left, y, pdf.HelveticaBold, 10, i18n.T(locale, "invoice.payments"))
+	y += 6
+
+	for _, p := range data.Payments {
+		if p.Status != models.PaymentSucceeded {
+			continue
+		}
+		y += 16
+		page.Text(left+5, y, pdf.Helvetica, 10, formatDate(p.CreatedAt, locale))
+		page.Text(left+100, y, pdf.Helvetica, 10, i18n.T(locale, "invoice.payment."+p.Kind))
+		page.TextRight(right-5, y, pdf.Helvetica, 10, money(p.Amount))
+	}
+	for _, refund := range data.Refunds {
+		if refund.Status == models.PaymentFailed {
+			continue
+		}
+		y += 16
+		page.Text(left+5, y, pdf.Helvetica, 10, formatDate(refund.CreatedAt, locale))
+		page.Text(left+100, y, pdf.Helvetica, 10, i18n.T(locale, "invoice.refund"))
+		page.TextRight(right-5, y, pdf.Helvetica, 10, money(-refund.Amount))
+	}
+
+	y += 10
+	page.Line(labelsLeft, y, right, y, 0.5)
+
+	paid := Paid(data.Payments, data.Refunds)
+	row(i18n.T(locale, "invoice.paid"), money(paid), pdf.Helvetica)
+
+	// nothing is owed for a cancelled stay beyond what the property kept
+	if data.Reservation.Status == models.ReservationCancelled {
+		y += 30
+		page.Text(left, y, pdf.Helvetica, 10, i18n.T(locale, "invoice.cancelled",
+			formatDate(data.Reservation.CancelledAt, locale)))
+	} else if balance := invoice.Total - paid; balance > 0 {
+		row(i18n.T(locale, "invoice.balance"), money(balance), pdf.HelveticaBold)
+	}
+
+	page.Text(left, 790, pdf.Helvetica, 9, i18n.T(locale, "invoice.thanks"))
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// formatDate writes a date the way it is written in locale
+func formatDate(t time.Time, locale string) string {
+	return i18n.FormatDate(t, i18n.T(locale, "date.format"), locale)
+}
+
+// percent writes a rate in hundredths of a percent as a percentage, e.g. 750 as 7.5
+func percent(rate int, locale string) string {
+	s := strconv.Itoa(rate / 100)
+	if fraction := rate % 100; fraction != 0 {
+		s += i18n.T(locale, "number.decimal") + strings.TrimSuffix(strconv.Itoa(100 + fraction)[1:], "0")
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func testData(total int) Data {
+	return Data{
+		Invoice: models.Invoice{
+			Number:        7,
+			ReservationID: 3,
+			IssuedAt:      time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC),
+			Name:          "John Smith",
+			Email:         "john@smith.com",
+			Currency:      "EUR",
+			Total:         total,
+			TaxName:       "VAT",
+			TaxRate:       1000,
+		},
+		Reservation: models.Reservation{
+			ID:        3,
+			StartDate: time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2040, 1, 13, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{RoomName: "General's Quarters"},
+			Status:    models.ReservationConfirmed,
+		},
+		Property: models.Property{
+			Name:    "Go's Reservations",
+			Address: []string{"1 Main Street", "Springfield"},
+			TaxID:   "123456789",
+		},
+		Payments: []models.Payment{
+			{Kind: models.PaymentDeposit, Amount: 10800, Status: models.PaymentSucceeded},
+			{Kind: models.PaymentFull, Amount: 36000, Status: models.PaymentFailed},
+		},
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines(testData(36000), "en")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(lines))
+	}
+
+	line := lines[0]
+	if line.Description != "General's Quarters, 2040-01-10 to 2040-01-13" {
+		t.Errorf("unexpected description %q", line.Description)
+	}
+	if line.Quantity != 3 || line.UnitPrice != 12000 || line.Amount != 36000 {
+		t.Errorf("expected 3 nights at 12000, got %d at %d for %d", line.Quantity, line.UnitPrice, line.Amount)
+	}
+
+	// a total that doesn't split into nights is billed as one item
+	line = Lines(testData(36001), "en")[0]
+	if line.Quantity != 1 || line.UnitPrice != 36001 || line.Amount != 36001 {
+		t.Errorf("expected a single item of 36001, got %d at %d for %d", line.Quantity, line.UnitPrice, line.Amount)
+	}
+}
+
+func TestLinesWithDiscount(t *testing.T) {
+	data := testData(32400)
+	data.Reservation.PromoCode, data.Reservation.Discount = "SUMMER10", 3600
+
+	lines := Lines(data, "en")
+	if len(lines) != 2 {
+		t.Fatalf("expected the stay and the discount, got %d lines", len(lines))
+	}
+
+	if stay := lines[0]; stay.Quantity != 3 || stay.UnitPrice != 12000 || stay.Amount != 36000 {
+		t.Errorf("expected the stay before the discount, got %d at %d for %d", stay.Quantity, stay.UnitPrice, stay.Amount)
+	}
+
+	discount := lines[1]
+	if discount.Description != "Discount (SUMMER10)" || discount.Amount != -3600 {
+		t.Errorf("unexpected discount line %q of %d", discount.Description, discount.Amount)
+	}
+}
+
+func TestLinesAfterAPriceChange(t *testing.T) {
+	// booked at 12000 a night, the room costing more now
+	data := testData(36000)
+	data.Reservation.Room.Price = 15000
+
+	if line := Lines(data, "en")[0]; line.Quantity != 3 || line.UnitPrice != 12000 {
+		t.Errorf("expected 3 nights at the booked 12000, got %d at %d", line.Quantity, line.UnitPrice)
+	}
+}
+
+func TestPaid(t *testing.T) {
+	data := testData(36000)
+	refunds := []models.Refund{
+		{Amount: 800, Status: models.PaymentSucceeded},
+		{Amount: 500, Status: models.PaymentFailed},
+	}
+
+	if paid := Paid(data.Payments, refunds); paid != 10000 {
+		t.Errorf("expected 10000 paid after refunds, got %d", paid)
+	}
+}
+
+func TestTax(t *testing.T) {
+	tests := []struct {
+		total            int
+		rate             int
+		expectedSubtotal int
+		expectedTax      int
+	}{
+		{11000, 1000, 10000, 1000},
+		{36000, 1000, 32727, 3273},
+		{10000, 0, 10000, 0},
+		{12345, 2300, 10037, 2308},
+	}
+
+	for _, e := range tests {
+		invoice := models.Invoice{Total: e.total, TaxRate: e.rate}
+		if invoice.Subtotal() != e.expectedSubtotal || invoice.Tax() != e.expectedTax {
+			t.Errorf("%d at %d: expected %d and %d of tax, got %d and %d",
+				e.total, e.rate, e.expectedSubtotal, e.expectedTax, invoice.Subtotal(), invoice.Tax())
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := map[int]string{1000: "10", 750: "7.5", 825: "8.25", 5: "0.05"}
+
+	for rate, expected := range tests {
+		if got := percent(rate, "en"); got != expected {
+			t.Errorf("percent(%d) = %q, expected %q", rate, got, expected)
+		}
+	}
+
+	if got := percent(750, "pt"); got != "7,5" {
+		t.Errorf("expected a decimal comma in Portuguese, got %q", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, status := range []string{models.ReservationConfirmed, models.ReservationCancelled} {
+		data := testData(36000)
+		data.Reservation.Status = status
+
+		for _, locale := range []string{"en", "pt"} {
+			var buf bytes.Buffer
+			err := Write(&buf, data, locale)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+				t.Errorf("%s invoice in %s isn't a PDF document", status, locale)
+			}
+			if !bytes.Contains(buf.Bytes(), []byte("INV-000007")) {
+				t.Errorf("expected the %s invoice in %s to be titled with its number", status, locale)
+			}
+		}
+	}
+}
+
+func TestFilename(t *testing.T) {
+	if name := Filename(models.Invoice{Number: 42}); name != "INV-000042.pdf" {
+		t.Errorf("unexpected file name %q", name)
+	}
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/crislainesc/bookings/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20230102000000_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"20230102000000_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"20230101000000_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"20230101000000_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	loaded, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(loaded))
+	}
+
+	if loaded[0].Version != 20230101000000 || loaded[0].Name != "first" {
+		t.Errorf("migrations not sorted by version: got %d_%s first", loaded[0].Version, loaded[0].Name)
+	}
+
+	if loaded[1].Down != "DROP TABLE b;" {
+		t.Errorf("down script not loaded, got %q", loaded[1].Down)
+	}
+}
+
+var invalidMigrationTests = []struct {
+	name string
+	fsys fstest.MapFS
+}{
+	{"bad-suffix", fstest.MapFS{"20230101000000_first.sql": {Data: []byte("SELECT 1;")}}},
+	{"no-name", fstest.MapFS{"20230101000000.up.sql": {Data: []byte("SELECT 1;")}}},
+	{"bad-version", fstest.MapFS{"first_table.up.sql": {Data: []byte("SELECT 1;")}}},
+	{"down-only", fstest.MapFS{"20230101000000_first.down.sql": {Data: []byte("SELECT 1;")}}},
+	{"duplicate-version", fstest.MapFS{
+		"20230101000000_first.up.sql":  {Data: []byte("SELECT 1;")},
+		"20230101000000_second.up.sql": {Data: []byte("SELECT 1;")},
+	}},
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, e := range invalidMigrationTests {
+		_, err := Load(e.fsys)
+		if err == nil {
+			t.Errorf("%s: expected an error but did not get one", e.name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range loaded {
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// AvailabilityQuery describes a search for the rooms that are free for a stay
+type AvailabilityQuery struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Adults    int
+	Children  int
+	Sort      string
+	Page      int
+	PerPage   int
+}
+
+// Sort orders accepted by AvailabilityQuery
+const (
+	SortByPrice    = "price"
+	SortByCapacity = "capacity"
+	SortByName     = "name"
+)
+
+// Nights returns the length of the stay
+func (q AvailabilityQuery) Nights() int {
+	return int(q.EndDate.Sub(q.StartDate).Hours() / 24)
+}
+
+// Offset returns how many results come before the requested page
+func (q AvailabilityQuery) Offset() int {
+	if q.Page < 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.PerPage
+}
+
+// AvailableRoom is a room found by an availability search, with the price of the whole stay
+type AvailableRoom struct {
+	Room
+	Nights    int
+	StayPrice int
+}
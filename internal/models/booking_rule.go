@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// BookingRule limits the stays that can be booked in a room, or in every room when RoomID is 0.
+// A rule with season dates only applies to arrivals within the season. Zero maximums mean no limit.
+type BookingRule struct {
+	ID                int
+	RoomID            int
+	Name              string
+	SeasonStart       time.Time
+	SeasonEnd         time.Time
+	MinNights         int
+	MaxNights         int
+	MinLeadDays       int
+	MaxHorizonDays    int
+	ClosedToArrival   []time.Weekday
+	ClosedToDeparture []time.Weekday
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Room              Room
+}
+
+// Seasonal reports whether the rule only applies to part of the year
+func (r BookingRule) Seasonal() bool {
+	return !r.SeasonStart.IsZero() && !r.SeasonEnd.IsZero()
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// CancellationPolicy is what cancelling a reservation costs. A reservation can be cancelled for free until
+// FreeDays before arrival; after that PenaltyPercent of its total is kept. Non-refundable reservations keep
+// everything that was paid.
+type CancellationPolicy struct {
+	ID             int
+	Name           string
+	FreeDays       int
+	PenaltyPercent int
+	NonRefundable  bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Refund is money given back to a guest for a payment through the gateway that took it.
+// Amount is in the minor units of Currency, the currency of the property.
+type Refund struct {
+	ID            int
+	ReservationID int
+	PaymentID     int
+	Gateway       string
+	RefundID      string
+	Amount        int
+	Currency      string
+	Status        string
+	Reason        string
+	CreatedAt     time.Time
+}
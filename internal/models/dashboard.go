@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Occupancy is how many of the nights the active rooms could be booked for over a period were booked
+type Occupancy struct {
+	BookedNights    int
+	AvailableNights int
+}
+
+// Rate returns the percentage of the available nights that were booked
+func (o Occupancy) Rate() float64 {
+	if o.AvailableNights == 0 {
+		return 0
+	}
+	return float64(o.BookedNights) * 100 / float64(o.AvailableNights)
+}
+
+// DailyCount is a count of something that happened on a day, such as the reservations booked on it
+type DailyCount struct {
+	Day   time.Time
+	Count int
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ExchangeRate is the number of units of a currency one unit of the property's currency buys
+type ExchangeRate struct {
+	ID        int
+	Currency  string
+	Rate      float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
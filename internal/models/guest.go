@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Tags staff can put on a guest
+const (
+	GuestVIP       = "vip"
+	GuestDoNotRent = "do-not-rent"
+)
+
+// GuestTags are the tags a guest can have, in the order they are shown
+var GuestTags = []string{GuestVIP, GuestDoNotRent}
+
+// GuestTagLabels are the names the tags are shown with in the admin
+var GuestTagLabels = map[string]string{
+	GuestVIP:       "VIP",
+	GuestDoNotRent: "Do not rent",
+}
+
+// Guest is a person who booked, recognised by their email in any case. Reservations are linked to the
+// guest of their email when they are made. A guest merged into another has MergedIntoID set and is no
+// longer listed; bookings with its email go to the guest it was merged into.
+type Guest struct {
+	ID           int
+	Email        string
+	FirstName    string
+	LastName     string
+	Phone        string
+	Notes        string
+	Tags         []string
+	MergedIntoID int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// Stays counts the reservations of the guest that weren't cancelled or expired, LastStay is the arrival
+	// of the latest of them and Spend is what the guest paid through the payment gateway less what was
+	// refunded, in the minor units of the currency of the property
+	Stays    int
+	LastStay time.Time
+	Spend    int
+}
+
+// HasTag reports whether the guest has a tag
+func (g Guest) HasTag(tag string) bool {
+	for _, t := range g.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GuestQuery describes a search through the guests in the admin. Search matches part of the guest's name,
+// email or phone, and Tag keeps the guests with that tag. Zero values don't filter.
+type GuestQuery struct {
+	Search  string
+	Tag     string
+	Page    int
+	PerPage int
+}
+
+// Offset returns how many results come before the requested page
+func (q GuestQuery) Offset() int {
+	if q.Page < 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.PerPage
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Invoice is the bill for a reservation. Numbers are sequential and never reused. The guest, the total and
+// the tax are kept as they were when the invoice was issued, so later changes to the reservation or to the
+// tax settings don't rewrite it. Total is in the minor units of Currency and includes the tax.
+type Invoice struct {
+	ID            int
+	Number        int
+	ReservationID int
+	IssuedAt      time.Time
+	Name          string
+	Email         string
+	Currency      string
+	Total         int
+	TaxName       string
+	// TaxRate is in hundredths of a percent, 1000 is 10%
+	TaxRate   int
+	CreatedAt time.Time
+}
+
+// Reference returns the number of the invoice as it is printed, e.g. INV-000042
+func (i Invoice) Reference() string {
+	return fmt.Sprintf("INV-%06d", i.Number)
+}
+
+// Tax returns the part of the total that is tax, rounded to the nearest minor unit
+func (i Invoice) Tax() int {
+	return i.Total - i.Subtotal()
+}
+
+// Subtotal returns the total without the tax
+func (i Invoice) Subtotal() int {
+	return (i.Total*10000 + (10000+i.TaxRate)/2) / (10000 + i.TaxRate)
+}
@@ -1,9 +1,17 @@
 package models
 
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	Template    string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
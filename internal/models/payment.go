@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Kinds of payment a reservation can ask for
+const (
+	PaymentDeposit = "deposit"
+	PaymentFull    = "full"
+)
+
+// Statuses of a payment
+const (
+	PaymentPending   = "pending"
+	PaymentSucceeded = "succeeded"
+	PaymentFailed    = "failed"
+)
+
+// Payment is a payment for a reservation taken through the hosted checkout of a payment gateway.
+// Amount is in the minor units of Currency, the currency of the property.
+type Payment struct {
+	ID            int
+	ReservationID int
+	Gateway       string
+	CheckoutID    string
+	CheckoutURL   string
+	Kind          string
+	Amount        int
+	Currency      string
+	Status        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// PaymentEvent is a change to the status of a checkout reported by a payment gateway webhook.
+// ID is unique per gateway, so an event delivered twice is only applied once.
+type PaymentEvent struct {
+	ID         string
+	Gateway    string
+	CheckoutID string
+	Status     string
+}
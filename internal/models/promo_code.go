@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Kinds of discount a promo code gives
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+// PromoCode is a code guests enter when booking to get a discount. Amount is a percentage of the price of
+// the stay for percent codes, and an amount in the minor units of the currency of the property for fixed ones.
+// A code with dates only applies to arrivals between them, and a code without rooms applies to every room.
+// A MaxUses of 0 means no limit.
+type PromoCode struct {
+	ID           int
+	Code         string
+	Description  string
+	Kind         string
+	Amount       int
+	StartsOn     time.Time
+	EndsOn       time.Time
+	MinNights    int
+	RoomIDs      []int
+	MaxUses      int
+	Uses         int
+	OncePerEmail bool
+	Active       bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	// Discounted is the total taken off the reservations the code was redeemed for
+	Discounted int
+}
+
+// Dated reports whether the code only applies to arrivals within its dates
+func (p PromoCode) Dated() bool {
+	return !p.StartsOn.IsZero() || !p.EndsOn.IsZero()
+}
+
+// UsedUp reports whether the code was redeemed as many times as it can be
+func (p PromoCode) UsedUp() bool {
+	return p.MaxUses > 0 && p.Uses >= p.MaxUses
+}
+
+// ForRoom reports whether the code applies to a room
+func (p PromoCode) ForRoom(roomID int) bool {
+	if len(p.RoomIDs) == 0 {
+		return true
+	}
+	for _, id := range p.RoomIDs {
+		if id == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// PromoRedemption is the use of a promo code for a reservation
+type PromoRedemption struct {
+	ID            int
+	PromoCodeID   int
+	ReservationID int
+	CreatedAt     time.Time
+	Reservation   Reservation
+}
@@ -0,0 +1,13 @@
+package models
+
+// Property is the business issuing the invoices of reservations. Its prices include the tax of TaxRate,
+// in hundredths of a percent; there is no tax when it is zero.
+type Property struct {
+	Name    string
+	Address []string
+	Email   string
+	Phone   string
+	TaxID   string
+	TaxName string
+	TaxRate int
+}
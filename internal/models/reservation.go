@@ -2,6 +2,14 @@ package models
 
 import "time"
 
+// Statuses of a reservation. A reservation waiting for its payment holds the room until it expires.
+const (
+	ReservationPending   = "pending"
+	ReservationConfirmed = "confirmed"
+	ReservationExpired   = "expired"
+	ReservationCancelled = "cancelled"
+)
+
 type Reservation struct {
 	ID        int
 	FirstName string
@@ -11,8 +19,57 @@ type Reservation struct {
 	StartDate time.Time
 	EndDate   time.Time
 	RoomID    int
+	Adults    int
+	Children  int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	Status    string
+	// ExpiresAt is when a pending reservation releases the room if it hasn't been paid
+	ExpiresAt time.Time
+	// Total is the price of the stay in the minor units of the currency of the property
+	Total int
+	// CancelToken lets the guest cancel the reservation from the link they were emailed
+	CancelToken string
+	CancelledAt time.Time
+	// PromoCode is the code the reservation was booked with and Discount what it took off the total.
+	// PromoCodeID is the code redeemed when the reservation is inserted.
+	PromoCodeID int
+	PromoCode   string
+	Discount    int
+	// HoldID is the room restriction holding the room while the guest fills in the reservation form,
+	// until HoldExpiresAt
+	HoldID        int
+	HoldExpiresAt time.Time
+	// SpecialRequests is what the guest asked for when booking
+	SpecialRequests string
+	// Paid is what the guest paid for the reservation through the payment gateway so far, read with the
+	// admin lists and reports
+	Paid int
+	// GuestID is the guest the reservation was linked to by its email
+	GuestID int
+}
+
+// Nights returns the length of the stay
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// Cancellable reports whether the reservation still holds its room and can be cancelled
+func (r Reservation) Cancellable() bool {
+	return r.Status == ReservationPending || r.Status == ReservationConfirmed
+}
+
+// Balance returns what the guest still owes for the stay
+func (r Reservation) Balance() int {
+	if r.Paid >= r.Total {
+		return 0
+	}
+	return r.Total - r.Paid
+}
+
+// Guests returns the number of people staying
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
 }
@@ -0,0 +1,21 @@
+package models
+
+// Kinds of the rows of a reservation import
+const (
+	ImportReservation = "reservation"
+	ImportBlock       = "block"
+)
+
+// ImportRow is a row of a reservation import: a reservation, with the restriction booking its room unless it
+// was cancelled, or a block of a room for the dates. Blocks only use the room and dates of Reservation.
+type ImportRow struct {
+	// Line is the line of the row in the imported file
+	Line        int
+	Kind        string
+	Reservation Reservation
+}
+
+// TakesRoom reports whether the row books or blocks its room for its dates
+func (row ImportRow) TakesRoom() bool {
+	return row.Kind == ImportBlock || row.Reservation.Cancellable()
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// ReservationQuery describes a search through the reservations in the admin. Search matches part of the
+// guest's name or email, From and To keep the stays that overlap them, and NewOnly keeps the reservations
+// that weren't processed yet. Zero values don't filter.
+type ReservationQuery struct {
+	Search  string
+	RoomID  int
+	GuestID int
+	From    time.Time
+	To      time.Time
+	Status  string
+	NewOnly bool
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+// Sort orders accepted by ReservationQuery
+const (
+	SortByID        = "id"
+	SortByGuest     = "guest"
+	SortByRoom      = "room"
+	SortByArrival   = "arrival"
+	SortByDeparture = "departure"
+	SortByStatus    = "status"
+	SortByCreated   = "created"
+)
+
+// Offset returns how many results come before the requested page
+func (q ReservationQuery) Offset() int {
+	if q.Page < 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.PerPage
+}
@@ -2,6 +2,13 @@ package models
 
 import "time"
 
+// Restriction IDs seeded into the restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	RestrictionHold        = 3
+)
+
 type Restriction struct {
 	ID              int
 	RestrictionName string
@@ -3,8 +3,53 @@ package models
 import "time"
 
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID           int
+	RoomName     string
+	Slug         string
+	Description  string
+	Capacity     int
+	MaxOccupancy int
+	// Price is the nightly rate in the minor units, e.g. cents, of the currency of the property
+	Price     int
+	Amenities []string
+	Active    bool
+	Photos    []RoomPhoto
+	// PaymentPolicy is whether booking the room takes a deposit or the full price of the stay
+	PaymentPolicy  string
+	DepositPercent int
+	// CancellationPolicyID is the policy cancelling the room follows, 0 for free cancellation until arrival
+	CancellationPolicyID int
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+// Thumbnail returns the first photo of the room, or an empty photo if it has none
+func (r Room) Thumbnail() RoomPhoto {
+	if len(r.Photos) == 0 {
+		return RoomPhoto{}
+	}
+	return r.Photos[0]
+}
+
+// Fits reports whether a party can stay in the room: capacity limits the adults,
+// and max occupancy limits everyone, children included
+func (r Room) Fits(adults, children int) bool {
+	return adults <= r.Capacity && adults+children <= r.MaxOccupancy
+}
+
+// AmountDue returns the part of the price of a stay paid when booking the room: the deposit percentage
+// of it for rooms that take a deposit, otherwise all of it
+func (r Room) AmountDue(total int) int {
+	if r.PaymentPolicy == PaymentDeposit && r.DepositPercent > 0 && r.DepositPercent < 100 {
+		return (total*r.DepositPercent + 99) / 100
+	}
+	return total
+}
+
+// PaymentKind returns the kind of payment booking the room takes
+func (r Room) PaymentKind() string {
+	if r.PaymentPolicy == PaymentDeposit && r.DepositPercent > 0 && r.DepositPercent < 100 {
+		return PaymentDeposit
+	}
+	return PaymentFull
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// RoomPhoto is a photo of a room. URL is the largest variant; uploaded photos
+// keep their variants in a blob store under StorageKey.
+type RoomPhoto struct {
+	ID           int
+	RoomID       int
+	URL          string
+	MediumURL    string
+	ThumbnailURL string
+	StorageKey   string
+	AltText      string
+	Position     int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
@@ -9,9 +9,11 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Room          Room
-	Reservation   Reservation
-	Restriction   Restriction
+	// ExpiresAt is when a hold releases the room
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Room        Room
+	Reservation Reservation
+	Restriction Restriction
 }
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/crislainesc/bookings/internal/forms"
+import (
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/forms"
+	"github.com/crislainesc/bookings/internal/i18n"
+)
 
 // TemplateData holds data sent from handlers to templates
 type TemplateData struct {
@@ -14,4 +18,12 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	Locale          string
+	Locales         []string
+	Money           currency.Display
+}
+
+// T returns the message with the key in the language of the page, formatted with args
+func (td *TemplateData) T(key string, args ...interface{}) string {
+	return i18n.T(td.Locale, key, args...)
 }
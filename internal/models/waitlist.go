@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Statuses of a waitlist entry. An entry is offered a room when one frees up for its dates, and expires
+// when the guest doesn't book it in time.
+const (
+	WaitlistWaiting = "waiting"
+	WaitlistOffered = "offered"
+	WaitlistBooked  = "booked"
+	WaitlistExpired = "expired"
+)
+
+// WaitlistEntry is a guest waiting for a room to free up for their dates. A RoomID of 0 means any room the
+// party fits in. An offered entry holds OfferedRoomID with HoldID until ExpiresAt, and is booked from the
+// link with Token.
+type WaitlistEntry struct {
+	ID            int
+	FirstName     string
+	LastName      string
+	Email         string
+	StartDate     time.Time
+	EndDate       time.Time
+	RoomID        int
+	Adults        int
+	Children      int
+	Status        string
+	Token         string
+	OfferedRoomID int
+	HoldID        int
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
@@ -0,0 +1,249 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// fakeSignatureHeader is the header the fake gateway signs its webhooks in
+const fakeSignatureHeader = "Fake-Signature"
+
+// Event types sent by the fake gateway
+const (
+	fakeCheckoutSucceeded = "checkout.succeeded"
+	fakeCheckoutFailed    = "checkout.failed"
+)
+
+// FakeGateway is a payment gateway for local development and tests. Its checkout pages are served by the
+// gateway itself as an http.Handler, and paying or declining there sends a signed webhook to WebhookURL
+// the way a real gateway would.
+type FakeGateway struct {
+	Secret string
+	// BaseURL is where the gateway is mounted, e.g. http://localhost:8080/fake-gateway
+	BaseURL    string
+	WebhookURL string
+	Client     *http.Client
+
+	mu        sync.Mutex
+	checkouts map[string]CheckoutRequest
+}
+
+// fakeEvent is the body of a webhook sent by the fake gateway
+type fakeEvent struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	CheckoutID string `json:"checkout_id"`
+	Reference  string `json:"reference"`
+	Amount     int    `json:"amount"`
+}
+
+// NewFakeGateway creates a fake gateway that signs its webhooks with secret
+func NewFakeGateway(secret, baseURL, webhookURL string) *FakeGateway {
+	return &FakeGateway{
+		Secret:     secret,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		checkouts:  make(map[string]CheckoutRequest),
+	}
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+// CreateCheckout keeps the payment in memory until the guest pays or declines it
+func (g *FakeGateway) CreateCheckout(ctx context.Context, req CheckoutRequest) (Checkout, error) {
+	if req.Amount <= 0 {
+		return Checkout{}, errors.New("checkout amount must be positive")
+	}
+
+	id, err := randomID("cs_fake_")
+	if err != nil {
+		return Checkout{}, err
+	}
+
+	g.mu.Lock()
+	g.checkouts[id] = req
+	g.mu.Unlock()
+
+	return Checkout{ID: id, URL: g.BaseURL + "/checkout/" + id}, nil
+}
+
+func (g *FakeGateway) ParseWebhook(r *http.Request) (models.PaymentEvent, error) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return models.PaymentEvent{}, err
+	}
+
+	err = Verify(g.Secret, payload, r.Header.Get(fakeSignatureHeader), time.Now(), SignatureTolerance)
+	if err != nil {
+		return models.PaymentEvent{}, err
+	}
+
+	var event fakeEvent
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return models.PaymentEvent{}, err
+	}
+
+	status := models.PaymentFailed
+	if event.Type == fakeCheckoutSucceeded {
+		status = models.PaymentSucceeded
+	}
+
+	return models.PaymentEvent{
+		ID:         event.ID,
+		Gateway:    g.Name(),
+		CheckoutID: event.CheckoutID,
+		Status:     status,
+	}, nil
+}
+
+// Refund gives the money back at once. The fake gateway doesn't remember paid checkouts across restarts,
+// so it refunds any of them.
+func (g *FakeGateway) Refund(ctx context.Context, req RefundRequest) (Refund, error) {
+	if req.CheckoutID == "" || req.Amount <= 0 {
+		return Refund{}, errors.New("refund needs a checkout and a positive amount")
+	}
+
+	id, err := randomID("re_fake_")
+	if err != nil {
+		return Refund{}, err
+	}
+
+	return Refund{ID: id, Status: models.PaymentSucceeded}, nil
+}
+
+var fakeCheckoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake Gateway</title></head>
+<body style="font-family: sans-serif; max-width: 30em; margin: 3em auto">
+  <h1>Fake Gateway</h1>
+  <p>{{.Request.Description}}</p>
+  <p><strong>{{.Amount}} {{.Request.Currency}}</strong></p>
+  <form method="post" action="{{.ID}}/pay" style="display: inline"><button type="submit">Pay</button></form>
+  <form method="post" action="{{.ID}}/decline" style="display: inline"><button type="submit">Decline</button></form>
+</body>
+</html>
+`))
+
+// ServeHTTP serves the checkout pages, GET /checkout/{id}, and their pay and decline buttons,
+// POST /checkout/{id}/pay and POST /checkout/{id}/decline. The gateway must be mounted with its prefix stripped.
+func (g *FakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "checkout" {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := parts[1]
+
+	g.mu.Lock()
+	req, ok := g.checkouts[id]
+	g.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 2 && r.Method == http.MethodGet {
+		_ = fakeCheckoutPage.Execute(w, map[string]interface{}{
+			"ID":      id,
+			"Request": req,
+			"Amount":  currency.FormatAmount(req.Amount, currency.Get(req.Currency)),
+		})
+		return
+	}
+
+	if len(parts) != 3 || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	eventType, next := fakeCheckoutSucceeded, req.SuccessURL
+	switch parts[2] {
+	case "pay":
+	case "decline":
+		eventType, next = fakeCheckoutFailed, req.CancelURL
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	err := g.sendWebhook(r.Context(), id, eventType, req)
+	if err != nil {
+		http.Error(w, "can't reach the webhook: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if eventType == fakeCheckoutSucceeded {
+		g.mu.Lock()
+		delete(g.checkouts, id)
+		g.mu.Unlock()
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// sendWebhook posts a signed event about a checkout to the webhook URL
+func (g *FakeGateway) sendWebhook(ctx context.Context, checkoutID, eventType string, req CheckoutRequest) error {
+	eventID, err := randomID("evt_fake_")
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(fakeEvent{
+		ID:         eventID,
+		Type:       eventType,
+		CheckoutID: checkoutID,
+		Reference:  req.Reference,
+		Amount:     req.Amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	webhook, err := http.NewRequestWithContext(ctx, http.MethodPost, g.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	webhook.Header.Set("Content-Type", "application/json")
+	webhook.Header.Set(fakeSignatureHeader, Sign(g.Secret, payload, time.Now()))
+
+	resp, err := g.Client.Do(webhook)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// randomID returns a random identifier with a prefix
+func randomID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
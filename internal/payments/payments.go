@@ -0,0 +1,119 @@
+// Package payments takes payments for reservations through the hosted checkout of a payment gateway.
+//
+// A checkout is created for the amount a reservation owes and the guest is sent to its URL to pay. The gateway
+// then reports the outcome to the webhook of the app with a signed request, which is turned into a
+// models.PaymentEvent with ParseWebhook.
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// ErrInvalidSignature is returned for webhook requests that weren't signed by the gateway
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// SignatureTolerance is how old a webhook signature can be, to stop old requests from being replayed
+const SignatureTolerance = 5 * time.Minute
+
+// PaymentGateway takes payments through a hosted checkout page
+type PaymentGateway interface {
+	// Name identifies the gateway in payment records
+	Name() string
+	// CreateCheckout starts the checkout of a payment and returns the page the guest pays on
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (Checkout, error)
+	// ParseWebhook verifies the signature of a webhook request and returns the event it reports
+	ParseWebhook(r *http.Request) (models.PaymentEvent, error)
+	// Refund gives back part or all of a payment taken through a checkout
+	Refund(ctx context.Context, req RefundRequest) (Refund, error)
+}
+
+// CheckoutRequest is a payment for a gateway to take. Amount is in the minor units of Currency.
+type CheckoutRequest struct {
+	// Reference identifies what is paid for, e.g. the reservation ID
+	Reference   string
+	Amount      int
+	Currency    string
+	Description string
+	Email       string
+	// SuccessURL and CancelURL are where the guest is sent back to after paying or giving up
+	SuccessURL string
+	CancelURL  string
+}
+
+// Checkout is a hosted checkout started by a gateway
+type Checkout struct {
+	ID  string
+	URL string
+}
+
+// RefundRequest is an amount of a checkout to give back, in the minor units of Currency
+type RefundRequest struct {
+	CheckoutID string
+	Amount     int
+	Currency   string
+	Reason     string
+}
+
+// Refund is a refund started by a gateway. Status is models.PaymentSucceeded once the money was sent back,
+// or models.PaymentPending while the gateway is still processing it.
+type Refund struct {
+	ID     string
+	Status string
+}
+
+// Sign returns the signature header of a webhook payload sent at t: the time and the HMAC-SHA256 of
+// "time.payload" keyed with the webhook secret, e.g. t=1700000000,v1=5257a8...
+func Sign(secret string, payload []byte, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, signature(secret, timestamp, payload))
+}
+
+// Verify checks that a signature header was made by Sign with the secret for the payload, no longer ago
+// than the tolerance
+func Verify(secret string, payload []byte, header string, now time.Time, tolerance time.Duration) error {
+	var timestamp, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			sig = value
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(unix, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, timestamp, payload))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func signature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
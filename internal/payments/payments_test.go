@@ -0,0 +1,139 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := []byte(`{"id":"evt_1"}`)
+	header := Sign("secret", payload, now)
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		header  string
+		now     time.Time
+		valid   bool
+	}{
+		{"valid", "secret", payload, header, now, true},
+		{"within-tolerance", "secret", payload, header, now.Add(SignatureTolerance), true},
+		{"wrong-secret", "other", payload, header, now, false},
+		{"tampered-payload", "secret", []byte(`{"id":"evt_2"}`), header, now, false},
+		{"too-old", "secret", payload, header, now.Add(SignatureTolerance + time.Second), false},
+		{"missing-header", "secret", payload, "", now, false},
+		{"malformed-header", "secret", payload, "t=soon,v1=abc", now, false},
+	}
+
+	for _, e := range tests {
+		err := Verify(e.secret, e.payload, e.header, e.now, SignatureTolerance)
+		if e.valid && err != nil {
+			t.Errorf("%s: expected a valid signature, got %v", e.name, err)
+		}
+		if !e.valid && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", e.name, err)
+		}
+	}
+}
+
+func TestFakeGateway(t *testing.T) {
+	events := make(chan models.PaymentEvent, 1)
+
+	var gateway *FakeGateway
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, err := gateway.ParseWebhook(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		events <- event
+	}))
+	defer webhook.Close()
+
+	gateway = NewFakeGateway("secret", "http://localhost/fake-gateway", webhook.URL)
+
+	_, err := gateway.CreateCheckout(context.Background(), CheckoutRequest{Amount: 0})
+	if err == nil {
+		t.Error("expected an error for a checkout without an amount")
+	}
+
+	checkout, err := gateway.CreateCheckout(context.Background(), CheckoutRequest{
+		Reference:  "1",
+		Amount:     3600,
+		Currency:   "USD",
+		SuccessURL: "/reservation-summary?paid",
+		CancelURL:  "/reservation-summary",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkout.URL != "http://localhost/fake-gateway/checkout/"+checkout.ID {
+		t.Errorf("unexpected checkout URL %s", checkout.URL)
+	}
+
+	rr := httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest("GET", "/checkout/"+checkout.ID, nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "36.00 USD") {
+		t.Errorf("expected the checkout page, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest("POST", "/checkout/"+checkout.ID+"/pay", nil))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/reservation-summary?paid" {
+		t.Errorf("expected to be sent back to the success URL, got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	select {
+	case event := <-events:
+		if event.CheckoutID != checkout.ID || event.Status != models.PaymentSucceeded || event.Gateway != "fake" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	default:
+		t.Error("expected the webhook to be delivered")
+	}
+
+	rr = httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest("GET", "/checkout/"+checkout.ID, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected a paid checkout to be gone, got %d", rr.Code)
+	}
+}
+
+func TestFakeGatewayRejectsUnsignedWebhooks(t *testing.T) {
+	gateway := NewFakeGateway("secret", "http://localhost/fake-gateway", "http://localhost/payments/webhook")
+
+	req := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(`{"id":"evt_1"}`))
+	req.Header.Set(fakeSignatureHeader, Sign("other", []byte(`{"id":"evt_1"}`), time.Now()))
+
+	_, err := gateway.ParseWebhook(req)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestFakeGatewayRefund(t *testing.T) {
+	gateway := NewFakeGateway("secret", "http://localhost/fake-gateway", "http://localhost/payments/webhook")
+
+	refund, err := gateway.Refund(context.Background(), RefundRequest{CheckoutID: "cs_fake_1", Amount: 3600, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(refund.ID, "re_fake_") || refund.Status != models.PaymentSucceeded {
+		t.Errorf("unexpected refund %+v", refund)
+	}
+
+	_, err = gateway.Refund(context.Background(), RefundRequest{CheckoutID: "cs_fake_1"})
+	if err == nil {
+		t.Error("expected an error for a refund without an amount")
+	}
+}
@@ -0,0 +1,238 @@
+// Package pdf writes simple PDF documents: pages of text, lines and shaded boxes.
+//
+// Text is set in the standard Helvetica fonts every PDF reader has, so no font files are embedded, and is
+// limited to the characters of the Windows-1252 code page; other characters are written as a question mark.
+// Positions are in points from the top-left corner of the page, with y growing down.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Font is one of the standard fonts text can be set in
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+// names of the fonts in the page resources and their PostScript names
+var fontNames = map[Font][2]string{
+	Helvetica:     {"F1", "Helvetica"},
+	HelveticaBold: {"F2", "Helvetica-Bold"},
+}
+
+// The size of an A4 page in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Document is a PDF document being built a page at a time
+type Document struct {
+	Width  float64
+	Height float64
+	Title  string
+	// Compress deflates the contents of the pages; tests turn it off to read them
+	Compress bool
+
+	pages []*Page
+}
+
+// Page is a page of a document, drawn on in the order its methods are called
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+// New returns an empty document of A4 pages
+func New() *Document {
+	return &Document{
+		Width:    A4Width,
+		Height:   A4Height,
+		Compress: true,
+	}
+}
+
+// AddPage adds a blank page at the end of the document
+func (d *Document) AddPage() *Page {
+	page := &Page{doc: d}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// Text writes s with its baseline starting at x, y
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		fontNames[font][0], number(size), number(x), number(p.doc.Height-y), escape(encode(s)))
+}
+
+// TextRight writes s with its baseline ending at x, y
+func (p *Page) TextRight(x, y float64, font Font, size float64, s string) {
+	p.Text(x-Width(font, size, s), y, font, size, s)
+}
+
+// Line draws a black line from x1, y1 to x2, y2
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		number(width), number(x1), number(p.doc.Height-y1), number(x2), number(p.doc.Height-y2))
+}
+
+// FillRect fills a box with its top-left corner at x, y with a gray from 0, black, to 1, white
+func (p *Page) FillRect(x, y, width, height, gray float64) {
+	fmt.Fprintf(&p.content, "q %s g %s %s %s %s re f Q\n",
+		number(gray), number(x), number(p.doc.Height-y-height), number(width), number(height))
+}
+
+// Width returns how wide s is when written in font at size
+func Width(font Font, size float64, s string) float64 {
+	widths := &helveticaWidths
+	if font == HelveticaBold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, c := range encode(s) {
+		total += widths[c-32]
+	}
+
+	return float64(total) * size / 1000
+}
+
+// WriteTo writes the document as a PDF file
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+
+	// object starts an object, numbered from 1 in the order they are written
+	object := func() int {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", len(offsets))
+		return len(offsets)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// the catalog, the page tree and the fonts come first, so the pages can refer to them
+	const catalogObj, pagesObj, firstFontObj = 1, 2, 3
+	infoObj := firstFontObj + len(fontNames)
+	firstPageObj := infoObj + 1
+
+	object()
+	fmt.Fprintf(&buf, "<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pagesObj)
+
+	object()
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+	fmt.Fprintf(&buf, "<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] >>\nendobj\n",
+		strings.Join(kids, " "), len(d.pages), number(d.Width), number(d.Height))
+
+	var fonts []string
+	for font := Helvetica; font <= HelveticaBold; font++ {
+		n := object()
+		fmt.Fprintf(&buf, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\nendobj\n",
+			fontNames[font][1])
+		fonts = append(fonts, fmt.Sprintf("/%s %d 0 R", fontNames[font][0], n))
+	}
+
+	object()
+	fmt.Fprintf(&buf, "<< /Title (%s) /Producer (bookings) >>\nendobj\n", escape(encode(d.Title)))
+
+	for _, page := range d.pages {
+		n := object()
+		fmt.Fprintf(&buf, "<< /Type /Page /Parent %d 0 R /Resources << /Font << %s >> >> /Contents %d 0 R >>\nendobj\n",
+			pagesObj, strings.Join(fonts, " "), n+1)
+
+		content, filter, err := d.stream(page.content.Bytes())
+		if err != nil {
+			return 0, err
+		}
+
+		object()
+		fmt.Fprintf(&buf, "<< /Length %d%s >>\nstream\n", len(content), filter)
+		buf.Write(content)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, catalogObj, infoObj, xref)
+
+	return buf.WriteTo(w)
+}
+
+// stream returns the contents of a page as they are stored, with the filter to read them back
+func (d *Document) stream(content []byte) ([]byte, string, error) {
+	if !d.Compress {
+		return content, "", nil
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(content)
+	if err != nil {
+		return nil, "", err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), " /Filter /FlateDecode", nil
+}
+
+// winAnsi maps the characters Windows-1252 puts between 128 and 159 to their codes
+var winAnsi = map[rune]byte{
+	'€': 128, '‚': 130, 'ƒ': 131, '„': 132, '…': 133, '†': 134, '‡': 135, 'ˆ': 136, '‰': 137, 'Š': 138,
+	'‹': 139, 'Œ': 140, 'Ž': 142, '‘': 145, '’': 146, '“': 147, '”': 148, '•': 149, '–': 150, '—': 151,
+	'˜': 152, '™': 153, 'š': 154, '›': 155, 'œ': 156, 'ž': 158, 'Ÿ': 159,
+}
+
+// encode returns s in Windows-1252, with a question mark for each character the code page doesn't have
+// and a space for each control character
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 32 || r == 127:
+			b = append(b, ' ')
+		case r < 127 || r >= 160 && r <= 255:
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// escape makes encoded text safe to write inside the parentheses of a PDF string
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == '\\' || c == '(' || c == ')' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// number formats a position or size with at most two decimals, as PDF readers expect
+func number(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,135 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	doc := New()
+	doc.Title = "Invoice (1)"
+	doc.Compress = false
+
+	page := doc.AddPage()
+	page.Text(50, 60, HelveticaBold, 18, "Invoice")
+	page.TextRight(545, 60, Helvetica, 10, `Cabin (2 nights) \ 5 €`)
+	page.Line(50, 70, 545, 70, 0.5)
+	page.FillRect(50, 80, 495, 20, 0.9)
+	doc.AddPage().Text(50, 60, Helvetica, 10, "Page 2")
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("expected the document to start with the PDF header and end with the end of file marker")
+	}
+
+	for _, want := range []string{
+		"/Count 2",
+		"/BaseFont /Helvetica-Bold",
+		"/Title (Invoice \\(1\\))",
+		"BT /F2 18 Tf 50 781.89 Td (Invoice) Tj ET",
+		"(Cabin \\(2 nights\\) \\\\ 5 \x80) Tj",
+		"0.5 w 50 771.89 m 545 771.89 l S",
+		"q 0.9 g 50 741.89 495 20 re f Q",
+		"(Page 2) Tj",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("expected the document to contain %q", want)
+		}
+	}
+
+	// every object must be where the cross-reference table says it is
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if startxref == nil {
+		t.Fatal("expected a startxref")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d doesn't point at the cross-reference table", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Errorf("expected 9 objects, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		want := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("expected object %d at offset %d", i+1, offset)
+		}
+	}
+}
+
+func TestWriteToCompressed(t *testing.T) {
+	doc := New()
+	doc.AddPage().Text(50, 60, Helvetica, 10, "Hello")
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "/Filter /FlateDecode") {
+		t.Fatal("expected the page contents to be compressed")
+	}
+
+	start := strings.Index(out, "stream\n") + len("stream\n")
+	end := strings.Index(out, "\nendstream")
+
+	zr, err := zlib.NewReader(strings.NewReader(out[start:end]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(content), "(Hello) Tj") {
+		t.Errorf("expected the page contents to write Hello, got %q", content)
+	}
+}
+
+var encodeTests = []struct {
+	text     string
+	expected string
+}{
+	{"Invoice", "Invoice"},
+	{"Reserva n.º 3, São Paulo", "Reserva n.\xba 3, S\xe3o Paulo"},
+	{"€ 10 – “paid”", "\x80 10 \x96 \x93paid\x94"},
+	{"₹ 100", "? 100"},
+	{"two\nlines", "two lines"},
+}
+
+func TestEncode(t *testing.T) {
+	for _, e := range encodeTests {
+		if got := string(encode(e.text)); got != e.expected {
+			t.Errorf("encode(%q) = %q, expected %q", e.text, got, e.expected)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	// H, i and the space are 722, 222 and 278 thousandths wide in Helvetica
+	if w := Width(Helvetica, 10, "Hi "); w != 12.22 {
+		t.Errorf("expected Hi to be 12.22 points wide, got %v", w)
+	}
+
+	if Width(HelveticaBold, 10, "Total") <= Width(Helvetica, 10, "Total") {
+		t.Error("expected bold text to be wider")
+	}
+}
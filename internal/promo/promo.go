@@ -0,0 +1,53 @@
+// Package promo decides whether a promo code can be used for a stay and what it takes off its price.
+package promo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// Normalize returns a code the way codes are stored, so guests can type it in any case
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check reports whether a code can be used for a stay in a room from start to end and, when it can't, the
+// reason to show the guest. Whether a guest already used a code that is once per email is only known when
+// the code is redeemed.
+func Check(code models.PromoCode, roomID int, start, end time.Time) (i18n.Message, bool) {
+	switch {
+	case !code.Active:
+		return i18n.Message{Key: "promo.invalid"}, false
+	case !code.StartsOn.IsZero() && dates.Day(start).Before(dates.Day(code.StartsOn)),
+		!code.EndsOn.IsZero() && dates.Day(start).After(dates.Day(code.EndsOn)):
+		return i18n.Message{Key: "promo.dates"}, false
+	case code.MinNights > 1 && dates.Between(start, end) < code.MinNights:
+		return i18n.Message{Key: "promo.min_nights", Args: []interface{}{code.MinNights}}, false
+	case !code.ForRoom(roomID):
+		return i18n.Message{Key: "promo.room"}, false
+	case code.UsedUp():
+		return i18n.Message{Key: "promo.used_up"}, false
+	}
+	return i18n.Message{}, true
+}
+
+// Discount returns what a code takes off a stay with a total price, in the minor units of the currency of
+// the property. Percentages are rounded down and a discount never takes off more than the total.
+func Discount(code models.PromoCode, total int) int {
+	discount := code.Amount
+	if code.Kind == models.PromoPercent {
+		discount = total * code.Amount / 100
+	}
+
+	if discount > total {
+		return total
+	}
+	if discount < 0 {
+		return 0
+	}
+	return discount
+}
@@ -0,0 +1,89 @@
+package promo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestNormalize(t *testing.T) {
+	if code := Normalize("  summer10 "); code != "SUMMER10" {
+		t.Errorf("expected SUMMER10, got %q", code)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	code := models.PromoCode{
+		Code:      "SUMMER10",
+		Kind:      models.PromoPercent,
+		Amount:    10,
+		StartsOn:  date("2040-06-01"),
+		EndsOn:    date("2040-08-31"),
+		MinNights: 2,
+		RoomIDs:   []int{1, 3},
+		MaxUses:   5,
+		Uses:      4,
+		Active:    true,
+	}
+
+	tests := []struct {
+		name     string
+		change   func(c *models.PromoCode)
+		roomID   int
+		start    string
+		end      string
+		expected string
+	}{
+		{"applies", nil, 1, "2040-07-01", "2040-07-03", ""},
+		{"last day of the window", nil, 3, "2040-08-31", "2040-09-05", ""},
+		{"inactive", func(c *models.PromoCode) { c.Active = false }, 1, "2040-07-01", "2040-07-03", "promo.invalid"},
+		{"before the window", nil, 1, "2040-05-31", "2040-06-03", "promo.dates"},
+		{"after the window", nil, 1, "2040-09-01", "2040-09-03", "promo.dates"},
+		{"only a start", func(c *models.PromoCode) { c.EndsOn = time.Time{} }, 1, "2041-01-01", "2041-01-03", ""},
+		{"too short", nil, 1, "2040-07-01", "2040-07-02", "promo.min_nights"},
+		{"other room", nil, 2, "2040-07-01", "2040-07-03", "promo.room"},
+		{"every room", func(c *models.PromoCode) { c.RoomIDs = nil }, 2, "2040-07-01", "2040-07-03", ""},
+		{"used up", func(c *models.PromoCode) { c.Uses = 5 }, 1, "2040-07-01", "2040-07-03", "promo.used_up"},
+		{"no limit", func(c *models.PromoCode) { c.MaxUses, c.Uses = 0, 100 }, 1, "2040-07-01", "2040-07-03", ""},
+	}
+
+	for _, e := range tests {
+		c := code
+		if e.change != nil {
+			e.change(&c)
+		}
+
+		msg, ok := Check(c, e.roomID, date(e.start), date(e.end))
+		if ok != (e.expected == "") || msg.Key != e.expected {
+			t.Errorf("%s: expected %q, got %q (ok %v)", e.name, e.expected, msg.Key, ok)
+		}
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		kind     string
+		amount   int
+		total    int
+		expected int
+	}{
+		{models.PromoPercent, 10, 36000, 3600},
+		{models.PromoPercent, 15, 12345, 1851},
+		{models.PromoPercent, 100, 36000, 36000},
+		{models.PromoFixed, 5000, 36000, 5000},
+		{models.PromoFixed, 50000, 36000, 36000},
+	}
+
+	for _, e := range tests {
+		code := models.PromoCode{Kind: e.kind, Amount: e.amount}
+		if discount := Discount(code, e.total); discount != e.expected {
+			t.Errorf("%s %d off %d: expected %d, got %d", e.kind, e.amount, e.total, e.expected, discount)
+		}
+	}
+}
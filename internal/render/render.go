@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/crislainesc/bookings/internal/config"
+	"github.com/crislainesc/bookings/internal/currency"
+	"github.com/crislainesc/bookings/internal/i18n"
 	"github.com/crislainesc/bookings/internal/models"
 	"github.com/justinas/nosurf"
 )
@@ -19,6 +21,10 @@ var functions = template.FuncMap{
 	"formatDateWithLayout": FormatDateWithLayout,
 	"iterate":              Iterate,
 	"add":                  Add,
+	"formatMoney":          FormatMoney,
+	"formatAmount":         FormatAmount,
+	"formatPrice":          FormatPrice,
+	"formatCurrency":       FormatCurrency,
 }
 
 var app *config.AppConfig
@@ -29,14 +35,44 @@ func NewRenderer(appConfig *config.AppConfig) {
 	app = appConfig
 }
 
-func FormatDate(d time.Time) string {
-	return d.Format("2006-01-02")
+// FormatDate formats a date the way it is written in locale, or the default locale when none is given
+func FormatDate(d time.Time, locale ...string) string {
+	l := firstLocale(locale)
+	return i18n.FormatDate(d, i18n.T(l, "date.format"), l)
 }
 
 func Add(a, b int) int {
 	return a + b
 }
 
+// FormatMoney formats an amount in the minor units of the property's currency, e.g. 12050 as $120.50
+func FormatMoney(amount int) string {
+	return currency.Format(amount, baseCurrency(), i18n.Default)
+}
+
+// FormatAmount formats an amount in the minor units of the property's currency for a form field, e.g. 12050 as 120.50
+func FormatAmount(amount int) string {
+	return currency.FormatAmount(amount, baseCurrency())
+}
+
+// FormatPrice formats an amount in the minor units of the property's currency in the currency and language
+// a guest picked
+func FormatPrice(amount int, display currency.Display) string {
+	return display.Format(amount)
+}
+
+// FormatCurrency formats an amount in the minor units of the currency with the code in the language of locale
+func FormatCurrency(amount int, code, locale string) string {
+	return currency.Format(amount, currency.Get(code), locale)
+}
+
+func baseCurrency() currency.Currency {
+	if app == nil {
+		return currency.Get(currency.Default)
+	}
+	return currency.Get(app.Currency)
+}
+
 // Iterate returns a slice of integers, starting at 0, going to count
 func Iterate(count int) []int {
 	var items []int
@@ -46,8 +82,17 @@ func Iterate(count int) []int {
 	return items
 }
 
-func FormatDateWithLayout(t time.Time, l string) string {
-	return t.Format(l)
+// FormatDateWithLayout formats a date with a time layout, writing month and weekday names in the language
+// of locale, or the default locale when none is given
+func FormatDateWithLayout(t time.Time, l string, locale ...string) string {
+	return i18n.FormatDate(t, l, firstLocale(locale))
+}
+
+func firstLocale(locale []string) string {
+	if len(locale) == 0 {
+		return i18n.Default
+	}
+	return locale[0]
 }
 
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
@@ -55,6 +100,11 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
+	td.Locale = i18n.FromContext(r.Context())
+	td.Locales = i18n.Supported
+	if td.Form != nil {
+		td.Form.Locale = td.Locale
+	}
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
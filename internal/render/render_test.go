@@ -76,3 +76,19 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestFormatMoney(t *testing.T) {
+	tests := map[int]string{
+		0:      "$0.00",
+		5:      "$0.05",
+		12050:  "$120.50",
+		-12050: "-$120.50",
+		123456: "$1,234.56",
+	}
+
+	for cents, expected := range tests {
+		if got := FormatMoney(cents); got != expected {
+			t.Errorf("FormatMoney(%d) = %s, wanted %s", cents, got, expected)
+		}
+	}
+}
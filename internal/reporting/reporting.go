@@ -0,0 +1,298 @@
+// Package reporting computes the occupancy and revenue statistics of the rooms over a period, by room and by
+// month, from the reservations staying in it.
+//
+// Reservations holding their room count as sold, with the total of a stay spread evenly over its nights, so
+// the revenue of a month is what its own nights were sold for. Bookings, cancellations and lead times are
+// counted in the month the guests arrive in. Reservations that expired unpaid were never booked and aren't
+// counted at all.
+package reporting
+
+import (
+	"math"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// LeadTime is a range of how many days before arrival bookings were made. A Max of -1 has no upper bound.
+type LeadTime struct {
+	Label string
+	Min   int
+	Max   int
+}
+
+// LeadTimes are the ranges the lead times of the bookings are counted in
+var LeadTimes = []LeadTime{
+	{"Same day", 0, 0},
+	{"1-7 days", 1, 7},
+	{"8-30 days", 8, 30},
+	{"31-90 days", 31, 90},
+	{"Over 90 days", 91, -1},
+}
+
+// leadTime returns the index in LeadTimes of a number of days
+func leadTime(days int) int {
+	for i, l := range LeadTimes {
+		if days <= l.Max || l.Max < 0 {
+			return i
+		}
+	}
+	return len(LeadTimes) - 1
+}
+
+// Stats are the statistics of a room, or of all the rooms when RoomID is 0, over a month, or over the whole
+// period when Month is the zero time. Revenue is in the minor units of the currency of the property.
+type Stats struct {
+	RoomID          int
+	RoomName        string
+	Month           time.Time
+	AvailableNights int
+	NightsSold      int
+	Revenue         int
+	Bookings        int
+	Cancellations   int
+	// LeadTimes counts the bookings in each of the ranges of LeadTimes
+	LeadTimes []int
+}
+
+// Occupancy returns the percentage of the available nights that were sold
+func (s Stats) Occupancy() float64 {
+	if s.AvailableNights == 0 {
+		return 0
+	}
+	return float64(s.NightsSold) * 100 / float64(s.AvailableNights)
+}
+
+// ADR returns the average daily rate, what a night sold was sold for on average
+func (s Stats) ADR() int {
+	return divide(s.Revenue, s.NightsSold)
+}
+
+// RevPAR returns the revenue per available room, what each night that could be sold brought in on average
+func (s Stats) RevPAR() int {
+	return divide(s.Revenue, s.AvailableNights)
+}
+
+// CancellationRate returns the percentage of the bookings that were cancelled
+func (s Stats) CancellationRate() float64 {
+	if s.Bookings == 0 {
+		return 0
+	}
+	return float64(s.Cancellations) * 100 / float64(s.Bookings)
+}
+
+// add adds the statistics of o to s
+func (s *Stats) add(o *Stats) {
+	s.AvailableNights += o.AvailableNights
+	s.NightsSold += o.NightsSold
+	s.Revenue += o.Revenue
+	s.Bookings += o.Bookings
+	s.Cancellations += o.Cancellations
+	for i, n := range o.LeadTimes {
+		s.LeadTimes[i] += n
+	}
+}
+
+// divide returns a divided by b rounded to the nearest whole number, or 0 when b is 0
+func divide(a, b int) int {
+	if b == 0 {
+		return 0
+	}
+	return int(math.Round(float64(a) / float64(b)))
+}
+
+// cell is the key of the statistics of a room in a month
+type cell struct {
+	roomID int
+	month  time.Time
+}
+
+// Report gathers the statistics of the rooms from Start to End, not including End
+type Report struct {
+	Start time.Time
+	End   time.Time
+
+	months []time.Time
+	rooms  []models.Room
+	stats  map[cell]*Stats
+}
+
+// New starts the report of the rooms from start to end, not including end. The active rooms are available
+// every night of the period; inactive rooms are only reported when reservations are added for them.
+func New(start, end time.Time, rooms []models.Room) *Report {
+	r := &Report{Start: start, End: end, stats: make(map[cell]*Stats)}
+
+	for month := monthOf(start); month.Before(end); month = month.AddDate(0, 1, 0) {
+		r.months = append(r.months, month)
+	}
+
+	for _, room := range rooms {
+		if !room.Active {
+			continue
+		}
+		r.rooms = append(r.rooms, room)
+		for _, month := range r.months {
+			from, to := r.clamp(month, month.AddDate(0, 1, 0))
+			r.cell(room.ID, month).AvailableNights = nights(from, to)
+		}
+	}
+
+	return r
+}
+
+// Add counts a reservation in the report
+func (r *Report) Add(res models.Reservation) {
+	if res.Status == models.ReservationExpired {
+		return
+	}
+
+	if !r.hasRoom(res.RoomID) {
+		room := res.Room
+		room.ID = res.RoomID
+		r.rooms = append(r.rooms, room)
+	}
+
+	if !res.StartDate.Before(r.Start) && res.StartDate.Before(r.End) {
+		s := r.cell(res.RoomID, monthOf(res.StartDate))
+		s.Bookings++
+		if res.Status == models.ReservationCancelled {
+			s.Cancellations++
+		}
+
+		s.LeadTimes[leadTime(nights(dates.Day(res.CreatedAt), res.StartDate))]++
+	}
+
+	if !res.Cancellable() {
+		return
+	}
+
+	// each month gets the nights of the stay in it, and the share of the total those nights were sold for
+	stay := res.Nights()
+	for _, month := range r.months {
+		from, to := r.clamp(month, month.AddDate(0, 1, 0))
+		if res.StartDate.After(from) {
+			from = res.StartDate
+		}
+		if res.EndDate.Before(to) {
+			to = res.EndDate
+		}
+		if !to.After(from) {
+			continue
+		}
+
+		s := r.cell(res.RoomID, month)
+		s.NightsSold += nights(from, to)
+		s.Revenue += res.Total*nights(res.StartDate, to)/stay - res.Total*nights(res.StartDate, from)/stay
+	}
+}
+
+// Months returns the first days of the months of the report, in order
+func (r *Report) Months() []time.Time {
+	return r.months
+}
+
+// Rows returns the statistics of each room in each month, by room and then by month
+func (r *Report) Rows() []Stats {
+	var rows []Stats
+	for _, room := range r.rooms {
+		for _, month := range r.months {
+			rows = append(rows, *r.cell(room.ID, month))
+		}
+	}
+	return rows
+}
+
+// ByRoom returns the statistics of each room over the whole period
+func (r *Report) ByRoom() []Stats {
+	var rows []Stats
+	for _, room := range r.rooms {
+		s := newStats(room.ID, room.RoomName, time.Time{})
+		for _, month := range r.months {
+			s.add(r.cell(room.ID, month))
+		}
+		rows = append(rows, *s)
+	}
+	return rows
+}
+
+// ByMonth returns the statistics of all the rooms in each month
+func (r *Report) ByMonth() []Stats {
+	var rows []Stats
+	for _, month := range r.months {
+		s := newStats(0, "", month)
+		for _, room := range r.rooms {
+			s.add(r.cell(room.ID, month))
+		}
+		rows = append(rows, *s)
+	}
+	return rows
+}
+
+// Total returns the statistics of all the rooms over the whole period
+func (r *Report) Total() Stats {
+	s := newStats(0, "", time.Time{})
+	for _, row := range r.ByMonth() {
+		s.add(&row)
+	}
+	return *s
+}
+
+// cell returns the statistics of a room in a month, starting them when there are none yet
+func (r *Report) cell(roomID int, month time.Time) *Stats {
+	key := cell{roomID, month}
+	s, ok := r.stats[key]
+	if !ok {
+		s = newStats(roomID, r.roomName(roomID), month)
+		r.stats[key] = s
+	}
+	return s
+}
+
+// clamp returns the part of a span of days within the period of the report
+func (r *Report) clamp(from, to time.Time) (time.Time, time.Time) {
+	if from.Before(r.Start) {
+		from = r.Start
+	}
+	if to.After(r.End) {
+		to = r.End
+	}
+	return from, to
+}
+
+// hasRoom reports whether a room is in the report
+func (r *Report) hasRoom(id int) bool {
+	for _, room := range r.rooms {
+		if room.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// roomName returns the name of a room of the report
+func (r *Report) roomName(id int) string {
+	for _, room := range r.rooms {
+		if room.ID == id {
+			return room.RoomName
+		}
+	}
+	return ""
+}
+
+func newStats(roomID int, roomName string, month time.Time) *Stats {
+	return &Stats{RoomID: roomID, RoomName: roomName, Month: month, LeadTimes: make([]int, len(LeadTimes))}
+}
+
+// monthOf returns the first day of the month of a date
+func monthOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// nights returns the number of nights from one date to another, or 0 when the second isn't later
+func nights(from, to time.Time) int {
+	if !to.After(from) {
+		return 0
+	}
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
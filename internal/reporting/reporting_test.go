@@ -0,0 +1,160 @@
+package reporting
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// testReport reports from 2040-01-15 to the end of February on two active rooms, with a stay in a room
+// that was taken off sale since
+func testReport() *Report {
+	r := New(date(2040, 1, 15), date(2040, 3, 1), []models.Room{
+		{ID: 1, RoomName: "General's Quarters", Active: true},
+		{ID: 2, RoomName: "Major's Suite", Active: true},
+		{ID: 3, RoomName: "Old Room"},
+	})
+
+	for _, res := range []models.Reservation{
+		// across the end of January, booked 10 days ahead
+		{RoomID: 1, Status: models.ReservationConfirmed, StartDate: date(2040, 1, 30), EndDate: date(2040, 2, 2),
+			Total: 30000, CreatedAt: date(2040, 1, 20).Add(15 * time.Hour)},
+		// cancelled on the day
+		{RoomID: 1, Status: models.ReservationCancelled, StartDate: date(2040, 2, 10), EndDate: date(2040, 2, 12),
+			Total: 20000, CreatedAt: date(2040, 2, 10)},
+		// never paid for
+		{RoomID: 2, Status: models.ReservationExpired, StartDate: date(2040, 2, 1), EndDate: date(2040, 2, 5),
+			Total: 40000, CreatedAt: date(2040, 1, 1)},
+		// arrived before the period
+		{RoomID: 2, Status: models.ReservationPending, StartDate: date(2040, 1, 10), EndDate: date(2040, 1, 17),
+			Total: 7000, CreatedAt: date(2039, 12, 1)},
+		// in the room off sale, booked months ahead
+		{RoomID: 3, Room: models.Room{RoomName: "Old Room"}, Status: models.ReservationConfirmed,
+			StartDate: date(2040, 2, 20), EndDate: date(2040, 2, 22), Total: 10000, CreatedAt: date(2039, 10, 1)},
+	} {
+		r.Add(res)
+	}
+
+	return r
+}
+
+func TestReport(t *testing.T) {
+	r := testReport()
+
+	if months := r.Months(); !reflect.DeepEqual(months, []time.Time{date(2040, 1, 1), date(2040, 2, 1)}) {
+		t.Errorf("expected the months of January and February, got %v", months)
+	}
+
+	total := r.Total()
+	expected := Stats{AvailableNights: 92, NightsSold: 7, Revenue: 42000, Bookings: 3, Cancellations: 1,
+		LeadTimes: []int{1, 0, 1, 0, 1}}
+	if !reflect.DeepEqual(total, expected) {
+		t.Errorf("expected a total of %+v, got %+v", expected, total)
+	}
+
+	byMonth := r.ByMonth()
+	if len(byMonth) != 2 {
+		t.Fatalf("expected 2 months, got %d", len(byMonth))
+	}
+	for i, e := range []struct {
+		available, sold, revenue, bookings int
+	}{
+		{34, 4, 22000, 1},
+		{58, 3, 20000, 2},
+	} {
+		s := byMonth[i]
+		if s.AvailableNights != e.available || s.NightsSold != e.sold || s.Revenue != e.revenue || s.Bookings != e.bookings {
+			t.Errorf("%s: expected %d nights available, %d sold for %d and %d bookings, got %+v",
+				s.Month.Format("2006-01"), e.available, e.sold, e.revenue, e.bookings, s)
+		}
+	}
+
+	byRoom := r.ByRoom()
+	if len(byRoom) != 3 {
+		t.Fatalf("expected 3 rooms, got %d", len(byRoom))
+	}
+	for i, e := range []struct {
+		name                     string
+		available, sold, revenue int
+	}{
+		{"General's Quarters", 46, 3, 30000},
+		{"Major's Suite", 46, 2, 2000},
+		{"Old Room", 0, 2, 10000},
+	} {
+		s := byRoom[i]
+		if s.RoomName != e.name || s.AvailableNights != e.available || s.NightsSold != e.sold || s.Revenue != e.revenue {
+			t.Errorf("expected %s to have %d nights available and %d sold for %d, got %+v",
+				e.name, e.available, e.sold, e.revenue, s)
+		}
+	}
+
+	rows := r.Rows()
+	if len(rows) != 6 {
+		t.Fatalf("expected a row for each room in each month, got %d", len(rows))
+	}
+	if s := rows[0]; s.RoomID != 1 || !s.Month.Equal(date(2040, 1, 1)) || s.NightsSold != 2 || s.Revenue != 20000 {
+		t.Errorf("expected General's Quarters to sell 2 nights for 20000 in January, got %+v", s)
+	}
+	if s := rows[1]; s.RoomID != 1 || s.NightsSold != 1 || s.Revenue != 10000 || s.Cancellations != 1 {
+		t.Errorf("expected General's Quarters to sell 1 night for 10000 and have a cancellation in February, got %+v", s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := Stats{AvailableNights: 46, NightsSold: 3, Revenue: 30000, Bookings: 4, Cancellations: 1}
+
+	if occupancy := s.Occupancy(); math.Abs(occupancy-6.52) > 0.01 {
+		t.Errorf("expected an occupancy of 6.52%%, got %f", occupancy)
+	}
+	if adr := s.ADR(); adr != 10000 {
+		t.Errorf("expected an ADR of 10000, got %d", adr)
+	}
+	if revPAR := s.RevPAR(); revPAR != 652 {
+		t.Errorf("expected a RevPAR of 652, got %d", revPAR)
+	}
+	if rate := s.CancellationRate(); rate != 25 {
+		t.Errorf("expected a cancellation rate of 25%%, got %f", rate)
+	}
+
+	var empty Stats
+	if empty.Occupancy() != 0 || empty.ADR() != 0 || empty.RevPAR() != 0 || empty.CancellationRate() != 0 {
+		t.Errorf("expected no statistics without nights or bookings, got %+v", empty)
+	}
+}
+
+func TestRevenueSplit(t *testing.T) {
+	// a total that doesn't divide evenly still adds up over the months
+	r := New(date(2040, 1, 1), date(2040, 4, 1), []models.Room{{ID: 1, Active: true}})
+	r.Add(models.Reservation{RoomID: 1, Status: models.ReservationConfirmed, StartDate: date(2040, 1, 31),
+		EndDate: date(2040, 3, 2), Total: 10001})
+
+	sum := 0
+	for _, s := range r.ByMonth() {
+		sum += s.Revenue
+	}
+	if sum != 10001 {
+		t.Errorf("expected the months to add up to the total of 10001, got %d", sum)
+	}
+}
+
+func TestLeadTime(t *testing.T) {
+	tests := []struct {
+		days     int
+		expected int
+	}{
+		{0, 0}, {1, 1}, {7, 1}, {8, 2}, {30, 2}, {31, 3}, {90, 3}, {91, 4}, {400, 4},
+	}
+
+	for _, e := range tests {
+		if i := leadTime(e.days); i != e.expected {
+			t.Errorf("expected %d days to be in %s, got %s", e.days, LeadTimes[e.expected].Label, LeadTimes[i].Label)
+		}
+	}
+}
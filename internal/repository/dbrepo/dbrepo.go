@@ -1,12 +1,78 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/crislainesc/bookings/internal/config"
 	"github.com/crislainesc/bookings/internal/repository"
 )
 
+// ErrRoomHasReservations is returned when deleting a room that has been booked
+var ErrRoomHasReservations = errors.New("room has reservations and can only be deactivated")
+
+// ErrNotCancellable is returned when cancelling a reservation that was already cancelled or expired
+var ErrNotCancellable = errors.New("reservation was already cancelled or expired")
+
+// ErrRoomUnavailable is returned when holding a room that is already booked, blocked or held for the dates
+var ErrRoomUnavailable = errors.New("room is unavailable for these dates")
+
+// ErrHoldExpired is returned when converting a hold that expired and was released
+var ErrHoldExpired = errors.New("hold expired and the room was released")
+
+// ErrNotWaiting is returned when offering a room to a waitlist entry that was already offered one
+var ErrNotWaiting = errors.New("waitlist entry is no longer waiting")
+
+// ErrPromoCodeUnavailable is returned when booking with a promo code that was deactivated or used up
+var ErrPromoCodeUnavailable = errors.New("promo code is inactive or was used up")
+
+// ErrPromoCodeAlreadyUsed is returned when booking with a promo code the guest's email was already used with
+var ErrPromoCodeAlreadyUsed = errors.New("promo code was already used with this email")
+
+// ErrRoomSlugExists is returned when saving a room with the slug of another one
+var ErrRoomSlugExists = errors.New("room slug already exists")
+
+// ErrPromoCodeExists is returned when saving a promo code with the code of another one
+var ErrPromoCodeExists = errors.New("promo code already exists")
+
+// ErrPromoCodeRedeemed is returned when deleting a promo code that was used
+var ErrPromoCodeRedeemed = errors.New("promo code was redeemed and can only be deactivated")
+
+// ErrGuestMerged is returned when merging guests that don't exist, were already merged or are the same guest
+var ErrGuestMerged = errors.New("guest doesn't exist or was already merged")
+
+// ImportRowError is returned when a row of a reservation import can't be inserted, with the line of the row
+type ImportRowError struct {
+	Line int
+	Err  error
+}
+
+func (e *ImportRowError) Error() string {
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+func (e *ImportRowError) Unwrap() error {
+	return e.Err
+}
+
+// PaidTooLateError is returned by ApplyPaymentEvent when a payment succeeded after its reservation expired or
+// was cancelled, and the reservation couldn't be confirmed again. The payment is recorded as succeeded, so
+// the money has to be given back.
+type PaidTooLateError struct {
+	ReservationID int
+	Status        string
+}
+
+func (e *PaidTooLateError) Error() string {
+	return "payment succeeded for " + e.Status + " reservation " + strconv.Itoa(e.ReservationID)
+}
+
+// defaultQueryTimeout bounds a query when the app config doesn't set one
+const defaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -18,3 +84,82 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 		DB:  conn,
 	}
 }
+
+// withTimeout derives a context from the caller's that is cancelled after the configured query timeout
+func (repository *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultQueryTimeout
+	if repository.App != nil && repository.App.DBQueryTimeout > 0 {
+		timeout = repository.App.DBQueryTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// hooks returns the query hooks registered in the app config
+func (repository *postgresDBRepo) hooks() []repository.QueryHook {
+	if repository.App == nil {
+		return nil
+	}
+	return repository.App.QueryHooks
+}
+
+// trace runs the before hooks for a statement and returns a function that runs the after hooks
+func (repository *postgresDBRepo) trace(ctx context.Context, query string, args []interface{}) (context.Context, func(error)) {
+	hooks := repository.hooks()
+	if len(hooks) == 0 {
+		return ctx, func(error) {}
+	}
+
+	for _, hook := range hooks {
+		ctx = hook.BeforeQuery(ctx, query, args)
+	}
+
+	start := time.Now()
+
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+		for _, hook := range hooks {
+			hook.AfterQuery(ctx, query, elapsed, err)
+		}
+	}
+}
+
+// exec runs a statement that returns no rows, notifying the query hooks
+func (repository *postgresDBRepo) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := repository.trace(ctx, query, args)
+	result, err := repository.DB.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+// query runs a statement that returns rows, notifying the query hooks
+func (repository *postgresDBRepo) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := repository.trace(ctx, query, args)
+	rows, err := repository.DB.QueryContext(ctx, query, args...)
+	done(err)
+	return rows, err
+}
+
+// queryRow runs a statement that returns at most one row, notifying the query hooks
+func (repository *postgresDBRepo) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := repository.trace(ctx, query, args)
+	row := repository.DB.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
+
+// txExec runs a statement of a transaction that returns no rows, notifying the query hooks
+func (repository *postgresDBRepo) txExec(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := repository.trace(ctx, query, args)
+	result, err := tx.ExecContext(ctx, query, args...)
+	done(err)
+	return result, err
+}
+
+// txQueryRow runs a statement of a transaction that returns at most one row, notifying the query hooks
+func (repository *postgresDBRepo) txQueryRow(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	ctx, done := repository.trace(ctx, query, args)
+	row := tx.QueryRowContext(ctx, query, args...)
+	done(row.Err())
+	return row
+}
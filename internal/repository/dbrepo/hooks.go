@@ -0,0 +1,43 @@
+package dbrepo
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/repository"
+)
+
+type slowQueryLogger struct {
+	Log       *log.Logger
+	Threshold time.Duration
+}
+
+// NewSlowQueryLogger returns a query hook that logs statements taking longer than threshold, and every failed statement
+func NewSlowQueryLogger(logger *log.Logger, threshold time.Duration) repository.QueryHook {
+	return &slowQueryLogger{
+		Log:       logger,
+		Threshold: threshold,
+	}
+}
+
+func (hook *slowQueryLogger) BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context {
+	return ctx
+}
+
+func (hook *slowQueryLogger) AfterQuery(ctx context.Context, query string, elapsed time.Duration, err error) {
+	if err != nil {
+		hook.Log.Printf("query failed after %s: %v: %s", elapsed, err, compactQuery(query))
+		return
+	}
+
+	if elapsed >= hook.Threshold {
+		hook.Log.Printf("slow query took %s: %s", elapsed, compactQuery(query))
+	}
+}
+
+// compactQuery collapses the whitespace of a multi-line query so it fits on one log line
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
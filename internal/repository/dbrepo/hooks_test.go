@@ -0,0 +1,34 @@
+package dbrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	hook := NewSlowQueryLogger(log.New(&buf, "", 0), 100*time.Millisecond)
+
+	ctx := hook.BeforeQuery(context.Background(), "SELECT 1", nil)
+
+	hook.AfterQuery(ctx, "SELECT 1", 10*time.Millisecond, nil)
+	if buf.Len() != 0 {
+		t.Errorf("fast query should not be logged, got %q", buf.String())
+	}
+
+	hook.AfterQuery(ctx, "SELECT\n\t\t1", 200*time.Millisecond, nil)
+	if !strings.Contains(buf.String(), "slow query took 200ms: SELECT 1") {
+		t.Errorf("slow query was not logged, got %q", buf.String())
+	}
+
+	buf.Reset()
+	hook.AfterQuery(ctx, "SELECT 1", time.Millisecond, errors.New("boom"))
+	if !strings.Contains(buf.String(), "boom") {
+		t.Errorf("failed query was not logged, got %q", buf.String())
+	}
+}
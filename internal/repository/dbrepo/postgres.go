@@ -2,9 +2,15 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/internal/rules"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -13,21 +19,50 @@ func (repository *postgresDBRepo) AllUsers() bool {
 	return true
 }
 
-func (repository *postgresDBRepo) InsertReservation(reservation models.Reservation) (int, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertReservation inserts a reservation linked to the guest of its email, creating the guest the first time
+// the email books, and redeems the promo code it was booked with, if any, in one statement. It returns
+// ErrPromoCodeUnavailable when the code was deactivated or used up in the meantime, and
+// ErrPromoCodeAlreadyUsed when the code is once per email and the guest already used it; the reservation
+// isn't inserted then.
+func (repository *postgresDBRepo) InsertReservation(ctx context.Context, reservation models.Reservation) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
 	query := `
-		INSERT INTO 
-			reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at) 
-		VALUES 
-			($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id
+		WITH code AS (
+			UPDATE promo_codes
+			SET uses = uses + 1, updated_at = $10
+			WHERE id = $16 AND active AND (max_uses = 0 OR uses < max_uses)
+			RETURNING id, once_per_email
+		), guest AS (` + guestUpsert("$3", "$1", "$2", "$4", "$10", "($16 = 0 OR EXISTS (SELECT 1 FROM code))") + `
+		), reservation AS (
+			INSERT INTO
+				reservations (first_name, last_name, email, phone, start_date, end_date, room_id, adults, children, created_at, updated_at,
+					status, expires_at, total, cancel_token, promo_code, discount, special_requests, guest_id)
+			SELECT
+				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $17, $18, $19,
+				(SELECT id FROM guest)
+			WHERE $16 = 0 OR EXISTS (SELECT 1 FROM code)
+			RETURNING id
+		), redemption AS (
+			INSERT INTO
+				promo_redemptions (promo_code_id, reservation_id, email_key, created_at)
+			SELECT
+				code.id, reservation.id, CASE WHEN code.once_per_email THEN lower($3) END, $10
+			FROM code, reservation
+		)
+		SELECT id FROM reservation
 	`
 
+	status := reservation.Status
+	if status == "" {
+		status = models.ReservationConfirmed
+	}
+
 	var newID int
 
-	err := repository.DB.QueryRowContext(context, query,
+	err := repository.queryRow(ctx, query,
 		reservation.FirstName,
 		reservation.LastName,
 		reservation.Email,
@@ -35,19 +70,35 @@ func (repository *postgresDBRepo) InsertReservation(reservation models.Reservati
 		reservation.StartDate,
 		reservation.EndDate,
 		reservation.RoomID,
+		reservation.Adults,
+		reservation.Children,
 		time.Now(),
 		time.Now(),
+		status,
+		nullDate(reservation.ExpiresAt),
+		reservation.Total,
+		reservation.CancelToken,
+		reservation.PromoCodeID,
+		reservation.PromoCode,
+		reservation.Discount,
+		reservation.SpecialRequests,
 	).Scan(&newID)
 
-	if err != nil {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && reservation.PromoCodeID != 0:
+		return 0, ErrPromoCodeUnavailable
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.TableName == "promo_redemptions":
+		return 0, ErrPromoCodeAlreadyUsed
+	case err != nil:
 		return 0, err
 	}
 
 	return newID, nil
 }
 
-func (repository *postgresDBRepo) InsertRoomRestriction(restriction models.RoomRestriction) error {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) InsertRoomRestriction(ctx context.Context, restriction models.RoomRestriction) error {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
@@ -58,7 +109,7 @@ func (repository *postgresDBRepo) InsertRoomRestriction(restriction models.RoomR
 			($1, $2, $3, $4, $5, $6, $7)
 	`
 
-	_, err := repository.DB.ExecContext(context, query,
+	_, err := repository.exec(ctx, query,
 		restriction.StartDate,
 		restriction.EndDate,
 		restriction.RoomID,
@@ -75,44 +126,64 @@ func (repository *postgresDBRepo) InsertRoomRestriction(restriction models.RoomR
 	return nil
 }
 
-func (repository *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SearchAvailabilityByDatesByRoomID reports whether the room is free for the dates and fits the party
+func (repository *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID, adults, children int) (bool, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
 	query := `
-		SELECT 
-			count(id)
-		FROM
-		  room_restrictions
-		WHERE
-			room_id = $1 AND
-		  $2 < end_date AND $3 > start_date
+		SELECT
+			(SELECT 
+				count(id)
+			FROM
+			  room_restrictions
+			WHERE
+				room_id = $1 AND
+			  $2 < end_date AND $3 > start_date),
+			(SELECT
+				count(id)
+			FROM
+				rooms
+			WHERE
+				id = $1 AND capacity >= $4 AND max_occupancy >= $4 + $5)
 	`
 
-	var numRows int
+	var numRows, fits int
 
-	row := repository.DB.QueryRowContext(context, query, roomID, start, end)
-	err := row.Scan(&numRows)
+	row := repository.queryRow(ctx, query, roomID, start, end, adults, children)
+	err := row.Scan(&numRows, &fits)
 
 	if err != nil {
 		return false, err
 	}
 
-	return numRows == 0, nil
+	return numRows == 0 && fits > 0, nil
 }
 
-func (repository *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// availabilitySorts maps the sort orders of an availability search to ORDER BY clauses
+var availabilitySorts = map[string]string{
+	models.SortByPrice:    "price, room_name, id",
+	models.SortByCapacity: "capacity DESC, max_occupancy DESC, price, id",
+	models.SortByName:     "room_name, id",
+}
+
+// SearchAvailabilityForAllRooms returns one page of the active rooms that are free for the dates and fit the party,
+// with the price of the stay, and the total number of matching rooms
+func (repository *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, search models.AvailabilityQuery) ([]models.AvailableRoom, int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
-	query := `
-		SELECT 
-			r.id, r.room_name
-		FROM
-		  rooms r
-		WHERE r.id NOT IN
+	orderBy, ok := availabilitySorts[search.Sort]
+	if !ok {
+		orderBy = availabilitySorts[models.SortByPrice]
+	}
+
+	where := `
+		WHERE active = true AND
+			capacity >= $3 AND max_occupancy >= $3 + $4 AND
+			id NOT IN
 			(SELECT 
 				room_id
 			FROM
@@ -121,55 +192,58 @@ func (repository *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.
 				$1 < rr.end_date AND $2 > rr.start_date)
 	`
 
-	var rooms []models.Room
-
-	rows, err := repository.DB.QueryContext(context, query, start, end)
+	var total int
 
+	err := repository.queryRow(ctx, `SELECT count(id) FROM rooms`+where,
+		search.StartDate, search.EndDate, search.Adults, search.Children,
+	).Scan(&total)
 	if err != nil {
-		return rooms, err
+		return nil, 0, err
 	}
 
-	if rows.Next() {
-		var room models.Room
-		err := rows.Scan(
-			&room.ID,
-			&room.RoomName,
-		)
-		if err != nil {
-			return rooms, err
-		}
-		rooms = append(rooms, room)
+	query := `SELECT ` + roomColumns + ` FROM rooms` + where + `
+		ORDER BY ` + orderBy + `
+		LIMIT $5 OFFSET $6
+	`
+
+	rooms, err := repository.getRooms(ctx, query,
+		search.StartDate, search.EndDate, search.Adults, search.Children, search.PerPage, search.Offset(),
+	)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	if err = rows.Err(); err != nil {
-		return rooms, err
+	nights := search.Nights()
+
+	available := make([]models.AvailableRoom, 0, len(rooms))
+	for _, room := range rooms {
+		available = append(available, models.AvailableRoom{
+			Room:      room,
+			Nights:    nights,
+			StayPrice: room.Price * nights,
+		})
 	}
 
-	return rooms, nil
+	return available, total, nil
 }
 
-func (repository *postgresDBRepo) GetRoomByID(roomID int) (models.Room, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) GetRoomByID(ctx context.Context, roomID int) (models.Room, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
 	query := `
-		SELECT id, room_name, created_at, updated_at
+		SELECT ` + roomColumns + `
 		FROM rooms
 		WHERE id = $1
 	`
 
-	var room models.Room
-
-	row := repository.DB.QueryRowContext(context, query, roomID)
-
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
+	room, err := scanRoom(repository.queryRow(ctx, query, roomID))
+	if err != nil {
+		return room, err
+	}
 
+	room.Photos, err = repository.getPhotosForRoom(ctx, room.ID)
 	if err != nil {
 		return room, err
 	}
@@ -177,8 +251,8 @@ func (repository *postgresDBRepo) GetRoomByID(roomID int) (models.Room, error) {
 	return room, nil
 }
 
-func (repository *postgresDBRepo) GetUserByID(userID int) (models.User, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) GetUserByID(ctx context.Context, userID int) (models.User, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
@@ -190,7 +264,7 @@ func (repository *postgresDBRepo) GetUserByID(userID int) (models.User, error) {
 
 	var user models.User
 
-	row := repository.DB.QueryRowContext(context, query, userID)
+	row := repository.queryRow(ctx, query, userID)
 
 	err := row.Scan(
 		&user.ID,
@@ -210,8 +284,8 @@ func (repository *postgresDBRepo) GetUserByID(userID int) (models.User, error) {
 	return user, nil
 }
 
-func (repository *postgresDBRepo) UpdateUser(user models.User) error {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
@@ -220,7 +294,7 @@ func (repository *postgresDBRepo) UpdateUser(user models.User) error {
 		SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5
 	`
 
-	_, err := repository.DB.ExecContext(context, query,
+	_, err := repository.exec(ctx, query,
 		user.FirstName,
 		user.LastName,
 		user.Email,
@@ -235,8 +309,8 @@ func (repository *postgresDBRepo) UpdateUser(user models.User) error {
 	return nil
 }
 
-func (repository *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
@@ -249,7 +323,7 @@ func (repository *postgresDBRepo) Authenticate(email, testPassword string) (int,
 		WHERE email = $1
 	`
 
-	row := repository.DB.QueryRowContext(context, query, email)
+	row := repository.queryRow(ctx, query, email)
 	err := row.Scan(&id, &hashedPassword)
 
 	if err != nil {
@@ -267,107 +341,222 @@ func (repository *postgresDBRepo) Authenticate(email, testPassword string) (int,
 	return id, hashedPassword, nil
 }
 
-func getReservations(query string, repository *postgresDBRepo) ([]models.Reservation, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// reservationListColumns are the columns of the reservations in the admin lists, exports and reports, read
+// by scanListedReservation. What was paid counts the payments that succeeded; refunds are only made when a
+// reservation is cancelled, and it then owes nothing.
+const reservationListColumns = `
+	r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
+	r.end_date, r.room_id, r.adults, r.children, r.created_at, r.updated_at, r.processed,
+	r.status, r.expires_at, r.total, r.promo_code, r.discount, r.special_requests,
+	(SELECT COALESCE(SUM(p.amount), 0) FROM payments p WHERE p.reservation_id = r.id AND p.status = 'succeeded'),
+	COALESCE(r.guest_id, 0), rm.id, rm.room_name`
+
+// scanListedReservation reads a reservation selected with reservationListColumns
+func scanListedReservation(row rowScanner) (models.Reservation, error) {
+	var r models.Reservation
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&r.ID,
+		&r.FirstName,
+		&r.LastName,
+		&r.Email,
+		&r.Phone,
+		&r.StartDate,
+		&r.EndDate,
+		&r.RoomID,
+		&r.Adults,
+		&r.Children,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&r.Processed,
+		&r.Status,
+		&expiresAt,
+		&r.Total,
+		&r.PromoCode,
+		&r.Discount,
+		&r.SpecialRequests,
+		&r.Paid,
+		&r.GuestID,
+		&r.Room.ID,
+		&r.Room.RoomName,
+	)
+
+	r.ExpiresAt = expiresAt.Time
+
+	return r, err
+}
+
+// reservationSorts maps the sort orders of a reservation search to the columns they order by
+var reservationSorts = map[string][]string{
+	models.SortByID:        {"r.id"},
+	models.SortByGuest:     {"lower(r.last_name)", "lower(r.first_name)"},
+	models.SortByRoom:      {"rm.room_name"},
+	models.SortByArrival:   {"r.start_date"},
+	models.SortByDeparture: {"r.end_date"},
+	models.SortByStatus:    {"r.status"},
+	models.SortByCreated:   {"r.created_at"},
+}
+
+// likePattern returns a LIKE pattern matching text anywhere, with the wildcards in text matched literally
+func likePattern(text string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+}
+
+// reservationSearchSQL returns the FROM and WHERE clauses selecting the reservations matching a search,
+// the ORDER BY clause of its sort order and the arguments of the clauses
+func reservationSearchSQL(search models.ReservationQuery) (string, string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	// arg adds a query argument and returns its placeholder
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if search.Search != "" {
+		pattern := arg(likePattern(search.Search))
+		conditions = append(conditions,
+			"(r.first_name || ' ' || r.last_name ILIKE "+pattern+" OR r.email ILIKE "+pattern+")")
+	}
+	if search.RoomID != 0 {
+		conditions = append(conditions, "r.room_id = "+arg(search.RoomID))
+	}
+	if search.GuestID != 0 {
+		conditions = append(conditions, "r.guest_id = "+arg(search.GuestID))
+	}
+	if !search.From.IsZero() {
+		conditions = append(conditions, "r.end_date > "+arg(search.From))
+	}
+	if !search.To.IsZero() {
+		conditions = append(conditions, "r.start_date <= "+arg(search.To))
+	}
+	if search.Status != "" {
+		conditions = append(conditions, "r.status = "+arg(search.Status))
+	}
+	if search.NewOnly {
+		conditions = append(conditions, "r.processed = 0")
+	}
+
+	from := `
+		FROM reservations r
+		LEFT JOIN rooms rm ON (r.room_id = rm.id)`
+	if len(conditions) > 0 {
+		from += `
+		WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	columns, ok := reservationSorts[search.Sort]
+	if !ok {
+		columns = reservationSorts[models.SortByArrival]
+	}
+	direction := " ASC"
+	if search.Desc {
+		direction = " DESC"
+	}
+	orderBy := `
+		ORDER BY ` + strings.Join(columns, direction+", ") + direction + ", r.id" + direction
+
+	return from, orderBy, args
+}
+
+// SearchReservations returns one page of the reservations matching the search, in its sort order, and the
+// total number of matching reservations
+func (repository *postgresDBRepo) SearchReservations(ctx context.Context, search models.ReservationQuery) ([]models.Reservation, int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
-	var reservations []models.Reservation
+	from, orderBy, args := reservationSearchSQL(search)
+
+	var total int
+
+	err := repository.queryRow(ctx, `SELECT count(r.id)`+from, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	rows, err := repository.DB.QueryContext(context, query)
+	n := len(args)
+	query := `SELECT` + reservationListColumns + from + orderBy +
+		` LIMIT $` + strconv.Itoa(n+1) + ` OFFSET $` + strconv.Itoa(n+2)
 
+	rows, err := repository.query(ctx, query, append(args, search.PerPage, search.Offset())...)
 	if err != nil {
-		return reservations, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
+	var reservations []models.Reservation
 	for rows.Next() {
-		var r models.Reservation
-		err := rows.Scan(
-			&r.ID,
-			&r.FirstName,
-			&r.LastName,
-			&r.Email,
-			&r.Phone,
-			&r.StartDate,
-			&r.EndDate,
-			&r.RoomID,
-			&r.CreatedAt,
-			&r.UpdatedAt,
-			&r.Processed,
-			&r.Room.ID,
-			&r.Room.RoomName,
-		)
-
+		r, err := scanListedReservation(rows)
 		if err != nil {
-			return reservations, err
+			return nil, 0, err
 		}
-
 		reservations = append(reservations, r)
 	}
 
 	if err = rows.Err(); err != nil {
-		return reservations, err
+		return nil, 0, err
 	}
 
-	return reservations, nil
-
+	return reservations, total, nil
 }
 
-func (repository *postgresDBRepo) GetAllReservations() ([]models.Reservation, error) {
-	query := `
-		SELECT 
-			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, 
-			r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-			rm.id, rm.room_name
-		FROM reservations r
-		LEFT JOIN rooms rm ON (r.room_id = rm.id)
-		ORDER BY r.start_date asc
-	`
+// EachReservation calls fn with every reservation matching the search, in its sort order, reading them
+// from the database one at a time. Page and PerPage are ignored. It stops at the first error fn returns.
+// The query isn't bound by the query timeout, since a long export would be cut off; it ends with ctx.
+func (repository *postgresDBRepo) EachReservation(ctx context.Context, search models.ReservationQuery, fn func(models.Reservation) error) error {
+	from, orderBy, args := reservationSearchSQL(search)
 
-	reservations, err := getReservations(query, repository)
+	rows, err := repository.query(ctx, `SELECT`+reservationListColumns+from+orderBy, args...)
 	if err != nil {
-		return reservations, err
+		return err
 	}
+	defer rows.Close()
 
-	return reservations, nil
-}
+	for rows.Next() {
+		r, err := scanListedReservation(rows)
+		if err != nil {
+			return err
+		}
 
-func (repository *postgresDBRepo) GetAllNewReservations() ([]models.Reservation, error) {
-	query := `
-		SELECT 
-			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-			r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-			rm.id, rm.room_name
-		FROM reservations r
-		LEFT JOIN rooms rm ON (r.room_id = rm.id)
-		WHERE processed = 0
-		ORDER BY r.start_date asc
-	`
+		err = fn(r)
+		if err != nil {
+			return err
+		}
+	}
 
-	reservations, err := getReservations(query, repository)
+	return rows.Err()
+}
 
-	if err != nil {
-		return reservations, err
-	}
+func (repository *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	return repository.getReservation(ctx, `r.id = $1`, id)
+}
 
-	return reservations, nil
+// GetReservationByCancelToken returns the reservation a cancel link was sent for
+func (repository *postgresDBRepo) GetReservationByCancelToken(ctx context.Context, token string) (models.Reservation, error) {
+	return repository.getReservation(ctx, `r.cancel_token = $1`, token)
 }
 
-func (repository *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// getReservation returns the reservation matching a condition on the reservations table, aliased r
+func (repository *postgresDBRepo) getReservation(ctx context.Context, where string, arg interface{}) (models.Reservation, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 	defer cancel()
 
 	var res models.Reservation
+	var expiresAt, cancelledAt sql.NullTime
+	var cancelToken sql.NullString
 
 	query := `
 			SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
-			r.created_at, r.updated_at, r.processed, rm.id, rm.room_name
+			r.adults, r.children, r.created_at, r.updated_at, r.processed, r.status, r.expires_at, r.total,
+			r.cancel_token, r.cancelled_at, r.promo_code, r.discount, r.special_requests, COALESCE(r.guest_id, 0),
+			rm.id, rm.room_name
 			FROM reservations r 
 			LEFT JOIN rooms rm on (r.room_id = rm.id)
-			WHERE r.id = $1`
+			WHERE ` + where
 
-	row := repository.DB.QueryRowContext(ctx, query, id)
+	row := repository.queryRow(ctx, query, arg)
 
 	err := row.Scan(
 		&res.ID,
@@ -378,13 +567,28 @@ func (repository *postgresDBRepo) GetReservationByID(id int) (models.Reservation
 		&res.StartDate,
 		&res.EndDate,
 		&res.RoomID,
+		&res.Adults,
+		&res.Children,
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Status,
+		&expiresAt,
+		&res.Total,
+		&cancelToken,
+		&cancelledAt,
+		&res.PromoCode,
+		&res.Discount,
+		&res.SpecialRequests,
+		&res.GuestID,
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
 
+	res.ExpiresAt = expiresAt.Time
+	res.CancelToken = cancelToken.String
+	res.CancelledAt = cancelledAt.Time
+
 	if err != nil {
 		return res, err
 	}
@@ -392,24 +596,31 @@ func (repository *postgresDBRepo) GetReservationByID(id int) (models.Reservation
 	return res, err
 }
 
-func (repository *postgresDBRepo) UpdateReservation(reservation models.Reservation) error {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// UpdateReservation updates the guest details of a reservation, linking it to the guest of its email
+func (repository *postgresDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
 	query := `
+		WITH guest AS (` + guestUpsert("$3", "$1", "$2", "$4", "$7", "") + `
+		)
 		UPDATE reservations
-		SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
-		WHERE id = $6
+		SET first_name = $1, last_name = $2, email = $3, phone = $4, adults = $5, children = $6, updated_at = $7,
+			special_requests = $9, guest_id = (SELECT id FROM guest)
+		WHERE id = $8
 	`
 
-	_, err := repository.DB.ExecContext(context, query,
+	_, err := repository.exec(ctx, query,
 		reservation.FirstName,
 		reservation.LastName,
 		reservation.Email,
 		reservation.Phone,
+		reservation.Adults,
+		reservation.Children,
 		time.Now(),
 		reservation.ID,
+		reservation.SpecialRequests,
 	)
 
 	if err != nil {
@@ -419,17 +630,27 @@ func (repository *postgresDBRepo) UpdateReservation(reservation models.Reservati
 	return nil
 }
 
-func (repository *postgresDBRepo) DeleteReservation(id int) error {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// DeleteReservation deletes a reservation, giving back the use of the promo code it was booked with
+func (repository *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
 	query := `
+		WITH redemptions AS (
+			DELETE FROM promo_redemptions
+			WHERE reservation_id = $1
+			RETURNING promo_code_id
+		), uses AS (
+			UPDATE promo_codes
+			SET uses = uses - 1
+			WHERE id IN (SELECT promo_code_id FROM redemptions)
+		)
 		DELETE FROM reservations
 		WHERE id = $1
 	`
 
-	_, err := repository.DB.ExecContext(context, query, id)
+	_, err := repository.exec(ctx, query, id)
 
 	if err != nil {
 		return err
@@ -438,8 +659,8 @@ func (repository *postgresDBRepo) DeleteReservation(id int) error {
 	return nil
 }
 
-func (repository *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
@@ -449,7 +670,7 @@ func (repository *postgresDBRepo) UpdateProcessedForReservation(id, processed in
 		WHERE id = $2
 	`
 
-	_, err := repository.DB.ExecContext(context, query,
+	_, err := repository.exec(ctx, query,
 		processed,
 		id,
 	)
@@ -461,52 +682,18 @@ func (repository *postgresDBRepo) UpdateProcessedForReservation(id, processed in
 	return nil
 }
 
-func (repository *postgresDBRepo) GetAllRooms() ([]models.Room, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	defer cancel()
-
-	var rooms []models.Room
-
+func (repository *postgresDBRepo) GetAllRooms(ctx context.Context) ([]models.Room, error) {
 	query := `
-		SELECT id, room_name, created_at, updated_at
+		SELECT ` + roomColumns + `
 		FROM rooms
 		ORDER BY room_name
 	`
 
-	rows, err := repository.DB.QueryContext(context, query)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var room models.Room
-		err := rows.Scan(
-			&room.ID,
-			&room.RoomName,
-			&room.CreatedAt,
-			&room.UpdatedAt,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-
-		rooms = append(rooms, room)
-	}
-
-	if rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return rooms, nil
+	return repository.getRooms(ctx, query)
 }
 
-func (repository *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	context, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := repository.withTimeout(ctx)
 
 	defer cancel()
 
@@ -515,10 +702,11 @@ func (repository *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start
 	query := `
 		SELECT id, COALESCE(reservation_id, 0) restriction_id, room_id, start_date, end_date
 		FROM room_restrictions
-		WHERE $1 < end_date and $2 >= start_date and room_id = $3
+		WHERE $1 < end_date and $2 >= start_date and room_id = $3 and restriction_id <> $4
 	`
 
-	rows, err := repository.DB.QueryContext(context, query, start, end, roomID)
+	// holds only last while a guest fills in the reservation form, so they aren't shown as blocks
+	rows, err := repository.query(ctx, query, start, end, roomID, models.RestrictionHold)
 	if err != nil {
 		return nil, err
 	}
@@ -547,15 +735,15 @@ func (repository *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start
 	return restrictions, nil
 }
 
-func (repository *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, cancel := repository.withTimeout(ctx)
 	defer cancel()
 
 	query := `
 		INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)`
 
-	_, err := repository.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 0), id, 2, time.Now(), time.Now())
+	_, err := repository.exec(ctx, query, startDate, startDate.AddDate(0, 0, 0), id, models.RestrictionOwnerBlock, time.Now(), time.Now())
 	if err != nil {
 		repository.App.ErrorLog.Println(err)
 		return err
@@ -563,16 +751,2340 @@ func (repository *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time
 	return nil
 }
 
-func (repository *postgresDBRepo) DeleteBlockByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (repository *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
 	defer cancel()
 
 	query := `DELETE from room_restrictions where id = $1`
 
-	_, err := repository.DB.ExecContext(ctx, query, id)
+	_, err := repository.exec(ctx, query, id)
 	if err != nil {
 		repository.App.ErrorLog.Println(err)
 		return err
 	}
 	return nil
 }
+
+// roomLockClass is the first key of the advisory locks taken on rooms, telling them from other advisory
+// locks; the second key is the id of the room
+const roomLockClass = 1
+
+// lockRooms takes the advisory lock of each room for the rest of a transaction, in order of id so two
+// transactions locking the same rooms can't deadlock. Restrictions taking a room are only inserted while
+// holding its lock, by statements checking that the room is free: under READ COMMITTED each statement sees
+// what was committed before it started, so the check sees the restrictions of any booking that held the
+// lock before.
+func (repository *postgresDBRepo) lockRooms(ctx context.Context, tx *sql.Tx, roomIDs ...int) error {
+	ids := append([]int(nil), roomIDs...)
+	sort.Ints(ids)
+
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		_, err := repository.txExec(ctx, tx, `SELECT pg_advisory_xact_lock($1::int, $2::int)`, roomLockClass, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertFreeRestriction inserts a restriction taking a room for the dates, in a transaction holding the lock
+// of the room, and returns its id. It returns ErrRoomUnavailable when the room is already booked, blocked or
+// held for any of the dates.
+func (repository *postgresDBRepo) insertFreeRestriction(ctx context.Context, tx *sql.Tx, restriction models.RoomRestriction, now time.Time) (int, error) {
+	query := `
+		INSERT INTO
+			room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, expires_at, created_at, updated_at)
+		SELECT
+			$1, $2, $3, NULLIF($4, 0), $5, $6, $7, $7
+		WHERE NOT EXISTS (
+			SELECT 1 FROM room_restrictions
+			WHERE room_id = $3 AND $1 < end_date AND $2 > start_date
+		)
+		RETURNING id
+	`
+
+	var id int
+
+	err := repository.txQueryRow(ctx, tx, query,
+		restriction.StartDate,
+		restriction.EndDate,
+		restriction.RoomID,
+		restriction.ReservationID,
+		restriction.RestrictionID,
+		nullDate(restriction.ExpiresAt),
+		now,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrRoomUnavailable
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// InsertHold holds a room for the dates until the hold expires, and returns the id of the hold. It returns
+// ErrRoomUnavailable when the room is already booked, blocked or held for any of the dates; the room is
+// locked while it is checked and held, so two guests can't hold it for the same dates.
+func (repository *postgresDBRepo) InsertHold(ctx context.Context, hold models.RoomRestriction) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	tx, err := repository.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = repository.lockRooms(ctx, tx, hold.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	hold.ReservationID = 0
+	hold.RestrictionID = models.RestrictionHold
+
+	id, err := repository.insertFreeRestriction(ctx, tx, hold, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// ConvertHold turns a hold into the room restriction of the reservation made from it. It returns
+// ErrHoldExpired when the hold expired and was released in the meantime.
+func (repository *postgresDBRepo) ConvertHold(ctx context.Context, id, reservationID int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE room_restrictions
+		SET reservation_id = $2, restriction_id = $3, expires_at = NULL, updated_at = $4
+		WHERE id = $1 AND restriction_id = $5
+	`
+
+	result, err := repository.exec(ctx, query, id, reservationID, models.RestrictionReservation, time.Now(), models.RestrictionHold)
+	if err != nil {
+		return err
+	}
+
+	converted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if converted == 0 {
+		return ErrHoldExpired
+	}
+
+	return nil
+}
+
+// DeleteHold releases a hold. Holds that were converted or already released are left alone.
+func (repository *postgresDBRepo) DeleteHold(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `DELETE FROM room_restrictions WHERE id = $1 AND restriction_id = $2`
+
+	_, err := repository.exec(ctx, query, id, models.RestrictionHold)
+	return err
+}
+
+// ExpireHolds releases the holds that expired by now and returns how many were released
+func (repository *postgresDBRepo) ExpireHolds(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `DELETE FROM room_restrictions WHERE restriction_id = $1 AND expires_at <= $2`
+
+	result, err := repository.exec(ctx, query, models.RestrictionHold, now)
+	if err != nil {
+		return 0, err
+	}
+
+	expired, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(expired), nil
+}
+
+// ImportReservations inserts the rows of a reservation import in one transaction: each reservation, linked to
+// the guest of its email, with the restriction booking its room unless it was cancelled, and each block.
+// Imported reservations are marked as processed so they don't fill the list of new reservations. The rooms of
+// the import are locked like for a hold and a restriction is only inserted when its room is free for the
+// dates, so either every row is imported or none is; an *ImportRowError wrapping ErrRoomUnavailable tells
+// which row's room was taken in the meantime.
+func (repository *postgresDBRepo) ImportReservations(ctx context.Context, rows []models.ImportRow) error {
+	tx, err := repository.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// insert runs a statement of the import, bound by the query timeout, and returns the id it inserted
+	insert := func(query string, args ...interface{}) (int, error) {
+		ctx, cancel := repository.withTimeout(ctx)
+		defer cancel()
+
+		var id int
+		err := repository.txQueryRow(ctx, tx, query, args...).Scan(&id)
+		return id, err
+	}
+
+	var roomIDs []int
+	for _, row := range rows {
+		if row.TakesRoom() {
+			roomIDs = append(roomIDs, row.Reservation.RoomID)
+		}
+	}
+
+	lockCtx, cancel := repository.withTimeout(ctx)
+	err = repository.lockRooms(lockCtx, tx, roomIDs...)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, row := range rows {
+		res := row.Reservation
+		reservationID := 0
+		restrictionID := models.RestrictionOwnerBlock
+
+		if row.Kind == models.ImportReservation {
+			reservationID, err = insert(`
+				WITH guest AS (`+guestUpsert("$3", "$1", "$2", "$4", "$10", "")+`
+				)
+				INSERT INTO
+					reservations (first_name, last_name, email, phone, start_date, end_date, room_id, adults, children,
+						created_at, updated_at, processed, status, total, guest_id)
+				VALUES
+					($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, 1, $11, $12, (SELECT id FROM guest))
+				RETURNING id`,
+				res.FirstName, res.LastName, res.Email, res.Phone, res.StartDate, res.EndDate, res.RoomID,
+				res.Adults, res.Children, now, res.Status, res.Total,
+			)
+			if err != nil {
+				return &ImportRowError{Line: row.Line, Err: err}
+			}
+			restrictionID = models.RestrictionReservation
+		}
+
+		if !row.TakesRoom() {
+			continue
+		}
+
+		insertCtx, cancel := repository.withTimeout(ctx)
+		_, err = repository.insertFreeRestriction(insertCtx, tx, models.RoomRestriction{
+			StartDate:     res.StartDate,
+			EndDate:       res.EndDate,
+			RoomID:        res.RoomID,
+			ReservationID: reservationID,
+			RestrictionID: restrictionID,
+		}, now)
+		cancel()
+		if err != nil {
+			return &ImportRowError{Line: row.Line, Err: err}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetOccupancy returns how many nights from start to end, not including end, the active rooms were booked
+// for by the reservations holding them, out of the nights they could have been
+func (repository *postgresDBRepo) GetOccupancy(ctx context.Context, start, end time.Time) (models.Occupancy, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT
+			COALESCE((
+				SELECT SUM(LEAST(r.end_date, $2::date) - GREATEST(r.start_date, $1::date))
+				FROM reservations r
+				JOIN rooms rm ON rm.id = r.room_id
+				WHERE rm.active AND r.status IN ($3, $4) AND r.start_date < $2 AND r.end_date > $1
+			), 0),
+			(SELECT count(id) FROM rooms WHERE active) * GREATEST($2::date - $1::date, 0)
+	`
+
+	var o models.Occupancy
+
+	err := repository.queryRow(ctx, query, start, end, models.ReservationPending, models.ReservationConfirmed).Scan(
+		&o.BookedNights,
+		&o.AvailableNights,
+	)
+
+	return o, err
+}
+
+// GetRevenueBooked returns the total of the confirmed reservations booked from start to end, not including
+// end, in the minor units of the currency of the property
+func (repository *postgresDBRepo) GetRevenueBooked(ctx context.Context, start, end time.Time) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT COALESCE(SUM(total), 0)
+		FROM reservations
+		WHERE status = $3 AND created_at >= $1 AND created_at < $2
+	`
+
+	var revenue int
+
+	err := repository.queryRow(ctx, query, start, end, models.ReservationConfirmed).Scan(&revenue)
+
+	return revenue, err
+}
+
+// GetBookingsPerDay returns the number of reservations booked on each day from start to end, not including
+// end, with the days nothing was booked counted as 0. Reservations that expired unpaid aren't counted.
+func (repository *postgresDBRepo) GetBookingsPerDay(ctx context.Context, start, end time.Time) ([]models.DailyCount, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT d.day, count(r.id)
+		FROM generate_series($1::timestamp, $2::timestamp - interval '1 day', interval '1 day') AS d(day)
+		LEFT JOIN reservations r
+			ON r.created_at >= d.day AND r.created_at < d.day + interval '1 day' AND r.status <> $3
+		GROUP BY d.day
+		ORDER BY d.day
+	`
+
+	rows, err := repository.query(ctx, query, start, end, models.ReservationExpired)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.DailyCount
+	for rows.Next() {
+		var c models.DailyCount
+		err := rows.Scan(&c.Day, &c.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// roomColumns are the rooms columns read by scanRoom, in order
+const roomColumns = `id, room_name, slug, description, capacity, max_occupancy, price, amenities, active, payment_policy,
+	deposit_percent, COALESCE(cancellation_policy_id, 0), created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoom(row rowScanner) (models.Room, error) {
+	var room models.Room
+	var amenities string
+
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.Slug,
+		&room.Description,
+		&room.Capacity,
+		&room.MaxOccupancy,
+		&room.Price,
+		&amenities,
+		&room.Active,
+		&room.PaymentPolicy,
+		&room.DepositPercent,
+		&room.CancellationPolicyID,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+
+	room.Amenities = splitAmenities(amenities)
+
+	return room, err
+}
+
+// splitAmenities turns the comma separated amenities column into a list
+func splitAmenities(amenities string) []string {
+	var list []string
+	for _, a := range strings.Split(amenities, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// getRooms runs a query selecting roomColumns and loads the photos of each room
+func (repository *postgresDBRepo) getRooms(ctx context.Context, query string, args ...interface{}) ([]models.Room, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var rooms []models.Room
+
+	rows, err := repository.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range rooms {
+		rooms[i].Photos, err = repository.getPhotosForRoom(ctx, rooms[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rooms, nil
+}
+
+func (repository *postgresDBRepo) GetActiveRooms(ctx context.Context) ([]models.Room, error) {
+	query := `
+		SELECT ` + roomColumns + `
+		FROM rooms
+		WHERE active = true
+		ORDER BY room_name
+	`
+
+	return repository.getRooms(ctx, query)
+}
+
+func (repository *postgresDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT ` + roomColumns + `
+		FROM rooms
+		WHERE slug = $1
+	`
+
+	room, err := scanRoom(repository.queryRow(ctx, query, slug))
+	if err != nil {
+		return room, err
+	}
+
+	room.Photos, err = repository.getPhotosForRoom(ctx, room.ID)
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// InsertRoom inserts a room and returns its id. It returns ErrRoomSlugExists when another room has its slug.
+func (repository *postgresDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			rooms (room_name, slug, description, capacity, max_occupancy, price, amenities, active, payment_policy,
+				deposit_percent, cancellation_policy_id, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), $12, $13) returning id
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.Capacity,
+		room.MaxOccupancy,
+		room.Price,
+		strings.Join(room.Amenities, ", "),
+		room.Active,
+		paymentPolicy(room),
+		room.DepositPercent,
+		room.CancellationPolicyID,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return 0, ErrRoomSlugExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateRoom updates a room. It returns ErrRoomSlugExists when another room has its slug.
+func (repository *postgresDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE rooms
+		SET room_name = $1, slug = $2, description = $3, capacity = $4, max_occupancy = $5, price = $6, amenities = $7,
+			active = $8, payment_policy = $9, deposit_percent = $10, cancellation_policy_id = NULLIF($11, 0),
+			updated_at = $12
+		WHERE id = $13
+	`
+
+	_, err := repository.exec(ctx, query,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.Capacity,
+		room.MaxOccupancy,
+		room.Price,
+		strings.Join(room.Amenities, ", "),
+		room.Active,
+		paymentPolicy(room),
+		room.DepositPercent,
+		room.CancellationPolicyID,
+		time.Now(),
+		room.ID,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrRoomSlugExists
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRoom deletes a room that has never been booked; rooms with reservations must be deactivated instead
+func (repository *postgresDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		DELETE FROM rooms
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM reservations WHERE room_id = $1)
+	`
+
+	result, err := repository.exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrRoomHasReservations
+	}
+
+	return nil
+}
+
+func (repository *postgresDBRepo) getPhotosForRoom(ctx context.Context, roomID int) ([]models.RoomPhoto, error) {
+	var photos []models.RoomPhoto
+
+	query := `
+		SELECT id, room_id, url, medium_url, thumbnail_url, storage_key, alt_text, position, created_at, updated_at
+		FROM room_photos
+		WHERE room_id = $1
+		ORDER BY position, id
+	`
+
+	rows, err := repository.query(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.RoomPhoto
+		err := rows.Scan(
+			&p.ID,
+			&p.RoomID,
+			&p.URL,
+			&p.MediumURL,
+			&p.ThumbnailURL,
+			&p.StorageKey,
+			&p.AltText,
+			&p.Position,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+func (repository *postgresDBRepo) InsertRoomPhoto(ctx context.Context, photo models.RoomPhoto) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			room_photos (room_id, url, medium_url, thumbnail_url, storage_key, alt_text, position, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		photo.RoomID,
+		photo.URL,
+		photo.MediumURL,
+		photo.ThumbnailURL,
+		photo.StorageKey,
+		photo.AltText,
+		photo.Position,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateRoomPhoto updates the alt text and position of a photo
+func (repository *postgresDBRepo) UpdateRoomPhoto(ctx context.Context, photo models.RoomPhoto) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE room_photos
+		SET alt_text = $1, position = $2, updated_at = $3
+		WHERE id = $4 AND room_id = $5
+	`
+
+	_, err := repository.exec(ctx, query,
+		photo.AltText,
+		photo.Position,
+		time.Now(),
+		photo.ID,
+		photo.RoomID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repository *postgresDBRepo) DeleteRoomPhoto(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `DELETE FROM room_photos WHERE id = $1`
+
+	_, err := repository.exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const bookingRuleColumns = `
+	b.id, COALESCE(b.room_id, 0), b.name, b.season_start, b.season_end, b.min_nights, b.max_nights,
+	b.min_lead_days, b.max_horizon_days, b.closed_to_arrival, b.closed_to_departure, b.created_at, b.updated_at,
+	COALESCE(rm.room_name, '')
+`
+
+func scanBookingRule(row rowScanner) (models.BookingRule, error) {
+	var rule models.BookingRule
+	var seasonStart, seasonEnd sql.NullTime
+	var closedToArrival, closedToDeparture string
+
+	err := row.Scan(
+		&rule.ID,
+		&rule.RoomID,
+		&rule.Name,
+		&seasonStart,
+		&seasonEnd,
+		&rule.MinNights,
+		&rule.MaxNights,
+		&rule.MinLeadDays,
+		&rule.MaxHorizonDays,
+		&closedToArrival,
+		&closedToDeparture,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+		&rule.Room.RoomName,
+	)
+
+	rule.Room.ID = rule.RoomID
+	rule.SeasonStart = seasonStart.Time
+	rule.SeasonEnd = seasonEnd.Time
+	rule.ClosedToArrival = rules.ParseWeekdays(closedToArrival)
+	rule.ClosedToDeparture = rules.ParseWeekdays(closedToDeparture)
+
+	return rule, err
+}
+
+// getBookingRules runs a query selecting bookingRuleColumns
+func (repository *postgresDBRepo) getBookingRules(ctx context.Context, query string, args ...interface{}) ([]models.BookingRule, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var bookingRules []models.BookingRule
+
+	rows, err := repository.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		rule, err := scanBookingRule(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		bookingRules = append(bookingRules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return bookingRules, nil
+}
+
+func (repository *postgresDBRepo) AllBookingRules(ctx context.Context) ([]models.BookingRule, error) {
+	query := `
+		SELECT ` + bookingRuleColumns + `
+		FROM booking_rules b
+		LEFT JOIN rooms rm ON (b.room_id = rm.id)
+		ORDER BY rm.room_name NULLS FIRST, b.season_start NULLS FIRST, b.id
+	`
+
+	return repository.getBookingRules(ctx, query)
+}
+
+// GetBookingRulesForRoom returns the rules of a room together with the rules for every room
+func (repository *postgresDBRepo) GetBookingRulesForRoom(ctx context.Context, roomID int) ([]models.BookingRule, error) {
+	query := `
+		SELECT ` + bookingRuleColumns + `
+		FROM booking_rules b
+		LEFT JOIN rooms rm ON (b.room_id = rm.id)
+		WHERE b.room_id IS NULL OR b.room_id = $1
+	`
+
+	return repository.getBookingRules(ctx, query, roomID)
+}
+
+func (repository *postgresDBRepo) GetBookingRuleByID(ctx context.Context, id int) (models.BookingRule, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT ` + bookingRuleColumns + `
+		FROM booking_rules b
+		LEFT JOIN rooms rm ON (b.room_id = rm.id)
+		WHERE b.id = $1
+	`
+
+	return scanBookingRule(repository.queryRow(ctx, query, id))
+}
+
+// nullDate stores the zero time as NULL, for optional dates such as the seasons of booking rules
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (repository *postgresDBRepo) InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			booking_rules (room_id, name, season_start, season_end, min_nights, max_nights, min_lead_days,
+				max_horizon_days, closed_to_arrival, closed_to_departure, created_at, updated_at)
+		VALUES
+			(NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning id
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		rule.RoomID,
+		rule.Name,
+		nullDate(rule.SeasonStart),
+		nullDate(rule.SeasonEnd),
+		rule.MinNights,
+		rule.MaxNights,
+		rule.MinLeadDays,
+		rule.MaxHorizonDays,
+		rules.FormatWeekdays(rule.ClosedToArrival),
+		rules.FormatWeekdays(rule.ClosedToDeparture),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (repository *postgresDBRepo) UpdateBookingRule(ctx context.Context, rule models.BookingRule) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE booking_rules
+		SET room_id = NULLIF($1, 0), name = $2, season_start = $3, season_end = $4, min_nights = $5, max_nights = $6,
+			min_lead_days = $7, max_horizon_days = $8, closed_to_arrival = $9, closed_to_departure = $10, updated_at = $11
+		WHERE id = $12
+	`
+
+	_, err := repository.exec(ctx, query,
+		rule.RoomID,
+		rule.Name,
+		nullDate(rule.SeasonStart),
+		nullDate(rule.SeasonEnd),
+		rule.MinNights,
+		rule.MaxNights,
+		rule.MinLeadDays,
+		rule.MaxHorizonDays,
+		rules.FormatWeekdays(rule.ClosedToArrival),
+		rules.FormatWeekdays(rule.ClosedToDeparture),
+		time.Now(),
+		rule.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repository *postgresDBRepo) DeleteBookingRule(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	_, err := repository.exec(ctx, `DELETE FROM booking_rules WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllExchangeRates returns the exchange rates ordered by currency
+func (repository *postgresDBRepo) AllExchangeRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var rates []models.ExchangeRate
+
+	query := `
+		SELECT id, currency, rate, created_at, updated_at
+		FROM exchange_rates
+		ORDER BY currency
+	`
+
+	rows, err := repository.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var rate models.ExchangeRate
+
+		err := rows.Scan(&rate.ID, &rate.Currency, &rate.Rate, &rate.CreatedAt, &rate.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, rate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// SaveExchangeRate inserts the rate of a currency, or updates it when the currency already has one
+func (repository *postgresDBRepo) SaveExchangeRate(ctx context.Context, rate models.ExchangeRate) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO exchange_rates (currency, rate, created_at, updated_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := repository.exec(ctx, query, rate.Currency, rate.Rate, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (repository *postgresDBRepo) DeleteExchangeRate(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	_, err := repository.exec(ctx, `DELETE FROM exchange_rates WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// paymentPolicy returns the payment policy stored for a room, full payment unless it takes a deposit
+func paymentPolicy(room models.Room) string {
+	if room.PaymentPolicy == models.PaymentDeposit {
+		return models.PaymentDeposit
+	}
+	return models.PaymentFull
+}
+
+func (repository *postgresDBRepo) InsertPayment(ctx context.Context, payment models.Payment) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			payments (reservation_id, gateway, checkout_id, checkout_url, kind, amount, currency, status,
+				created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		payment.ReservationID,
+		payment.Gateway,
+		payment.CheckoutID,
+		payment.CheckoutURL,
+		payment.Kind,
+		payment.Amount,
+		payment.Currency,
+		models.PaymentPending,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetPaymentsForReservation returns the payments of a reservation, oldest first
+func (repository *postgresDBRepo) GetPaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var payments []models.Payment
+
+	query := `
+		SELECT id, reservation_id, gateway, checkout_id, checkout_url, kind, amount, currency, status,
+			created_at, updated_at
+		FROM payments
+		WHERE reservation_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := repository.query(ctx, query, reservationID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Gateway,
+			&p.CheckoutID,
+			&p.CheckoutURL,
+			&p.Kind,
+			&p.Amount,
+			&p.Currency,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// ApplyPaymentEvent records a webhook event and updates the status of its payment, confirming the pending
+// reservation the payment is for when it succeeded. It all happens in one transaction, so an event delivered
+// twice, even at the same time, is only applied once. It returns the ID of the reservation the event confirmed,
+// or 0 when it didn't confirm one.
+//
+// A payment can succeed after its reservation expired unpaid: the reservation is confirmed anyway when its
+// room is still free, unless it was booked with a promo code, whose use was given back when it expired.
+// Otherwise, and for reservations that were cancelled, a *PaidTooLateError is returned.
+func (repository *postgresDBRepo) ApplyPaymentEvent(ctx context.Context, event models.PaymentEvent) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	tx, err := repository.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH event AS (
+			INSERT INTO payment_events (gateway, event_id, created_at)
+			VALUES ($1, $2, $5)
+			ON CONFLICT (gateway, event_id) DO NOTHING
+			RETURNING id
+		), payment AS (
+			UPDATE payments
+			SET status = $4, updated_at = $5
+			WHERE gateway = $1 AND checkout_id = $3 AND status <> 'succeeded' AND EXISTS (SELECT 1 FROM event)
+			RETURNING reservation_id, status
+		), confirmed AS (
+			UPDATE reservations
+			SET status = 'confirmed', expires_at = NULL, updated_at = $5
+			WHERE id IN (SELECT reservation_id FROM payment WHERE status = 'succeeded') AND status = 'pending'
+			RETURNING id
+		), late AS (
+			SELECT r.id, r.status, r.room_id, r.discount
+			FROM reservations r
+			WHERE r.id IN (SELECT reservation_id FROM payment WHERE status = 'succeeded')
+				AND r.status IN ('expired', 'cancelled')
+		)
+		SELECT
+			(SELECT COALESCE(max(id), 0) FROM confirmed),
+			COALESCE(late.id, 0), COALESCE(late.status, ''), COALESCE(late.room_id, 0), COALESCE(late.discount, 0)
+		FROM (SELECT 1) one
+		LEFT JOIN late ON true
+	`
+
+	now := time.Now()
+
+	var reservationID, lateID, roomID, discount int
+	var lateStatus string
+
+	err = repository.txQueryRow(ctx, tx, query,
+		event.Gateway,
+		event.ID,
+		event.CheckoutID,
+		event.Status,
+		now,
+	).Scan(&reservationID, &lateID, &lateStatus, &roomID, &discount)
+	if err != nil {
+		return 0, err
+	}
+
+	if lateID != 0 && lateStatus == models.ReservationExpired && discount == 0 {
+		reservationID, err = repository.reconfirm(ctx, tx, lateID, roomID, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	if lateID != 0 && reservationID == 0 {
+		return 0, &PaidTooLateError{ReservationID: lateID, Status: lateStatus}
+	}
+
+	return reservationID, nil
+}
+
+// reconfirm confirms a reservation that expired again, booking its room for its dates if the room is still
+// free, and returns its ID, or 0 when the room was taken in the meantime
+func (repository *postgresDBRepo) reconfirm(ctx context.Context, tx *sql.Tx, reservationID, roomID int, now time.Time) (int, error) {
+	err := repository.lockRooms(ctx, tx, roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		WITH restriction AS (
+			INSERT INTO
+				room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			SELECT
+				r.start_date, r.end_date, r.room_id, r.id, $2, $3, $3
+			FROM reservations r
+			WHERE r.id = $1 AND r.status = 'expired' AND NOT EXISTS (
+				SELECT 1 FROM room_restrictions rr
+				WHERE rr.room_id = r.room_id AND r.start_date < rr.end_date AND r.end_date > rr.start_date
+			)
+			RETURNING reservation_id
+		)
+		UPDATE reservations
+		SET status = 'confirmed', expires_at = NULL, updated_at = $3
+		WHERE id IN (SELECT reservation_id FROM restriction)
+		RETURNING id
+	`
+
+	var id int
+
+	err = repository.txQueryRow(ctx, tx, query, reservationID, models.RestrictionReservation, now).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// ExpirePendingReservations expires the pending reservations that weren't paid by their expiry time and
+// releases their rooms and the uses of the promo codes they were booked with. It returns the number of
+// reservations expired.
+func (repository *postgresDBRepo) ExpirePendingReservations(ctx context.Context, now time.Time) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		WITH expired AS (
+			UPDATE reservations
+			SET status = 'expired', updated_at = $1
+			WHERE status = 'pending' AND expires_at <= $1
+			RETURNING id
+		), released AS (
+			DELETE FROM room_restrictions
+			WHERE reservation_id IN (SELECT id FROM expired)
+		), redemptions AS (
+			DELETE FROM promo_redemptions
+			WHERE reservation_id IN (SELECT id FROM expired)
+			RETURNING promo_code_id
+		), uses AS (
+			UPDATE promo_codes p
+			SET uses = p.uses - r.count
+			FROM (SELECT promo_code_id, count(*) AS count FROM redemptions GROUP BY promo_code_id) r
+			WHERE p.id = r.promo_code_id
+		)
+		SELECT count(*) FROM expired
+	`
+
+	var expired int
+
+	err := repository.queryRow(ctx, query, now).Scan(&expired)
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
+
+// AllCancellationPolicies returns the cancellation policies ordered by name
+func (repository *postgresDBRepo) AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := `
+		SELECT id, name, free_days, penalty_percent, non_refundable, created_at, updated_at
+		FROM cancellation_policies
+		ORDER BY name, id
+	`
+
+	rows, err := repository.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		policy, err := scanCancellationPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func (repository *postgresDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT id, name, free_days, penalty_percent, non_refundable, created_at, updated_at
+		FROM cancellation_policies
+		WHERE id = $1
+	`
+
+	return scanCancellationPolicy(repository.queryRow(ctx, query, id))
+}
+
+func scanCancellationPolicy(row rowScanner) (models.CancellationPolicy, error) {
+	var policy models.CancellationPolicy
+
+	err := row.Scan(
+		&policy.ID,
+		&policy.Name,
+		&policy.FreeDays,
+		&policy.PenaltyPercent,
+		&policy.NonRefundable,
+		&policy.CreatedAt,
+		&policy.UpdatedAt,
+	)
+
+	return policy, err
+}
+
+func (repository *postgresDBRepo) InsertCancellationPolicy(ctx context.Context, policy models.CancellationPolicy) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			cancellation_policies (name, free_days, penalty_percent, non_refundable, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6) returning id
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		policy.Name,
+		policy.FreeDays,
+		policy.PenaltyPercent,
+		policy.NonRefundable,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+func (repository *postgresDBRepo) UpdateCancellationPolicy(ctx context.Context, policy models.CancellationPolicy) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE cancellation_policies
+		SET name = $1, free_days = $2, penalty_percent = $3, non_refundable = $4, updated_at = $5
+		WHERE id = $6
+	`
+
+	_, err := repository.exec(ctx, query,
+		policy.Name,
+		policy.FreeDays,
+		policy.PenaltyPercent,
+		policy.NonRefundable,
+		time.Now(),
+		policy.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteCancellationPolicy deletes a cancellation policy; its rooms go back to free cancellation until arrival
+func (repository *postgresDBRepo) DeleteCancellationPolicy(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	_, err := repository.exec(ctx, `DELETE FROM cancellation_policies WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CancelReservation cancels a pending or confirmed reservation and releases its room. It returns
+// ErrNotCancellable when the reservation was already cancelled or expired, so a reservation cancelled
+// twice at the same time is only refunded once.
+func (repository *postgresDBRepo) CancelReservation(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		WITH cancelled AS (
+			UPDATE reservations
+			SET status = 'cancelled', cancelled_at = $2, expires_at = NULL, updated_at = $2
+			WHERE id = $1 AND status IN ('pending', 'confirmed')
+			RETURNING id
+		), released AS (
+			DELETE FROM room_restrictions
+			WHERE reservation_id IN (SELECT id FROM cancelled)
+		)
+		SELECT count(*) FROM cancelled
+	`
+
+	var cancelled int
+
+	err := repository.queryRow(ctx, query, id, time.Now()).Scan(&cancelled)
+	if err != nil {
+		return err
+	}
+
+	if cancelled == 0 {
+		return ErrNotCancellable
+	}
+
+	return nil
+}
+
+func (repository *postgresDBRepo) InsertRefund(ctx context.Context, refund models.Refund) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			refunds (reservation_id, payment_id, gateway, refund_id, amount, currency, status, reason, created_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		refund.ReservationID,
+		refund.PaymentID,
+		refund.Gateway,
+		refund.RefundID,
+		refund.Amount,
+		refund.Currency,
+		refund.Status,
+		refund.Reason,
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetRefundsForReservation returns the refunds of a reservation, oldest first
+func (repository *postgresDBRepo) GetRefundsForReservation(ctx context.Context, reservationID int) ([]models.Refund, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var refunds []models.Refund
+
+	query := `
+		SELECT id, reservation_id, payment_id, gateway, refund_id, amount, currency, status, reason, created_at
+		FROM refunds
+		WHERE reservation_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := repository.query(ctx, query, reservationID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var refund models.Refund
+
+		err := rows.Scan(
+			&refund.ID,
+			&refund.ReservationID,
+			&refund.PaymentID,
+			&refund.Gateway,
+			&refund.RefundID,
+			&refund.Amount,
+			&refund.Currency,
+			&refund.Status,
+			&refund.Reason,
+			&refund.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// invoiceColumns are the columns scanInvoice reads, in order
+const invoiceColumns = `id, number, COALESCE(reservation_id, 0), issued_at, name, email, currency, total, tax_name, tax_rate, created_at`
+
+func scanInvoice(row rowScanner) (models.Invoice, error) {
+	var invoice models.Invoice
+
+	err := row.Scan(
+		&invoice.ID,
+		&invoice.Number,
+		&invoice.ReservationID,
+		&invoice.IssuedAt,
+		&invoice.Name,
+		&invoice.Email,
+		&invoice.Currency,
+		&invoice.Total,
+		&invoice.TaxName,
+		&invoice.TaxRate,
+		&invoice.CreatedAt,
+	)
+
+	return invoice, err
+}
+
+// uniqueViolation is the code postgres fails a statement with when it breaks a unique constraint
+const uniqueViolation = "23505"
+
+// issueInvoiceAttempts bounds how many times issuing an invoice is retried when another invoice took its number
+const issueInvoiceAttempts = 5
+
+// IssueInvoice issues the invoice of a reservation with the next invoice number, or returns the invoice the
+// reservation already has. Numbers have no gaps: when two invoices are issued at the same time, the one that
+// loses the race for a number is issued again with the next one.
+func (repository *postgresDBRepo) IssueInvoice(ctx context.Context, invoice models.Invoice) (models.Invoice, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	// the existing invoice isn't seen when it was issued after this statement started, which is retried too
+	query := `
+		WITH issued AS (
+			INSERT INTO
+				invoices (number, reservation_id, issued_at, name, email, currency, total, tax_name, tax_rate, created_at)
+			SELECT
+				COALESCE(max(number), 0) + 1, $1, $2, $3, $4, $5, $6, $7, $8, $2
+			FROM invoices
+			ON CONFLICT (reservation_id) DO NOTHING
+			RETURNING ` + invoiceColumns + `
+		)
+		SELECT * FROM issued
+		UNION ALL
+		SELECT ` + invoiceColumns + ` FROM invoices WHERE reservation_id = $1
+	`
+
+	var err error
+
+	for attempt := 0; attempt < issueInvoiceAttempts; attempt++ {
+		var issued models.Invoice
+
+		issued, err = scanInvoice(repository.queryRow(ctx, query,
+			invoice.ReservationID,
+			time.Now(),
+			invoice.Name,
+			invoice.Email,
+			invoice.Currency,
+			invoice.Total,
+			invoice.TaxName,
+			invoice.TaxRate,
+		))
+
+		var pgErr *pgconn.PgError
+		if errors.Is(err, sql.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			continue
+		}
+
+		return issued, err
+	}
+
+	return models.Invoice{}, err
+}
+
+// GetInvoiceForReservation returns the invoice issued for a reservation, or sql.ErrNoRows when there is none
+func (repository *postgresDBRepo) GetInvoiceForReservation(ctx context.Context, reservationID int) (models.Invoice, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE reservation_id = $1`
+
+	return scanInvoice(repository.queryRow(ctx, query, reservationID))
+}
+
+// promoCodeColumns are the columns scanPromoCode reads, in order, from the promo_codes table aliased p
+const promoCodeColumns = `
+	p.id, p.code, p.description, p.kind, p.amount, p.starts_on, p.ends_on, p.min_nights,
+	COALESCE((SELECT string_agg(room_id::text, ',' ORDER BY room_id) FROM promo_code_rooms WHERE promo_code_id = p.id), ''),
+	p.max_uses, p.uses, p.once_per_email, p.active, p.created_at, p.updated_at,
+	COALESCE((SELECT sum(r.discount) FROM promo_redemptions pr JOIN reservations r ON r.id = pr.reservation_id
+		WHERE pr.promo_code_id = p.id), 0)
+`
+
+func scanPromoCode(row rowScanner) (models.PromoCode, error) {
+	var code models.PromoCode
+	var startsOn, endsOn sql.NullTime
+	var roomIDs string
+
+	err := row.Scan(
+		&code.ID,
+		&code.Code,
+		&code.Description,
+		&code.Kind,
+		&code.Amount,
+		&startsOn,
+		&endsOn,
+		&code.MinNights,
+		&roomIDs,
+		&code.MaxUses,
+		&code.Uses,
+		&code.OncePerEmail,
+		&code.Active,
+		&code.CreatedAt,
+		&code.UpdatedAt,
+		&code.Discounted,
+	)
+
+	code.StartsOn = startsOn.Time
+	code.EndsOn = endsOn.Time
+	code.RoomIDs = parseIDs(roomIDs)
+
+	return code, err
+}
+
+// formatIDs turns ids into the comma separated list they are passed to queries as
+func formatIDs(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseIDs reads ids aggregated as a comma separated list
+func parseIDs(s string) []int {
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.Atoi(part); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// AllPromoCodes returns the promo codes, the active ones first
+func (repository *postgresDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var codes []models.PromoCode
+
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes p ORDER BY p.active DESC, p.code`
+
+	rows, err := repository.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		code, err := scanPromoCode(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (repository *postgresDBRepo) GetPromoCodeByID(ctx context.Context, id int) (models.PromoCode, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes p WHERE p.id = $1`
+
+	return scanPromoCode(repository.queryRow(ctx, query, id))
+}
+
+// GetPromoCodeByCode returns the promo code with a code, as stored, or sql.ErrNoRows when there is none
+func (repository *postgresDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `SELECT ` + promoCodeColumns + ` FROM promo_codes p WHERE p.code = $1`
+
+	return scanPromoCode(repository.queryRow(ctx, query, code))
+}
+
+// InsertPromoCode inserts a promo code with its rooms. It returns ErrPromoCodeExists when another promo code
+// has the same code.
+func (repository *postgresDBRepo) InsertPromoCode(ctx context.Context, code models.PromoCode) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		WITH code AS (
+			INSERT INTO
+				promo_codes (code, description, kind, amount, starts_on, ends_on, min_nights, max_uses, once_per_email,
+					active, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+			RETURNING id
+		), rooms AS (
+			INSERT INTO promo_code_rooms (promo_code_id, room_id)
+			SELECT code.id, unnest(string_to_array($12, ',')::integer[]) FROM code
+		)
+		SELECT id FROM code
+	`
+
+	var newID int
+
+	err := repository.queryRow(ctx, query,
+		code.Code,
+		code.Description,
+		code.Kind,
+		code.Amount,
+		nullDate(code.StartsOn),
+		nullDate(code.EndsOn),
+		code.MinNights,
+		code.MaxUses,
+		code.OncePerEmail,
+		code.Active,
+		time.Now(),
+		formatIDs(code.RoomIDs),
+	).Scan(&newID)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return 0, ErrPromoCodeExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdatePromoCode updates a promo code and replaces its rooms. It returns ErrPromoCodeExists when another
+// promo code has the same code.
+func (repository *postgresDBRepo) UpdatePromoCode(ctx context.Context, code models.PromoCode) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		WITH code AS (
+			UPDATE promo_codes
+			SET code = $1, description = $2, kind = $3, amount = $4, starts_on = $5, ends_on = $6, min_nights = $7,
+				max_uses = $8, once_per_email = $9, active = $10, updated_at = $11
+			WHERE id = $12
+			RETURNING id
+		), removed AS (
+			DELETE FROM promo_code_rooms
+			WHERE promo_code_id IN (SELECT id FROM code) AND room_id <> ALL (string_to_array($13, ',')::integer[])
+		), added AS (
+			INSERT INTO promo_code_rooms (promo_code_id, room_id)
+			SELECT code.id, unnest(string_to_array($13, ',')::integer[]) FROM code
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*) FROM code
+	`
+
+	var updated int
+
+	err := repository.queryRow(ctx, query,
+		code.Code,
+		code.Description,
+		code.Kind,
+		code.Amount,
+		nullDate(code.StartsOn),
+		nullDate(code.EndsOn),
+		code.MinNights,
+		code.MaxUses,
+		code.OncePerEmail,
+		code.Active,
+		time.Now(),
+		code.ID,
+		formatIDs(code.RoomIDs),
+	).Scan(&updated)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrPromoCodeExists
+	}
+
+	return err
+}
+
+// DeletePromoCode deletes a promo code that was never redeemed; used codes must be deactivated instead
+func (repository *postgresDBRepo) DeletePromoCode(ctx context.Context, id int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		DELETE FROM promo_codes
+		WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM promo_redemptions WHERE promo_code_id = $1)
+	`
+
+	result, err := repository.exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrPromoCodeRedeemed
+	}
+
+	return nil
+}
+
+// GetRedemptionsForPromoCode returns the reservations a promo code was redeemed for, the latest first
+func (repository *postgresDBRepo) GetRedemptionsForPromoCode(ctx context.Context, promoCodeID int) ([]models.PromoRedemption, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	var redemptions []models.PromoRedemption
+
+	query := `
+		SELECT
+			pr.id, pr.promo_code_id, pr.reservation_id, pr.created_at, r.first_name, r.last_name, r.email,
+			r.start_date, r.end_date, r.status, r.total, r.discount, rm.id, rm.room_name
+		FROM promo_redemptions pr
+		JOIN reservations r ON r.id = pr.reservation_id
+		LEFT JOIN rooms rm ON rm.id = r.room_id
+		WHERE pr.promo_code_id = $1
+		ORDER BY pr.created_at DESC, pr.id DESC
+	`
+
+	rows, err := repository.query(ctx, query, promoCodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var redemption models.PromoRedemption
+		res := &redemption.Reservation
+
+		err := rows.Scan(
+			&redemption.ID,
+			&redemption.PromoCodeID,
+			&redemption.ReservationID,
+			&redemption.CreatedAt,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.StartDate,
+			&res.EndDate,
+			&res.Status,
+			&res.Total,
+			&res.Discount,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		res.ID = redemption.ReservationID
+		res.RoomID = res.Room.ID
+		redemptions = append(redemptions, redemption)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return redemptions, nil
+}
+
+// waitlistColumns are the waitlist_entries columns read by scanWaitlistEntry, in order
+const waitlistColumns = `id, first_name, last_name, email, start_date, end_date, COALESCE(room_id, 0), adults, children,
+	status, COALESCE(token, ''), COALESCE(offered_room_id, 0), COALESCE(hold_id, 0), expires_at, created_at, updated_at`
+
+func scanWaitlistEntry(row rowScanner) (models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	var expiresAt sql.NullTime
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.FirstName,
+		&entry.LastName,
+		&entry.Email,
+		&entry.StartDate,
+		&entry.EndDate,
+		&entry.RoomID,
+		&entry.Adults,
+		&entry.Children,
+		&entry.Status,
+		&entry.Token,
+		&entry.OfferedRoomID,
+		&entry.HoldID,
+		&expiresAt,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+	)
+
+	entry.ExpiresAt = expiresAt.Time
+
+	return entry, err
+}
+
+func (repository *postgresDBRepo) getWaitlistEntries(ctx context.Context, query string, args ...interface{}) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	rows, err := repository.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (repository *postgresDBRepo) InsertWaitlistEntry(ctx context.Context, entry models.WaitlistEntry) (int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		INSERT INTO
+			waitlist_entries (first_name, last_name, email, start_date, end_date, room_id, adults, children, status,
+				created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, $9, $10, $10)
+		RETURNING id
+	`
+
+	var id int
+
+	err := repository.queryRow(ctx, query,
+		entry.FirstName,
+		entry.LastName,
+		entry.Email,
+		entry.StartDate,
+		entry.EndDate,
+		entry.RoomID,
+		entry.Adults,
+		entry.Children,
+		models.WaitlistWaiting,
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetWaitingEntriesForRoom returns the entries still waiting for the room, or for any room, with dates that
+// overlap the given ones, in the order the guests joined the waitlist
+func (repository *postgresDBRepo) GetWaitingEntriesForRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT ` + waitlistColumns + `
+		FROM waitlist_entries
+		WHERE status = $1 AND (room_id = $2 OR room_id IS NULL) AND $3 < end_date AND $4 > start_date
+		ORDER BY created_at, id
+	`
+
+	return repository.getWaitlistEntries(ctx, query, models.WaitlistWaiting, roomID, start, end)
+}
+
+func (repository *postgresDBRepo) GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `SELECT ` + waitlistColumns + ` FROM waitlist_entries WHERE token = $1`
+
+	return scanWaitlistEntry(repository.queryRow(ctx, query, token))
+}
+
+// OfferWaitlistEntry records the room held for a waiting entry, with the token of its booking link and
+// when the offer expires. It returns ErrNotWaiting when the entry was offered a room in the meantime.
+func (repository *postgresDBRepo) OfferWaitlistEntry(ctx context.Context, entry models.WaitlistEntry) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE waitlist_entries
+		SET status = $2, token = $3, offered_room_id = $4, hold_id = $5, expires_at = $6, updated_at = $7
+		WHERE id = $1 AND status = $8
+	`
+
+	result, err := repository.exec(ctx, query,
+		entry.ID,
+		models.WaitlistOffered,
+		entry.Token,
+		entry.OfferedRoomID,
+		entry.HoldID,
+		entry.ExpiresAt,
+		time.Now(),
+		models.WaitlistWaiting,
+	)
+	if err != nil {
+		return err
+	}
+
+	offered, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if offered == 0 {
+		return ErrNotWaiting
+	}
+
+	return nil
+}
+
+// BookWaitlistOffer marks the entry offered the hold as booked, if the hold was offered from the waitlist
+func (repository *postgresDBRepo) BookWaitlistOffer(ctx context.Context, holdID int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `UPDATE waitlist_entries SET status = $2, updated_at = $3 WHERE hold_id = $1 AND status = $4`
+
+	_, err := repository.exec(ctx, query, holdID, models.WaitlistBooked, time.Now(), models.WaitlistOffered)
+	return err
+}
+
+// ExpireWaitlistOffers expires the offers that weren't booked by now and returns their entries, so the rooms
+// can be offered to the next guests
+func (repository *postgresDBRepo) ExpireWaitlistOffers(ctx context.Context, now time.Time) ([]models.WaitlistEntry, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		UPDATE waitlist_entries
+		SET status = $1, updated_at = $2
+		WHERE status = $3 AND expires_at <= $2
+		RETURNING ` + waitlistColumns
+
+	return repository.getWaitlistEntries(ctx, query, models.WaitlistExpired, now, models.WaitlistOffered)
+}
+
+// guestUpsert returns the statement linking a reservation to the guest of its email, for a WITH clause: it
+// creates the guest the first time the email books and returns the id of the guest the email belongs to,
+// following a merge. A guest without a phone gets the one booked with. The arguments are the placeholders
+// of the statement the clause is part of, and an optional condition the guest is only created under. No
+// guest is returned for an empty email.
+func guestUpsert(email, firstName, lastName, phone, now, condition string) string {
+	where := email + ` <> ''`
+	if condition != "" {
+		where += ` AND ` + condition
+	}
+
+	return `
+			INSERT INTO guests (email, first_name, last_name, phone, created_at, updated_at)
+			SELECT ` + email + `, ` + firstName + `, ` + lastName + `, ` + phone + `, ` + now + `, ` + now + `
+			WHERE ` + where + `
+			ON CONFLICT ((lower(email))) DO UPDATE
+			SET phone = CASE WHEN guests.phone = '' THEN EXCLUDED.phone ELSE guests.phone END,
+				updated_at = EXCLUDED.updated_at
+			RETURNING COALESCE(merged_into_id, id) AS id`
+}
+
+// guestColumns are the columns scanGuest reads, in order. Only the reservations that weren't cancelled or
+// expired count as stays; what was paid for any reservation counts towards the spend, less the refunds.
+const guestColumns = `
+	g.id, g.email, g.first_name, g.last_name, g.phone, g.notes,
+	COALESCE((SELECT string_agg(tag, ',' ORDER BY tag) FROM guest_tags WHERE guest_id = g.id), ''),
+	COALESCE(g.merged_into_id, 0), g.created_at, g.updated_at,
+	(SELECT count(*) FROM reservations r WHERE r.guest_id = g.id AND r.status IN ('pending', 'confirmed')),
+	(SELECT max(r.start_date) FROM reservations r WHERE r.guest_id = g.id AND r.status IN ('pending', 'confirmed')),
+	(SELECT COALESCE(sum(p.amount), 0) FROM payments p JOIN reservations r ON r.id = p.reservation_id
+		WHERE r.guest_id = g.id AND p.status = 'succeeded') -
+	(SELECT COALESCE(sum(f.amount), 0) FROM refunds f JOIN reservations r ON r.id = f.reservation_id
+		WHERE r.guest_id = g.id AND f.status = 'succeeded')
+`
+
+func scanGuest(row rowScanner) (models.Guest, error) {
+	var guest models.Guest
+	var tags string
+	var lastStay sql.NullTime
+
+	err := row.Scan(
+		&guest.ID,
+		&guest.Email,
+		&guest.FirstName,
+		&guest.LastName,
+		&guest.Phone,
+		&guest.Notes,
+		&tags,
+		&guest.MergedIntoID,
+		&guest.CreatedAt,
+		&guest.UpdatedAt,
+		&guest.Stays,
+		&lastStay,
+		&guest.Spend,
+	)
+
+	if tags != "" {
+		guest.Tags = strings.Split(tags, ",")
+	}
+	guest.LastStay = lastStay.Time
+
+	return guest, err
+}
+
+// getGuests runs a query selecting guestColumns
+func (repository *postgresDBRepo) getGuests(ctx context.Context, query string, args ...interface{}) ([]models.Guest, error) {
+	rows, err := repository.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var guests []models.Guest
+	for rows.Next() {
+		guest, err := scanGuest(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		guests = append(guests, guest)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return guests, nil
+}
+
+// SearchGuests returns one page of the guests matching the search, by name, and the total number of
+// matching guests. Guests merged into others are left out.
+func (repository *postgresDBRepo) SearchGuests(ctx context.Context, search models.GuestQuery) ([]models.Guest, int, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	conditions := []string{"g.merged_into_id IS NULL"}
+	var args []interface{}
+
+	// arg adds a query argument and returns its placeholder
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if search.Search != "" {
+		pattern := arg(likePattern(search.Search))
+		conditions = append(conditions,
+			"(g.first_name || ' ' || g.last_name ILIKE "+pattern+" OR g.email ILIKE "+pattern+" OR g.phone ILIKE "+pattern+")")
+	}
+	if search.Tag != "" {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM guest_tags t WHERE t.guest_id = g.id AND t.tag = "+arg(search.Tag)+")")
+	}
+
+	from := `
+		FROM guests g
+		WHERE ` + strings.Join(conditions, " AND ")
+
+	var total int
+
+	err := repository.queryRow(ctx, `SELECT count(g.id)`+from, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n := len(args)
+	query := `SELECT` + guestColumns + from + `
+		ORDER BY lower(g.last_name), lower(g.first_name), g.id
+		LIMIT $` + strconv.Itoa(n+1) + ` OFFSET $` + strconv.Itoa(n+2)
+
+	guests, err := repository.getGuests(ctx, query, append(args, search.PerPage, search.Offset())...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return guests, total, nil
+}
+
+// GetGuestByID returns a guest, or sql.ErrNoRows when there is none
+func (repository *postgresDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `SELECT` + guestColumns + `FROM guests g WHERE g.id = $1`
+
+	return scanGuest(repository.queryRow(ctx, query, id))
+}
+
+// UpdateGuest updates the name, phone, notes and tags of a guest. The email the guest is recognised by
+// doesn't change.
+func (repository *postgresDBRepo) UpdateGuest(ctx context.Context, guest models.Guest) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		WITH guest AS (
+			UPDATE guests
+			SET first_name = $1, last_name = $2, phone = $3, notes = $4, updated_at = $5
+			WHERE id = $6
+			RETURNING id
+		), removed AS (
+			DELETE FROM guest_tags
+			WHERE guest_id IN (SELECT id FROM guest) AND tag <> ALL (string_to_array($7, ','))
+		)
+		INSERT INTO guest_tags (guest_id, tag)
+		SELECT guest.id, unnest(string_to_array($7, ',')) FROM guest
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := repository.exec(ctx, query,
+		guest.FirstName,
+		guest.LastName,
+		guest.Phone,
+		guest.Notes,
+		time.Now(),
+		guest.ID,
+		strings.Join(guest.Tags, ","),
+	)
+
+	return err
+}
+
+// GetDuplicateGuests returns the other guests that may be the same person as a guest: those with the same
+// name, in any case, or the same phone number, whatever its punctuation. Guests merged into others are
+// left out.
+func (repository *postgresDBRepo) GetDuplicateGuests(ctx context.Context, guest models.Guest) ([]models.Guest, error) {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		SELECT` + guestColumns + `
+		FROM guests g
+		WHERE g.id <> $1 AND g.merged_into_id IS NULL AND (
+			($2 <> '' AND lower(g.first_name) = lower($2) AND lower(g.last_name) = lower($3))
+			OR ($4 <> '' AND regexp_replace(g.phone, '\D', '', 'g') = $4)
+		)
+		ORDER BY lower(g.last_name), lower(g.first_name), g.id
+		LIMIT 20`
+
+	phone := strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, guest.Phone)
+
+	return repository.getGuests(ctx, query, guest.ID, guest.FirstName, guest.LastName, phone)
+}
+
+// MergeGuests merges a duplicate guest into the guest kept, in one statement: the reservations and tags of
+// the duplicate go to the kept guest, which gets its notes appended and its phone when it has none, and the
+// duplicate is marked as merged so later bookings with its email are linked to the kept guest. It returns
+// ErrGuestMerged when either guest doesn't exist or was already merged, or they are the same guest.
+func (repository *postgresDBRepo) MergeGuests(ctx context.Context, keepID, duplicateID int) error {
+	ctx, cancel := repository.withTimeout(ctx)
+
+	defer cancel()
+
+	query := `
+		WITH pair AS (
+			SELECT k.id AS keep_id, d.id AS duplicate_id, d.phone, d.notes
+			FROM guests k, guests d
+			WHERE k.id = $1 AND d.id = $2 AND k.id <> d.id AND k.merged_into_id IS NULL AND d.merged_into_id IS NULL
+			FOR UPDATE
+		), moved AS (
+			UPDATE reservations r
+			SET guest_id = pair.keep_id
+			FROM pair
+			WHERE r.guest_id = pair.duplicate_id
+		), redirected AS (
+			UPDATE guests g
+			SET merged_into_id = pair.keep_id
+			FROM pair
+			WHERE g.merged_into_id = pair.duplicate_id
+		), tagged AS (
+			INSERT INTO guest_tags (guest_id, tag)
+			SELECT pair.keep_id, t.tag
+			FROM pair
+			JOIN guest_tags t ON t.guest_id = pair.duplicate_id
+			ON CONFLICT DO NOTHING
+		), untagged AS (
+			DELETE FROM guest_tags t
+			USING pair
+			WHERE t.guest_id = pair.duplicate_id
+		), merged AS (
+			UPDATE guests g
+			SET merged_into_id = pair.keep_id, updated_at = $3
+			FROM pair
+			WHERE g.id = pair.duplicate_id
+		)
+		UPDATE guests g
+		SET phone = CASE WHEN g.phone = '' THEN pair.phone ELSE g.phone END,
+			notes = concat_ws(E'\n\n', NULLIF(g.notes, ''), NULLIF(pair.notes, '')),
+			updated_at = $3
+		FROM pair
+		WHERE g.id = pair.keep_id
+	`
+
+	result, err := repository.exec(ctx, query, keepID, duplicateID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	merged, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if merged == 0 {
+		return ErrGuestMerged
+	}
+
+	return nil
+}
@@ -0,0 +1,1441 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/migrate"
+	"github.com/crislainesc/bookings/internal/models"
+	"github.com/crislainesc/bookings/migrations"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL, applies the migrations and empties the
+// booking tables. Tests using it are skipped when the variable is unset.
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.ExecContext(ctx, `TRUNCATE guest_tags, guests, waitlist_entries, promo_redemptions, promo_code_rooms, promo_codes, invoices, refunds, payment_events, payments, room_restrictions, reservations, room_photos, rooms, cancellation_policies RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestSearchAvailabilityForAllRooms(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	rooms := []models.Room{
+		{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true},
+		{RoomName: "Family Suite", Slug: "family-suite", Capacity: 4, MaxOccupancy: 6, Price: 20000, Active: true},
+		{RoomName: "Booked Room", Slug: "booked-room", Capacity: 2, MaxOccupancy: 3, Price: 15000, Active: true},
+		{RoomName: "Closed Room", Slug: "closed-room", Capacity: 2, MaxOccupancy: 2, Price: 5000, Active: false},
+		{RoomName: "Loft", Slug: "loft", Capacity: 2, MaxOccupancy: 4, Price: 30000, Active: true},
+	}
+
+	ids := make(map[string]int)
+	for _, room := range rooms {
+		id, err := repo.InsertRoom(ctx, room)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[room.Slug] = id
+	}
+
+	_, err := repo.InsertRoomPhoto(ctx, models.RoomPhoto{
+		RoomID:       ids["cabin"],
+		URL:          "/uploads/cabin/large.jpg",
+		MediumURL:    "/uploads/cabin/medium.jpg",
+		ThumbnailURL: "/uploads/cabin/thumbnail.jpg",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+
+	reservationID, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		StartDate: start.AddDate(0, 0, 1),
+		EndDate:   end.AddDate(0, 0, 1),
+		RoomID:    ids["booked-room"],
+		Adults:    2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     start.AddDate(0, 0, 1),
+		EndDate:       end.AddDate(0, 0, 1),
+		RoomID:        ids["booked-room"],
+		ReservationID: reservationID,
+		RestrictionID: models.RestrictionReservation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		search        models.AvailabilityQuery
+		expectedSlugs []string
+		expectedTotal int
+	}{
+		{
+			name:          "sorted by price",
+			search:        models.AvailabilityQuery{Adults: 2, Sort: models.SortByPrice, Page: 1, PerPage: 10},
+			expectedSlugs: []string{"cabin", "family-suite", "loft"},
+			expectedTotal: 3,
+		},
+		{
+			name:          "second page",
+			search:        models.AvailabilityQuery{Adults: 2, Sort: models.SortByPrice, Page: 2, PerPage: 2},
+			expectedSlugs: []string{"loft"},
+			expectedTotal: 3,
+		},
+		{
+			name:          "sorted by capacity",
+			search:        models.AvailabilityQuery{Adults: 1, Sort: models.SortByCapacity, Page: 1, PerPage: 10},
+			expectedSlugs: []string{"family-suite", "loft", "cabin"},
+			expectedTotal: 3,
+		},
+		{
+			name:          "with children",
+			search:        models.AvailabilityQuery{Adults: 2, Children: 2, Sort: models.SortByName, Page: 1, PerPage: 10},
+			expectedSlugs: []string{"family-suite", "loft"},
+			expectedTotal: 2,
+		},
+		{
+			name:          "too many adults",
+			search:        models.AvailabilityQuery{Adults: 5, Page: 1, PerPage: 10},
+			expectedTotal: 0,
+		},
+	}
+
+	for _, e := range tests {
+		e.search.StartDate = start
+		e.search.EndDate = end
+
+		found, total, err := repo.SearchAvailabilityForAllRooms(ctx, e.search)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		if total != e.expectedTotal {
+			t.Errorf("%s: expected %d rooms in total, got %d", e.name, e.expectedTotal, total)
+		}
+
+		var slugs []string
+		for _, room := range found {
+			slugs = append(slugs, room.Slug)
+
+			if room.Nights != 3 || room.StayPrice != room.Price*3 {
+				t.Errorf("%s: %s costs %d for %d nights at %d", e.name, room.Slug, room.StayPrice, room.Nights, room.Price)
+			}
+		}
+
+		if len(slugs) != len(e.expectedSlugs) {
+			t.Errorf("%s: expected rooms %v, got %v", e.name, e.expectedSlugs, slugs)
+			continue
+		}
+		for i := range slugs {
+			if slugs[i] != e.expectedSlugs[i] {
+				t.Errorf("%s: expected rooms %v, got %v", e.name, e.expectedSlugs, slugs)
+				break
+			}
+		}
+	}
+
+	found, _, err := repo.SearchAvailabilityForAllRooms(ctx, models.AvailabilityQuery{
+		StartDate: start, EndDate: end, Adults: 1, Sort: models.SortByPrice, Page: 1, PerPage: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Thumbnail().ThumbnailURL != "/uploads/cabin/thumbnail.jpg" {
+		t.Errorf("expected the cheapest room to come with its thumbnail, got %+v", found)
+	}
+}
+
+func TestApplyPaymentEvent(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	reservationID, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 2),
+		RoomID:    roomID,
+		Adults:    2,
+		Status:    models.ReservationPending,
+		ExpiresAt: time.Now().Add(time.Hour),
+		Total:     20000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertPayment(ctx, models.Payment{
+		ReservationID: reservationID, Gateway: "fake", CheckoutID: "cs_1", Kind: models.PaymentFull, Amount: 20000, Currency: "USD",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		event    models.PaymentEvent
+		expected int
+	}{
+		{"failed", models.PaymentEvent{ID: "evt_1", Gateway: "fake", CheckoutID: "cs_1", Status: models.PaymentFailed}, 0},
+		{"succeeded", models.PaymentEvent{ID: "evt_2", Gateway: "fake", CheckoutID: "cs_1", Status: models.PaymentSucceeded}, reservationID},
+		{"delivered-again", models.PaymentEvent{ID: "evt_2", Gateway: "fake", CheckoutID: "cs_1", Status: models.PaymentSucceeded}, 0},
+		{"unknown-checkout", models.PaymentEvent{ID: "evt_3", Gateway: "fake", CheckoutID: "cs_2", Status: models.PaymentSucceeded}, 0},
+	}
+
+	for _, e := range tests {
+		confirmed, err := repo.ApplyPaymentEvent(ctx, e.event)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if confirmed != e.expected {
+			t.Errorf("%s: expected reservation %d to be confirmed, got %d", e.name, e.expected, confirmed)
+		}
+	}
+
+	reservation, err := repo.GetReservationByID(ctx, reservationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != models.ReservationConfirmed || !reservation.ExpiresAt.IsZero() {
+		t.Errorf("expected a confirmed reservation without expiry, got %s expiring %v", reservation.Status, reservation.ExpiresAt)
+	}
+
+	payments, err := repo.GetPaymentsForReservation(ctx, reservationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 || payments[0].Status != models.PaymentSucceeded {
+		t.Errorf("expected one succeeded payment, got %+v", payments)
+	}
+}
+
+func TestLatePayment(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+
+	// book inserts a reservation holding the room until it is paid, and starts its checkout
+	book := func(arrival int, checkoutID string) int {
+		id, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "John", LastName: "Smith", Email: "john@smith.com", RoomID: roomID, Adults: 1,
+			StartDate: start.AddDate(0, 0, arrival), EndDate: start.AddDate(0, 0, arrival+2),
+			Status: models.ReservationPending, ExpiresAt: now.Add(-time.Minute), Total: 20000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+			StartDate: start.AddDate(0, 0, arrival), EndDate: start.AddDate(0, 0, arrival+2), RoomID: roomID,
+			ReservationID: id, RestrictionID: models.RestrictionReservation,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = repo.InsertPayment(ctx, models.Payment{
+			ReservationID: id, Gateway: "fake", CheckoutID: checkoutID, Kind: models.PaymentFull, Amount: 20000, Currency: "USD",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	free := book(0, "cs_free")
+	taken := book(10, "cs_taken")
+
+	if _, err := repo.ExpirePendingReservations(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// somebody else holds the room of the second reservation once it expired
+	_, err = repo.InsertHold(ctx, models.RoomRestriction{
+		StartDate: start.AddDate(0, 0, 11), EndDate: start.AddDate(0, 0, 12), RoomID: roomID, ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the room of the first reservation is still free, so it is confirmed when paid late
+	confirmed, err := repo.ApplyPaymentEvent(ctx, models.PaymentEvent{ID: "evt_1", Gateway: "fake", CheckoutID: "cs_free", Status: models.PaymentSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if confirmed != free {
+		t.Errorf("expected reservation %d to be confirmed again, got %d", free, confirmed)
+	}
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, start.AddDate(0, 0, 2), roomID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available {
+		t.Error("expected the reservation confirmed again to book its room")
+	}
+
+	// the second one can't be, and its payment is still recorded so it can be refunded
+	_, err = repo.ApplyPaymentEvent(ctx, models.PaymentEvent{ID: "evt_2", Gateway: "fake", CheckoutID: "cs_taken", Status: models.PaymentSucceeded})
+	var late *PaidTooLateError
+	if !errors.As(err, &late) || late.ReservationID != taken || late.Status != models.ReservationExpired {
+		t.Fatalf("expected a PaidTooLateError for reservation %d, got %v", taken, err)
+	}
+
+	res, err := repo.GetReservationByID(ctx, taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments, err := repo.GetPaymentsForReservation(ctx, taken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != models.ReservationExpired || len(payments) != 1 || payments[0].Status != models.PaymentSucceeded {
+		t.Errorf("expected an expired reservation with a succeeded payment, got %s and %+v", res.Status, payments)
+	}
+
+	// the event delivered again isn't applied twice
+	if _, err := repo.ApplyPaymentEvent(ctx, models.PaymentEvent{ID: "evt_2", Gateway: "fake", CheckoutID: "cs_taken", Status: models.PaymentSucceeded}); err != nil {
+		t.Errorf("expected the event delivered again to be ignored, got %v", err)
+	}
+}
+
+func TestExpirePendingReservations(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+
+	reservations := []models.Reservation{
+		{Status: models.ReservationPending, ExpiresAt: now.Add(-time.Minute)},
+		{Status: models.ReservationPending, ExpiresAt: now.Add(time.Minute)},
+		{Status: models.ReservationConfirmed},
+	}
+
+	ids := make([]int, len(reservations))
+	for i, reservation := range reservations {
+		reservation.FirstName, reservation.LastName, reservation.Email = "John", "Smith", "john@smith.com"
+		reservation.StartDate = start.AddDate(0, 0, i*3)
+		reservation.EndDate = reservation.StartDate.AddDate(0, 0, 2)
+		reservation.RoomID = roomID
+		reservation.Adults = 1
+
+		ids[i], err = repo.InsertReservation(ctx, reservation)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+			StartDate:     reservation.StartDate,
+			EndDate:       reservation.EndDate,
+			RoomID:        roomID,
+			ReservationID: ids[i],
+			RestrictionID: models.RestrictionReservation,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := repo.ExpirePendingReservations(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Errorf("expected 1 reservation to expire, got %d", expired)
+	}
+
+	reservation, err := repo.GetReservationByID(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.Status != models.ReservationExpired {
+		t.Errorf("expected the unpaid reservation to expire, got %s", reservation.Status)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, start.AddDate(0, 0, 2), roomID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected the room of the expired reservation to be available again")
+	}
+}
+
+func TestHolds(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+
+	hold := models.RoomRestriction{StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomID: roomID, ExpiresAt: now.Add(time.Minute)}
+	holdID, err := repo.InsertHold(ctx, hold)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another guest can't hold the room for any of the same nights
+	taken := hold
+	taken.StartDate, taken.EndDate = start.AddDate(0, 0, 1), start.AddDate(0, 0, 3)
+	if _, err := repo.InsertHold(ctx, taken); !errors.Is(err, ErrRoomUnavailable) {
+		t.Fatalf("expected ErrRoomUnavailable for held dates, got %v", err)
+	}
+
+	restrictions, err := repo.GetRestrictionsForRoomByDate(ctx, roomID, start, start.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restrictions) != 0 {
+		t.Errorf("expected holds to be left out of the calendar, got %d restriction(s)", len(restrictions))
+	}
+
+	reservationID, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John", LastName: "Smith", Email: "john@smith.com",
+		StartDate: hold.StartDate, EndDate: hold.EndDate, RoomID: roomID, Adults: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.ConvertHold(ctx, holdID, reservationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.ConvertHold(ctx, holdID, reservationID); !errors.Is(err, ErrHoldExpired) {
+		t.Errorf("expected ErrHoldExpired converting a hold twice, got %v", err)
+	}
+
+	// a converted hold is the reservation's restriction and doesn't expire
+	released, err := repo.ExpireHolds(ctx, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released != 0 {
+		t.Errorf("expected no holds to expire, got %d", released)
+	}
+
+	expiring := hold
+	expiring.StartDate, expiring.EndDate = start.AddDate(0, 0, 5), start.AddDate(0, 0, 7)
+	expiring.ExpiresAt = now.Add(-time.Minute)
+	if _, err := repo.InsertHold(ctx, expiring); err != nil {
+		t.Fatal(err)
+	}
+
+	released, err = repo.ExpireHolds(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released != 1 {
+		t.Errorf("expected 1 hold to expire, got %d", released)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, expiring.StartDate, expiring.EndDate, roomID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected the room of the expired hold to be available again")
+	}
+}
+
+func TestConcurrentHolds(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	// guests holding the room for overlapping nights at the same time: only one of them gets it
+	const guests = 10
+	errs := make(chan error, guests)
+	var wg sync.WaitGroup
+	for i := 0; i < guests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := repo.InsertHold(ctx, models.RoomRestriction{
+				StartDate: start.AddDate(0, 0, i%2), EndDate: start.AddDate(0, 0, 2+i%2), RoomID: roomID, ExpiresAt: time.Now().Add(time.Minute),
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	held := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			held++
+		case !errors.Is(err, ErrRoomUnavailable):
+			t.Errorf("expected ErrRoomUnavailable, got %v", err)
+		}
+	}
+	if held != 1 {
+		t.Errorf("expected exactly 1 hold, got %d", held)
+	}
+}
+
+func TestCancelReservation(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	policyID, err := repo.InsertCancellationPolicy(ctx, models.CancellationPolicy{Name: "Flexible", FreeDays: 7, PenaltyPercent: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true, CancellationPolicyID: policyID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room, err := repo.GetRoomByID(ctx, roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.CancellationPolicyID != policyID {
+		t.Errorf("expected the room to have policy %d, got %d", policyID, room.CancellationPolicyID)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	reservation := models.Reservation{
+		FirstName:   "John",
+		LastName:    "Smith",
+		Email:       "john@smith.com",
+		StartDate:   start,
+		EndDate:     start.AddDate(0, 0, 2),
+		RoomID:      roomID,
+		Adults:      1,
+		Status:      models.ReservationConfirmed,
+		CancelToken: "token",
+	}
+
+	reservationID, err := repo.InsertReservation(ctx, reservation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertRoomRestriction(ctx, models.RoomRestriction{
+		StartDate:     reservation.StartDate,
+		EndDate:       reservation.EndDate,
+		RoomID:        roomID,
+		ReservationID: reservationID,
+		RestrictionID: models.RestrictionReservation,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.CancelReservation(ctx, reservationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.CancelReservation(ctx, reservationID)
+	if !errors.Is(err, ErrNotCancellable) {
+		t.Errorf("expected cancelling twice to fail with ErrNotCancellable, got %v", err)
+	}
+
+	cancelled, err := repo.GetReservationByCancelToken(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != models.ReservationCancelled || cancelled.CancelledAt.IsZero() {
+		t.Errorf("expected the reservation to be cancelled, got %s at %v", cancelled.Status, cancelled.CancelledAt)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, start, start.AddDate(0, 0, 2), roomID, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !available {
+		t.Error("expected the room of the cancelled reservation to be available again")
+	}
+
+	err = repo.DeleteCancellationPolicy(ctx, policyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room, err = repo.GetRoomByID(ctx, roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.CancellationPolicyID != 0 {
+		t.Errorf("expected the room to lose its deleted policy, got %d", room.CancellationPolicyID)
+	}
+}
+
+func TestIssueInvoice(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	ids := make([]int, 3)
+	for i := range ids {
+		ids[i], err = repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "John",
+			LastName:  "Smith",
+			Email:     "john@smith.com",
+			StartDate: start.AddDate(0, 0, i*3),
+			EndDate:   start.AddDate(0, 0, i*3+2),
+			RoomID:    roomID,
+			Adults:    1,
+			Total:     20000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issue := func(reservationID int) models.Invoice {
+		invoice, err := repo.IssueInvoice(ctx, models.Invoice{
+			ReservationID: reservationID,
+			Name:          "John Smith",
+			Email:         "john@smith.com",
+			Currency:      "USD",
+			Total:         20000,
+			TaxName:       "VAT",
+			TaxRate:       1000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return invoice
+	}
+
+	first := issue(ids[0])
+	if first.Number != 1 || first.ReservationID != ids[0] || first.TaxRate != 1000 {
+		t.Errorf("expected invoice 1 for reservation %d, got %+v", ids[0], first)
+	}
+
+	if again := issue(ids[0]); again.ID != first.ID || again.Number != 1 {
+		t.Errorf("expected issuing twice to return invoice 1 again, got number %d", again.Number)
+	}
+
+	if second := issue(ids[1]); second.Number != 2 {
+		t.Errorf("expected invoice 2, got %d", second.Number)
+	}
+
+	found, err := repo.GetInvoiceForReservation(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Number != 2 {
+		t.Errorf("expected to find invoice 2, got %d", found.Number)
+	}
+
+	// the number of the invoice of a deleted reservation isn't given out again
+	err = repo.DeleteReservation(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if third := issue(ids[2]); third.Number != 3 {
+		t.Errorf("expected invoice 3, got %d", third.Number)
+	}
+
+	_, err = repo.GetInvoiceForReservation(ctx, ids[1])
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the deleted reservation to have no invoice, got %v", err)
+	}
+}
+
+func TestPromoCodes(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codeID, err := repo.InsertPromoCode(ctx, models.PromoCode{
+		Code:         "SUMMER10",
+		Kind:         models.PromoPercent,
+		Amount:       10,
+		StartsOn:     time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		MinNights:    1,
+		RoomIDs:      []int{roomID},
+		MaxUses:      2,
+		OncePerEmail: true,
+		Active:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.InsertPromoCode(ctx, models.PromoCode{Code: "SUMMER10", Kind: models.PromoFixed, Amount: 100}); !errors.Is(err, ErrPromoCodeExists) {
+		t.Errorf("expected ErrPromoCodeExists for a duplicate code, got %v", err)
+	}
+
+	code, err := repo.GetPromoCodeByCode(ctx, "SUMMER10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.ID != codeID || len(code.RoomIDs) != 1 || code.RoomIDs[0] != roomID || code.EndsOn != (time.Time{}) {
+		t.Errorf("unexpected promo code %+v", code)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	book := func(email string, status string) (int, error) {
+		return repo.InsertReservation(ctx, models.Reservation{
+			FirstName:   "John",
+			LastName:    "Smith",
+			Email:       email,
+			StartDate:   start,
+			EndDate:     start.AddDate(0, 0, 2),
+			RoomID:      roomID,
+			Adults:      1,
+			Status:      status,
+			ExpiresAt:   start,
+			Total:       18000,
+			PromoCodeID: codeID,
+			PromoCode:   "SUMMER10",
+			Discount:    2000,
+		})
+	}
+
+	uses := func() int {
+		code, err := repo.GetPromoCodeByID(ctx, codeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code.Uses
+	}
+
+	first, err := book("john@smith.com", models.ReservationConfirmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := book("John@Smith.com", models.ReservationConfirmed); !errors.Is(err, ErrPromoCodeAlreadyUsed) {
+		t.Errorf("expected ErrPromoCodeAlreadyUsed for the same email, got %v", err)
+	}
+
+	if _, err := book("jane@smith.com", models.ReservationPending); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := book("joe@smith.com", models.ReservationConfirmed); !errors.Is(err, ErrPromoCodeUnavailable) {
+		t.Errorf("expected ErrPromoCodeUnavailable once the code is used up, got %v", err)
+	}
+
+	if n := uses(); n != 2 {
+		t.Errorf("expected 2 uses, got %d", n)
+	}
+
+	reservation, err := repo.GetReservationByID(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reservation.PromoCode != "SUMMER10" || reservation.Discount != 2000 {
+		t.Errorf("expected the reservation to keep its code and discount, got %q and %d", reservation.PromoCode, reservation.Discount)
+	}
+
+	redemptions, err := repo.GetRedemptionsForPromoCode(ctx, codeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redemptions) != 2 {
+		t.Errorf("expected 2 redemptions, got %d", len(redemptions))
+	}
+
+	if err := repo.DeletePromoCode(ctx, codeID); !errors.Is(err, ErrPromoCodeRedeemed) {
+		t.Errorf("expected ErrPromoCodeRedeemed for a used code, got %v", err)
+	}
+
+	// the unpaid reservation expiring and the paid one being deleted give back their uses
+	if _, err := repo.ExpirePendingReservations(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	if n := uses(); n != 1 {
+		t.Errorf("expected 1 use after the pending reservation expired, got %d", n)
+	}
+
+	if err := repo.DeleteReservation(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if n := uses(); n != 0 {
+		t.Errorf("expected no uses after the reservation was deleted, got %d", n)
+	}
+
+	code.RoomIDs = nil
+	code.Active = false
+	if err := repo.UpdatePromoCode(ctx, code); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := repo.GetPromoCodeByID(ctx, codeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.RoomIDs) != 0 || updated.Active {
+		t.Errorf("expected an inactive code for every room, got %+v", updated)
+	}
+
+	if _, err := book("joe@smith.com", models.ReservationConfirmed); !errors.Is(err, ErrPromoCodeUnavailable) {
+		t.Errorf("expected ErrPromoCodeUnavailable for an inactive code, got %v", err)
+	}
+
+	if err := repo.DeletePromoCode(ctx, codeID); err != nil {
+		t.Errorf("expected a code without redemptions to be deleted, got %v", err)
+	}
+}
+
+func TestWaitlist(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRoomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Suite", Slug: "suite", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	entries := []models.WaitlistEntry{
+		{RoomID: roomID, StartDate: start, EndDate: start.AddDate(0, 0, 2)},
+		{StartDate: start.AddDate(0, 0, 1), EndDate: start.AddDate(0, 0, 3)},
+		{RoomID: otherRoomID, StartDate: start, EndDate: start.AddDate(0, 0, 2)},
+		{StartDate: start.AddDate(0, 0, 5), EndDate: start.AddDate(0, 0, 7)},
+	}
+	for i, entry := range entries {
+		entry.FirstName, entry.LastName, entry.Email, entry.Adults = "Jane", "Doe", "jane@doe.com", 1
+		entries[i].ID, err = repo.InsertWaitlistEntry(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the entries for the room or any room that overlap the freed dates, in the order they were added
+	waiting, err := repo.GetWaitingEntriesForRoom(ctx, roomID, start, start.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waiting) != 2 || waiting[0].ID != entries[0].ID || waiting[1].ID != entries[1].ID {
+		t.Fatalf("expected entries %d and %d to be waiting, got %+v", entries[0].ID, entries[1].ID, waiting)
+	}
+
+	offer := waiting[0]
+	offer.Token, offer.OfferedRoomID, offer.HoldID, offer.ExpiresAt = "token", roomID, 7, time.Now().Add(-time.Minute)
+	err = repo.OfferWaitlistEntry(ctx, offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.OfferWaitlistEntry(ctx, offer); !errors.Is(err, ErrNotWaiting) {
+		t.Errorf("expected ErrNotWaiting offering a room twice, got %v", err)
+	}
+
+	offered, err := repo.GetWaitlistEntryByToken(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offered.Status != models.WaitlistOffered || offered.OfferedRoomID != roomID || offered.HoldID != 7 {
+		t.Errorf("expected the entry to be offered the room with hold 7, got %+v", offered)
+	}
+
+	expired, err := repo.ExpireWaitlistOffers(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].ID != offer.ID || expired[0].Status != models.WaitlistExpired {
+		t.Errorf("expected the offer of entry %d to expire, got %+v", offer.ID, expired)
+	}
+
+	booked := waiting[1]
+	booked.Token, booked.OfferedRoomID, booked.HoldID, booked.ExpiresAt = "other", roomID, 8, time.Now().Add(time.Hour)
+	err = repo.OfferWaitlistEntry(ctx, booked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.BookWaitlistOffer(ctx, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	booked, err = repo.GetWaitlistEntryByToken(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booked.Status != models.WaitlistBooked {
+		t.Errorf("expected the offer to be booked, got %s", booked.Status)
+	}
+}
+
+// TestSearchReservations tests that reservations are filtered, sorted and paginated in the database
+func TestSearchReservations(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRoomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Suite", Slug: "suite", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	reservations := []models.Reservation{
+		{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", RoomID: roomID, StartDate: start, Status: models.ReservationConfirmed},
+		{FirstName: "John", LastName: "Smith", Email: "john@smith.com", RoomID: roomID, StartDate: start.AddDate(0, 0, 5), Status: models.ReservationPending},
+		{FirstName: "Ann", LastName: "Lee", Email: "ann_lee@example.com", RoomID: otherRoomID, StartDate: start.AddDate(0, 0, 1), Status: models.ReservationCancelled},
+	}
+	ids := make([]int, len(reservations))
+	for i, reservation := range reservations {
+		reservation.EndDate = reservation.StartDate.AddDate(0, 0, 2)
+		reservation.Adults = 1
+
+		ids[i], err = repo.InsertReservation(ctx, reservation)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = repo.UpdateProcessedForReservation(ctx, ids[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		search   models.ReservationQuery
+		expected []int
+		total    int
+	}{
+		{"all-by-arrival", models.ReservationQuery{}, []int{ids[0], ids[2], ids[1]}, 3},
+		{"latest-arrival-first", models.ReservationQuery{Desc: true}, []int{ids[1], ids[2], ids[0]}, 3},
+		{"by-guest", models.ReservationQuery{Sort: models.SortByGuest}, []int{ids[0], ids[2], ids[1]}, 3},
+		{"name", models.ReservationQuery{Search: "john sm"}, []int{ids[1]}, 1},
+		{"email", models.ReservationQuery{Search: "DOE.COM"}, []int{ids[0]}, 1},
+		{"literal-underscore", models.ReservationQuery{Search: "n_l"}, []int{ids[2]}, 1},
+		{"wildcard-not-matched", models.ReservationQuery{Search: "%"}, nil, 0},
+		{"room", models.ReservationQuery{RoomID: otherRoomID}, []int{ids[2]}, 1},
+		{"staying-after", models.ReservationQuery{From: start.AddDate(0, 0, 2)}, []int{ids[2], ids[1]}, 2},
+		{"staying-until", models.ReservationQuery{To: start.AddDate(0, 0, 1)}, []int{ids[0], ids[2]}, 2},
+		{"status", models.ReservationQuery{Status: models.ReservationPending}, []int{ids[1]}, 1},
+		{"new-only", models.ReservationQuery{NewOnly: true}, []int{ids[2], ids[1]}, 2},
+		{"second-page", models.ReservationQuery{Page: 2, PerPage: 2}, []int{ids[1]}, 3},
+	}
+
+	for _, e := range tests {
+		if e.search.PerPage == 0 {
+			e.search.PerPage = 10
+		}
+
+		found, total, err := repo.SearchReservations(ctx, e.search)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if total != e.total {
+			t.Errorf("%s: expected %d reservations in total, got %d", e.name, e.total, total)
+		}
+
+		var got []int
+		for _, res := range found {
+			got = append(got, res.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(e.expected) {
+			t.Errorf("%s: expected reservations %v, got %v", e.name, e.expected, got)
+		}
+	}
+
+	// exports read every matching reservation, whatever the page
+	var exported []int
+	err = repo.EachReservation(ctx, models.ReservationQuery{Sort: models.SortByGuest, Desc: true, Page: 2, PerPage: 1}, func(res models.Reservation) error {
+		exported = append(exported, res.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(exported) != fmt.Sprint([]int{ids[1], ids[2], ids[0]}) {
+		t.Errorf("expected every reservation to be exported by guest, got %v", exported)
+	}
+
+	stop := errors.New("stop")
+	err = repo.EachReservation(ctx, models.ReservationQuery{}, func(models.Reservation) error { return stop })
+	if err != stop {
+		t.Errorf("expected the error of the callback, got %v", err)
+	}
+}
+
+func TestImportReservations(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	guest := models.Reservation{FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", RoomID: roomID, Adults: 1, Status: models.ReservationConfirmed}
+
+	stay, cancelled, block := guest, guest, guest
+	stay.StartDate, stay.EndDate, stay.Total = start, start.AddDate(0, 0, 2), 20000
+	cancelled.StartDate, cancelled.EndDate, cancelled.Status = start, start.AddDate(0, 0, 2), models.ReservationCancelled
+	block.StartDate, block.EndDate = start.AddDate(0, 0, 2), start.AddDate(0, 0, 4)
+
+	err = repo.ImportReservations(ctx, []models.ImportRow{
+		{Line: 2, Kind: models.ImportReservation, Reservation: stay},
+		{Line: 3, Kind: models.ImportReservation, Reservation: cancelled},
+		{Line: 4, Kind: models.ImportBlock, Reservation: block},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, total, err := repo.SearchReservations(ctx, models.ReservationQuery{PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || found[0].Total != 20000 || found[0].Processed != 1 {
+		t.Errorf("expected 2 processed reservations to be imported, got %d: %+v", total, found)
+	}
+
+	// the cancelled reservation doesn't take the room, the block does
+	restrictions, err := repo.GetRestrictionsForRoomByDate(ctx, roomID, start, start.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved := map[int]bool{}
+	for _, restriction := range restrictions {
+		reserved[restriction.ReservationID] = true
+	}
+	if len(restrictions) != 2 || !reserved[found[0].ID] || !reserved[0] {
+		t.Errorf("expected the restrictions of the stay and the block, got %+v", restrictions)
+	}
+
+	// a row whose room is taken rolls back the whole import
+	later := guest
+	later.StartDate, later.EndDate = start.AddDate(0, 0, 10), start.AddDate(0, 0, 12)
+	err = repo.ImportReservations(ctx, []models.ImportRow{
+		{Line: 2, Kind: models.ImportReservation, Reservation: later},
+		{Line: 3, Kind: models.ImportReservation, Reservation: stay},
+	})
+	var rowErr *ImportRowError
+	if !errors.As(err, &rowErr) || rowErr.Line != 3 || !errors.Is(err, ErrRoomUnavailable) {
+		t.Fatalf("expected ErrRoomUnavailable on line 3, got %v", err)
+	}
+
+	_, total, err = repo.SearchReservations(ctx, models.ReservationQuery{PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("expected the failed import to be rolled back, got %d reservations", total)
+	}
+}
+
+func TestConcurrentImportAndHold(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	stay := models.Reservation{
+		FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", RoomID: roomID, Adults: 1,
+		StartDate: start, EndDate: start.AddDate(0, 0, 2), Status: models.ReservationConfirmed,
+	}
+
+	// a guest holds the room while the same nights are imported: only one of them gets it
+	var importErr, holdErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		importErr = repo.ImportReservations(ctx, []models.ImportRow{{Line: 2, Kind: models.ImportReservation, Reservation: stay}})
+	}()
+	go func() {
+		defer wg.Done()
+		_, holdErr = repo.InsertHold(ctx, models.RoomRestriction{
+			StartDate: start.AddDate(0, 0, 1), EndDate: start.AddDate(0, 0, 3), RoomID: roomID, ExpiresAt: time.Now().Add(time.Minute),
+		})
+	}()
+	wg.Wait()
+
+	switch {
+	case importErr == nil && holdErr == nil:
+		t.Error("expected the import and the hold not to both take the room")
+	case importErr != nil && !errors.Is(importErr, ErrRoomUnavailable):
+		t.Errorf("expected the import to fail with ErrRoomUnavailable, got %v", importErr)
+	case holdErr != nil && !errors.Is(holdErr, ErrRoomUnavailable):
+		t.Errorf("expected the hold to fail with ErrRoomUnavailable, got %v", holdErr)
+	}
+}
+
+func TestDashboardMetrics(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.InsertRoom(ctx, models.Room{RoomName: "Suite", Slug: "suite", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+	closedID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Closed Room", Slug: "closed-room", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	reservations := []struct {
+		room     int
+		arrival  int
+		nights   int
+		status   string
+		total    int
+		bookedOn int
+	}{
+		{roomID, -2, 4, models.ReservationConfirmed, 40000, -20},
+		{roomID, 5, 10, models.ReservationPending, 100000, -1},
+		{roomID, 2, 1, models.ReservationCancelled, 10000, -1},
+		{roomID, 3, 1, models.ReservationExpired, 10000, -1},
+		{closedID, 0, 2, models.ReservationConfirmed, 20000, -1},
+	}
+	for _, e := range reservations {
+		id, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", RoomID: e.room, Adults: 1,
+			StartDate: start.AddDate(0, 0, e.arrival), EndDate: start.AddDate(0, 0, e.arrival+e.nights),
+			Status: e.status, Total: e.total,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.ExecContext(ctx, `UPDATE reservations SET created_at = $1 WHERE id = $2`, start.AddDate(0, 0, e.bookedOn).Add(10*time.Hour), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first week takes 2 nights of the first stay and 2 of the pending one, in the 2 active rooms
+	occupancy, err := repo.GetOccupancy(ctx, start, start.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if occupancy.BookedNights != 4 || occupancy.AvailableNights != 14 {
+		t.Errorf("expected 4 of 14 nights booked, got %+v", occupancy)
+	}
+
+	revenue, err := repo.GetRevenueBooked(ctx, start.AddDate(0, 0, -1), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revenue != 20000 {
+		t.Errorf("expected 200.00 of confirmed reservations booked the day before, got %d", revenue)
+	}
+
+	bookings, err := repo.GetBookingsPerDay(ctx, start.AddDate(0, 0, -2), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 2 || !bookings[0].Day.Equal(start.AddDate(0, 0, -2)) || bookings[0].Count != 0 || bookings[1].Count != 3 {
+		t.Errorf("expected no bookings then 3 bookings, got %+v", bookings)
+	}
+}
+
+func TestReservationBalance(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	reservationID, err := repo.InsertReservation(ctx, models.Reservation{
+		FirstName: "John", LastName: "Smith", Email: "john@smith.com", StartDate: start, EndDate: start.AddDate(0, 0, 3),
+		RoomID: roomID, Adults: 2, Status: models.ReservationPending, ExpiresAt: time.Now().Add(time.Hour), Total: 30000,
+		SpecialRequests: "Late check-in",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deposit was paid, the second checkout was never finished
+	for i, amount := range []int{10000, 5000} {
+		_, err = repo.InsertPayment(ctx, models.Payment{
+			ReservationID: reservationID, Gateway: "fake", CheckoutID: fmt.Sprintf("cs_%d", i), Kind: models.PaymentDeposit, Amount: amount, Currency: "USD",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = repo.ApplyPaymentEvent(ctx, models.PaymentEvent{ID: "evt_1", Gateway: "fake", CheckoutID: "cs_0", Status: models.PaymentSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, _, err := repo.SearchReservations(ctx, models.ReservationQuery{PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Paid != 10000 || found[0].Balance() != 20000 || found[0].SpecialRequests != "Late check-in" {
+		t.Errorf("expected 200.00 left to pay and the special requests, got %+v", found)
+	}
+
+	res, err := repo.GetReservationByID(ctx, reservationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.SpecialRequests = "Early check-in"
+	err = repo.UpdateReservation(ctx, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = repo.GetReservationByID(ctx, reservationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SpecialRequests != "Early check-in" {
+		t.Errorf("expected the special requests to be updated, got %q", res.SpecialRequests)
+	}
+}
+
+func TestGuests(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	roomID, err := repo.InsertRoom(ctx, models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	book := func(email, phone string, arrival int, status string) int {
+		id, err := repo.InsertReservation(ctx, models.Reservation{
+			FirstName: "John", LastName: "Smith", Email: email, Phone: phone, RoomID: roomID, Adults: 1,
+			StartDate: start.AddDate(0, 0, arrival), EndDate: start.AddDate(0, 0, arrival+2), Status: status, Total: 20000,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	// the same email in any case is the same guest, who gets the phone of a later booking when they had none
+	first := book("john@smith.com", "", 0, models.ReservationConfirmed)
+	book("John@Smith.com", "555-555-5555", 10, models.ReservationConfirmed)
+	book("john@smith.com", "", 20, models.ReservationCancelled)
+	other := book("j.smith@example.com", "(555) 555-5555", 30, models.ReservationConfirmed)
+
+	res, err := repo.GetReservationByID(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest, err := repo.GetGuestByID(ctx, res.GuestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guest.Phone != "555-555-5555" || guest.Stays != 2 || !guest.LastStay.Equal(start.AddDate(0, 0, 10)) {
+		t.Errorf("expected 2 stays and the phone of the second booking, got %+v", guest)
+	}
+
+	guests, total, err := repo.SearchGuests(ctx, models.GuestQuery{Search: "SMITH.COM", Page: 1, PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || guests[0].ID != guest.ID {
+		t.Errorf("expected the guest to be found by email, got %d: %+v", total, guests)
+	}
+
+	guest.Notes = "Likes a quiet room"
+	guest.Tags = []string{models.GuestVIP}
+	if err := repo.UpdateGuest(ctx, guest); err != nil {
+		t.Fatal(err)
+	}
+	guests, _, err = repo.SearchGuests(ctx, models.GuestQuery{Tag: models.GuestVIP, Page: 1, PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(guests) != 1 || guests[0].Notes != "Likes a quiet room" || !guests[0].HasTag(models.GuestVIP) {
+		t.Errorf("expected the VIP guest with their notes, got %+v", guests)
+	}
+
+	duplicates, err := repo.GetDuplicateGuests(ctx, guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = repo.GetReservationByID(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 1 || duplicates[0].ID != res.GuestID {
+		t.Fatalf("expected the guest booked with the other email to be a duplicate, got %+v", duplicates)
+	}
+
+	// merging moves the stays, and later bookings with the other email go to the guest kept
+	if err := repo.MergeGuests(ctx, guest.ID, res.GuestID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.MergeGuests(ctx, guest.ID, res.GuestID); !errors.Is(err, ErrGuestMerged) {
+		t.Errorf("expected ErrGuestMerged merging the guest again, got %v", err)
+	}
+
+	later := book("j.smith@example.com", "", 40, models.ReservationConfirmed)
+	res, err = repo.GetReservationByID(ctx, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GuestID != guest.ID {
+		t.Errorf("expected a later booking to go to guest %d, got %d", guest.ID, res.GuestID)
+	}
+
+	guest, err = repo.GetGuestByID(ctx, guest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guest.Stays != 4 || !guest.HasTag(models.GuestVIP) {
+		t.Errorf("expected 4 stays after the merge, got %+v", guest)
+	}
+
+	_, total, err = repo.SearchGuests(ctx, models.GuestQuery{Page: 1, PerPage: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Errorf("expected the merged guest to be left out of the list, got %d guests", total)
+	}
+}
+
+func TestRoomSlugs(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPostgresRepo(db, nil)
+	ctx := context.Background()
+
+	cabin := models.Room{RoomName: "Cabin", Slug: "cabin", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true}
+	if _, err := repo.InsertRoom(ctx, cabin); err != nil {
+		t.Fatal(err)
+	}
+
+	suite := models.Room{RoomName: "Suite", Slug: "suite", Capacity: 2, MaxOccupancy: 2, Price: 10000, Active: true}
+	suiteID, err := repo.InsertRoom(ctx, suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.InsertRoom(ctx, cabin); !errors.Is(err, ErrRoomSlugExists) {
+		t.Errorf("expected ErrRoomSlugExists inserting a room with a taken slug, got %v", err)
+	}
+
+	suite.ID, suite.Slug = suiteID, "cabin"
+	if err := repo.UpdateRoom(ctx, suite); !errors.Is(err, ErrRoomSlugExists) {
+		t.Errorf("expected ErrRoomSlugExists updating a room to a taken slug, got %v", err)
+	}
+
+	if _, err := repo.GetRoomByID(ctx, suiteID+1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown room, got %v", err)
+	}
+}
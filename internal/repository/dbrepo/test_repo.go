@@ -1,10 +1,15 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/crislainesc/bookings/internal/dates"
 	"github.com/crislainesc/bookings/internal/models"
 )
 
@@ -13,16 +18,22 @@ func (m *testDBRepo) AllUsers() bool {
 }
 
 // InsertReservation inserts a reservation into the database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
 	// if the room id is 2, then fail; otherwise, pass
 	if res.RoomID == 2 {
 		return 0, errors.New("some error)")
 	}
+	switch res.PromoCodeID {
+	case 6:
+		return 0, ErrPromoCodeUnavailable
+	case 7:
+		return 0, ErrPromoCodeAlreadyUsed
+	}
 	return 1, nil
 }
 
 // InsertRoomRestriction inserts a room restriction into the database
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
 	if r.RoomID == 1000 {
 		return errors.New("some error")
 	}
@@ -30,7 +41,7 @@ func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 }
 
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID, and false if no availability
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID, adults, children int) (bool, error) {
 	// set up a test time
 	layout := "2006-01-02"
 	str := "2049-12-31"
@@ -55,13 +66,18 @@ func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roo
 		return false, nil
 	}
 
-	// otherwise, we have availability
+	// otherwise, we have availability if the party fits in the room
+	for _, room := range testRooms {
+		if room.ID == roomID {
+			return room.Fits(adults, children), nil
+		}
+	}
 	return true, nil
 }
 
-// SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	var rooms []models.Room
+// SearchAvailabilityForAllRooms returns a page of available rooms, if any, for given date range
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, search models.AvailabilityQuery) ([]models.AvailableRoom, int, error) {
+	var rooms []models.AvailableRoom
 
 	// if the start date is after 2049-12-31, then return empty slice,
 	// indicating no rooms are available;
@@ -77,93 +93,861 @@ func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]mode
 		log.Println(err)
 	}
 
-	if start == testDateToFail {
-		return rooms, errors.New("some error")
+	if search.StartDate == testDateToFail {
+		return rooms, 0, errors.New("some error")
 	}
 
-	if start.After(t) {
-		return rooms, nil
+	if search.StartDate.After(t) {
+		return rooms, 0, nil
 	}
 
-	// otherwise, put an entry into the slice, indicating that some room is
-	// available for search dates
-	room := models.Room{
-		ID: 1,
+	// otherwise, every test room that fits the party is available
+	for _, room := range testRooms {
+		if room.Fits(search.Adults, search.Children) {
+			rooms = append(rooms, models.AvailableRoom{
+				Room:      room,
+				Nights:    search.Nights(),
+				StayPrice: room.Price * search.Nights(),
+			})
+		}
 	}
-	rooms = append(rooms, room)
 
-	return rooms, nil
+	total := len(rooms)
+	if search.Offset() >= total {
+		return nil, total, nil
+	}
+	rooms = rooms[search.Offset():]
+	if search.PerPage > 0 && len(rooms) > search.PerPage {
+		rooms = rooms[:search.PerPage]
+	}
+
+	return rooms, total, nil
 }
 
-// GetRoomByID gets a room by id
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+// GetRoomByID returns one of the test rooms, sql.ErrNoRows for room 50 and fails for any other id above 2
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
 	var room models.Room
+	if id == 50 {
+		return room, sql.ErrNoRows
+	}
 	if id > 2 {
 		return room, errors.New("some error")
 	}
+	for _, r := range testRooms {
+		if r.ID == id {
+			return r, nil
+		}
+	}
 	return room, nil
 }
 
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
 	var user models.User
 
 	return user, nil
 }
 
-func (m *testDBRepo) UpdateUser(user models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, user models.User) error {
 	return nil
 }
 
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
 	if email == "me@here.ca" {
 		return 1, "", nil
 	}
 	return 0, "", errors.New("invalid credentials")
 }
 
-func (m *testDBRepo) GetAllReservations() ([]models.Reservation, error) {
-	var res []models.Reservation
+// SearchReservations returns a page of the test reservations matching the search, in id order, and fails
+// when searching for "fail" or for stays from 2060
+func (m *testDBRepo) SearchReservations(ctx context.Context, search models.ReservationQuery) ([]models.Reservation, int, error) {
+	reservations, err := searchTestReservations(search)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(reservations)
+	if search.Offset() >= total {
+		return nil, total, nil
+	}
+	reservations = reservations[search.Offset():]
+	if len(reservations) > search.PerPage {
+		reservations = reservations[:search.PerPage]
+	}
+
+	return reservations, total, nil
+}
+
+// EachReservation calls fn with every test reservation matching the search, in id order, and fails when
+// searching for "fail" or for stays from 2060
+func (m *testDBRepo) EachReservation(ctx context.Context, search models.ReservationQuery, fn func(models.Reservation) error) error {
+	reservations, err := searchTestReservations(search)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range reservations {
+		err := fn(res)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// searchTestReservations returns the test reservations matching the search, in id order
+func searchTestReservations(search models.ReservationQuery) ([]models.Reservation, error) {
+	if search.Search == "fail" || search.From.Year() == 2060 {
+		return nil, errors.New("some error")
+	}
+
+	var reservations []models.Reservation
+	for id := 1; id <= len(testReservations)+2; id++ {
+		res, ok := testReservations[id]
+		if !ok ||
+			search.Search != "" && !strings.Contains(strings.ToLower(res.FirstName+" "+res.LastName+" "+res.Email), strings.ToLower(search.Search)) ||
+			search.RoomID != 0 && res.RoomID != search.RoomID ||
+			search.GuestID != 0 && res.GuestID != search.GuestID ||
+			!search.From.IsZero() && !res.EndDate.After(search.From) ||
+			!search.To.IsZero() && res.StartDate.After(search.To) ||
+			search.Status != "" && res.Status != search.Status ||
+			search.NewOnly && res.Processed != 0 {
+			continue
+		}
+		reservations = append(reservations, res)
+	}
+
+	return reservations, nil
+}
+
+// ImportReservations fails for a row with the email fail@example.com, and finds the room of a row with the
+// email taken@example.com booked in the meantime
+func (m *testDBRepo) ImportReservations(ctx context.Context, rows []models.ImportRow) error {
+	for _, row := range rows {
+		switch row.Reservation.Email {
+		case "fail@example.com":
+			return &ImportRowError{Line: row.Line, Err: errors.New("some error")}
+		case "taken@example.com":
+			return &ImportRowError{Line: row.Line, Err: ErrRoomUnavailable}
+		}
+	}
+	return nil
+}
+
+// GetOccupancy returns the two test rooms booked for 3 of the nights of the period
+func (m *testDBRepo) GetOccupancy(ctx context.Context, start, end time.Time) (models.Occupancy, error) {
+	nights := int(end.Sub(start).Hours() / 24)
+	return models.Occupancy{BookedNights: 3, AvailableNights: 2 * nights}, nil
+}
 
-	return res, nil
+// GetRevenueBooked returns 240.00 for any period
+func (m *testDBRepo) GetRevenueBooked(ctx context.Context, start, end time.Time) (int, error) {
+	return 24000, nil
 }
 
-func (m *testDBRepo) GetAllNewReservations() ([]models.Reservation, error) {
-	var res []models.Reservation
+// GetBookingsPerDay returns a booking on every other day of the period
+func (m *testDBRepo) GetBookingsPerDay(ctx context.Context, start, end time.Time) ([]models.DailyCount, error) {
+	var counts []models.DailyCount
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		counts = append(counts, models.DailyCount{Day: d, Count: len(counts) % 2})
+	}
+	return counts, nil
+}
 
-	return res, nil
+// testReservations are the reservations known to the test repository. Reservation 3 is a paid stay in
+// room 1, reservation 4 was already cancelled after being invoiced, and cancelling or invoicing
+// reservation 5 fails.
+var testReservations = map[int]models.Reservation{
+	3: testReservation(3, models.ReservationConfirmed),
+	4: testReservation(4, models.ReservationCancelled),
+	5: testReservation(5, models.ReservationConfirmed),
 }
 
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	var res models.Reservation
-	return res, nil
+func testReservation(id int, status string) models.Reservation {
+	return models.Reservation{
+		ID:          id,
+		FirstName:   "John",
+		LastName:    "Smith",
+		Email:       "john@smith.com",
+		StartDate:   time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2040, 1, 13, 0, 0, 0, 0, time.UTC),
+		RoomID:      1,
+		Room:        models.Room{ID: 1, RoomName: "General's Quarters"},
+		Adults:      2,
+		Status:      status,
+		Total:       36000,
+		CancelToken: fmt.Sprintf("token-%d", id),
+		GuestID:     1,
+	}
 }
 
-func (m *testDBRepo) UpdateReservation(reservation models.Reservation) error {
+// GetReservationByID returns one of the test reservations, or an empty reservation for any other id
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	return testReservations[id], nil
+}
+
+func (m *testDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
 	return nil
 }
 
-func (m *testDBRepo) DeleteReservation(id int) error {
+// DeleteReservation fails for reservation 5
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if id == 5 {
+		return errors.New("some error")
+	}
 	return nil
 }
 
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
 	return nil
 }
 
-func (m *testDBRepo) GetAllRooms() ([]models.Room, error) {
-	var rooms []models.Room
-	return rooms, nil
+// GetAllRooms returns the test rooms
+func (m *testDBRepo) GetAllRooms(ctx context.Context) ([]models.Room, error) {
+	return testRooms, nil
 }
 
-func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+// GetRestrictionsForRoomByDate returns a reservation from 2040-01-10 to 2040-01-13 for room 2 when the dates
+// overlap it, and nothing for other rooms
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
 	var restrictions []models.RoomRestriction
+
+	restriction := models.RoomRestriction{
+		ID:            1,
+		RoomID:        2,
+		ReservationID: 1,
+		StartDate:     time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2040, 1, 13, 0, 0, 0, 0, time.UTC),
+	}
+	if roomID == 2 && !start.After(restriction.EndDate) && !end.Before(restriction.StartDate) {
+		restrictions = append(restrictions, restriction)
+	}
+
 	return restrictions, nil
 }
 
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	return nil
+}
+
+// testRooms are the rooms known to the test repository. Room 1 takes a 30% deposit, room 2 the full price.
+var testRooms = []models.Room{
+	{
+		ID: 1, RoomName: "General's Quarters", Slug: "generals-quarters", Capacity: 2, MaxOccupancy: 3, Price: 12000, Active: true,
+		PaymentPolicy: models.PaymentDeposit, DepositPercent: 30, CancellationPolicyID: 1,
+		Photos: []models.RoomPhoto{
+			{ID: 1, RoomID: 1, URL: "/uploads/rooms/1/a/large.jpg", StorageKey: "rooms/1/a", AltText: "Bedroom"},
+		},
+	},
+	{ID: 2, RoomName: "Major's Suite", Slug: "majors-suite", Capacity: 2, MaxOccupancy: 4, Price: 15000, Active: true},
+}
+
+func (m *testDBRepo) GetActiveRooms(ctx context.Context) ([]models.Room, error) {
+	return testRooms, nil
+}
+
+// GetRoomBySlug returns one of the test rooms, or an error for any other slug
+func (m *testDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	for _, room := range testRooms {
+		if room.Slug == slug {
+			return room, nil
+		}
+	}
+	return models.Room{}, errors.New("some error")
+}
+
+// InsertRoom fails for a room named "fail"
+func (m *testDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	if room.RoomName == "fail" {
+		return 0, errors.New("some error")
+	}
+	for _, r := range testRooms {
+		if r.Slug == room.Slug {
+			return 0, ErrRoomSlugExists
+		}
+	}
+	return 3, nil
+}
+
+// UpdateRoom fails for a room named "fail" and refuses the slug of another test room
+func (m *testDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	if room.RoomName == "fail" {
+		return errors.New("some error")
+	}
+	for _, r := range testRooms {
+		if r.Slug == room.Slug && r.ID != room.ID {
+			return ErrRoomSlugExists
+		}
+	}
 	return nil
 }
 
-func (m *testDBRepo) DeleteBlockByID(id int) error {
+// DeleteRoom refuses to delete room 2, which is treated as booked
+func (m *testDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	if id == 2 {
+		return ErrRoomHasReservations
+	}
+	return nil
+}
+
+// InsertRoomPhoto fails for photos of room 2
+func (m *testDBRepo) InsertRoomPhoto(ctx context.Context, photo models.RoomPhoto) (int, error) {
+	if photo.RoomID == 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) UpdateRoomPhoto(ctx context.Context, photo models.RoomPhoto) error {
+	return nil
+}
+
+func (m *testDBRepo) DeleteRoomPhoto(ctx context.Context, id int) error {
+	return nil
+}
+
+// testBookingRules are the booking rules known to the test repository. Room 1 has a winter season in 2045
+// with a three night minimum and no arrivals on Sundays.
+var testBookingRules = []models.BookingRule{
+	{ID: 1, Name: "Standard", MinNights: 1, MaxNights: 30},
+	{
+		ID:              2,
+		RoomID:          1,
+		Name:            "Winter",
+		SeasonStart:     time.Date(2045, 1, 1, 0, 0, 0, 0, time.UTC),
+		SeasonEnd:       time.Date(2045, 3, 31, 0, 0, 0, 0, time.UTC),
+		MinNights:       3,
+		ClosedToArrival: []time.Weekday{time.Sunday},
+	},
+}
+
+func (m *testDBRepo) AllBookingRules(ctx context.Context) ([]models.BookingRule, error) {
+	return testBookingRules, nil
+}
+
+func (m *testDBRepo) GetBookingRulesForRoom(ctx context.Context, roomID int) ([]models.BookingRule, error) {
+	if roomID == 99 {
+		return nil, errors.New("some error")
+	}
+
+	var bookingRules []models.BookingRule
+	for _, rule := range testBookingRules {
+		if rule.RoomID == 0 || rule.RoomID == roomID {
+			bookingRules = append(bookingRules, rule)
+		}
+	}
+	return bookingRules, nil
+}
+
+func (m *testDBRepo) GetBookingRuleByID(ctx context.Context, id int) (models.BookingRule, error) {
+	for _, rule := range testBookingRules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+	return models.BookingRule{}, errors.New("booking rule not found")
+}
+
+// InsertBookingRule fails for rules named "fail"
+func (m *testDBRepo) InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error) {
+	if rule.Name == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 3, nil
+}
+
+func (m *testDBRepo) UpdateBookingRule(ctx context.Context, rule models.BookingRule) error {
+	if rule.Name == "fail" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteBookingRule(ctx context.Context, id int) error {
+	return nil
+}
+
+// testExchangeRates are the exchange rates known to the test repository, from US dollars
+var testExchangeRates = []models.ExchangeRate{
+	{ID: 1, Currency: "BRL", Rate: 5},
+	{ID: 2, Currency: "EUR", Rate: 0.9},
+}
+
+func (m *testDBRepo) AllExchangeRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	return testExchangeRates, nil
+}
+
+// SaveExchangeRate fails for Swiss francs
+func (m *testDBRepo) SaveExchangeRate(ctx context.Context, rate models.ExchangeRate) error {
+	if rate.Currency == "CHF" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteExchangeRate(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *testDBRepo) InsertPayment(ctx context.Context, payment models.Payment) (int, error) {
+	return 1, nil
+}
+
+// GetPaymentsForReservation returns a pending payment for reservation 1, the paid deposits of reservations
+// 3 and 5, the deposit paid for reservation 4 after it was cancelled, and nothing for other reservations
+func (m *testDBRepo) GetPaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	var payments []models.Payment
+
+	if reservationID == 1 {
+		payments = append(payments, models.Payment{
+			ID:            1,
+			ReservationID: 1,
+			Gateway:       "fake",
+			CheckoutID:    "cs_fake_1",
+			CheckoutURL:   "/fake-gateway/checkout/cs_fake_1",
+			Kind:          models.PaymentDeposit,
+			Amount:        7200,
+			Currency:      "USD",
+			Status:        models.PaymentPending,
+		})
+	}
+
+	if reservationID == 4 {
+		payments = append(payments, models.Payment{
+			ID:            4,
+			ReservationID: 4,
+			Gateway:       "fake",
+			CheckoutID:    "cs_late_4",
+			Kind:          models.PaymentDeposit,
+			Amount:        10800,
+			Currency:      "USD",
+			Status:        models.PaymentSucceeded,
+		})
+	}
+
+	if reservationID == 3 || reservationID == 5 {
+		payments = append(payments, models.Payment{
+			ID:            reservationID,
+			ReservationID: reservationID,
+			Gateway:       "fake",
+			CheckoutID:    fmt.Sprintf("cs_fake_%d", reservationID),
+			Kind:          models.PaymentDeposit,
+			Amount:        10800,
+			Currency:      "USD",
+			Status:        models.PaymentSucceeded,
+		})
+	}
+
+	return payments, nil
+}
+
+// ApplyPaymentEvent fails for the checkout "fail", ignores the event "duplicate" as already applied,
+// returns a PaidTooLateError for reservation 4, which was cancelled, for the checkouts starting with
+// "cs_late", and confirms reservation 1 for other successful payments
+func (m *testDBRepo) ApplyPaymentEvent(ctx context.Context, event models.PaymentEvent) (int, error) {
+	if event.CheckoutID == "fail" {
+		return 0, errors.New("some error")
+	}
+	if event.ID == "duplicate" || event.Status != models.PaymentSucceeded {
+		return 0, nil
+	}
+	if strings.HasPrefix(event.CheckoutID, "cs_late") {
+		return 0, &PaidTooLateError{ReservationID: 4, Status: models.ReservationCancelled}
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) ExpirePendingReservations(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+// GetReservationByCancelToken returns the test reservation a token was made for. The token token-arriving-today
+// is for a confirmed stay arriving today and token-stayed for one that already checked out.
+func (m *testDBRepo) GetReservationByCancelToken(ctx context.Context, token string) (models.Reservation, error) {
+	switch token {
+	case "token-arriving-today":
+		res := testReservation(6, models.ReservationConfirmed)
+		res.StartDate = dates.Day(time.Now())
+		res.EndDate = res.StartDate.AddDate(0, 0, 3)
+		res.CancelToken = token
+		return res, nil
+	case "token-stayed":
+		res := testReservation(7, models.ReservationConfirmed)
+		res.StartDate = time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+		res.EndDate = time.Date(2020, 1, 13, 0, 0, 0, 0, time.UTC)
+		res.CancelToken = token
+		return res, nil
+	}
+
+	for _, res := range testReservations {
+		if res.CancelToken == token {
+			return res, nil
+		}
+	}
+	return models.Reservation{}, sql.ErrNoRows
+}
+
+// CancelReservation refuses reservations that are no longer cancellable and fails for reservation 5
+func (m *testDBRepo) CancelReservation(ctx context.Context, id int) error {
+	if id == 5 {
+		return errors.New("some error")
+	}
+	if res, ok := testReservations[id]; ok && !res.Cancellable() {
+		return ErrNotCancellable
+	}
+	return nil
+}
+
+// testCancellationPolicies are the cancellation policies known to the test repository; room 1 follows the first
+var testCancellationPolicies = []models.CancellationPolicy{
+	{ID: 1, Name: "Flexible", FreeDays: 7, PenaltyPercent: 50},
+	{ID: 2, Name: "Non-refundable", NonRefundable: true},
+}
+
+func (m *testDBRepo) AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error) {
+	return testCancellationPolicies, nil
+}
+
+// GetCancellationPolicyByID returns one of the test policies, or an error for any other id
+func (m *testDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	for _, policy := range testCancellationPolicies {
+		if policy.ID == id {
+			return policy, nil
+		}
+	}
+	return models.CancellationPolicy{}, errors.New("some error")
+}
+
+// InsertCancellationPolicy fails for a policy named "fail"
+func (m *testDBRepo) InsertCancellationPolicy(ctx context.Context, policy models.CancellationPolicy) (int, error) {
+	if policy.Name == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 3, nil
+}
+
+// UpdateCancellationPolicy fails for a policy named "fail"
+func (m *testDBRepo) UpdateCancellationPolicy(ctx context.Context, policy models.CancellationPolicy) error {
+	if policy.Name == "fail" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteCancellationPolicy(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *testDBRepo) InsertRefund(ctx context.Context, refund models.Refund) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) GetRefundsForReservation(ctx context.Context, reservationID int) ([]models.Refund, error) {
+	return nil, nil
+}
+
+// IssueInvoice issues invoice 42, failing for reservation 5
+func (m *testDBRepo) IssueInvoice(ctx context.Context, invoice models.Invoice) (models.Invoice, error) {
+	if invoice.ReservationID == 5 {
+		return models.Invoice{}, errors.New("can't issue invoice")
+	}
+
+	invoice.ID = 1
+	invoice.Number = 42
+	invoice.IssuedAt = time.Now()
+	return invoice, nil
+}
+
+// GetInvoiceForReservation returns the invoice of reservation 4, and sql.ErrNoRows for any other
+func (m *testDBRepo) GetInvoiceForReservation(ctx context.Context, reservationID int) (models.Invoice, error) {
+	if reservationID != 4 {
+		return models.Invoice{}, sql.ErrNoRows
+	}
+
+	return models.Invoice{
+		ID:            2,
+		Number:        41,
+		ReservationID: 4,
+		IssuedAt:      time.Date(2039, 12, 1, 0, 0, 0, 0, time.UTC),
+		Name:          "John Smith",
+		Email:         "john@smith.com",
+		Currency:      "USD",
+		Total:         36000,
+	}, nil
+}
+
+// testPromoCodes are the promo codes known to the test repository. SUMMER10 takes 10% off any room, FREE
+// takes off the whole price, SUITE is only for room 2, OLD was deactivated and FULL was used up. Booking with
+// GONE fails as if it was used up in the meantime, and booking with ONCE as if the guest already used it.
+var testPromoCodes = []models.PromoCode{
+	{ID: 1, Code: "SUMMER10", Kind: models.PromoPercent, Amount: 10, MinNights: 1, Uses: 1, Active: true, Discounted: 3600},
+	{ID: 2, Code: "FREE", Kind: models.PromoPercent, Amount: 100, MinNights: 1, Active: true},
+	{ID: 3, Code: "SUITE", Kind: models.PromoFixed, Amount: 5000, MinNights: 1, RoomIDs: []int{2}, Active: true},
+	{ID: 4, Code: "OLD", Kind: models.PromoPercent, Amount: 20, MinNights: 1},
+	{ID: 5, Code: "FULL", Kind: models.PromoFixed, Amount: 1000, MinNights: 1, MaxUses: 2, Uses: 2, Active: true},
+	{ID: 6, Code: "GONE", Kind: models.PromoFixed, Amount: 1000, MinNights: 1, MaxUses: 1, Active: true},
+	{ID: 7, Code: "ONCE", Kind: models.PromoFixed, Amount: 1000, MinNights: 1, OncePerEmail: true, Active: true},
+}
+
+func (m *testDBRepo) AllPromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	return testPromoCodes, nil
+}
+
+func (m *testDBRepo) GetPromoCodeByID(ctx context.Context, id int) (models.PromoCode, error) {
+	for _, code := range testPromoCodes {
+		if code.ID == id {
+			return code, nil
+		}
+	}
+	return models.PromoCode{}, errors.New("promo code not found")
+}
+
+func (m *testDBRepo) GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error) {
+	for _, c := range testPromoCodes {
+		if c.Code == code {
+			return c, nil
+		}
+	}
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+// InsertPromoCode fails for the code FAIL and refuses the code of another promo code
+func (m *testDBRepo) InsertPromoCode(ctx context.Context, code models.PromoCode) (int, error) {
+	switch code.Code {
+	case "FAIL":
+		return 0, errors.New("some error")
+	case "SUMMER10":
+		return 0, ErrPromoCodeExists
+	}
+	return 8, nil
+}
+
+func (m *testDBRepo) UpdatePromoCode(ctx context.Context, code models.PromoCode) error {
+	switch code.Code {
+	case "FAIL":
+		return errors.New("some error")
+	case "FREE":
+		if code.ID != 2 {
+			return ErrPromoCodeExists
+		}
+	}
+	return nil
+}
+
+// DeletePromoCode refuses to delete promo code 1, which was redeemed
+func (m *testDBRepo) DeletePromoCode(ctx context.Context, id int) error {
+	if id == 1 {
+		return ErrPromoCodeRedeemed
+	}
+	return nil
+}
+
+// GetRedemptionsForPromoCode returns reservation 3 for promo code 1, and nothing for other codes
+func (m *testDBRepo) GetRedemptionsForPromoCode(ctx context.Context, promoCodeID int) ([]models.PromoRedemption, error) {
+	if promoCodeID != 1 {
+		return nil, nil
+	}
+
+	reservation := testReservations[3]
+	reservation.PromoCode, reservation.Discount = "SUMMER10", 3600
+
+	return []models.PromoRedemption{
+		{ID: 1, PromoCodeID: 1, ReservationID: reservation.ID, Reservation: reservation},
+	}, nil
+}
+
+// InsertHold fails for room 1000, returns ErrRoomUnavailable when the dates overlap the test reservations of
+// room 1, from 2040-01-10 to 2040-01-13, and holds other rooms and dates as hold 1
+func (m *testDBRepo) InsertHold(ctx context.Context, hold models.RoomRestriction) (int, error) {
+	if hold.RoomID == 1000 {
+		return 0, errors.New("some error")
+	}
+	booked := testReservations[3]
+	if hold.RoomID == booked.RoomID && hold.StartDate.Before(booked.EndDate) && hold.EndDate.After(booked.StartDate) {
+		return 0, ErrRoomUnavailable
+	}
+	return 1, nil
+}
+
+// ConvertHold returns ErrHoldExpired for hold 2 and fails for hold 3
+func (m *testDBRepo) ConvertHold(ctx context.Context, id, reservationID int) error {
+	switch id {
+	case 2:
+		return ErrHoldExpired
+	case 3:
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) DeleteHold(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *testDBRepo) ExpireHolds(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+// InsertWaitlistEntry fails for the email fail@example.com
+func (m *testDBRepo) InsertWaitlistEntry(ctx context.Context, entry models.WaitlistEntry) (int, error) {
+	if entry.Email == "fail@example.com" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// GetWaitingEntriesForRoom fails for room 2. For room 1 it returns, in order, a guest waiting for dates that
+// overlap the test reservations, a guest waiting for any room from 2040-01-20 to 2040-01-22, and a party too
+// large for the room.
+func (m *testDBRepo) GetWaitingEntriesForRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	if roomID == 2 {
+		return nil, errors.New("some error")
+	}
+	if roomID != 1 {
+		return nil, nil
+	}
+
+	entry := func(id, roomID, day, adults int) models.WaitlistEntry {
+		return models.WaitlistEntry{
+			ID: id, FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", RoomID: roomID, Adults: adults,
+			StartDate: time.Date(2040, 1, day, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2040, 1, day+2, 0, 0, 0, 0, time.UTC),
+			Status:    models.WaitlistWaiting,
+		}
+	}
+
+	return []models.WaitlistEntry{entry(1, 1, 11, 1), entry(2, 0, 20, 2), entry(3, 1, 20, 4)}, nil
+}
+
+// GetWaitlistEntryByToken returns an entry offered room 1 for the token "offered", an expired offer for the
+// token "expired", and sql.ErrNoRows for other tokens
+func (m *testDBRepo) GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error) {
+	entry := models.WaitlistEntry{
+		ID: 1, FirstName: "Jane", LastName: "Doe", Email: "jane@doe.com", Adults: 1, Token: token,
+		StartDate:     time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Status:        models.WaitlistOffered,
+		OfferedRoomID: 1,
+		HoldID:        1,
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}
+
+	switch token {
+	case "offered":
+		return entry, nil
+	case "expired":
+		entry.Status = models.WaitlistExpired
+		return entry, nil
+	}
+	return models.WaitlistEntry{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) OfferWaitlistEntry(ctx context.Context, entry models.WaitlistEntry) error {
+	return nil
+}
+
+func (m *testDBRepo) BookWaitlistOffer(ctx context.Context, holdID int) error {
+	return nil
+}
+
+// ExpireWaitlistOffers returns an offer of room 1 from 2040-01-20 to 2040-01-22 that expired
+func (m *testDBRepo) ExpireWaitlistOffers(ctx context.Context, now time.Time) ([]models.WaitlistEntry, error) {
+	return []models.WaitlistEntry{{
+		ID: 4, FirstName: "John", Email: "john@smith.com", Adults: 1,
+		StartDate:     time.Date(2040, 1, 20, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2040, 1, 22, 0, 0, 0, 0, time.UTC),
+		Status:        models.WaitlistExpired,
+		OfferedRoomID: 1,
+		HoldID:        4,
+	}}, nil
+}
+
+// testGuests are John Smith, a VIP, a duplicate of him booked with another email, and a guest already merged
+// into him
+var testGuests = []models.Guest{
+	{
+		ID: 1, Email: "john@smith.com", FirstName: "John", LastName: "Smith", Phone: "555-555-5555",
+		Notes: "Likes a quiet room", Tags: []string{models.GuestVIP}, Stays: 2, Spend: 36000,
+		LastStay: time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC),
+	},
+	{ID: 2, Email: "j.smith@example.com", FirstName: "John", LastName: "Smith", Phone: "(555) 555 5555"},
+	{ID: 3, Email: "johnny@smith.com", FirstName: "Johnny", LastName: "Smith", MergedIntoID: 1},
+}
+
+// SearchGuests returns the test guests that weren't merged whose name or email matches the search, and
+// fails when searching for "fail"
+func (m *testDBRepo) SearchGuests(ctx context.Context, search models.GuestQuery) ([]models.Guest, int, error) {
+	if search.Search == "fail" {
+		return nil, 0, errors.New("some error")
+	}
+
+	var guests []models.Guest
+	for _, guest := range testGuests {
+		if guest.MergedIntoID != 0 ||
+			search.Search != "" && !strings.Contains(strings.ToLower(guest.FirstName+" "+guest.LastName+" "+guest.Email), strings.ToLower(search.Search)) ||
+			search.Tag != "" && !guest.HasTag(search.Tag) {
+			continue
+		}
+		guests = append(guests, guest)
+	}
+
+	total := len(guests)
+	if search.Offset() >= total {
+		return nil, total, nil
+	}
+	guests = guests[search.Offset():]
+	if len(guests) > search.PerPage {
+		guests = guests[:search.PerPage]
+	}
+
+	return guests, total, nil
+}
+
+// GetGuestByID returns one of the test guests, fails for guest 99 and returns sql.ErrNoRows for any other id
+func (m *testDBRepo) GetGuestByID(ctx context.Context, id int) (models.Guest, error) {
+	if id == 99 {
+		return models.Guest{}, errors.New("some error")
+	}
+	for _, guest := range testGuests {
+		if guest.ID == id {
+			return guest, nil
+		}
+	}
+	return models.Guest{}, sql.ErrNoRows
+}
+
+// UpdateGuest fails for a guest with the notes "fail"
+func (m *testDBRepo) UpdateGuest(ctx context.Context, guest models.Guest) error {
+	if guest.Notes == "fail" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetDuplicateGuests returns the other test guests with the same name that weren't merged
+func (m *testDBRepo) GetDuplicateGuests(ctx context.Context, guest models.Guest) ([]models.Guest, error) {
+	var guests []models.Guest
+	for _, g := range testGuests {
+		if g.ID != guest.ID && g.MergedIntoID == 0 && g.FirstName == guest.FirstName && g.LastName == guest.LastName {
+			guests = append(guests, g)
+		}
+	}
+	return guests, nil
+}
+
+// MergeGuests merges guests 1 and 2 into each other, fails when merging guest 99 and returns ErrGuestMerged
+// for any other guests
+func (m *testDBRepo) MergeGuests(ctx context.Context, keepID, duplicateID int) error {
+	if keepID == 99 || duplicateID == 99 {
+		return errors.New("some error")
+	}
+	if keepID == duplicateID || keepID > 2 || duplicateID > 2 {
+		return ErrGuestMerged
+	}
 	return nil
 }
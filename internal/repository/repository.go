@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"time"
 
 	"github.com/crislainesc/bookings/internal/models"
@@ -8,22 +9,86 @@ import (
 
 type DatabaseRepo interface {
 	AllUsers() bool
-	InsertReservation(reservation models.Reservation) (int, error)
-	InsertRoomRestriction(restriction models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(roomID int) (models.Room, error)
-	GetUserByID(userID int) (models.User, error)
-	UpdateUser(user models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-	GetAllReservations() ([]models.Reservation, error)
-	GetAllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(reservation models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-	GetAllRooms() ([]models.Room, error)
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
-	DeleteBlockByID(id int) error
+	InsertReservation(ctx context.Context, reservation models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, restriction models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID, adults, children int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, search models.AvailabilityQuery) ([]models.AvailableRoom, int, error)
+	GetRoomByID(ctx context.Context, roomID int) (models.Room, error)
+	GetUserByID(ctx context.Context, userID int) (models.User, error)
+	UpdateUser(ctx context.Context, user models.User) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	SearchReservations(ctx context.Context, search models.ReservationQuery) ([]models.Reservation, int, error)
+	EachReservation(ctx context.Context, search models.ReservationQuery, fn func(models.Reservation) error) error
+	ImportReservations(ctx context.Context, rows []models.ImportRow) error
+	GetOccupancy(ctx context.Context, start, end time.Time) (models.Occupancy, error)
+	GetRevenueBooked(ctx context.Context, start, end time.Time) (int, error)
+	GetBookingsPerDay(ctx context.Context, start, end time.Time) ([]models.DailyCount, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, reservation models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+	GetAllRooms(ctx context.Context) ([]models.Room, error)
+	GetActiveRooms(ctx context.Context) ([]models.Room, error)
+	GetRoomBySlug(ctx context.Context, slug string) (models.Room, error)
+	InsertRoom(ctx context.Context, room models.Room) (int, error)
+	UpdateRoom(ctx context.Context, room models.Room) error
+	DeleteRoom(ctx context.Context, id int) error
+	InsertRoomPhoto(ctx context.Context, photo models.RoomPhoto) (int, error)
+	UpdateRoomPhoto(ctx context.Context, photo models.RoomPhoto) error
+	DeleteRoomPhoto(ctx context.Context, id int) error
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+	AllBookingRules(ctx context.Context) ([]models.BookingRule, error)
+	GetBookingRulesForRoom(ctx context.Context, roomID int) ([]models.BookingRule, error)
+	GetBookingRuleByID(ctx context.Context, id int) (models.BookingRule, error)
+	InsertBookingRule(ctx context.Context, rule models.BookingRule) (int, error)
+	UpdateBookingRule(ctx context.Context, rule models.BookingRule) error
+	DeleteBookingRule(ctx context.Context, id int) error
+	AllExchangeRates(ctx context.Context) ([]models.ExchangeRate, error)
+	SaveExchangeRate(ctx context.Context, rate models.ExchangeRate) error
+	DeleteExchangeRate(ctx context.Context, id int) error
+	InsertPayment(ctx context.Context, payment models.Payment) (int, error)
+	GetPaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error)
+	ApplyPaymentEvent(ctx context.Context, event models.PaymentEvent) (int, error)
+	ExpirePendingReservations(ctx context.Context, now time.Time) (int, error)
+	GetReservationByCancelToken(ctx context.Context, token string) (models.Reservation, error)
+	CancelReservation(ctx context.Context, id int) error
+	AllCancellationPolicies(ctx context.Context) ([]models.CancellationPolicy, error)
+	GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error)
+	InsertCancellationPolicy(ctx context.Context, policy models.CancellationPolicy) (int, error)
+	UpdateCancellationPolicy(ctx context.Context, policy models.CancellationPolicy) error
+	DeleteCancellationPolicy(ctx context.Context, id int) error
+	InsertRefund(ctx context.Context, refund models.Refund) (int, error)
+	GetRefundsForReservation(ctx context.Context, reservationID int) ([]models.Refund, error)
+	IssueInvoice(ctx context.Context, invoice models.Invoice) (models.Invoice, error)
+	GetInvoiceForReservation(ctx context.Context, reservationID int) (models.Invoice, error)
+	AllPromoCodes(ctx context.Context) ([]models.PromoCode, error)
+	GetPromoCodeByID(ctx context.Context, id int) (models.PromoCode, error)
+	GetPromoCodeByCode(ctx context.Context, code string) (models.PromoCode, error)
+	InsertPromoCode(ctx context.Context, code models.PromoCode) (int, error)
+	UpdatePromoCode(ctx context.Context, code models.PromoCode) error
+	DeletePromoCode(ctx context.Context, id int) error
+	GetRedemptionsForPromoCode(ctx context.Context, promoCodeID int) ([]models.PromoRedemption, error)
+	InsertHold(ctx context.Context, hold models.RoomRestriction) (int, error)
+	ConvertHold(ctx context.Context, id, reservationID int) error
+	DeleteHold(ctx context.Context, id int) error
+	ExpireHolds(ctx context.Context, now time.Time) (int, error)
+	InsertWaitlistEntry(ctx context.Context, entry models.WaitlistEntry) (int, error)
+	GetWaitingEntriesForRoom(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error)
+	GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error)
+	OfferWaitlistEntry(ctx context.Context, entry models.WaitlistEntry) error
+	BookWaitlistOffer(ctx context.Context, holdID int) error
+	ExpireWaitlistOffers(ctx context.Context, now time.Time) ([]models.WaitlistEntry, error)
+	SearchGuests(ctx context.Context, search models.GuestQuery) ([]models.Guest, int, error)
+	GetGuestByID(ctx context.Context, id int) (models.Guest, error)
+	UpdateGuest(ctx context.Context, guest models.Guest) error
+	GetDuplicateGuests(ctx context.Context, guest models.Guest) ([]models.Guest, error)
+	MergeGuests(ctx context.Context, keepID, duplicateID int) error
+}
+
+// QueryHook is notified around every statement the repository sends to the database
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, query string, args []interface{}) context.Context
+	AfterQuery(ctx context.Context, query string, elapsed time.Duration, err error)
 }
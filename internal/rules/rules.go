@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/dates"
+	"github.com/crislainesc/bookings/internal/i18n"
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+// Default applies to stays no configured rule covers
+var Default = models.BookingRule{Name: "Default", MinNights: 1}
+
+// Violation is a broken rule, reported against the form field it concerns
+type Violation struct {
+	Field   string
+	Message i18n.Message
+}
+
+// ForStay returns the rule that applies to an arrival in a room. Room rules take precedence over
+// rules for every room, and seasonal rules over year-round ones.
+func ForStay(rules []models.BookingRule, roomID int, arrival time.Time) models.BookingRule {
+	best, bestScore := Default, -1
+
+	for _, rule := range rules {
+		if rule.RoomID != 0 && rule.RoomID != roomID {
+			continue
+		}
+		if rule.Seasonal() && (dates.Day(arrival).Before(dates.Day(rule.SeasonStart)) || dates.Day(arrival).After(dates.Day(rule.SeasonEnd))) {
+			continue
+		}
+
+		score := 0
+		if rule.RoomID != 0 {
+			score += 2
+		}
+		if rule.Seasonal() {
+			score++
+		}
+
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+
+	return best
+}
+
+// Check returns the ways a stay from start to end, booked at now, breaks the rule.
+// A stay must always last at least one night and can't start in the past.
+func Check(rule models.BookingRule, start, end, now time.Time) []Violation {
+	var violations []Violation
+
+	start, end, today := dates.Day(start), dates.Day(end), dates.Day(now)
+	nights := dates.Between(start, end)
+
+	if nights < 1 {
+		return append(violations, violation("end_date", "rules.departure_after_arrival"))
+	}
+
+	if start.Before(today) {
+		return append(violations, violation("start_date", "rules.arrival_in_past"))
+	}
+
+	if rule.MinNights > 1 && nights < rule.MinNights {
+		violations = append(violations, violation("end_date", "rules.min_nights", rule.MinNights))
+	}
+
+	if rule.MaxNights > 0 && nights > rule.MaxNights {
+		violations = append(violations, violation("end_date", "rules.max_nights", rule.MaxNights))
+	}
+
+	lead := dates.Between(today, start)
+	if lead < rule.MinLeadDays {
+		violations = append(violations, violation("start_date", "rules.min_lead", rule.MinLeadDays))
+	}
+
+	if rule.MaxHorizonDays > 0 && lead > rule.MaxHorizonDays {
+		violations = append(violations, violation("start_date", "rules.horizon", rule.MaxHorizonDays))
+	}
+
+	if contains(rule.ClosedToArrival, start.Weekday()) {
+		violations = append(violations, violation("start_date", "rules.closed_to_arrival", weekdays(start.Weekday())))
+	}
+
+	if contains(rule.ClosedToDeparture, end.Weekday()) {
+		violations = append(violations, violation("end_date", "rules.closed_to_departure", weekdays(end.Weekday())))
+	}
+
+	return violations
+}
+
+// FormatWeekdays turns weekdays into the comma separated numbers they are stored as
+func FormatWeekdays(days []time.Weekday) string {
+	var parts []string
+	for _, d := range days {
+		parts = append(parts, fmt.Sprint(int(d)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseWeekdays reads weekdays stored as comma separated numbers, Sunday being 0, ignoring anything else
+func ParseWeekdays(s string) []time.Weekday {
+	var days []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		var d int
+		if _, err := fmt.Sscan(strings.TrimSpace(part), &d); err == nil && d >= 0 && d <= 6 {
+			days = append(days, time.Weekday(d))
+		}
+	}
+	return days
+}
+
+// violation returns a violation of a field with a message from the catalog
+func violation(field, key string, args ...interface{}) Violation {
+	return Violation{Field: field, Message: i18n.Message{Key: key, Args: args}}
+}
+
+// weekdays returns the plural name of a weekday, as in "no arrivals on Sundays"
+func weekdays(d time.Weekday) i18n.Message {
+	return i18n.Message{Key: fmt.Sprintf("date.weekday_plural.%d", d)}
+}
+
+func contains(days []time.Weekday, d time.Weekday) bool {
+	for _, x := range days {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
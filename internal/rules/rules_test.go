@@ -0,0 +1,102 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var testRules = []models.BookingRule{
+	{ID: 1, Name: "Standard", MinNights: 1, MaxNights: 30, MaxHorizonDays: 365},
+	{ID: 2, Name: "Summer", SeasonStart: date("2040-06-01"), SeasonEnd: date("2040-08-31"), MinNights: 3},
+	{ID: 3, RoomID: 1, Name: "Suite", MinNights: 2},
+	{ID: 4, RoomID: 1, Name: "Suite summer", SeasonStart: date("2040-06-01"), SeasonEnd: date("2040-08-31"), MinNights: 7},
+	{ID: 5, RoomID: 2, Name: "Other room", MinNights: 10},
+}
+
+func TestForStay(t *testing.T) {
+	tests := []struct {
+		name     string
+		roomID   int
+		arrival  string
+		expected int
+	}{
+		{"global", 3, "2040-01-10", 1},
+		{"global season", 3, "2040-07-01", 2},
+		{"season end is included", 3, "2040-08-31", 2},
+		{"room", 1, "2040-01-10", 3},
+		{"room season", 1, "2040-07-01", 4},
+	}
+
+	for _, e := range tests {
+		rule := ForStay(testRules, e.roomID, date(e.arrival))
+		if rule.ID != e.expected {
+			t.Errorf("%s: expected rule %d, got %d (%s)", e.name, e.expected, rule.ID, rule.Name)
+		}
+	}
+
+	if rule := ForStay(nil, 1, date("2040-01-10")); rule.Name != Default.Name {
+		t.Errorf("expected the default rule without rules, got %s", rule.Name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := date("2040-01-01")
+
+	rule := models.BookingRule{
+		MinNights:         2,
+		MaxNights:         14,
+		MinLeadDays:       2,
+		MaxHorizonDays:    365,
+		ClosedToArrival:   []time.Weekday{time.Sunday},
+		ClosedToDeparture: []time.Weekday{time.Saturday},
+	}
+
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		expected []string
+	}{
+		{"valid", "2040-01-10", "2040-01-12", nil},
+		{"end before start", "2040-01-12", "2040-01-10", []string{"end_date"}},
+		{"zero nights", "2040-01-10", "2040-01-10", []string{"end_date"}},
+		{"in the past", "2039-12-30", "2040-01-03", []string{"start_date"}},
+		{"too short", "2040-01-10", "2040-01-11", []string{"end_date"}},
+		{"too long", "2040-01-10", "2040-02-10", []string{"end_date"}},
+		{"too soon", "2040-01-02", "2040-01-05", []string{"start_date"}},
+		{"too far ahead", "2041-01-03", "2041-01-07", []string{"start_date"}},
+		{"closed to arrival", "2040-01-08", "2040-01-10", []string{"start_date"}},
+		{"closed to departure", "2040-01-10", "2040-01-14", []string{"end_date"}},
+	}
+
+	for _, e := range tests {
+		violations := Check(rule, date(e.start), date(e.end), now)
+		if len(violations) != len(e.expected) {
+			t.Errorf("%s: expected %d violations, got %v", e.name, len(e.expected), violations)
+			continue
+		}
+		for i, v := range violations {
+			if v.Field != e.expected[i] {
+				t.Errorf("%s: expected a violation of %s, got %s: %s", e.name, e.expected[i], v.Field, v.Message.Key)
+			}
+		}
+	}
+}
+
+func TestWeekdays(t *testing.T) {
+	days := ParseWeekdays("0, 6,x,9")
+	if len(days) != 2 || days[0] != time.Sunday || days[1] != time.Saturday {
+		t.Fatalf("unexpected weekdays %v", days)
+	}
+
+	if s := FormatWeekdays(days); s != "0,6" {
+		t.Errorf("expected 0,6, got %s", s)
+	}
+}
@@ -0,0 +1,265 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/crislainesc/bookings/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// demoEmailDomain marks generated guests so demo data can be replaced without touching real bookings
+const demoEmailDomain = "demo.example.com"
+
+// adminAccessLevel is the access level given to the seeded admin user
+const adminAccessLevel = 3
+
+// restrictions are the restriction types the handlers refer to by ID
+var restrictions = []models.Restriction{
+	{ID: models.RestrictionReservation, RestrictionName: "Reservation"},
+	{ID: models.RestrictionOwnerBlock, RestrictionName: "Owner Block"},
+	{ID: models.RestrictionHold, RestrictionName: "Hold"},
+}
+
+// defaultDescription is the description of the default rooms
+const defaultDescription = "Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember."
+
+// rooms are the rooms that used to have the Generals and Majors pages
+var rooms = []models.Room{
+	{ID: 1, RoomName: "General's Quarters", Slug: "generals-quarters", Description: defaultDescription, Capacity: 2, MaxOccupancy: 3, Price: 12000, Active: true},
+	{ID: 2, RoomName: "Major's Suite", Slug: "majors-suite", Description: defaultDescription, Capacity: 2, MaxOccupancy: 4, Price: 15000, Active: true},
+}
+
+// Admin holds the details of the initial admin user
+type Admin struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Password  string
+}
+
+// DemoOptions controls the generation of demo reservations
+type DemoOptions struct {
+	From  time.Time
+	To    time.Time
+	Count int
+	Rand  *rand.Rand
+}
+
+// Stay is a generated demo reservation
+type Stay struct {
+	RoomID    int
+	FirstName string
+	LastName  string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// ReferenceData inserts the restriction types and default rooms, leaving existing rows untouched
+func ReferenceData(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range restrictions {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO restrictions (id, restriction_name, created_at, updated_at)
+			VALUES ($1, $2, $3, $3)
+			ON CONFLICT (id) DO NOTHING
+		`, r.ID, r.RestrictionName, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rooms {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO rooms (id, room_name, slug, description, capacity, max_occupancy, price, active, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+			ON CONFLICT DO NOTHING
+		`, r.ID, r.RoomName, r.Slug, r.Description, r.Capacity, r.MaxOccupancy, r.Price, r.Active, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	// explicit IDs don't advance the serial sequences, so move them past the seeded rows
+	for _, table := range []string{"restrictions", "rooms"} {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%s', 'id'), (SELECT MAX(id) FROM %s))`, table, table,
+		))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AdminUser creates the admin user unless a user with the same email exists, and reports whether it did
+func AdminUser(ctx context.Context, db *sql.DB, admin Admin) (bool, error) {
+	if admin.Email == "" || admin.Password == "" {
+		return false, fmt.Errorf("admin email and password are required")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(admin.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO users (first_name, last_name, email, password, access_level, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (email) DO NOTHING
+	`, admin.FirstName, admin.LastName, admin.Email, string(hashedPassword), adminAccessLevel, time.Now())
+	if err != nil {
+		return false, err
+	}
+
+	created, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return created > 0, nil
+}
+
+// DemoReservations replaces previously generated demo reservations with a fresh set and returns how many it created
+func DemoReservations(ctx context.Context, db *sql.DB, options DemoOptions) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// room_restrictions rows of demo reservations go with them through the cascading foreign key
+	_, err = tx.ExecContext(ctx, `DELETE FROM reservations WHERE email LIKE $1`, "%@"+demoEmailDomain)
+	if err != nil {
+		return 0, err
+	}
+
+	var roomIDs []int
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM rooms ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		roomIDs = append(roomIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	created := 0
+	for _, stay := range DemoStays(options, roomIDs) {
+		// real bookings and blocks take precedence over generated ones
+		var overlapping int
+		err := tx.QueryRowContext(ctx, `
+			SELECT count(id) FROM room_restrictions
+			WHERE room_id = $1 AND $2 < end_date AND $3 > start_date
+		`, stay.RoomID, stay.StartDate, stay.EndDate).Scan(&overlapping)
+		if err != nil {
+			return created, err
+		}
+		if overlapping > 0 {
+			continue
+		}
+
+		var reservationID int
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, processed, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9) RETURNING id
+		`,
+			stay.FirstName,
+			stay.LastName,
+			stay.Email(),
+			"555-555-5555",
+			stay.StartDate,
+			stay.EndDate,
+			stay.RoomID,
+			options.Rand.Intn(2),
+			time.Now(),
+		).Scan(&reservationID)
+		if err != nil {
+			return created, err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $6)
+		`, stay.StartDate, stay.EndDate, stay.RoomID, reservationID, models.RestrictionReservation, time.Now())
+		if err != nil {
+			return created, err
+		}
+
+		created++
+	}
+
+	return created, tx.Commit()
+}
+
+var firstNames = []string{"Ana", "Bruno", "Carla", "Daniel", "Elisa", "Felipe", "Gabriela", "Hugo", "Isabel", "Joana", "Karen", "Lucas", "Marina", "Nelson", "Olivia", "Paulo"}
+var lastNames = []string{"Almeida", "Barbosa", "Costa", "Dias", "Ferreira", "Gomes", "Lima", "Martins", "Nunes", "Oliveira", "Pereira", "Rocha", "Santos", "Souza"}
+
+// DemoStays generates up to options.Count stays of one to seven nights between options.From and options.To,
+// never overlapping another generated stay in the same room
+func DemoStays(options DemoOptions, roomIDs []int) []Stay {
+	var stays []Stay
+
+	days := int(options.To.Sub(options.From).Hours() / 24)
+	if len(roomIDs) == 0 || days < 1 {
+		return stays
+	}
+
+	booked := make(map[int][]Stay)
+
+	// give up after a bounded number of attempts when the range is too full for the requested count
+	for attempts := 0; len(stays) < options.Count && attempts < options.Count*10; attempts++ {
+		nights := 1 + options.Rand.Intn(7)
+		if nights > days {
+			nights = days
+		}
+
+		start := options.From.AddDate(0, 0, options.Rand.Intn(days-nights+1))
+		stay := Stay{
+			RoomID:    roomIDs[options.Rand.Intn(len(roomIDs))],
+			FirstName: firstNames[options.Rand.Intn(len(firstNames))],
+			LastName:  lastNames[options.Rand.Intn(len(lastNames))],
+			StartDate: start,
+			EndDate:   start.AddDate(0, 0, nights),
+		}
+
+		overlaps := false
+		for _, other := range booked[stay.RoomID] {
+			if stay.StartDate.Before(other.EndDate) && stay.EndDate.After(other.StartDate) {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+
+		booked[stay.RoomID] = append(booked[stay.RoomID], stay)
+		stays = append(stays, stay)
+	}
+
+	return stays
+}
+
+// Email returns the demo email address of the stay's guest
+func (s Stay) Email() string {
+	return strings.ToLower(fmt.Sprintf("%s.%s.%d@%s", s.FirstName, s.LastName, s.StartDate.Unix(), demoEmailDomain))
+}
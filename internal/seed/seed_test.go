@@ -0,0 +1,58 @@
+package seed
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDemoStays(t *testing.T) {
+	from := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2050, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	stays := DemoStays(DemoOptions{
+		From:  from,
+		To:    to,
+		Count: 20,
+		Rand:  rand.New(rand.NewSource(1)),
+	}, []int{1, 2})
+
+	if len(stays) == 0 {
+		t.Fatal("expected demo stays but got none")
+	}
+
+	for i, s := range stays {
+		if s.StartDate.Before(from) || s.EndDate.After(to) {
+			t.Errorf("stay %d from %s to %s is outside the requested range", i, s.StartDate, s.EndDate)
+		}
+
+		if !s.EndDate.After(s.StartDate) {
+			t.Errorf("stay %d has no nights", i)
+		}
+
+		if !strings.HasSuffix(s.Email(), "@"+demoEmailDomain) {
+			t.Errorf("stay %d has non-demo email %s", i, s.Email())
+		}
+
+		for j, other := range stays[:i] {
+			if s.RoomID == other.RoomID && s.StartDate.Before(other.EndDate) && s.EndDate.After(other.StartDate) {
+				t.Errorf("stays %d and %d overlap in room %d", j, i, s.RoomID)
+			}
+		}
+	}
+}
+
+func TestDemoStaysEmptyRange(t *testing.T) {
+	day := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	stays := DemoStays(DemoOptions{From: day, To: day, Count: 5, Rand: rand.New(rand.NewSource(1))}, []int{1})
+	if len(stays) != 0 {
+		t.Errorf("expected no stays for an empty range, got %d", len(stays))
+	}
+
+	stays = DemoStays(DemoOptions{From: day, To: day.AddDate(0, 1, 0), Count: 5, Rand: rand.New(rand.NewSource(1))}, nil)
+	if len(stays) != 0 {
+		t.Errorf("expected no stays without rooms, got %d", len(stays))
+	}
+}
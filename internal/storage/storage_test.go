@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(dir, "/uploads/")
+	ctx := context.Background()
+
+	err := store.Put(ctx, "rooms/1/photo.jpg", strings.NewReader("jpeg bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "rooms", "1", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "jpeg bytes" {
+		t.Errorf("stored content does not match, got %q", data)
+	}
+
+	if url := store.URL("rooms/1/photo.jpg"); url != "/uploads/rooms/1/photo.jpg" {
+		t.Errorf("unexpected url %s", url)
+	}
+
+	err = store.Delete(ctx, "rooms/1/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rooms", "1", "photo.jpg")); !os.IsNotExist(err) {
+		t.Error("file still exists after delete")
+	}
+
+	err = store.Delete(ctx, "rooms/1/photo.jpg")
+	if err != nil {
+		t.Errorf("deleting a missing blob should not fail, got %v", err)
+	}
+}
+
+func TestLocalStoreInvalidKeys(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/uploads")
+
+	for _, key := range []string{"", "../escape.jpg", "rooms/../../escape.jpg", "/absolute.jpg", "rooms//photo.jpg"} {
+		err := store.Put(context.Background(), key, strings.NewReader("x"))
+		if err != ErrInvalidKey {
+			t.Errorf("key %q: expected ErrInvalidKey but got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package xlsx streams spreadsheets in the Office Open XML format Excel, LibreOffice and Google Sheets open.
+//
+// A spreadsheet has a single sheet whose rows are written to the output as they come, so writing one of any
+// size takes no more memory than a row. Text is stored inline in its cell rather than in a shared strings
+// table, and cells are text, numbers, dates or amounts of money, each with a fixed style.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the styles of the cells, in the order of cellXfs in styles.xml
+const (
+	styleGeneral = iota
+	styleBold
+	styleDate
+	styleWhole
+	styleDecimal
+)
+
+// Cell is the value of a cell of a row
+type Cell struct {
+	text    string
+	number  float64
+	numeric bool
+	style   int
+}
+
+// Text returns a cell with text
+func Text(s string) Cell {
+	return Cell{text: s}
+}
+
+// Bold returns a cell with text in bold, for headers
+func Bold(s string) Cell {
+	return Cell{text: s, style: styleBold}
+}
+
+// Number returns a cell with a number
+func Number(n float64) Cell {
+	return Cell{number: n, numeric: true}
+}
+
+// Date returns a cell with the date of t, shown as 2006-01-02 and sortable as a date
+func Date(t time.Time) Cell {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return Cell{number: math.Round(day.Sub(epoch).Hours() / 24), numeric: true, style: styleDate}
+}
+
+// Amount returns a cell with an amount of money kept in minor units with the given number of decimals,
+// e.g. 12050 cents with 2 decimals as 120.50, shown with thousands separators
+func Amount(minor, decimals int) Cell {
+	style := styleDecimal
+	if decimals == 0 {
+		style = styleWhole
+	}
+	return Cell{number: float64(minor) / math.Pow10(decimals), numeric: true, style: style}
+}
+
+// epoch is the day before day 1 of the dates in a spreadsheet, counting 1900 as a leap year like Excel does
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Writer writes a spreadsheet a row at a time
+type Writer struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	err   error
+}
+
+// ErrClosed is returned when rows are written to a spreadsheet that was closed
+var ErrClosed = errors.New("xlsx: writer closed")
+
+// NewWriter starts a spreadsheet on w with a sheet named sheetName, which spreadsheet programs limit to 31
+// characters other than []:*?/\. The spreadsheet is complete once Close is called.
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	z := zip.NewWriter(w)
+
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName))
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="` + name.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/styles.xml", styles},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(f, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the sheet is written last so its rows can be streamed into it
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &Writer{zip: z, sheet: bufio.NewWriter(f)}
+	sw.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return sw, nil
+}
+
+// WriteRow writes the next row of the sheet
+func (w *Writer) WriteRow(cells ...Cell) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	w.rows++
+	b := w.sheet
+	b.WriteString(`<row r="`)
+	b.WriteString(strconv.Itoa(w.rows))
+	b.WriteString(`">`)
+	for _, c := range cells {
+		b.WriteString(`<c`)
+		if c.style != styleGeneral {
+			b.WriteString(` s="`)
+			b.WriteString(strconv.Itoa(c.style))
+			b.WriteString(`"`)
+		}
+		if c.numeric {
+			b.WriteString(`><v>`)
+			b.WriteString(strconv.FormatFloat(c.number, 'f', -1, 64))
+			b.WriteString(`</v></c>`)
+			continue
+		}
+		b.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(b, []byte(c.text))
+		b.WriteString(`</t></is></c>`)
+	}
+	_, err := b.WriteString(`</row>`)
+
+	// a failed write is kept by the buffer and returned on every later write
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// Close ends the sheet and writes the end of the spreadsheet. It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = ErrClosed
+
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	err := w.sheet.Flush()
+	if err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+const contentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+
+const rootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const workbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+// styles are general, bold, a yyyy-mm-dd date, and whole and two decimal numbers with thousands separators
+const styles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="5"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`
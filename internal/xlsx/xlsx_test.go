@@ -0,0 +1,88 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Reservations & more")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]Cell{
+		{Bold("Guest"), Bold("Arrival"), Bold("Nights"), Bold("Total")},
+		{Text("  O'Brien <Jane> & co  "), Date(time.Date(2040, 1, 10, 15, 0, 0, 0, time.UTC)), Number(3), Amount(123450, 2)},
+		{Text("Yamada"), Date(time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)), Number(1.5), Amount(5000, 0)},
+	}
+	for _, row := range rows {
+		err := w.WriteRow(row...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow(Text("late")); err != ErrClosed {
+		t.Errorf("expected ErrClosed writing to a closed spreadsheet, got %v", err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+
+		// every part is well-formed XML
+		d := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s isn't well-formed: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("expected the spreadsheet to have %s", name)
+		}
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Reservations &amp; more"`) {
+		t.Errorf("expected the sheet name to be escaped, got %s", parts["xl/workbook.xml"])
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<row r="1"><c s="1" t="inlineStr"><is><t xml:space="preserve">Guest</t></is></c>`,
+		`<t xml:space="preserve">  O&#39;Brien &lt;Jane&gt; &amp; co  </t>`,
+		`<c s="2"><v>51145</v></c><c><v>3</v></c><c s="4"><v>1234.5</v></c></row>`,
+		`<c s="2"><v>61</v></c><c><v>1.5</v></c><c s="3"><v>5000</v></c></row>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("expected the sheet to contain %s, got %s", want, sheet)
+		}
+	}
+}
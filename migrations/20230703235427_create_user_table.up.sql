@@ -0,0 +1,10 @@
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	first_name VARCHAR(255) NOT NULL DEFAULT '',
+	last_name VARCHAR(255) NOT NULL DEFAULT '',
+	email VARCHAR(255) NOT NULL,
+	password VARCHAR(60) NOT NULL,
+	access_level INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,10 @@
+CREATE TABLE room_restrictions (
+	id SERIAL PRIMARY KEY,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	room_id INTEGER NOT NULL,
+	reservation_id INTEGER NOT NULL,
+	restriction_id INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE reservations ADD COLUMN processed INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- blocks would violate the constraint, so remove them before restoring it
+DELETE FROM room_restrictions WHERE reservation_id IS NULL;
+ALTER TABLE room_restrictions ALTER COLUMN reservation_id SET NOT NULL;
@@ -0,0 +1,2 @@
+-- owner blocks have no reservation, so reservation_id must accept null
+ALTER TABLE room_restrictions ALTER COLUMN reservation_id DROP NOT NULL;
@@ -0,0 +1,10 @@
+DROP TABLE room_photos;
+
+DROP INDEX rooms_slug_idx;
+
+ALTER TABLE rooms
+	DROP COLUMN slug,
+	DROP COLUMN description,
+	DROP COLUMN capacity,
+	DROP COLUMN amenities,
+	DROP COLUMN active;
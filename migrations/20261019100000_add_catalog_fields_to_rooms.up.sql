@@ -0,0 +1,33 @@
+ALTER TABLE rooms
+	ADD COLUMN slug VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN description TEXT NOT NULL DEFAULT '',
+	ADD COLUMN capacity INTEGER NOT NULL DEFAULT 2,
+	ADD COLUMN amenities TEXT NOT NULL DEFAULT '',
+	ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+UPDATE rooms SET room_name = 'General''s Quarters', slug = 'generals-quarters' WHERE id = 1;
+UPDATE rooms SET room_name = 'Major''s Suite', slug = 'majors-suite' WHERE id = 2;
+UPDATE rooms SET slug = 'room-' || id WHERE slug = '';
+
+UPDATE rooms SET description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.'
+WHERE id IN (1, 2);
+
+CREATE UNIQUE INDEX rooms_slug_idx ON rooms (slug);
+
+CREATE TABLE room_photos (
+	id SERIAL PRIMARY KEY,
+	room_id INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	url VARCHAR(255) NOT NULL,
+	alt_text VARCHAR(255) NOT NULL DEFAULT '',
+	position INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX room_photos_room_id_idx ON room_photos (room_id);
+
+INSERT INTO room_photos (room_id, url, alt_text, position, created_at, updated_at)
+SELECT id, '/static/images/generals-quarters.png', 'General''s Quarters', 0, now(), now() FROM rooms WHERE id = 1;
+
+INSERT INTO room_photos (room_id, url, alt_text, position, created_at, updated_at)
+SELECT id, '/static/images/marjors-suite.png', 'Major''s Suite', 0, now(), now() FROM rooms WHERE id = 2;
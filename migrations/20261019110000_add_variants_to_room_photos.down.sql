@@ -0,0 +1,4 @@
+ALTER TABLE room_photos
+	DROP COLUMN storage_key,
+	DROP COLUMN thumbnail_url,
+	DROP COLUMN medium_url;
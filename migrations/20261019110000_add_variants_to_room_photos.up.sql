@@ -0,0 +1,7 @@
+ALTER TABLE room_photos
+	ADD COLUMN storage_key VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN medium_url VARCHAR(255) NOT NULL DEFAULT '';
+
+-- photos added before uploads are single static files used at every size
+UPDATE room_photos SET thumbnail_url = url, medium_url = url;
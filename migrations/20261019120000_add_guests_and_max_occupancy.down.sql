@@ -0,0 +1,6 @@
+ALTER TABLE reservations
+	DROP COLUMN adults,
+	DROP COLUMN children;
+
+ALTER TABLE rooms
+	DROP COLUMN max_occupancy;
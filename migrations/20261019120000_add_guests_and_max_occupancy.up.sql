@@ -0,0 +1,8 @@
+ALTER TABLE rooms
+	ADD COLUMN max_occupancy INTEGER NOT NULL DEFAULT 2;
+
+UPDATE rooms SET max_occupancy = capacity;
+
+ALTER TABLE reservations
+	ADD COLUMN adults INTEGER NOT NULL DEFAULT 1,
+	ADD COLUMN children INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+ALTER TABLE rooms
+	ADD COLUMN price INTEGER NOT NULL DEFAULT 0;
+
+UPDATE rooms SET price = 12000 WHERE id = 1;
+UPDATE rooms SET price = 15000 WHERE id = 2;
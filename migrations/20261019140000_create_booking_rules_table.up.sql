@@ -0,0 +1,20 @@
+CREATE TABLE booking_rules (
+	id SERIAL PRIMARY KEY,
+	room_id INTEGER REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	name VARCHAR(255) NOT NULL DEFAULT '',
+	season_start DATE,
+	season_end DATE,
+	min_nights INTEGER NOT NULL DEFAULT 1,
+	max_nights INTEGER NOT NULL DEFAULT 0,
+	min_lead_days INTEGER NOT NULL DEFAULT 0,
+	max_horizon_days INTEGER NOT NULL DEFAULT 0,
+	closed_to_arrival VARCHAR(20) NOT NULL DEFAULT '',
+	closed_to_departure VARCHAR(20) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX booking_rules_room_id_idx ON booking_rules (room_id);
+
+INSERT INTO booking_rules (name, min_nights, max_nights, max_horizon_days, created_at, updated_at)
+VALUES ('Standard', 1, 30, 365, now(), now());
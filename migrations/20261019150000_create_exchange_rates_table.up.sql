@@ -0,0 +1,7 @@
+CREATE TABLE exchange_rates (
+	id SERIAL PRIMARY KEY,
+	currency VARCHAR(3) NOT NULL UNIQUE,
+	rate NUMERIC(18, 8) NOT NULL CHECK (rate > 0),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
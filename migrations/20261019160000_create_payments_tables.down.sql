@@ -0,0 +1,13 @@
+DROP TABLE payment_events;
+DROP TABLE payments;
+
+DROP INDEX reservations_status_expires_at_idx;
+
+ALTER TABLE reservations
+	DROP COLUMN status,
+	DROP COLUMN expires_at,
+	DROP COLUMN total;
+
+ALTER TABLE rooms
+	DROP COLUMN payment_policy,
+	DROP COLUMN deposit_percent;
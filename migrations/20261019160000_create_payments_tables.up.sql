@@ -0,0 +1,37 @@
+ALTER TABLE rooms
+	ADD COLUMN payment_policy VARCHAR(20) NOT NULL DEFAULT 'full',
+	ADD COLUMN deposit_percent INTEGER NOT NULL DEFAULT 0;
+
+-- reservations made before online payments were already confirmed
+ALTER TABLE reservations
+	ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'confirmed',
+	ADD COLUMN expires_at TIMESTAMP,
+	ADD COLUMN total INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX reservations_status_expires_at_idx ON reservations (status, expires_at);
+
+CREATE TABLE payments (
+	id SERIAL PRIMARY KEY,
+	reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	gateway VARCHAR(50) NOT NULL,
+	checkout_id VARCHAR(255) NOT NULL,
+	checkout_url TEXT NOT NULL DEFAULT '',
+	kind VARCHAR(20) NOT NULL,
+	amount INTEGER NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE (gateway, checkout_id)
+);
+
+CREATE INDEX payments_reservation_id_idx ON payments (reservation_id);
+
+-- the webhook events already applied, so a redelivered event is ignored
+CREATE TABLE payment_events (
+	id SERIAL PRIMARY KEY,
+	gateway VARCHAR(50) NOT NULL,
+	event_id VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (gateway, event_id)
+);
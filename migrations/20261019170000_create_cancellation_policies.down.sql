@@ -0,0 +1,12 @@
+DROP TABLE refunds;
+
+DROP INDEX reservations_cancel_token_idx;
+
+ALTER TABLE reservations
+	DROP COLUMN cancel_token,
+	DROP COLUMN cancelled_at;
+
+ALTER TABLE rooms
+	DROP COLUMN cancellation_policy_id;
+
+DROP TABLE cancellation_policies;
@@ -0,0 +1,36 @@
+CREATE TABLE cancellation_policies (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	free_days INTEGER NOT NULL DEFAULT 0,
+	penalty_percent INTEGER NOT NULL DEFAULT 0,
+	non_refundable BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+-- rooms without a policy can be cancelled for free until arrival
+ALTER TABLE rooms
+	ADD COLUMN cancellation_policy_id INTEGER REFERENCES cancellation_policies (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+-- the cancel token is sent to the guest so they can cancel without an account
+ALTER TABLE reservations
+	ADD COLUMN cancel_token VARCHAR(64),
+	ADD COLUMN cancelled_at TIMESTAMP;
+
+CREATE UNIQUE INDEX reservations_cancel_token_idx ON reservations (cancel_token);
+
+CREATE TABLE refunds (
+	id SERIAL PRIMARY KEY,
+	reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	payment_id INTEGER NOT NULL REFERENCES payments (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	gateway VARCHAR(50) NOT NULL,
+	refund_id VARCHAR(255) NOT NULL,
+	amount INTEGER NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	reason VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (gateway, refund_id)
+);
+
+CREATE INDEX refunds_reservation_id_idx ON refunds (reservation_id);
@@ -0,0 +1,14 @@
+-- invoices keep their number and what they billed when the reservation is deleted, since numbers can't be reused
+CREATE TABLE invoices (
+	id SERIAL PRIMARY KEY,
+	number INTEGER NOT NULL UNIQUE,
+	reservation_id INTEGER UNIQUE REFERENCES reservations (id) ON DELETE SET NULL ON UPDATE CASCADE,
+	issued_at TIMESTAMP NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	total INTEGER NOT NULL,
+	tax_name VARCHAR(50) NOT NULL DEFAULT '',
+	tax_rate INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,9 @@
+ALTER TABLE reservations
+	DROP COLUMN promo_code,
+	DROP COLUMN discount;
+
+DROP TABLE promo_redemptions;
+
+DROP TABLE promo_code_rooms;
+
+DROP TABLE promo_codes;
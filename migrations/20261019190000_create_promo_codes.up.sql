@@ -0,0 +1,38 @@
+CREATE TABLE promo_codes (
+	id SERIAL PRIMARY KEY,
+	code VARCHAR(50) NOT NULL UNIQUE,
+	description VARCHAR(255) NOT NULL DEFAULT '',
+	kind VARCHAR(20) NOT NULL,
+	amount INTEGER NOT NULL,
+	starts_on DATE,
+	ends_on DATE,
+	min_nights INTEGER NOT NULL DEFAULT 1,
+	max_uses INTEGER NOT NULL DEFAULT 0,
+	uses INTEGER NOT NULL DEFAULT 0,
+	once_per_email BOOLEAN NOT NULL DEFAULT FALSE,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+-- a code without rooms applies to every room
+CREATE TABLE promo_code_rooms (
+	promo_code_id INTEGER NOT NULL REFERENCES promo_codes (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	room_id INTEGER NOT NULL REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	PRIMARY KEY (promo_code_id, room_id)
+);
+
+-- email_key is only set for codes that can be used once per email, so the unique constraint only holds for them
+CREATE TABLE promo_redemptions (
+	id SERIAL PRIMARY KEY,
+	promo_code_id INTEGER NOT NULL REFERENCES promo_codes (id) ON DELETE RESTRICT ON UPDATE CASCADE,
+	reservation_id INTEGER NOT NULL UNIQUE REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	email_key VARCHAR(255),
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (promo_code_id, email_key)
+);
+
+-- reservations keep the code they were booked with and what it took off their total
+ALTER TABLE reservations
+	ADD COLUMN promo_code VARCHAR(50) NOT NULL DEFAULT '',
+	ADD COLUMN discount INTEGER NOT NULL DEFAULT 0;
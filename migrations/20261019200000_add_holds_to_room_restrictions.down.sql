@@ -0,0 +1,5 @@
+DELETE FROM room_restrictions WHERE restriction_id = 3;
+
+ALTER TABLE room_restrictions DROP COLUMN expires_at;
+
+DELETE FROM restrictions WHERE id = 3;
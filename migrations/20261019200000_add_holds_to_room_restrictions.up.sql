@@ -0,0 +1,8 @@
+-- holds keep a room for a guest while they fill in the reservation form, until they expire
+INSERT INTO restrictions (id, restriction_name, created_at, updated_at)
+VALUES (3, 'Hold', now(), now())
+ON CONFLICT (id) DO NOTHING;
+
+ALTER TABLE room_restrictions ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX room_restrictions_expires_at_idx ON room_restrictions (expires_at) WHERE expires_at IS NOT NULL;
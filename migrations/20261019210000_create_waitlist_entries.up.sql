@@ -0,0 +1,22 @@
+-- a waitlist entry without a room takes any room the party fits in. Guests are offered a freed room in the
+-- order they joined: the room is held for them until expires_at and they book it from the link with token.
+CREATE TABLE waitlist_entries (
+	id SERIAL PRIMARY KEY,
+	first_name VARCHAR(255) NOT NULL,
+	last_name VARCHAR(255) NOT NULL DEFAULT '',
+	email VARCHAR(255) NOT NULL,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	room_id INTEGER REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	adults INTEGER NOT NULL DEFAULT 1,
+	children INTEGER NOT NULL DEFAULT 0,
+	status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+	token VARCHAR(64) UNIQUE,
+	offered_room_id INTEGER REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	hold_id INTEGER,
+	expires_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX waitlist_entries_waiting_idx ON waitlist_entries (start_date, end_date) WHERE status = 'waiting';
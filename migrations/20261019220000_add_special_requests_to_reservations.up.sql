@@ -0,0 +1,3 @@
+-- what the guest asked for when booking, shown to the front desk on the daily reports
+ALTER TABLE reservations
+	ADD COLUMN special_requests TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE reservations DROP COLUMN guest_id;
+
+DROP TABLE guest_tags;
+
+DROP TABLE guests;
@@ -0,0 +1,39 @@
+-- guests are recognised by their email, in any case. A guest merged into another keeps its row pointing to
+-- that guest, so later bookings with its email are linked to the guest it was merged into.
+CREATE TABLE guests (
+	id SERIAL PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	first_name VARCHAR(255) NOT NULL DEFAULT '',
+	last_name VARCHAR(255) NOT NULL DEFAULT '',
+	phone VARCHAR(255) NOT NULL DEFAULT '',
+	notes TEXT NOT NULL DEFAULT '',
+	merged_into_id INTEGER REFERENCES guests (id) ON DELETE SET NULL ON UPDATE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX guests_email_idx ON guests (lower(email));
+
+CREATE TABLE guest_tags (
+	guest_id INTEGER NOT NULL REFERENCES guests (id) ON DELETE CASCADE ON UPDATE CASCADE,
+	tag VARCHAR(50) NOT NULL,
+	PRIMARY KEY (guest_id, tag)
+);
+
+ALTER TABLE reservations
+	ADD COLUMN guest_id INTEGER REFERENCES guests (id) ON DELETE SET NULL ON UPDATE CASCADE;
+
+CREATE INDEX reservations_guest_id_idx ON reservations (guest_id);
+
+-- every email booked with so far becomes a guest, with the details of its latest reservation
+INSERT INTO guests (email, first_name, last_name, phone, created_at, updated_at)
+SELECT DISTINCT ON (lower(email))
+	email, first_name, last_name, phone, min(created_at) OVER (PARTITION BY lower(email)), now()
+FROM reservations
+WHERE email <> ''
+ORDER BY lower(email), created_at DESC;
+
+UPDATE reservations r
+SET guest_id = g.id
+FROM guests g
+WHERE lower(r.email) = lower(g.email);
@@ -0,0 +1,10 @@
+// Package migrations holds the database schema as versioned SQL files embedded into the binary.
+//
+// Each migration is a pair of files named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// where version is the timestamp the migration was written at.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -137,3 +137,73 @@ function Prompt() {
     custom: custom,
   }
 }
+
+// availabilityCalendar renders a month view of the nights a room can be booked for into element,
+// using the room calendar endpoint, with buttons to move between months. Month and weekday names
+// are written in the language of locale.
+function availabilityCalendar(element, slug, locale) {
+  // 2023-01-01 was a Sunday
+  const weekdays = [...Array(7).keys()].map((i) =>
+    new Date(Date.UTC(2023, 0, 1 + i)).toLocaleString(locale, { weekday: 'short', timeZone: 'UTC' }))
+  const today = new Date()
+  let year = today.getFullYear()
+  let month = today.getMonth() + 1
+
+  function render(data) {
+    const first = new Date(Date.UTC(data.year, data.month - 1, 1))
+    const title = first.toLocaleString(locale, { month: 'long', year: 'numeric', timeZone: 'UTC' })
+
+    let html = `
+      <div class="d-flex justify-content-between align-items-center mb-2">
+        <button type="button" class="btn btn-sm btn-outline-secondary" data-move="-1">&lt;</button>
+        <strong>${title}</strong>
+        <button type="button" class="btn btn-sm btn-outline-secondary" data-move="1">&gt;</button>
+      </div>
+      <table class="table table-sm text-center availability-calendar">
+        <thead><tr>${weekdays.map((d) => `<th>${d}</th>`).join('')}</tr></thead>
+        <tbody><tr>`
+
+    for (let i = 0; i < first.getUTCDay(); i++) {
+      html += '<td></td>'
+    }
+
+    data.days.forEach((day, i) => {
+      if (i > 0 && (first.getUTCDay() + i) % 7 === 0) {
+        html += '</tr><tr>'
+      }
+      const cls = day.available ? 'available' : 'unavailable'
+      html += `<td class="${cls}" title="${day.date}">${i + 1}</td>`
+    })
+
+    html += '</tr></tbody></table>'
+    element.innerHTML = html
+
+    element.querySelectorAll('[data-move]').forEach((button) => {
+      button.addEventListener('click', () => {
+        month += parseInt(button.dataset.move, 10)
+        if (month < 1) {
+          month = 12
+          year--
+        } else if (month > 12) {
+          month = 1
+          year++
+        }
+        load()
+      })
+    })
+  }
+
+  function load() {
+    fetch(`/rooms/${slug}/calendar?y=${year}&m=${month}`)
+      .then((response) => response.json())
+      .then((data) => {
+        if (data.ok) {
+          render(data)
+        } else {
+          element.innerHTML = `<p class="text-muted">${data.message}</p>`
+        }
+      })
+  }
+
+  load()
+}